@@ -0,0 +1,73 @@
+package main
+
+import (
+    "fmt"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    // run statements of this migration one by one, without transaction
+    // (e.g. for ALTER TYPE ... ADD VALUE or CREATE INDEX CONCURRENTLY)
+    CONST_ANNOTATION_NO_TRANSACTION = migrate.AnnotationNoTransaction
+
+    // this part of the migration is intentionally empty (e.g. a data-only change which cannot be undone)
+    CONST_ANNOTATION_NOOP = migrate.AnnotationNoop
+
+    // team which owns the migration, e.g. "-- owner: team-payments" in the header of the file
+    CONST_HEADER_OWNER = "owner"
+)
+
+// parse annotations like "-- migrate:no-transaction" from part of migration file
+func parseAnnotations(migrationPart string) map[string]string {
+    return migrate.ParseAnnotations(migrationPart)
+}
+
+// read annotations of up and down part of migration file
+func readMigrationAnnotationsFromFile(fileName string) (map[string]string, map[string]string) {
+    rawMigrationForward, rawMigrationBackward := readMigrationPartsFromFile(fileName)
+
+    return parseAnnotations(rawMigrationForward), parseAnnotations(rawMigrationBackward)
+}
+
+// check if annotation is set
+func hasAnnotation(annotations map[string]string, name string) bool {
+    _, ok := annotations[name]
+    return ok
+}
+
+// parse header fields from the comment block at the top of the up part, until the first sql line
+func parseHeaderFields(rawMigrationForward string) map[string]string {
+    return migrate.ParseHeader(rawMigrationForward)
+}
+
+// read header fields of migration file
+func readMigrationHeaderFromFile(fileName string) map[string]string {
+    rawMigrationForward, _ := readMigrationPartsFromFile(fileName)
+
+    return parseHeaderFields(rawMigrationForward)
+}
+
+// check if migration file exists locally (applied migrations might not)
+func migrationFileExists(fileName string) bool {
+    return getMigrationSource().Exists(fileName)
+}
+
+// get owner of migration file, empty if it has none or does not exist locally
+func getMigrationOwner(fileName string) string {
+    if !migrationFileExists(fileName) {
+        return ""
+    }
+
+    return readMigrationHeaderFromFile(fileName)[CONST_HEADER_OWNER]
+}
+
+// file name with owner for messages, e.g. "20240101120000-add-index.sql (owner: team-payments)"
+func describeMigrationFile(fileName string) string {
+    owner := getMigrationOwner(fileName)
+    if len(owner) == 0 {
+        return fileName
+    }
+
+    return fmt.Sprintf("%s (owner: %s)", fileName, owner)
+}
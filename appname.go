@@ -0,0 +1,36 @@
+package main
+
+import (
+    "context"
+)
+
+// command being run, part of application_name, e.g. 'up'
+var currentCommand string
+
+// false if the connection string sets application_name or the connection is managed by the caller
+var stampApplicationName bool
+
+// application_name for pg_stat_activity, e.g. go-simple-postgresql-migrate/v1.2.3/up
+// or go-simple-postgresql-migrate/up/20240101120000-add-index.sql while a migration runs
+// (PostgreSQL truncates it to 63 bytes, so the version makes room for the file name)
+func getApplicationName(fileName string) string {
+    if len(fileName) > 0 {
+        return CONST_TOOL_NAME + "/" + currentCommand + "/" + fileName
+    }
+
+    if len(currentCommand) > 0 {
+        return getUserAgent() + "/" + currentCommand
+    }
+
+    return getUserAgent()
+}
+
+// show DBAs watching pg_stat_activity which file a session is executing
+func setApplicationName(fileName string) {
+    if !stampApplicationName {
+        return
+    }
+
+    // only informational, fails e.g. within an aborted transaction after a failed migration
+    postgreSQLConnection.Exec(context.Background(), "SELECT set_config('application_name', $1, false)", getApplicationName(fileName))
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "os/user"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    CONST_ENV_VAR_REQUIRE_APPROVAL = "MIGRATE_REQUIRE_APPROVAL"
+
+    // four-eyes control: 'request-apply' records the plan, another role approves it, 'up --approved id' applies it
+    CONST_POSTGRESQL_APPROVALS_TABLE_SCHEMA = "CREATE TABLE IF NOT EXISTS %s (id serial PRIMARY KEY, plan_hash text NOT NULL, migrations text NOT NULL, requested_at timestamp with time zone NOT NULL DEFAULT NOW(), requested_by text NOT NULL, requested_role text NOT NULL DEFAULT session_user, approved_at timestamp with time zone, approved_by text, approved_role text, used_at timestamp with time zone)"
+
+    CONST_POSTGRESQL_SELECT_APPROVAL = "SELECT plan_hash, migrations, requested_at, requested_by, requested_role, approved_at, COALESCE(approved_by, ''), COALESCE(approved_role, ''), used_at FROM %s WHERE id = $1"
+)
+
+// get approvals table of the tracking table (of the component)
+func getApprovalsTableName() string {
+    return trackingTableName + "_approvals"
+}
+
+var flagApproved = commandLineFlags.Int("approved", 0, "for 'up': id of the approved request (see 'request-apply'), needed in protected environments with require-approval")
+
+// request to apply pending migrations, with its approval
+type applyApproval struct {
+    id            int
+    planHash      string
+    migrations    string
+    requestedAt   time.Time
+    requestedBy   string
+    requestedRole string
+    approvedAt    *time.Time
+    approvedBy    string
+    approvedRole  string
+    usedAt        *time.Time // applied with 'up --approved id', a request is only good for one run
+}
+
+// name of the person running this command, e.g. alice@bastion-1
+func getOperatorName() string {
+    name := "unknown"
+    if currentUser, err := user.Current(); err == nil {
+        name = currentUser.Username
+    }
+    if hostName, err := os.Hostname(); err == nil {
+        name += "@" + hostName
+    }
+
+    return name
+}
+
+// check if 'up' needs an approved request in this environment
+func isApprovalRequired() bool {
+    required, err := strconv.ParseBool(getConfigValue("require-approval"))
+    if err != nil {
+        logError("Error: Invalid require-approval %s, use true or false", getConfigValue("require-approval"))
+        os.Exit(1)
+    }
+
+    return required && isProtectedEnvironment()
+}
+
+// create approvals table
+func createApprovalsTable() {
+    connectToStoredDatabaseConnection()
+
+    _, err := postgreSQLConnection.Exec(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_APPROVALS_TABLE_SCHEMA, getApprovalsTableName()))
+    if err != nil {
+        logError("Error: Failed to create table %s", getApprovalsTableName())
+        panic(err)
+    }
+}
+
+// get request by id, exits if there is none
+func getApplyApproval(id int) applyApproval {
+    approval := applyApproval{id: id}
+    err := postgreSQLConnection.QueryRow(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_SELECT_APPROVAL, getApprovalsTableName()), id).Scan(
+        &approval.planHash, &approval.migrations, &approval.requestedAt, &approval.requestedBy, &approval.requestedRole,
+        &approval.approvedAt, &approval.approvedBy, &approval.approvedRole, &approval.usedAt)
+    if err == pgx.ErrNoRows {
+        logError("Error: There is no request with id %d", id)
+        logError("Hint: Record one with 'request-apply'")
+        os.Exit(1)
+    }
+    if err != nil {
+        logError("Error: Could not read request %d from table %s", id, getApprovalsTableName())
+        panic(err)
+    }
+
+    return approval
+}
+
+// get role which this connection logged in as (SET ROLE does not change it)
+func getSessionRole() string {
+    var role string
+    err := postgreSQLConnection.QueryRow(context.Background(), "SELECT session_user").Scan(&role)
+    if err != nil {
+        logError("Error: Could not read database role")
+        panic(err)
+    }
+
+    return role
+}
+
+// with require-approval in protected environments, only apply planned migrations (catch-up ones and the skip decisions
+// included) which another role has approved
+func checkApproval(plan *migrate.Plan) {
+    if *flagApproved == 0 {
+        if isApprovalRequired() && len(getPlannedMigrations(plan)) > 0 {
+            logError("Error: Environment %s needs an approved request to apply migrations", getConfigValue("environment"))
+            logError("Hint: Run 'request-apply', let another database role run 'approve <id>', then 'up --approved <id>'")
+            os.Exit(1)
+        }
+        return
+    }
+
+    createApprovalsTable()
+    approval := getApplyApproval(*flagApproved)
+
+    if approval.approvedAt == nil {
+        logError("Error: Request %d by %s has not been approved yet", approval.id, approval.requestedBy)
+        logError("Hint: Another database role than %s needs to run 'approve %d'", approval.requestedRole, approval.id)
+        os.Exit(1)
+    }
+
+    if approval.usedAt != nil {
+        logError("Error: Request %d by %s has already been used at %s", approval.id, approval.requestedBy,
+            approval.usedAt.Local().Format("2006-01-02 15:04"))
+        logError("Hint: Run 'request-apply' again and let it be approved")
+        os.Exit(1)
+    }
+
+    planHash := getPlanHash(plan)
+    if planHash != approval.planHash {
+        logError("Error: Plan has changed since request %d, approved plan hash %s but planned migrations have hash %s",
+            approval.id, approval.planHash, planHash)
+        logError("Hint: Migration files, grants.sql or the database changed, run 'request-apply' again")
+        os.Exit(1)
+    }
+
+    // claimed before anything is applied: of two runs with the same request, only one gets the row
+    commandTag, err := postgreSQLConnection.Exec(context.Background(),
+        fmt.Sprintf("UPDATE %s SET used_at = NOW() WHERE id = $1 AND used_at IS NULL", getApprovalsTableName()), approval.id)
+    if err != nil {
+        logError("Error: Failed to record use of request %d", approval.id)
+        panic(err)
+    }
+    if commandTag.RowsAffected() != 1 {
+        logError("Error: Request %d has been used by another run meanwhile", approval.id)
+        logError("Hint: Run 'request-apply' again and let it be approved")
+        os.Exit(1)
+    }
+
+    fmt.Printf("approved: request %d by %s, approved by %s (role %s)\n", approval.id, approval.requestedBy, approval.approvedBy, approval.approvedRole)
+}
+
+// record intent to apply the planned migrations, for another role to approve
+func cmd_request_apply() {
+    plan := getMigrationPlan()
+    checkMigrationStatus(plan.Status)
+    plannedMigrations := getPlannedMigrations(plan)
+    if len(plannedMigrations) == 0 {
+        fmt.Println("Database up to date, no pending migrations.")
+        os.Exit(0)
+    }
+
+    var descriptions []string
+    for _, fileName := range plannedMigrations {
+        descriptions = append(descriptions, describePlannedMigration(plan, fileName))
+    }
+
+    createApprovalsTable()
+
+    var id int
+    err := postgreSQLConnection.QueryRow(context.Background(),
+        fmt.Sprintf("INSERT INTO %s (plan_hash, migrations, requested_by) VALUES ($1, $2, $3) RETURNING id", getApprovalsTableName()),
+        getPlanHash(plan), strings.Join(descriptions, "\n"), getOperatorName()).Scan(&id)
+    if err != nil {
+        logError("Error: Failed to record request in table %s", getApprovalsTableName())
+        panic(err)
+    }
+
+    fmt.Printf("%d planned migration(s):\n", len(plannedMigrations))
+    for _, fileName := range plannedMigrations {
+        if decision := getPlanDecision(plan, fileName); len(decision) > 0 {
+            fmt.Printf("    %s (%s)\n", newPendingReportMigration(fileName), decision)
+        } else {
+            fmt.Println("   ", newPendingReportMigration(fileName))
+        }
+    }
+    fmt.Printf("request: %d\n", id)
+    fmt.Printf("Hint: Another database role needs to run 'approve %d', then apply with 'up --approved %d'\n", id, id)
+
+    os.Exit(0)
+}
+
+// approve request of another role
+func cmd_approve(idArgument string) {
+    id, err := strconv.Atoi(idArgument)
+    if err != nil {
+        logError("Error: Invalid request id %s", idArgument)
+        os.Exit(1)
+    }
+
+    createApprovalsTable()
+    approval := getApplyApproval(id)
+
+    if approval.approvedAt != nil {
+        fmt.Printf("Request %d has already been approved by %s (role %s).\n", id, approval.approvedBy, approval.approvedRole)
+        os.Exit(0)
+    }
+
+    role := getSessionRole()
+    if role == approval.requestedRole {
+        logError("Error: Request %d has been recorded by role %s, it needs to be approved by another role", id, role)
+        os.Exit(1)
+    }
+
+    fmt.Printf("Request %d by %s (role %s) at %s applies:\n", id, approval.requestedBy, approval.requestedRole,
+        approval.requestedAt.Local().Format("2006-01-02 15:04"))
+    for _, fileName := range strings.Split(approval.migrations, "\n") {
+        fmt.Println("   ", fileName)
+    }
+    fmt.Println("plan hash:", approval.planHash)
+
+    if !confirm("Approve these migrations?") {
+        logError("Error: Aborted, request %d has not been approved", id)
+        os.Exit(1)
+    }
+
+    _, err = postgreSQLConnection.Exec(context.Background(),
+        fmt.Sprintf("UPDATE %s SET approved_at = NOW(), approved_by = $2, approved_role = session_user WHERE id = $1 AND approved_at IS NULL", getApprovalsTableName()),
+        id, getOperatorName())
+    if err != nil {
+        logError("Error: Failed to approve request %d", id)
+        panic(err)
+    }
+
+    fmt.Printf("approved: request %d, apply it with 'up --approved %d'\n", id, id)
+    os.Exit(0)
+}
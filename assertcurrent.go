@@ -0,0 +1,114 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path"
+    "strings"
+)
+
+var flagExpect = commandLineFlags.String("expect", "", "for 'assert-current': latest migration file name the deployed code expects, or a lock file with one migration file name per line (default: local migration files)")
+
+// migrations the deployed code expects: all lines of a lock file, or the local migration files
+func getExpectedMigrations() []string {
+    if len(*flagExpect) == 0 {
+        return getMigrationsFromFileSystem()
+    }
+
+    fileContent, err := ioutil.ReadFile(*flagExpect)
+    if err != nil {
+        logError("Error: Could not read lock file %s", *flagExpect)
+        panic(err)
+    }
+
+    // other files of the migrations folder (e.g. from 'ls') are left out
+    var expected []string
+    for _, line := range strings.Split(string(fileContent), "\n") {
+        line = strings.TrimSpace(line)
+        if len(line) > 0 && !strings.HasPrefix(line, "#") && isMigrationFileName(path.Base(line)) {
+            expected = append(expected, path.Base(line))
+        }
+    }
+    sortMigrationFileNames(expected)
+
+    return expected
+}
+
+// for readiness probes: exit 0 only if the database has exactly the migrations the deployed code expects
+func cmd_assert_current() {
+    connectToStoredDatabaseConnection()
+
+    // no tracking table yet: nothing has been applied, without creating anything
+    var exists bool
+    err := postgreSQLConnection.QueryRow(context.Background(), "SELECT to_regclass($1) IS NOT NULL", trackingTableName).Scan(&exists)
+    if err != nil {
+        logError("Error: Could not check for table %s", trackingTableName)
+        panic(err)
+    }
+
+    var migrationsInDatabase []string
+    if exists {
+        migrationsInDatabase = getMigrationsFromDatabase()
+    }
+
+    latestApplied := "(none)"
+    if len(migrationsInDatabase) > 0 {
+        latestApplied = migrationsInDatabase[len(migrationsInDatabase)-1]
+    }
+
+    // latest migration only, e.g. --expect 20240101120000-add-users.sql baked into the image
+    if len(*flagExpect) > 0 && isMigrationFileName(*flagExpect) {
+        if _, statErr := os.Stat(*flagExpect); os.IsNotExist(statErr) {
+            if latestApplied != *flagExpect {
+                logError("Error: Database is not current, latest applied migration is %s, expected %s", latestApplied, *flagExpect)
+                os.Exit(1)
+            }
+
+            fmt.Printf("Database is current, latest applied migration is %s\n", latestApplied)
+            os.Exit(0)
+        }
+    }
+
+    expected := getExpectedMigrations()
+    applied := make(map[string]bool)
+    for _, fileName := range migrationsInDatabase {
+        applied[fileName] = true
+    }
+
+    // migrations archived by 'prune-history' are the oldest ones
+    prunedCount := 0
+    if exists {
+        prunedCount = getPrunedMigrationCount()
+    }
+
+    expectedSet := make(map[string]bool)
+    var missing []string
+    for index, fileName := range expected {
+        expectedSet[fileName] = true
+        if index >= prunedCount && !applied[fileName] {
+            missing = append(missing, fileName)
+        }
+    }
+
+    var unexpected []string
+    for _, fileName := range migrationsInDatabase {
+        if !expectedSet[fileName] {
+            unexpected = append(unexpected, fileName)
+        }
+    }
+
+    if len(missing) > 0 || len(unexpected) > 0 {
+        if len(missing) > 0 {
+            logError("Error: Database is behind, %d expected migrations have not been applied, first one: %s", len(missing), missing[0])
+        }
+        if len(unexpected) > 0 {
+            logError("Error: Database has %d migrations the deployed code does not know, first one: %s", len(unexpected), unexpected[0])
+        }
+        os.Exit(1)
+    }
+
+    fmt.Printf("Database is current, %d migrations applied, latest is %s\n", len(expected), latestApplied)
+    os.Exit(0)
+}
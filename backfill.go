@@ -0,0 +1,155 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "regexp"
+    "strings"
+    "time"
+)
+
+const (
+    CONST_BACKFILL_MARKER_COUNT = "-- backfill:count"
+    CONST_BACKFILL_MARKER_BATCH = "-- backfill:batch"
+
+    CONST_BACKFILL_TEMPLATE = `--
+-- backfill: run with '%s backfill <this file>'
+--
+-- The batch statement is executed again and again (each time in its own
+-- transaction) until it does not affect any rows anymore. $1 is replaced
+-- by the batch size. The count query is optional and only used to show progress.
+--
+
+` + CONST_BACKFILL_MARKER_COUNT + `
+SELECT count(*) FROM my_table WHERE new_column IS NULL;
+
+` + CONST_BACKFILL_MARKER_BATCH + `
+UPDATE my_table SET new_column = old_column
+WHERE id IN (SELECT id FROM my_table WHERE new_column IS NULL LIMIT $1);
+`
+)
+
+var flagBatchSize = commandLineFlags.Int("batch-size", 1000, "number of rows per batch for 'backfill'")
+var flagBatchPause = commandLineFlags.Duration("batch-pause", 0, "pause between two batches for 'backfill', e.g. 100ms")
+
+// read count query and batch statement from backfill file
+func readBackfillFromFile(filePath string) (string, string) {
+    fileContentBytes, err := ioutil.ReadFile(filePath)
+    if err != nil {
+        logError("Error: Could not read file %s", filePath)
+        panic(err)
+    }
+
+    fileContent := string(fileContentBytes)
+
+    reMarkers := regexp.MustCompile("(?m)^(" + CONST_BACKFILL_MARKER_COUNT + "|" + CONST_BACKFILL_MARKER_BATCH + ")[ \t]*$")
+    markerPositions := reMarkers.FindAllStringSubmatchIndex(fileContent, -1)
+
+    // split file into sections following the markers
+    var sqlCount, sqlBatch string
+    for index, position := range markerPositions {
+        sectionEnd := len(fileContent)
+        if index+1 < len(markerPositions) {
+            sectionEnd = markerPositions[index+1][0]
+        }
+
+        section := cleanUpSQLString(fileContent[position[1]:sectionEnd])
+        section = strings.TrimSuffix(section, ";")
+
+        if fileContent[position[2]:position[3]] == CONST_BACKFILL_MARKER_COUNT {
+            sqlCount = section
+        } else {
+            sqlBatch = section
+        }
+    }
+
+    if len(sqlBatch) == 0 {
+        logError("Error: No batch statement found in backfill file %s", filePath)
+        logError("Hint: Put the statement below a line '%s', use '%s backfill-template' for an example",
+            CONST_BACKFILL_MARKER_BATCH, os.Args[0])
+        os.Exit(1)
+    }
+
+    return sqlCount, sqlBatch
+}
+
+// render progress bar, e.g. [#####-----]  50% 500/1000 rows
+func formatProgressBar(done int64, total int64) string {
+    const width = 30
+
+    if total <= 0 {
+        return fmt.Sprintf("%d rows", done)
+    }
+
+    percent := done * 100 / total
+    if percent > 100 {
+        percent = 100
+    }
+
+    filled := int(percent) * width / 100
+    return fmt.Sprintf("[%s%s] %3d%% %d/%d rows",
+        strings.Repeat("#", filled), strings.Repeat("-", width-filled), percent, done, total)
+}
+
+// print example backfill file
+func cmd_backfill_template() {
+    fmt.Printf(CONST_BACKFILL_TEMPLATE, os.Args[0])
+    os.Exit(0)
+}
+
+// run backfill in batches driven from the client, each batch is committed on its own
+func cmd_backfill(filePath string) {
+    sqlCount, sqlBatch := readBackfillFromFile(filePath)
+
+    if *flagBatchSize <= 0 {
+        logError("Error: --batch-size must be greater than zero")
+        os.Exit(1)
+    }
+
+    // not at the same time as migrations, and not during a freeze
+    defer lockRun()()
+    checkMigrationFreeze()
+
+    // count rows to show progress
+    var total int64 = -1
+    if len(sqlCount) > 0 {
+        err := postgreSQLConnection.QueryRow(context.Background(), sqlCount).Scan(&total)
+        if err != nil {
+            logError("Error: Count query of backfill failed")
+            logError(sqlCount)
+            panic(err)
+        }
+    }
+
+    fmt.Printf("backfill: %s (batch size %d)\n", filePath, *flagBatchSize)
+
+    startedAt := time.Now()
+    var done int64
+    for {
+        // statement without explicit transaction is committed right away
+        commandTag, err := postgreSQLConnection.Exec(context.Background(), sqlBatch, *flagBatchSize)
+        if err != nil {
+            fmt.Println()
+            logError("Error: Batch of backfill failed after %d rows", done)
+            logError(sqlBatch)
+            panic(err)
+        }
+
+        if commandTag.RowsAffected() == 0 {
+            break
+        }
+
+        done += commandTag.RowsAffected()
+
+        rowsPerSecond := float64(done) / time.Since(startedAt).Seconds()
+        fmt.Printf("\r%s (%.0f rows/s)", formatProgressBar(done, total), rowsPerSecond)
+
+        time.Sleep(*flagBatchPause)
+    }
+
+    fmt.Printf("\nbackfill done: %d rows in %s\n", done, time.Since(startedAt).Round(time.Millisecond))
+
+    os.Exit(0)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+    "context"
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    // cancel requests go through a new connection to the server
+    CONST_CANCEL_REQUEST_TIMEOUT = 10 * time.Second
+
+    // exit code after a second interrupt, like shells report SIGINT
+    CONST_EXIT_CODE_INTERRUPTED = 130
+)
+
+var flagDeadline = commandLineFlags.Duration("deadline", 0, "for 'up' and 'down': give up after this long (0: no deadline), the running statement is cancelled on the server")
+
+// context of this run, see getRunContext
+var runContext context.Context
+
+// context of this run: ends with --deadline, SIGINT or SIGTERM (e.g. a Kubernetes pod which is stopped)
+func getRunContext() context.Context {
+    if runContext != nil {
+        return runContext
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    if *flagDeadline > 0 {
+        ctx, cancel = context.WithTimeout(ctx, *flagDeadline)
+    }
+
+    signals := make(chan os.Signal, 2)
+    signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        <-signals
+        logError("Error: Interrupted, cancelling the running statement on the server (interrupt again to exit right away)")
+        cancel()
+
+        <-signals
+        os.Exit(CONST_EXIT_CODE_INTERRUPTED)
+    }()
+
+    runContext = ctx
+    return runContext
+}
+
+// do not start another migration after the run context has ended
+func checkRunContext() {
+    err := getRunContext().Err()
+    if err == context.DeadlineExceeded {
+        logError("Error: Deadline of %s exceeded, no further migrations are applied", *flagDeadline)
+        panic(err)
+    }
+    if err != nil {
+        logError("Error: Interrupted, no further migrations are applied")
+        panic(err)
+    }
+}
+
+// when the context ends, cancel the running statement on the server: a client which just goes away
+// leaves it running there (holding its locks) until the server notices; returns function to stop watching
+func cancelOnServerWhenDone(ctx context.Context, connection databaseConnection) func() {
+    conn, ok := connection.(*pgx.Conn)
+    if !ok {
+        return func() {}
+    }
+
+    stop := make(chan struct{})
+    go func() {
+        select {
+        case <-stop:
+            return
+        case <-ctx.Done():
+        }
+
+        if ctx.Err() == context.DeadlineExceeded {
+            logError("Error: Deadline of %s exceeded, cancelling the running statement on the server", *flagDeadline)
+        }
+
+        cancelCtx, cancel := context.WithTimeout(context.Background(), CONST_CANCEL_REQUEST_TIMEOUT)
+        defer cancel()
+
+        err := conn.PgConn().CancelRequest(cancelCtx)
+        if err != nil {
+            logError("Warning: Could not cancel the running statement on the server: %s", err)
+        }
+    }()
+
+    return func() { close(stop) }
+}
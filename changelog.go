@@ -0,0 +1,183 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "regexp"
+    "time"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    CONST_CHANGE_ADDED   = "Added"
+    CONST_CHANGE_CHANGED = "Changed"
+    CONST_CHANGE_REMOVED = "Removed"
+)
+
+var flagSince = commandLineFlags.String("since", "", "for 'changelog': only migrations after this migration file, or created on or after this date (YYYY-MM-DD); for 'generate rollback': roll back all migrations applied after this one")
+
+// leading timestamp of default file names
+var regexpFileNameTimestamp = regexp.MustCompile(`^(\d{8})`)
+
+// one line of the changelog
+type schemaChange struct {
+    kind        string
+    description string
+    fileName    string
+}
+
+// describe schema changes of one statement
+func getSchemaChangesOfStatement(statement string, fileName string) []schemaChange {
+    var changes []schemaChange
+    add := func(kind string, format string, args ...interface{}) {
+        changes = append(changes, schemaChange{kind, fmt.Sprintf(format, args...), fileName})
+    }
+
+    parsed := migrate.ParseStatement(statement)
+
+    if object := parsed.CreatedObject(); object != nil {
+        switch {
+        case object.Kind != "index":
+            // tables, views, functions, types, ...
+            add(CONST_CHANGE_ADDED, "%s `%s`", object.Kind, object.Name)
+        case len(object.Name) > 0 && object.Unique:
+            add(CONST_CHANGE_ADDED, "unique index `%s` on `%s`", object.Name, object.Table)
+        case len(object.Name) > 0:
+            add(CONST_CHANGE_ADDED, "index `%s` on `%s`", object.Name, object.Table)
+        case object.Unique:
+            add(CONST_CHANGE_ADDED, "unique index on `%s`", object.Table)
+        default:
+            add(CONST_CHANGE_ADDED, "index on `%s`", object.Table)
+        }
+    } else if objects := parsed.DroppedObjects(); len(objects) > 0 {
+        for _, object := range objects {
+            add(CONST_CHANGE_REMOVED, "%s `%s`", object.Kind, object.Name)
+        }
+    } else if alterTable := parsed.AlterTable(); alterTable != nil {
+        changes = append(changes, getAlterTableChanges(alterTable, fileName)...)
+    } else if name := parsed.AlteredType(); len(name) > 0 {
+        add(CONST_CHANGE_CHANGED, "type `%s`", name)
+    }
+
+    return changes
+}
+
+// describe actions of ALTER TABLE
+func getAlterTableChanges(alterTable *migrate.AlterTable, fileName string) []schemaChange {
+    var changes []schemaChange
+    add := func(kind string, format string, args ...interface{}) {
+        changes = append(changes, schemaChange{kind, fmt.Sprintf(format, args...), fileName})
+    }
+
+    table := alterTable.Table
+    for _, action := range alterTable.Actions {
+        switch action.Kind {
+        case migrate.ActionRenameTable:
+            add(CONST_CHANGE_CHANGED, "table `%s` renamed to `%s`", table, action.NewName)
+        case migrate.ActionAddConstraint:
+            if len(action.Name) > 0 {
+                add(CONST_CHANGE_ADDED, "constraint `%s` on `%s`", action.Name, table)
+            }
+        case migrate.ActionDropConstraint:
+            add(CONST_CHANGE_REMOVED, "constraint `%s` on `%s`", action.Name, table)
+        case migrate.ActionAddColumn:
+            add(CONST_CHANGE_ADDED, "column `%s.%s`", table, action.Name)
+        case migrate.ActionDropColumn:
+            add(CONST_CHANGE_REMOVED, "column `%s.%s`", table, action.Name)
+        case migrate.ActionAlterColumn, migrate.ActionAlterColumnType:
+            add(CONST_CHANGE_CHANGED, "column `%s.%s`", table, action.Name)
+        case migrate.ActionRenameColumn:
+            add(CONST_CHANGE_CHANGED, "column `%s.%s` renamed to `%s`", table, action.Name, action.NewName)
+        }
+    }
+
+    if len(changes) == 0 {
+        add(CONST_CHANGE_CHANGED, "table `%s`", table)
+    }
+
+    return changes
+}
+
+// get migrations after given migration file, or created on or after given date (YYYY-MM-DD)
+func getMigrationsSince(since string) []string {
+    migrations := getMigrationsFromFileSystem()
+    if len(since) == 0 {
+        return migrations
+    }
+
+    for index, fileName := range migrations {
+        if fileName == since {
+            return migrations[index+1:]
+        }
+    }
+
+    sinceDate, err := time.Parse("2006-01-02", since)
+    if err != nil {
+        logError("Error: --since %s is neither a migration file nor a date (YYYY-MM-DD)", since)
+        os.Exit(1)
+    }
+
+    var migrationsSince []string
+    for _, fileName := range migrations {
+        createdAt, ok := getMigrationCreatedAt(fileName)
+        if !ok {
+            logError("Warning: Cannot tell when %s has been created, leaving it out", fileName)
+            continue
+        }
+        if !createdAt.Before(sinceDate) {
+            migrationsSince = append(migrationsSince, fileName)
+        }
+    }
+
+    return migrationsSince
+}
+
+// get creation date of migration from timestamp in file name or from its header
+func getMigrationCreatedAt(fileName string) (time.Time, bool) {
+    if match := regexpFileNameTimestamp.FindStringSubmatch(fileName); match != nil {
+        createdAt, err := time.Parse("20060102", match[1])
+        if err == nil {
+            return createdAt, true
+        }
+    }
+
+    createdAt, err := time.Parse(time.RFC850, readMigrationHeaderFromFile(fileName)["created"])
+    return createdAt, err == nil
+}
+
+// print schema changes of migrations as Markdown, for release notes
+func cmd_changelog() {
+    changesByKind := make(map[string][]schemaChange)
+    migrations := getMigrationsSince(*flagSince)
+
+    for _, fileName := range migrations {
+        sqlMigrationForward, _ := readMigrationFromFile(fileName)
+        for _, statement := range splitSQLStatements(cleanUpSQLString(sqlMigrationForward)) {
+            for _, change := range getSchemaChangesOfStatement(statement, fileName) {
+                changesByKind[change.kind] = append(changesByKind[change.kind], change)
+            }
+        }
+    }
+
+    fmt.Println("## Database schema changes")
+    fmt.Println()
+    if len(changesByKind) == 0 {
+        fmt.Printf("No schema changes in %d migration(s).\n", len(migrations))
+        os.Exit(0)
+    }
+
+    for _, kind := range []string{CONST_CHANGE_ADDED, CONST_CHANGE_CHANGED, CONST_CHANGE_REMOVED} {
+        if len(changesByKind[kind]) == 0 {
+            continue
+        }
+
+        fmt.Printf("### %s\n\n", kind)
+        for _, change := range changesByKind[kind] {
+            fmt.Printf("- %s (%s)\n", change.description, change.fileName)
+        }
+        fmt.Println()
+    }
+
+    os.Exit(0)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+    "github.com/jackc/pgx/v4"
+)
+
+var flagAcceptChecksums = commandLineFlags.Bool("accept-checksums", false, "for 'up': record the current checksums of applied migration files which have been edited, instead of failing")
+
+// checksum of an applied migration which the run records when it applies, see recordPendingChecksums
+type pendingChecksum struct {
+    migration migrate.AppliedMigration
+
+    // edited file accepted with --accept-checksums, applied before checksums were stored otherwise
+    accepted bool
+}
+
+// checksums found by checkChecksumsOfAppliedMigrations, planning does not write
+var pendingChecksums []pendingChecksum
+
+// refuse to continue if an applied migration file has been edited since: the database does not contain what the file says.
+// Migrations applied before checksums were stored get the checksum of their current file, when the run applies
+func checkChecksumsOfAppliedMigrations(status *migrate.Status) {
+    pendingChecksums = nil
+    for _, migration := range status.Applied {
+        // skipped migrations have not run, missing files are reported by the consistency checks
+        if len(migration.Checksum) == 0 && len(migration.SkippedBy) == 0 && len(migration.LocalFileName) > 0 {
+            pendingChecksums = append(pendingChecksums, pendingChecksum{migration: migration})
+        }
+    }
+
+    err := getMigrator().VerifyChecksums(status.Applied)
+    var checksumError *migrate.ChecksumError
+    if err != nil && !errors.As(err, &checksumError) {
+        logError("Error: could not verify checksums of applied migrations")
+        panic(err)
+    }
+    if checksumError == nil {
+        return
+    }
+
+    if *flagAcceptChecksums {
+        for _, migration := range checksumError.Changed {
+            pendingChecksums = append(pendingChecksums, pendingChecksum{migration: migration, accepted: true})
+        }
+        return
+    }
+
+    for _, migration := range checksumError.Changed {
+        logError("Error: Migration %s has been changed after it was applied (%s)", migration.FileName,
+            migration.AppliedAt.Format("2006-01-02 15:04:05"))
+    }
+    logError("Hint: Revert the changes and add a new migration instead")
+    logError("Hint: If the database matches the changed files (e.g. only comments changed), 'up --accept-checksums' records them")
+    os.Exit(1)
+}
+
+// store the pending checksums in the transaction of the first migration the run applies (Options.InTransaction),
+// so they are stored if and only if the run changes the database
+func recordPendingChecksums(ctx context.Context, tx pgx.Tx) error {
+    recordedCount := 0
+    for _, checksum := range pendingChecksums {
+        err := getMigrator().RecordChecksumInTransaction(ctx, tx, checksum.migration)
+        if err != nil {
+            return err
+        }
+
+        if checksum.accepted {
+            fmt.Println("accepted changed migration file:", checksum.migration.FileName)
+        } else {
+            recordedCount++
+        }
+    }
+
+    if recordedCount > 0 {
+        fmt.Printf("recorded checksums of %d migrations applied before checksums were stored\n", recordedCount)
+    }
+    pendingChecksums = nil
+
+    return nil
+}
+
+// store the pending checksums in a transaction of their own, for runs which apply nothing (e.g. 'up --accept-checksums'
+// after an edit); not with --rollback-at-end, which persists nothing
+func recordPendingChecksumsWithoutMigration() {
+    if len(pendingChecksums) == 0 || *flagRollbackAtEnd {
+        return
+    }
+
+    tx, err := postgreSQLConnection.Begin(context.Background())
+    if err != nil {
+        logError("Error: Failed to store checksums of applied migrations in %s", trackingTableName)
+        panic(err)
+    }
+    defer tx.Rollback(context.Background())
+
+    err = recordPendingChecksums(context.Background(), tx)
+    if err == nil {
+        err = tx.Commit(context.Background())
+    }
+    if err != nil {
+        logError("Error: Failed to store checksums of applied migrations in %s", trackingTableName)
+        panic(err)
+    }
+}
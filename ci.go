@@ -0,0 +1,292 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strings"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    // inputs of 'ci', read from environment so they can be set in pipeline definitions
+    CONST_ENV_VAR_CI_APPLY        = "MIGRATE_CI_APPLY"
+    CONST_ENV_VAR_CI_FAIL_ON      = "MIGRATE_CI_FAIL_ON"
+    CONST_ENV_VAR_CI_SUMMARY_FILE = "MIGRATE_CI_SUMMARY_FILE"
+
+    // job summary file of GitHub Actions, used if no summary file is given
+    CONST_ENV_VAR_GITHUB_STEP_SUMMARY = "GITHUB_STEP_SUMMARY"
+
+    // fail conditions for MIGRATE_CI_FAIL_ON
+    CONST_CI_FAIL_ON_PENDING        = "pending"
+    CONST_CI_FAIL_ON_NO_TRANSACTION = "no-transaction"
+    CONST_CI_FAIL_ON_DROP           = "drop"
+)
+
+// pending migration as seen by 'ci'
+type ciMigration struct {
+    FileName      string `json:"filename"`
+    Owner         string `json:"owner,omitempty"`
+    SkippedBy     string `json:"skipped_by,omitempty"`
+    NoTransaction bool   `json:"no_transaction"`
+    Drop          bool   `json:"drop"`
+    Applied       bool   `json:"applied"`
+    Failed        bool   `json:"failed"`
+}
+
+// check if a statement of the migration destroys data, see migrate.Statement.DestroysData
+func destroysData(sqlMigration string) bool {
+    for _, statement := range splitSQLStatements(sqlMigration) {
+        if migrate.ParseStatement(statement).DestroysData() {
+            return true
+        }
+    }
+
+    return false
+}
+
+// outcome of 'ci', printed as JSON
+type ciResult struct {
+    Success          bool          `json:"success"`
+    MigrationFiles   int           `json:"migration_files"`
+    AppliedBefore    int           `json:"applied_before"`
+    Pending          []ciMigration `json:"pending"`
+    ValidationErrors []string      `json:"validation_errors"`
+    Failures         []string      `json:"failures"`
+}
+
+// get enabled fail conditions, exits on unknown ones
+func getCIFailConditions() map[string]bool {
+    failConditions := make(map[string]bool)
+
+    for _, condition := range strings.Split(os.Getenv(CONST_ENV_VAR_CI_FAIL_ON), ",") {
+        condition = strings.TrimSpace(condition)
+        switch condition {
+        case "":
+            continue
+        case CONST_CI_FAIL_ON_PENDING, CONST_CI_FAIL_ON_NO_TRANSACTION, CONST_CI_FAIL_ON_DROP:
+            failConditions[condition] = true
+        default:
+            logError("Error: Unknown fail condition in %s: %s", CONST_ENV_VAR_CI_FAIL_ON, condition)
+            logError("Hint: Use a comma separated list of: %s, %s, %s",
+                CONST_CI_FAIL_ON_PENDING, CONST_CI_FAIL_ON_NO_TRANSACTION, CONST_CI_FAIL_ON_DROP)
+            os.Exit(1)
+        }
+    }
+
+    return failConditions
+}
+
+// check pending migrations against fail conditions
+func getCIFailures(pending []ciMigration, failConditions map[string]bool) []string {
+    failures := []string{}
+
+    pendingCount := 0
+    for _, migration := range pending {
+        if len(migration.SkippedBy) == 0 {
+            pendingCount++
+        }
+    }
+    if failConditions[CONST_CI_FAIL_ON_PENDING] && pendingCount > 0 {
+        failures = append(failures, fmt.Sprintf("%d pending migration(s)", pendingCount))
+    }
+
+    for _, migration := range pending {
+        // only recorded as skipped, nothing runs
+        if len(migration.SkippedBy) > 0 {
+            continue
+        }
+
+        if failConditions[CONST_CI_FAIL_ON_NO_TRANSACTION] && migration.NoTransaction {
+            failures = append(failures, migration.FileName+" cannot run inside a transaction")
+        }
+
+        if failConditions[CONST_CI_FAIL_ON_DROP] && migration.Drop {
+            failures = append(failures, migration.FileName+" drops or truncates data")
+        }
+    }
+
+    return failures
+}
+
+// render result as Markdown for job summaries
+func renderCISummary(result ciResult) string {
+    var summary strings.Builder
+
+    status := "succeeded"
+    if !result.Success {
+        status = "failed"
+    }
+
+    fmt.Fprintf(&summary, "### Database migrations %s\n\n", status)
+    fmt.Fprintf(&summary, "%d migration files, %d applied before this run, %d pending.\n\n",
+        result.MigrationFiles, result.AppliedBefore, len(result.Pending))
+
+    if len(result.Pending) > 0 {
+        summary.WriteString("| Migration | Owner | Applied | Without transaction | Drops data |\n")
+        summary.WriteString("| --- | --- | --- | --- | --- |\n")
+        for _, migration := range result.Pending {
+            fmt.Fprintf(&summary, "| `%s` | %s | %s | %s | %s |\n", migration.FileName, migration.Owner,
+                formatBool(migration.Applied), formatBool(migration.NoTransaction), formatBool(migration.Drop))
+        }
+        summary.WriteString("\n")
+    }
+
+    for _, validationError := range result.ValidationErrors {
+        fmt.Fprintf(&summary, "- :x: %s\n", validationError)
+    }
+
+    for _, failure := range result.Failures {
+        fmt.Fprintf(&summary, "- :x: %s\n", failure)
+    }
+
+    return summary.String()
+}
+
+// append Markdown summary to summary file (if there is one)
+func writeCISummary(result ciResult) {
+    filePath := os.Getenv(CONST_ENV_VAR_CI_SUMMARY_FILE)
+    if len(filePath) == 0 {
+        filePath = os.Getenv(CONST_ENV_VAR_GITHUB_STEP_SUMMARY)
+    }
+    if len(filePath) == 0 {
+        return
+    }
+
+    file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if err != nil {
+        logError("Error: Could not open summary file %s", filePath)
+        panic(err)
+    }
+    defer file.Close()
+
+    _, err = file.WriteString(renderCISummary(result))
+    if err != nil {
+        logError("Error: Could not write summary file %s", filePath)
+        panic(err)
+    }
+}
+
+// apply pending migrations, failures are recorded instead of aborting the run
+func applyCIMigrations(result *ciResult) {
+    // index of the migration being applied, so alerts can go to its owner
+    current := -1
+
+    defer func() {
+        if err := recover(); err != nil {
+            failure := fmt.Sprint(err)
+            if current >= 0 {
+                result.Pending[current].Failed = true
+                failure = result.Pending[current].FileName + ": " + failure
+            }
+            if recoveredErr, ok := err.(error); ok && len(getSQLStateHint(recoveredErr)) > 0 {
+                failure += " (hint: " + getSQLStateHint(recoveredErr) + ")"
+            }
+            result.Failures = append(result.Failures, failure)
+            reportMigrationError("ci", failingMigrationFileName, err)
+        }
+    }()
+
+    recordRun()
+
+    for index, migration := range result.Pending {
+        // keep the order of positions, but do not run it
+        if len(migration.SkippedBy) > 0 {
+            insertedId := skipMigration(migration.FileName, migration.SkippedBy)
+            fmt.Printf("skipped migration: %s (%s, database id: %d)\n", migration.FileName, migration.SkippedBy, insertedId)
+            continue
+        }
+
+        current = index
+        migrateForward(migration.FileName)
+
+        result.Pending[index].Applied = true
+        current = -1
+        fmt.Println("forward migration:", migration.FileName)
+        runFeatureFlagHooks(migration.FileName)
+    }
+
+    // nothing applied, or only skipped migrations
+    recordPendingChecksumsWithoutMigration()
+
+    applyGrants()
+}
+
+// pipeline entrypoint: validate, plan and up, with summary as Markdown file and JSON on STDOUT
+func cmd_ci() {
+    failConditions := getCIFailConditions()
+    apply := os.Getenv(CONST_ENV_VAR_CI_APPLY) != "false"
+
+    // JSON is the only output on STDOUT, progress goes to STDERR
+    stdout := os.Stdout
+    os.Stdout = os.Stderr
+
+    result := ciResult{Pending: []ciMigration{}, ValidationErrors: []string{}}
+
+    // validate
+    migrationsInFileSystem := getMigrationsFromFileSystem()
+    result.MigrationFiles = len(migrationsInFileSystem)
+    for _, fileName := range migrationsInFileSystem {
+        _, err := validateMigrationFile(fileName, migrationFileInfo{})
+        if err != nil {
+            result.ValidationErrors = append(result.ValidationErrors, fmt.Sprintf("%s: %s", fileName, err))
+        }
+    }
+
+    // plan, under the lock 'up' and 'down' hold, so a concurrent run cannot apply the same migrations
+    unlock := func() {}
+    if len(result.ValidationErrors) == 0 {
+        unlock = lockRun()
+        createTrackingTable()
+
+        // the checks of 'up': consistency, checksums, phases, tags, syntax, server version, replication, ...
+        plan := planUp()
+        result.AppliedBefore = len(plan.migrationsInDatabase)
+
+        for _, fileName := range append(append([]string{}, plan.catchUpMigrations...), plan.pendingMigrations...) {
+            sqlMigrationForward, _ := readMigrationFromFile(fileName)
+            annotationsForward, _ := readMigrationAnnotationsFromFile(fileName)
+
+            result.Pending = append(result.Pending, ciMigration{
+                FileName:      fileName,
+                Owner:         getMigrationOwner(fileName),
+                SkippedBy:     plan.skippedBy[fileName],
+                NoTransaction: hasAnnotation(annotationsForward, CONST_ANNOTATION_NO_TRANSACTION),
+                Drop:          destroysData(sqlMigrationForward),
+            })
+        }
+
+        result.Failures = getCIFailures(result.Pending, failConditions)
+        if freeze := getMigrationFreeze(); apply && freeze != nil {
+            result.Failures = append(result.Failures, fmt.Sprintf("schema changes are frozen %s", freeze))
+        }
+
+        if apply {
+            checkApproval(plan.migrationPlan)
+        }
+    }
+
+    // up
+    if apply && len(result.ValidationErrors) == 0 && len(result.Failures) == 0 {
+        applyCIMigrations(&result)
+    }
+    unlock()
+
+    result.Success = len(result.ValidationErrors) == 0 && len(result.Failures) == 0
+
+    writeCISummary(result)
+
+    os.Stdout = stdout
+    output, err := json.MarshalIndent(result, "", "  ")
+    if err != nil {
+        panic(err)
+    }
+    fmt.Println(string(output))
+
+    if !result.Success {
+        os.Exit(1)
+    }
+
+    os.Exit(0)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+    "os"
+    "reflect"
+    "testing"
+)
+
+func TestGetCIFailures(t *testing.T) {
+    pending := []ciMigration{
+        {FileName: "20240101120000-a.sql"},
+        {FileName: "20240102120000-b.sql", NoTransaction: true},
+        {FileName: "20240103120000-c.sql", Drop: true},
+        {FileName: "20240104120000-d.sql", NoTransaction: true, Drop: true, SkippedBy: "legacy"},
+    }
+
+    tests := []struct {
+        name           string
+        pending        []ciMigration
+        failConditions map[string]bool
+        expected       []string
+    }{
+        {
+            name:           "no fail conditions",
+            pending:        pending,
+            failConditions: map[string]bool{},
+            expected:       []string{},
+        },
+        {
+            name:           "nothing pending",
+            pending:        nil,
+            failConditions: map[string]bool{CONST_CI_FAIL_ON_PENDING: true, CONST_CI_FAIL_ON_NO_TRANSACTION: true, CONST_CI_FAIL_ON_DROP: true},
+            expected:       []string{},
+        },
+        {
+            name:           "pending without skipped ones",
+            pending:        pending,
+            failConditions: map[string]bool{CONST_CI_FAIL_ON_PENDING: true},
+            expected:       []string{"3 pending migration(s)"},
+        },
+        {
+            name:           "only skipped ones pending",
+            pending:        pending[3:],
+            failConditions: map[string]bool{CONST_CI_FAIL_ON_PENDING: true, CONST_CI_FAIL_ON_NO_TRANSACTION: true, CONST_CI_FAIL_ON_DROP: true},
+            expected:       []string{},
+        },
+        {
+            name:           "without transaction",
+            pending:        pending,
+            failConditions: map[string]bool{CONST_CI_FAIL_ON_NO_TRANSACTION: true},
+            expected:       []string{"20240102120000-b.sql cannot run inside a transaction"},
+        },
+        {
+            name:           "all conditions",
+            pending:        pending,
+            failConditions: map[string]bool{CONST_CI_FAIL_ON_PENDING: true, CONST_CI_FAIL_ON_NO_TRANSACTION: true, CONST_CI_FAIL_ON_DROP: true},
+            expected: []string{
+                "3 pending migration(s)",
+                "20240102120000-b.sql cannot run inside a transaction",
+                "20240103120000-c.sql drops or truncates data",
+            },
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            if failures := getCIFailures(test.pending, test.failConditions); !reflect.DeepEqual(failures, test.expected) {
+                t.Errorf("got %q, want %q", failures, test.expected)
+            }
+        })
+    }
+}
+
+func TestGetCIFailConditions(t *testing.T) {
+    tests := []struct {
+        name     string
+        failOn   string
+        expected map[string]bool
+    }{
+        {
+            name:     "empty",
+            failOn:   "",
+            expected: map[string]bool{},
+        },
+        {
+            name:     "empty entries and spaces",
+            failOn:   " pending, ,drop ,",
+            expected: map[string]bool{CONST_CI_FAIL_ON_PENDING: true, CONST_CI_FAIL_ON_DROP: true},
+        },
+        {
+            name:     "repeated",
+            failOn:   "no-transaction,no-transaction",
+            expected: map[string]bool{CONST_CI_FAIL_ON_NO_TRANSACTION: true},
+        },
+    }
+
+    original, wasSet := os.LookupEnv(CONST_ENV_VAR_CI_FAIL_ON)
+    defer func() {
+        if wasSet {
+            os.Setenv(CONST_ENV_VAR_CI_FAIL_ON, original)
+        } else {
+            os.Unsetenv(CONST_ENV_VAR_CI_FAIL_ON)
+        }
+    }()
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            os.Setenv(CONST_ENV_VAR_CI_FAIL_ON, test.failOn)
+            if failConditions := getCIFailConditions(); !reflect.DeepEqual(failConditions, test.expected) {
+                t.Errorf("got %v, want %v", failConditions, test.expected)
+            }
+        })
+    }
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "sort"
+
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    // all schema objects with a comparable definition, one row each: kind, name, definition
+    CONST_POSTGRESQL_SCHEMA_SNAPSHOT_QUERY = `
+    WITH user_namespaces AS (
+        SELECT oid, nspname FROM pg_namespace
+        WHERE nspname NOT IN ('pg_catalog', 'information_schema')
+        AND nspname NOT LIKE 'pg\_toast%' AND nspname NOT LIKE 'pg\_temp%'
+    )
+        SELECT
+            CASE c.relkind WHEN 'v' THEN 'view' WHEN 'm' THEN 'materialized view'
+                WHEN 'f' THEN 'foreign table' WHEN 'S' THEN 'sequence' ELSE 'table' END,
+            format('%I.%I', n.nspname, c.relname),
+            CASE WHEN c.relkind IN ('v', 'm') THEN pg_get_viewdef(c.oid) ELSE '' END
+        FROM pg_class c
+        JOIN user_namespaces n ON n.oid = c.relnamespace
+        WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f', 'S')
+    UNION ALL
+        SELECT 'column', format('%I.%I.%I', n.nspname, c.relname, a.attname),
+            format_type(a.atttypid, a.atttypmod)
+                || CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END
+                || COALESCE(' DEFAULT ' || pg_get_expr(d.adbin, d.adrelid), '')
+        FROM pg_attribute a
+        JOIN pg_class c ON c.oid = a.attrelid
+        JOIN user_namespaces n ON n.oid = c.relnamespace
+        LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+        WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f') AND a.attnum > 0 AND NOT a.attisdropped
+    UNION ALL
+        SELECT 'index', format('%I.%I', i.schemaname, i.indexname), i.indexdef
+        FROM pg_indexes i
+        JOIN user_namespaces n ON n.nspname = i.schemaname
+    UNION ALL
+        SELECT 'constraint', format('%I.%I.%I', n.nspname, c.relname, con.conname), pg_get_constraintdef(con.oid)
+        FROM pg_constraint con
+        JOIN pg_class c ON c.oid = con.conrelid
+        JOIN user_namespaces n ON n.oid = c.relnamespace
+    UNION ALL
+        SELECT 'function', format('%I.%I(%s)', n.nspname, p.proname, pg_get_function_identity_arguments(p.oid)),
+            'returns ' || pg_get_function_result(p.oid) || ', source md5 ' || md5(p.prosrc)
+        FROM pg_proc p
+        JOIN user_namespaces n ON n.oid = p.pronamespace`
+)
+
+var flagCompareA = commandLineFlags.String("a", "", "connection string of first database for 'compare'")
+var flagCompareB = commandLineFlags.String("b", "", "connection string of second database for 'compare'")
+
+// schema object in a snapshot
+type schemaObject struct {
+    kind       string
+    name       string
+    definition string
+}
+
+// read all schema objects, keyed by kind and name
+func getSchemaSnapshot(connection *pgx.Conn) map[string]schemaObject {
+    rows, err := connection.Query(context.Background(), CONST_POSTGRESQL_SCHEMA_SNAPSHOT_QUERY)
+    if err != nil {
+        logError("Error: Could not read schema from database")
+        panic(err)
+    }
+    defer rows.Close()
+
+    snapshot := make(map[string]schemaObject)
+    for rows.Next() {
+        var object schemaObject
+        err := rows.Scan(&object.kind, &object.name, &object.definition)
+        if err != nil {
+            logError("Error: Could not read schema from database: unable to scan row")
+            panic(err)
+        }
+
+        snapshot[object.kind+" "+object.name] = object
+    }
+
+    err = rows.Err()
+    if err != nil {
+        logError("Error: Could not read schema from database: row error")
+        panic(err)
+    }
+
+    return snapshot
+}
+
+// sorted keys of snapshot
+func getSortedSchemaObjectKeys(snapshot map[string]schemaObject) []string {
+    keys := make([]string, 0, len(snapshot))
+    for key := range snapshot {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    return keys
+}
+
+// print differences between two snapshots, returns number of differences
+func printSchemaDifferences(labelA string, snapshotA map[string]schemaObject, labelB string, snapshotB map[string]schemaObject) int {
+    differences := 0
+
+    for _, key := range getSortedSchemaObjectKeys(snapshotA) {
+        objectA := snapshotA[key]
+        objectB, existsInB := snapshotB[key]
+
+        if !existsInB {
+            fmt.Printf("only in %s: %s\n", labelA, key)
+            differences++
+        } else if objectA.definition != objectB.definition {
+            fmt.Printf("different: %s\n", key)
+            fmt.Printf("    %s: %s\n", labelA, objectA.definition)
+            fmt.Printf("    %s: %s\n", labelB, objectB.definition)
+            differences++
+        }
+    }
+
+    for _, key := range getSortedSchemaObjectKeys(snapshotB) {
+        if _, existsInA := snapshotA[key]; !existsInA {
+            fmt.Printf("only in %s: %s\n", labelB, key)
+            differences++
+        }
+    }
+
+    return differences
+}
+
+// compare schemas of two live databases
+func cmd_compare(connectionStringA string, connectionStringB string) {
+    if len(connectionStringA) == 0 || len(connectionStringB) == 0 {
+        logError("Error: Both databases need to be given, e.g. compare --a postgres://staging --b postgres://prod")
+        os.Exit(1)
+    }
+
+    connectionA := openPostgreSQLConnection(connectionStringA)
+    defer closePostgreSQLConnection(connectionA)
+
+    connectionB := openPostgreSQLConnection(connectionStringB)
+    defer closePostgreSQLConnection(connectionB)
+
+    snapshotA := getSchemaSnapshot(connectionA)
+    snapshotB := getSchemaSnapshot(connectionB)
+
+    differences := printSchemaDifferences("a", snapshotA, "b", snapshotB)
+    if differences > 0 {
+        logError("Found %d differences between the schemas of database a and b", differences)
+        os.Exit(1)
+    }
+
+    fmt.Printf("Schemas are identical (%d objects compared)\n", len(snapshotA))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+    "io/fs"
+    "os"
+    "path"
+    "regexp"
+)
+
+var flagComponent = commandLineFlags.String("component", "", "independent migration stream with its own subfolder of "+CONST_MIGRATIONS_FOLDER+" and its own tracking table, e.g. analytics")
+
+var (
+    // becomes part of the tracking table name
+    regexpComponentName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
+// folder of the migration files, a subfolder for components
+var migrationsFolder = CONST_MIGRATIONS_FOLDER
+
+// tracking table, one per component
+var trackingTableName = CONST_POSTGRESQL_TABLE_NAME
+
+// switch folder and tracking table to the component given with --component,
+// config files (config.json, grants.sql, ...) stay shared in the migrations folder
+func selectComponent() {
+    if len(*flagComponent) == 0 {
+        return
+    }
+
+    if !regexpComponentName.MatchString(*flagComponent) {
+        logError("Error: Invalid component %s, use lower case letters, digits and underscores", *flagComponent)
+        os.Exit(1)
+    }
+
+    migrationsFolder = path.Join(CONST_MIGRATIONS_FOLDER, *flagComponent)
+    trackingTableName = CONST_POSTGRESQL_TABLE_NAME + "_" + *flagComponent
+
+    if stat, err := fs.Stat(migrationFileSystem, migrationsFolder); err != nil || !stat.IsDir() {
+        if currentCommand != "create" {
+            logError("Error: No folder %s for component %s", migrationsFolder, *flagComponent)
+            logError("Hint: Create its first migration with 'create --component %s'", *flagComponent)
+            os.Exit(1)
+        }
+
+        // 'create' writes new files to disk, not to the migration file system
+        err = os.MkdirAll(migrationsFolder, 0700)
+        if err != nil {
+            logError("Error: Could not create folder %s", migrationsFolder)
+            panic(err)
+        }
+    }
+}
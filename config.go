@@ -0,0 +1,472 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net"
+    "net/url"
+    "os"
+    "path"
+    "sort"
+    "strings"
+    "text/tabwriter"
+)
+
+const (
+    CONST_CONFIG_FILENAME = "config.json"
+
+    CONST_ENV_VAR_POSTGRESQL_PARAMETERS = "POSTGRESQL_PARAMETERS"
+    CONST_ENV_VAR_ENVIRONMENT            = "MIGRATE_ENVIRONMENT"
+    CONST_ENV_VAR_PROTECTED_ENVIRONMENTS = "MIGRATE_PROTECTED_ENVIRONMENTS"
+)
+
+// setting which is resolved by precedence: flags > environment > config file > stored connection file > default
+type configSetting struct {
+    name         string // name of flag and key in config file
+    envVar       string
+    defaultValue string
+    secret       bool
+}
+
+// value of a setting and where it came from
+type configValue struct {
+    value  string
+    source string
+}
+
+// all settings, in the order they are shown
+var configSettings = []configSetting{
+    {"host", CONST_ENV_VAR_POSTGRESQL_HOST, DEFAULT_HOST, false},
+    {"port", CONST_ENV_VAR_POSTGRESQL_PORT, DEFAULT_PORT, false},
+    {"user", CONST_ENV_VAR_POSTGRESQL_USER, DEFAULT_USER, false},
+    {"password", CONST_ENV_VAR_POSTGRESQL_PASSWORD, DEFAULT_PASSWORD, true},
+    {"database", CONST_ENV_VAR_POSTGRESQL_DATABASE, DEFAULT_DATABASE, false},
+    // command which prints the password (e.g. from the OS keychain), used if no password is configured
+    {"credential-helper", CONST_ENV_VAR_CREDENTIAL_HELPER, "", false},
+    // bastion which the database connection is tunneled through
+    {"ssh-host", CONST_ENV_VAR_SSH_HOST, "", false},
+    {"ssh-user", CONST_ENV_VAR_SSH_USER, "", false},
+    {"ssh-key", CONST_ENV_VAR_SSH_KEY, "", false},
+    {"ssh-known-hosts", CONST_ENV_VAR_SSH_KNOWN_HOSTS, getDefaultSSHKnownHosts(), false},
+    // SOCKS5 or HTTP proxy for database connections, may contain a password
+    {"proxy", CONST_ENV_VAR_PROXY, "", true},
+    // additional connection parameters in URL query format, e.g. sslmode=require
+    {"parameters", CONST_ENV_VAR_POSTGRESQL_PARAMETERS, "", false},
+    {"filename-pattern", CONST_ENV_VAR_FILENAME_PATTERN, CONST_DEFAULT_FILENAME_PATTERN, false},
+    // e.g. ".sql,.psql,.pgsql" for existing script collections
+    {"extensions", CONST_ENV_VAR_EXTENSIONS, CONST_DEFAULT_EXTENSIONS, false},
+    // name of the environment, e.g. staging or production
+    {"environment", CONST_ENV_VAR_ENVIRONMENT, "", false},
+    // comma separated environments where risky operations need confirmation
+    {"protected-environments", CONST_ENV_VAR_PROTECTED_ENVIRONMENTS, "production", false},
+    // warn about migrations which took longer in another environment
+    {"duration-budget", CONST_ENV_VAR_DURATION_BUDGET, "1m", false},
+    // tell CDC consumers about schema changes
+    {"schema-signal-table", CONST_ENV_VAR_SCHEMA_SIGNAL_TABLE, "", false},
+    {"schema-notify-channel", CONST_ENV_VAR_SCHEMA_NOTIFY_CHANNEL, "", false},
+    // protected environments only apply migrations approved by another role
+    {"require-approval", CONST_ENV_VAR_REQUIRE_APPROVAL, "false", false},
+    // keep the schema file of code generators (e.g. sqlc) in sync with the applied migrations
+    {"schema-export", CONST_ENV_VAR_SCHEMA_EXPORT, "", false},
+    {"schema-export-format", CONST_ENV_VAR_SCHEMA_EXPORT_FORMAT, CONST_SCHEMA_FORMAT_SQLC, false},
+    // Sentry DSN or URL which failed migrations are reported to, the DSN contains a key
+    {"error-sink", CONST_ENV_VAR_ERROR_SINK, "", true},
+    // role with reserved connection slots, for incidents in which the application took all others
+    {"maintenance-user", CONST_ENV_VAR_MAINTENANCE_USER, "", false},
+    {"maintenance-password", CONST_ENV_VAR_MAINTENANCE_PASSWORD, "", true},
+    {"maintenance-parameters", CONST_ENV_VAR_MAINTENANCE_PARAMETERS, "", false},
+    // SET LOCAL in each migration, e.g. "maintenance_work_mem=1GB"
+    {"set-local", CONST_ENV_VAR_SET_LOCAL, "", false},
+    // settings which "-- migrate:set" annotations may change
+    {"set-allowlist", CONST_ENV_VAR_SET_ALLOWLIST, CONST_DEFAULT_SET_ALLOWLIST, false},
+    // advisory lock of 'up' and 'down', default per tracking table
+    {"lock-key", CONST_ENV_VAR_LOCK_KEY, "", false},
+}
+
+// flags for all settings, e.g. for wrapper scripts which do not want to rely on environment or stored files
+var flagHost = commandLineFlags.String("host", "", "database host")
+var flagPort = commandLineFlags.String("port", "", "database port")
+var flagUser = commandLineFlags.String("user", "", "database user")
+var flagPassword = commandLineFlags.String("password", "", "database password (prefer --password-file, command lines are visible to other users)")
+var flagPasswordFile = commandLineFlags.String("password-file", "", "read database password from this file")
+var flagDatabase = commandLineFlags.String("database", "", "database name")
+var flagParameters = commandLineFlags.String("parameters", "", "additional connection parameters, e.g. sslmode=require")
+var flagCredentialHelper = commandLineFlags.String("credential-helper", "", "command which prints the database password, e.g. from the OS keychain")
+var flagEnvironment = commandLineFlags.String("environment", "", "name of the environment, e.g. staging or production")
+
+// settings which make up the database connection
+var connectionSettingNames = []string{"host", "port", "user", "password", "database", "parameters"}
+
+var resolvedConfiguration map[string]configValue
+
+// path of the optional config file
+func getConfigFilePath() string {
+    return path.Join(CONST_MIGRATIONS_FOLDER, CONST_CONFIG_FILENAME)
+}
+
+// read config file, returns raw values by key (empty if there is no config file)
+func readConfigFile() map[string]json.RawMessage {
+    values := make(map[string]json.RawMessage)
+
+    fileContent, err := ioutil.ReadFile(getConfigFilePath())
+    if os.IsNotExist(err) {
+        return values
+    }
+    if err != nil {
+        logError("Error: Could not read config file %s", getConfigFilePath())
+        panic(err)
+    }
+
+    err = json.Unmarshal(fileContent, &values)
+    if err != nil {
+        logError("Error: Config file %s is not valid JSON", getConfigFilePath())
+        panic(err)
+    }
+
+    return values
+}
+
+// get simple value from config file as string (numbers and booleans are allowed as well)
+func getConfigFileString(values map[string]json.RawMessage, key string) (string, bool) {
+    rawValue, ok := values[key]
+    if !ok {
+        return "", false
+    }
+
+    var value interface{}
+    err := json.Unmarshal(rawValue, &value)
+    if err != nil || value == nil {
+        return "", false
+    }
+
+    switch value.(type) {
+    case string, float64, bool:
+        return fmt.Sprint(value), true
+    }
+
+    logError("Error: Setting %s in config file %s needs to be a string", key, getConfigFilePath())
+    os.Exit(1)
+    return "", false
+}
+
+// split connection string in key=value format into key & value pairs, like libpq (and pgconn) do:
+// spaces around '=' are allowed, values may be single-quoted, backslash escapes quotes, backslashes and spaces,
+// e.g. password='a b' or password=it\'s
+func parseKeyValueConnectionString(connectionString string) ([][2]string, error) {
+    var keyValues [][2]string
+
+    remaining := strings.TrimLeft(connectionString, " \t\n\r")
+    for len(remaining) > 0 {
+        equalsIndex := strings.IndexByte(remaining, '=')
+        if equalsIndex < 0 {
+            // not quoting the rest, it may contain a password
+            return nil, fmt.Errorf("missing '=' after %d characters", len(connectionString)-len(remaining))
+        }
+
+        key := strings.TrimSpace(remaining[:equalsIndex])
+        if len(key) == 0 || strings.ContainsAny(key, " \t\n\r") {
+            return nil, fmt.Errorf("invalid key %q", key)
+        }
+        remaining = strings.TrimLeft(remaining[equalsIndex+1:], " \t\n\r")
+
+        var value strings.Builder
+        quoted := strings.HasPrefix(remaining, "'")
+        if quoted {
+            remaining = remaining[1:]
+        }
+
+        closed := !quoted
+        index := 0
+        for ; index < len(remaining); index++ {
+            character := remaining[index]
+            if character == '\\' && index+1 < len(remaining) {
+                index++
+                value.WriteByte(remaining[index])
+                continue
+            }
+            if quoted && character == '\'' {
+                closed = true
+                index++
+                break
+            }
+            if !quoted && strings.IndexByte(" \t\n\r", character) >= 0 {
+                break
+            }
+            value.WriteByte(character)
+        }
+
+        if !closed {
+            return nil, fmt.Errorf("unterminated quoted value of %s", key)
+        }
+
+        keyValues = append(keyValues, [2]string{key, value.String()})
+        remaining = strings.TrimLeft(remaining[index:], " \t\n\r")
+    }
+
+    return keyValues, nil
+}
+
+// split connection string (URL or key=value format) into settings
+func parseConnectionString(connectionString string) map[string]string {
+    settings := make(map[string]string)
+    parameters := url.Values{}
+
+    if strings.HasPrefix(connectionString, "postgres://") || strings.HasPrefix(connectionString, "postgresql://") {
+        parsedURL, err := url.Parse(connectionString)
+        if err != nil {
+            logError("Error: Could not parse connection string")
+            panic(err)
+        }
+
+        if parsedURL.User != nil {
+            settings["user"] = parsedURL.User.Username()
+            settings["password"], _ = parsedURL.User.Password()
+        }
+
+        settings["host"] = parsedURL.Hostname()
+        settings["port"] = parsedURL.Port()
+        settings["database"] = strings.TrimPrefix(parsedURL.Path, "/")
+        parameters = parsedURL.Query()
+    } else {
+        keyValues, err := parseKeyValueConnectionString(connectionString)
+        if err != nil {
+            logError("Error: Could not parse connection string")
+            panic(err)
+        }
+
+        for _, keyValue := range keyValues {
+            switch keyValue[0] {
+            case "host", "port", "user", "password":
+                settings[keyValue[0]] = keyValue[1]
+            case "dbname":
+                settings["database"] = keyValue[1]
+            default:
+                parameters.Set(keyValue[0], keyValue[1])
+            }
+        }
+    }
+
+    settings["parameters"] = parameters.Encode()
+
+    // drop empty values, so they do not override defaults
+    for key, value := range settings {
+        if len(value) == 0 {
+            delete(settings, key)
+        }
+    }
+
+    return settings
+}
+
+// read connection settings stored by 'init' (empty if there is no such file)
+func readStoredConnectionSettings() map[string]string {
+    filePath := path.Join(CONST_MIGRATIONS_FOLDER, CONST_DATABASE_INFO_FILENAME)
+    connectionString, err := ioutil.ReadFile(filePath)
+    if os.IsNotExist(err) {
+        return map[string]string{}
+    }
+
+    // file cannot be read
+    if err != nil {
+        logError("Error: Could not read connection details from: %s", filePath)
+        panic(err)
+    }
+
+    return parseConnectionString(strings.TrimSpace(string(connectionString)))
+}
+
+// names of flags given on the command line
+func getFlagsSetOnCommandLine() map[string]bool {
+    flagsSet := make(map[string]bool)
+    commandLineFlags.Visit(func(f *flag.Flag) {
+        flagsSet[f.Name] = true
+    })
+
+    return flagsSet
+}
+
+// resolve all settings from all sources, only done once
+func resolveConfiguration() map[string]configValue {
+    if resolvedConfiguration != nil {
+        return resolvedConfiguration
+    }
+
+    flagsSet := getFlagsSetOnCommandLine()
+    configFileValues := readConfigFile()
+    storedConnectionSettings := readStoredConnectionSettings()
+
+    resolvedConfiguration = make(map[string]configValue)
+    for _, setting := range configSettings {
+        if flagsSet[setting.name] {
+            resolvedConfiguration[setting.name] = configValue{
+                commandLineFlags.Lookup(setting.name).Value.String(), "flag --" + setting.name}
+            continue
+        }
+
+        // value read from file, e.g. --password-file
+        if flagsSet[setting.name+"-file"] {
+            filePath := commandLineFlags.Lookup(setting.name + "-file").Value.String()
+            fileContent, err := ioutil.ReadFile(filePath)
+            if err != nil {
+                logError("Error: Could not read %s from file %s", setting.name, filePath)
+                panic(err)
+            }
+
+            resolvedConfiguration[setting.name] = configValue{
+                strings.TrimRight(string(fileContent), "\r\n"), "flag --" + setting.name + "-file"}
+            continue
+        }
+
+        if value, ok := getValueFromEnvironment(setting.envVar); ok {
+            envVarName := setting.envVar
+            if len(os.Getenv(setting.envVar)) == 0 {
+                envVarName += CONST_ENV_VAR_FILE_SUFFIX
+            }
+            resolvedConfiguration[setting.name] = configValue{value, "environment " + envVarName}
+            continue
+        }
+
+        if value, ok := getConfigFileString(configFileValues, setting.name); ok {
+            resolvedConfiguration[setting.name] = configValue{value, "config file " + getConfigFilePath()}
+            continue
+        }
+
+        if value, ok := storedConnectionSettings[setting.name]; ok {
+            resolvedConfiguration[setting.name] = configValue{value,
+                "stored file " + path.Join(CONST_MIGRATIONS_FOLDER, CONST_DATABASE_INFO_FILENAME)}
+            continue
+        }
+
+        resolvedConfiguration[setting.name] = configValue{setting.defaultValue, "default"}
+    }
+
+    // no secrets on disk: the password comes from the credential helper unless it is configured otherwise
+    helper := resolvedConfiguration["credential-helper"].value
+    if len(helper) > 0 && resolvedConfiguration["password"].source == "default" {
+        resolvedConfiguration["password"] = configValue{
+            getPasswordFromCredentialHelper(helper, resolvedConfiguration), "credential helper " + helper}
+    }
+
+    return resolvedConfiguration
+}
+
+// get effective value of setting
+func getConfigValue(name string) string {
+    return resolveConfiguration()[name].value
+}
+
+// check if any connection setting has been configured (not only defaults)
+func isDatabaseConnectionConfigured() bool {
+    for _, name := range connectionSettingNames {
+        if resolveConfiguration()[name].source != "default" {
+            return true
+        }
+    }
+
+    return false
+}
+
+// check if the current environment is one of the protected environments
+func isProtectedEnvironment() bool {
+    environment := getConfigValue("environment")
+    if len(environment) == 0 {
+        return false
+    }
+
+    for _, protectedEnvironment := range strings.Split(getConfigValue("protected-environments"), ",") {
+        if strings.TrimSpace(protectedEnvironment) == environment {
+            return true
+        }
+    }
+
+    return false
+}
+
+// build connection string from settings
+func buildConnectionString(host string, port string, user string, password string, database string, parameters string) string {
+    connectionURL := url.URL{
+        Scheme:   "postgresql",
+        User:     url.UserPassword(user, password),
+        Host:     net.JoinHostPort(host, port),
+        Path:     "/" + database,
+        RawQuery: parameters,
+    }
+
+    return connectionURL.String()
+}
+
+// get connection string and where its settings came from
+func getDatabaseConnectionString() (string, string) {
+    connectionString, sources, err := readDatabaseConnectionString()
+    if err != nil {
+        logError("Error: %s", err)
+        logError("Hint: Maybe you should run 'init' first?")
+        os.Exit(1)
+    }
+
+    return connectionString, sources
+}
+
+// see getDatabaseConnectionString, error instead of exit if no connection is configured
+func readDatabaseConnectionString() (string, string, error) {
+    if !isDatabaseConnectionConfigured() {
+        return "", "", fmt.Errorf("Could not read connection details from: %s",
+            path.Join(CONST_MIGRATIONS_FOLDER, CONST_DATABASE_INFO_FILENAME))
+    }
+
+    configuration := resolveConfiguration()
+
+    // list distinct sources
+    var sources []string
+    seen := make(map[string]bool)
+    for _, name := range connectionSettingNames {
+        source := configuration[name].source
+        if !seen[source] {
+            seen[source] = true
+            sources = append(sources, source)
+        }
+    }
+    sort.Strings(sources)
+
+    connectionString := buildConnectionString(
+        configuration["host"].value, configuration["port"].value,
+        configuration["user"].value, configuration["password"].value,
+        configuration["database"].value, configuration["parameters"].value)
+
+    return connectionString, strings.Join(sources, ", "), nil
+}
+
+// print effective configuration with the source of each value
+func cmd_config_show() {
+    writeConfiguration(os.Stdout)
+
+    os.Exit(0)
+}
+
+// write effective configuration as table, secrets masked
+func writeConfiguration(output io.Writer) {
+    configuration := resolveConfiguration()
+
+    writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(writer, "SETTING\tVALUE\tSOURCE")
+
+    for _, setting := range configSettings {
+        value := configuration[setting.name].value
+        if setting.secret {
+            value = maskPassword(value)
+        }
+
+        fmt.Fprintf(writer, "%s\t%s\t%s\n", setting.name, value, configuration[setting.name].source)
+    }
+
+    environment := configuration["environment"].value
+    for _, name := range getTemplateVariableNames(environment) {
+        fmt.Fprintf(writer, "${%s}\t%s\tconfig file %s (%s.%s)\n", name, getTemplateVariables()[environment][name],
+            getConfigFilePath(), CONST_CONFIG_VARIABLES, environment)
+    }
+
+    writer.Flush()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestParseKeyValueConnectionString(t *testing.T) {
+    tests := []struct {
+        name             string
+        connectionString string
+        expected         [][2]string
+        expectedError    string
+    }{
+        {
+            name:             "plain values",
+            connectionString: "host=localhost port=5432 dbname=app",
+            expected:         [][2]string{{"host", "localhost"}, {"port", "5432"}, {"dbname", "app"}},
+        },
+        {
+            name:             "whitespace around keys and values",
+            connectionString: "  host = localhost\tdbname=\napp  ",
+            expected:         [][2]string{{"host", "localhost"}, {"dbname", "app"}},
+        },
+        {
+            name:             "quoted value with spaces",
+            connectionString: "password='secret with spaces' user=app",
+            expected:         [][2]string{{"password", "secret with spaces"}, {"user", "app"}},
+        },
+        {
+            name:             "escaped quote and backslash in quoted value",
+            connectionString: `password='it\'s \\ here'`,
+            expected:         [][2]string{{"password", `it's \ here`}},
+        },
+        {
+            name:             "escaped space in unquoted value",
+            connectionString: `password=two\ words host=db`,
+            expected:         [][2]string{{"password", "two words"}, {"host", "db"}},
+        },
+        {
+            name:             "empty quoted value",
+            connectionString: "password='' host=db",
+            expected:         [][2]string{{"password", ""}, {"host", "db"}},
+        },
+        {
+            name:             "empty value at the end",
+            connectionString: "host=db password=",
+            expected:         [][2]string{{"host", "db"}, {"password", ""}},
+        },
+        {
+            name:             "equals sign in value",
+            connectionString: "options='-c search_path=app'",
+            expected:         [][2]string{{"options", "-c search_path=app"}},
+        },
+        {
+            name:             "empty connection string",
+            connectionString: "",
+            expected:         nil,
+        },
+        {
+            name:             "missing equals sign",
+            connectionString: "host=db secret",
+            expectedError:    "missing '=' after 8 characters",
+        },
+        {
+            name:             "empty key",
+            connectionString: "=db",
+            expectedError:    `invalid key ""`,
+        },
+        {
+            name:             "unterminated quoted value",
+            connectionString: "host=db password='secret",
+            expectedError:    "unterminated quoted value of password",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            keyValues, err := parseKeyValueConnectionString(test.connectionString)
+            if len(test.expectedError) > 0 {
+                if err == nil || err.Error() != test.expectedError {
+                    t.Fatalf("got error %v, want %q", err, test.expectedError)
+                }
+                if strings.Contains(err.Error(), "secret") {
+                    t.Errorf("error %q contains the password", err)
+                }
+                return
+            }
+
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            if !reflect.DeepEqual(keyValues, test.expected) {
+                t.Errorf("got %q, want %q", keyValues, test.expected)
+            }
+        })
+    }
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+    "context"
+    "os"
+    "strconv"
+    "sync"
+
+    "github.com/jackc/pgx/v4"
+)
+
+// Every command works on one connection (postgreSQLConnection, opened once), plus a monitoring connection
+// which is only opened while a slow migration runs. Exceptions open short-lived connections on purpose:
+// 'compare' (one per database), 'env' and 'rehearse' (maintenance database, while 'up' runs in a child process)
+// and 'up --schemas' (one child process per schema). With --max-conns all of them count against one budget.
+var flagMaxConns = commandLineFlags.Int("max-conns", 0, "maximum number of database connections open at the same time, including child processes (0: no limit)")
+
+var openConnectionCount int
+var openConnectionCountMutex sync.Mutex
+
+// reserve a connection, false if --max-conns connections are open already
+func tryReserveConnection() bool {
+    openConnectionCountMutex.Lock()
+    defer openConnectionCountMutex.Unlock()
+
+    if *flagMaxConns > 0 && openConnectionCount >= *flagMaxConns {
+        return false
+    }
+
+    openConnectionCount++
+    return true
+}
+
+// reserve a connection the command cannot do without, exits if --max-conns connections are open already
+func reserveConnection() {
+    if !tryReserveConnection() {
+        logError("Error: This command needs more than --max-conns %d database connection(s)", *flagMaxConns)
+        logError("Hint: Raise --max-conns, e.g. 'compare' needs 2 and 'up --schemas' 1 per --parallel schema")
+        os.Exit(1)
+    }
+}
+
+// release a connection reserved with reserveConnection or tryReserveConnection
+func releaseConnection() {
+    openConnectionCountMutex.Lock()
+    defer openConnectionCountMutex.Unlock()
+
+    openConnectionCount--
+}
+
+// close connection opened by openPostgreSQLConnection
+func closePostgreSQLConnection(connection *pgx.Conn) {
+    connection.Close(context.Background())
+    releaseConnection()
+}
+
+// connections left for child processes, which get them as their --max-conns; 0 if there is no limit
+func getRemainingConnections() int {
+    if *flagMaxConns <= 0 {
+        return 0
+    }
+
+    openConnectionCountMutex.Lock()
+    defer openConnectionCountMutex.Unlock()
+
+    remaining := *flagMaxConns - openConnectionCount
+    if remaining < 1 {
+        logError("Error: No database connection left for the child process with --max-conns %d", *flagMaxConns)
+        os.Exit(1)
+    }
+
+    return remaining
+}
+
+// --max-conns of a child process, unless overridden
+func getChildMaxConnsFlag(overriddenFlags map[string]string) (string, bool) {
+    if _, overridden := overriddenFlags["max-conns"]; overridden {
+        return "", false
+    }
+
+    remaining := getRemainingConnections()
+    if remaining == 0 {
+        return "", false
+    }
+
+    return strconv.Itoa(remaining), true
+}
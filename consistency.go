@@ -0,0 +1,114 @@
+package main
+
+import (
+    "os"
+    "path"
+    "strings"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    CONST_CONSISTENCY_STRICT  = "strict"
+    CONST_CONSISTENCY_LENIENT = "lenient"
+
+    CONST_CONSISTENCY_ALLOWLIST_FILENAME = "consistency-allowlist.txt"
+)
+
+var flagConsistency = commandLineFlags.String("consistency", CONST_CONSISTENCY_STRICT,
+    "'strict' exits on any mismatch between database and local files, 'lenient' reports mismatches and lets those listed in "+CONST_CONSISTENCY_ALLOWLIST_FILENAME+" pass")
+
+// local file name -> file name stored in database, for renamed migrations
+var databaseFileNames = make(map[string]string)
+
+// get file name under which a local migration is stored in the database
+func getDatabaseFileName(fileName string) string {
+    if databaseFileName, ok := databaseFileNames[fileName]; ok {
+        return databaseFileName
+    }
+
+    return fileName
+}
+
+// path of the list of allowed mismatches
+func getConsistencyAllowlistFilePath() string {
+    return path.Join(CONST_MIGRATIONS_FOLDER, CONST_CONSISTENCY_ALLOWLIST_FILENAME)
+}
+
+// read allowed mismatches, one per line: 'missing file', 'renamed old-file new-file' or 'out-of-order file'
+func readConsistencyAllowlist() *migrate.Allowlist {
+    file, err := os.Open(getConsistencyAllowlistFilePath())
+    if os.IsNotExist(err) {
+        allowlist, _ := migrate.ParseAllowlist(strings.NewReader(""))
+        return allowlist
+    }
+    if err != nil {
+        logError("Error: Could not read file %s", getConsistencyAllowlistFilePath())
+        panic(err)
+    }
+    defer file.Close()
+
+    allowlist, err := migrate.ParseAllowlist(file)
+    if err != nil {
+        logError("Error: Could not read file %s: %s", getConsistencyAllowlistFilePath(), err)
+        os.Exit(1)
+    }
+
+    return allowlist
+}
+
+// get mismatches which pass, nil in strict mode
+func getConsistencyAllowlist() *migrate.Allowlist {
+    switch *flagConsistency {
+    case CONST_CONSISTENCY_LENIENT:
+        return readConsistencyAllowlist()
+    case CONST_CONSISTENCY_STRICT:
+        return nil
+    }
+
+    logError("Error: Unknown consistency mode %s, use one of: %s, %s",
+        *flagConsistency, CONST_CONSISTENCY_STRICT, CONST_CONSISTENCY_LENIENT)
+    os.Exit(1)
+    return nil
+}
+
+// report mismatches between database and local files, allowed ones as warnings
+func printConsistencyMismatches(mismatches []migrate.Mismatch) {
+    for _, mismatch := range mismatches {
+        if mismatch.Allowed {
+            logError("Warning: %s (allowed)", capitalize(mismatch.String()))
+        } else {
+            logError("Error: %s", capitalize(mismatch.String()))
+        }
+    }
+}
+
+// exit because of mismatches which do not pass
+func exitOnConsistencyMismatches(mismatchError *migrate.MismatchError) {
+    printConsistencyMismatches(mismatchError.Mismatches)
+
+    if *flagConsistency == CONST_CONSISTENCY_STRICT {
+        logError("Hint: Use '--consistency lenient' to report all mismatches and allow some of them")
+        os.Exit(2)
+    }
+
+    notAllowed := 0
+    for _, mismatch := range mismatchError.Mismatches {
+        if !mismatch.Allowed {
+            notAllowed++
+        }
+    }
+
+    logError("Error: Found %d mismatch(es) between database and local folder %s", notAllowed, migrationsFolder)
+    logError("Hint: List mismatches which should pass in %s", getConsistencyAllowlistFilePath())
+    os.Exit(2)
+}
+
+// first letter in upper case, for messages of the library
+func capitalize(message string) string {
+    if len(message) == 0 {
+        return message
+    }
+
+    return strings.ToUpper(message[:1]) + message[1:]
+}
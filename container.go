@@ -0,0 +1,132 @@
+package main
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "net"
+    "os"
+    "os/exec"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    CONST_CONTAINER_DATABASE = "test"
+    CONST_CONTAINER_USER     = "postgres"
+
+    // the image initializes the database before it listens on TCP
+    CONST_CONTAINER_STARTUP_TIMEOUT = 60 * time.Second
+)
+
+// same default as migratetest.DefaultImage, keep them in sync
+var flagPostgresImage = commandLineFlags.String("postgres-image", "postgres:13-alpine", "for 'test-database': docker image of the disposable database")
+
+// run docker command, returns its trimmed output
+func runDocker(args ...string) (string, error) {
+    command := exec.Command("docker", args...)
+    command.Stderr = os.Stderr
+
+    output, err := command.Output()
+    return strings.TrimSpace(string(output)), err
+}
+
+// start disposable PostgreSQL container (removed when it stops), wait until it accepts connections,
+// returns its connection string and the container id
+func startDisposablePostgreSQL(image string) (string, string) {
+    passwordBytes := make([]byte, 16)
+    _, err := rand.Read(passwordBytes)
+    if err != nil {
+        panic(err)
+    }
+    password := hex.EncodeToString(passwordBytes)
+
+    containerId, err := runDocker("run", "--detach", "--rm",
+        "--env", "POSTGRES_USER="+CONST_CONTAINER_USER, "--env", "POSTGRES_PASSWORD="+password, "--env", "POSTGRES_DB="+CONST_CONTAINER_DATABASE,
+        "--publish", "127.0.0.1::5432", image)
+    if err != nil {
+        logError("Error: Could not start container from image %s", image)
+        logError("Hint: 'test-database' needs docker in PATH and a running docker daemon")
+        panic(err)
+    }
+
+    // random port on the host
+    address, err := runDocker("port", containerId, "5432/tcp")
+    if err != nil {
+        stopDisposablePostgreSQL(containerId)
+        logError("Error: Could not read port of container %s", containerId)
+        panic(err)
+    }
+    host, port, err := net.SplitHostPort(strings.Split(address, "\n")[0])
+    if err != nil {
+        stopDisposablePostgreSQL(containerId)
+        logError("Error: Unexpected port of container %s: %s", containerId, address)
+        panic(err)
+    }
+
+    connectionString := buildConnectionString(host, port, CONST_CONTAINER_USER, password, CONST_CONTAINER_DATABASE, "sslmode=disable")
+
+    startedAt := time.Now()
+    for {
+        connection, err := pgx.Connect(context.Background(), connectionString)
+        if err == nil {
+            connection.Close(context.Background())
+            break
+        }
+
+        if time.Since(startedAt) > CONST_CONTAINER_STARTUP_TIMEOUT {
+            stopDisposablePostgreSQL(containerId)
+            logError("Error: Container %s did not accept connections within %s", containerId, CONST_CONTAINER_STARTUP_TIMEOUT)
+            panic(err)
+        }
+
+        time.Sleep(500 * time.Millisecond)
+    }
+
+    return connectionString, containerId
+}
+
+// stop and remove disposable container
+func stopDisposablePostgreSQL(containerId string) {
+    _, err := runDocker("rm", "--force", containerId)
+    if err != nil {
+        logError("Warning: Could not remove container %s, remove it with 'docker rm --force %s'", containerId, containerId)
+    }
+}
+
+// start disposable PostgreSQL in docker, run all migrations and print its connection string,
+// e.g. for integration tests: DATABASE_URL=$(go-simple-postgresql-migrate test-database);
+// Go tests do the same with migratetest.StartTestDatabase of module migrate/migratetest
+func cmd_test_database() {
+    connectionString, containerId := startDisposablePostgreSQL(*flagPostgresImage)
+    connectionSettings := parseConnectionString(connectionString)
+
+    // 'up' in a child process, with the connection settings of the container only
+    command := exec.Command(os.Args[0], getChildCommandLineArgs("up",
+        map[string]bool{"postgres-image": true, "password-file": true, "credential-helper": true, "ssh-host": true, "proxy": true},
+        map[string]string{
+            "host":        connectionSettings["host"],
+            "port":        connectionSettings["port"],
+            "user":        CONST_CONTAINER_USER,
+            "password":    connectionSettings["password"],
+            "database":    CONST_CONTAINER_DATABASE,
+            "parameters":  "sslmode=disable",
+            "environment": "test-database",
+        })...)
+    command.Stdout = os.Stderr
+    command.Stderr = os.Stderr
+    err := command.Run()
+    if err != nil {
+        stopDisposablePostgreSQL(containerId)
+        logError("Error: Migrations failed in container %s: %s", containerId, err)
+        os.Exit(1)
+    }
+
+    logError("container %s is ready, remove it with 'docker rm --force %s'", containerId, containerId)
+    fmt.Println(connectionString)
+
+    os.Exit(0)
+}
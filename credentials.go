@@ -0,0 +1,47 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "os"
+    "os/exec"
+    "runtime"
+    "strings"
+)
+
+const (
+    CONST_ENV_VAR_CREDENTIAL_HELPER = "MIGRATE_CREDENTIAL_HELPER"
+)
+
+// run credential helper like git does: it gets host, port, user and database as key=value lines on STDIN
+// and prints the password, either as the first line or as a line password=...
+func getPasswordFromCredentialHelper(helper string, configuration map[string]configValue) string {
+    var command *exec.Cmd
+    if runtime.GOOS == "windows" {
+        command = exec.Command("cmd", "/C", helper)
+    } else {
+        command = exec.Command("sh", "-c", helper)
+    }
+
+    var input bytes.Buffer
+    for _, name := range []string{"host", "port", "user", "database"} {
+        fmt.Fprintf(&input, "%s=%s\n", name, configuration[name].value)
+    }
+    command.Stdin = &input
+    command.Stderr = os.Stderr
+
+    output, err := command.Output()
+    if err != nil {
+        logError("Error: Credential helper '%s' failed", helper)
+        panic(err)
+    }
+
+    lines := strings.Split(strings.TrimRight(string(output), "\r\n"), "\n")
+    for _, line := range lines {
+        if strings.HasPrefix(line, "password=") {
+            return strings.TrimRight(strings.TrimPrefix(line, "password="), "\r")
+        }
+    }
+
+    return strings.TrimRight(lines[0], "\r")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+    "os"
+    "regexp"
+    "strings"
+    "unicode"
+
+    "golang.org/x/text/unicode/norm"
+)
+
+const (
+    // keeps file names well below the limits of file systems and tar archives
+    CONST_MAX_DESCRIPTION_LENGTH = 100
+)
+
+// letters which do not decompose into ASCII letter + accent
+var descriptionTransliterations = map[rune]string{
+    'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O",
+    'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D", 'þ': "th", 'Þ': "TH", 'ı': "i",
+}
+
+var regexpDescriptionWhitespace = regexp.MustCompile(`\s+`)
+var regexpDescriptionUnsafe = regexp.MustCompile("[^a-zA-Z0-9-_]")
+
+// turn description into the part of a migration file name, e.g. "Größe hinzufügen" -> "Grosse-hinzufugen"
+func sanitizeMigrationDescription(description string) string {
+    // é -> e + accent, accents are dropped below
+    decomposed := norm.NFKD.String(strings.TrimSpace(description))
+
+    var transliterated strings.Builder
+    for _, character := range decomposed {
+        if unicode.Is(unicode.Mn, character) {
+            continue
+        }
+
+        if replacement, ok := descriptionTransliterations[character]; ok {
+            transliterated.WriteString(replacement)
+            continue
+        }
+
+        transliterated.WriteRune(character)
+    }
+
+    sanitized := regexpDescriptionWhitespace.ReplaceAllString(transliterated.String(), "-")
+    sanitized = regexpDescriptionUnsafe.ReplaceAllString(sanitized, "")
+
+    if len(strings.Trim(sanitized, "-_")) == 0 {
+        logError("Error: Description %q contains no letters or digits which can be used in a file name", description)
+        logError("Hint: Use a description with latin letters or digits, e.g. add-users-table")
+        os.Exit(1)
+    }
+
+    if len(sanitized) > CONST_MAX_DESCRIPTION_LENGTH {
+        logError("Error: Description is too long for a file name (%d characters, at most %d)",
+            len(sanitized), CONST_MAX_DESCRIPTION_LENGTH)
+        logError("Hint: Use a shorter description and put the details into a comment in the migration file")
+        os.Exit(1)
+    }
+
+    return sanitized
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "path"
+    "sort"
+    "strings"
+)
+
+const (
+    // down migrations which have run cleanly in 'up --rollback-at-end --verify-down', committed with the migrations
+    CONST_VERIFIED_DOWN_FILENAME = "verified-down.txt"
+)
+
+var flagVerifyDown = commandLineFlags.Bool("verify-down", false, "for 'up --rollback-at-end': also run all down migrations before rolling back, and record them as verified")
+var flagForce = commandLineFlags.Bool("force", false, "for 'down': revert even if the down migration has never been verified in a protected environment")
+
+// path of the list of verified down migrations
+func getVerifiedDownFilePath() string {
+    return path.Join(CONST_MIGRATIONS_FOLDER, CONST_VERIFIED_DOWN_FILENAME)
+}
+
+// get checksum of migration file
+func getMigrationFileChecksum(fileName string) string {
+    fileContent, err := readMigrationFile(fileName)
+    if err != nil {
+        logError("Error: Could not read migration file %s", fileName)
+        panic(err)
+    }
+
+    return getChecksum(fileContent)
+}
+
+// read verified down migrations, file name -> checksum of the migration file when it was verified
+func readVerifiedDownMigrations() map[string]string {
+    verifiedMigrations := make(map[string]string)
+
+    file, err := os.Open(getVerifiedDownFilePath())
+    if os.IsNotExist(err) {
+        return verifiedMigrations
+    }
+    if err != nil {
+        logError("Error: Could not read file %s", getVerifiedDownFilePath())
+        panic(err)
+    }
+    defer file.Close()
+
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) == 2 {
+            verifiedMigrations[fields[1]] = fields[0]
+        }
+    }
+
+    err = scanner.Err()
+    if err != nil {
+        logError("Error: Could not read file %s", getVerifiedDownFilePath())
+        panic(err)
+    }
+
+    return verifiedMigrations
+}
+
+// add migrations to the list of verified down migrations
+func recordVerifiedDownMigrations(fileNames []string) {
+    verifiedMigrations := readVerifiedDownMigrations()
+    for _, fileName := range fileNames {
+        verifiedMigrations[fileName] = getMigrationFileChecksum(fileName)
+    }
+
+    var lines []string
+    for fileName, checksum := range verifiedMigrations {
+        lines = append(lines, checksum+" "+fileName)
+    }
+    sort.Slice(lines, func(i, j int) bool {
+        return strings.Fields(lines[i])[1] < strings.Fields(lines[j])[1]
+    })
+
+    writeStringToFile(getVerifiedDownFilePath(), strings.Join(lines, "\n")+"\n")
+
+    fmt.Printf("recorded %d verified down migration(s) in %s\n", len(fileNames), getVerifiedDownFilePath())
+}
+
+// run down migrations of the just applied migrations in reverse order, within the --rollback-at-end transaction
+func verifyDownMigrations(appliedMigrations []string) {
+    for index := len(appliedMigrations) - 1; index >= 0; index-- {
+        fileName := appliedMigrations[index]
+
+        status := getMigrationStatus()
+        mostRecentMigration := status.Applied[len(status.Applied)-1]
+        if mostRecentMigration.LocalFileName != fileName {
+            logError("Error: Most recent migration in database is %s, not %s", mostRecentMigration.FileName, fileName)
+            os.Exit(2)
+        }
+
+        migrateBackward(mostRecentMigration)
+
+        fmt.Println("verified undo:", fileName)
+    }
+}
+
+// warn before reverting a down migration which has never been verified, refuse in protected environments without --force
+func checkDownMigrationVerified(fileName string) {
+    if readVerifiedDownMigrations()[fileName] == getMigrationFileChecksum(fileName) {
+        return
+    }
+
+    if isProtectedEnvironment() && !*flagForce {
+        logError("Error: Down migration of %s has never been verified, refusing to run it in protected environment %s",
+            fileName, getConfigValue("environment"))
+        logError("Hint: Verify it with 'up --rollback-at-end --verify-down' before it is applied, or use --force")
+        os.Exit(1)
+    }
+
+    logError("Warning: Down migration of %s has never been verified", fileName)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+
+    "github.com/jackc/pgx/v4"
+)
+
+// pgx logger writing the driver's view of the connection to STDERR (--verbose)
+type driverLogger struct{}
+
+// log a single driver event, e.g. "[pgx] info Exec sql=... time=1.2ms"
+func (l *driverLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+    // sort keys for stable output
+    keys := make([]string, 0, len(data))
+    for key := range data {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    var fields []string
+    for _, key := range keys {
+        fields = append(fields, fmt.Sprintf("%s=%v", key, data[key]))
+    }
+
+    fmt.Fprintf(os.Stderr, "[pgx] %s %s %s\n", level, msg, strings.Join(fields, " "))
+}
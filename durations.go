@@ -0,0 +1,127 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path"
+    "strings"
+    "time"
+)
+
+const (
+    // durations exported from another environment (e.g. staging) by 'export-durations'
+    CONST_DURATIONS_FILENAME = "durations.json"
+
+    CONST_ENV_VAR_DURATION_BUDGET = "MIGRATE_DURATION_BUDGET"
+)
+
+var flagDurationBudget = commandLineFlags.String("duration-budget", "", "for 'up': warn about migrations which took longer than this in another environment, e.g. 5m")
+var flagYes = commandLineFlags.Bool("yes", false, "confirm risky operations in protected environments without asking")
+
+// durations of applied migrations in one environment
+type migrationDurations struct {
+    Environment string           `json:"environment"`
+    DurationsMs map[string]int64 `json:"durations_ms"`
+}
+
+// path of durations exported from another environment
+func getDurationsFilePath() string {
+    return path.Join(CONST_MIGRATIONS_FOLDER, CONST_DURATIONS_FILENAME)
+}
+
+// read durations from another environment, empty if there are none
+func readMigrationDurations() migrationDurations {
+    durations := migrationDurations{DurationsMs: map[string]int64{}}
+
+    fileContent, err := ioutil.ReadFile(getDurationsFilePath())
+    if os.IsNotExist(err) {
+        return durations
+    }
+    if err != nil {
+        logError("Error: Could not read file %s", getDurationsFilePath())
+        panic(err)
+    }
+
+    err = json.Unmarshal(fileContent, &durations)
+    if err != nil {
+        logError("Error: File %s is not valid JSON", getDurationsFilePath())
+        panic(err)
+    }
+
+    return durations
+}
+
+// ask user to confirm, unless --yes is given
+func confirm(question string) bool {
+    if *flagYes {
+        return true
+    }
+
+    fmt.Println(question)
+    return strings.ToLower(readFromStdIn("type 'yes' to continue", "no")) == "yes"
+}
+
+// warn about pending migrations which took longer than the budget in another environment,
+// protected environments need confirmation
+func checkDurationBudget(pendingMigrations []string) {
+    budgetSetting := getConfigValue("duration-budget")
+    if len(budgetSetting) == 0 {
+        return
+    }
+
+    budget, err := time.ParseDuration(budgetSetting)
+    if err != nil {
+        logError("Error: Invalid duration-budget %s, use e.g. 30s or 5m", budgetSetting)
+        os.Exit(1)
+    }
+
+    durations := readMigrationDurations()
+
+    slowMigrations := 0
+    for _, fileName := range pendingMigrations {
+        durationMs, ok := durations.DurationsMs[fileName]
+        if !ok {
+            continue
+        }
+
+        duration := time.Duration(durationMs) * time.Millisecond
+        if duration > budget {
+            logError("Warning: %s took %s on %s (budget: %s)", fileName, duration, durations.Environment, budget)
+            slowMigrations++
+        }
+    }
+
+    if slowMigrations == 0 || !isProtectedEnvironment() {
+        return
+    }
+
+    if !confirm(fmt.Sprintf("%d migration(s) exceeded the duration budget on %s, apply them to %s now?",
+        slowMigrations, durations.Environment, getConfigValue("environment"))) {
+        logError("Error: Aborted, nothing has been applied")
+        os.Exit(1)
+    }
+}
+
+// print durations of applied migrations as JSON, to be stored as durations.json for other environments
+func cmd_export_durations() {
+    durations := migrationDurations{
+        Environment: getConfigValue("environment"),
+        DurationsMs: make(map[string]int64),
+    }
+
+    for _, migration := range getAppliedMigrations() {
+        if migration.Duration != nil {
+            durations.DurationsMs[migration.FileName] = migration.Duration.Milliseconds()
+        }
+    }
+
+    output, err := json.MarshalIndent(durations, "", "  ")
+    if err != nil {
+        panic(err)
+    }
+    fmt.Println(string(output))
+
+    os.Exit(0)
+}
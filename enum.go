@@ -0,0 +1,225 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "strings"
+)
+
+const (
+    // rebuild enum type with new list of values, columns using the type are converted via text
+    CONST_ENUM_REBUILD_TEMPLATE = `
+-- rebuild enum type %[1]s, this fails if rows still use values which are removed
+-- (column defaults using the type need to be dropped before and re-created after)
+ALTER TYPE %[1]s RENAME TO %[3]s;
+CREATE TYPE %[1]s AS ENUM (%[4]s);
+DO $migrate$
+DECLARE
+    col record;
+BEGIN
+    FOR col IN
+        SELECT a.attrelid::regclass AS table_name, a.attname AS column_name
+        FROM pg_attribute a
+        JOIN pg_class c ON c.oid = a.attrelid
+        WHERE a.atttypid = '%[2]s'::regtype
+        AND a.attnum > 0 AND NOT a.attisdropped
+        AND c.relkind IN ('r', 'p') AND NOT c.relispartition
+    LOOP
+        EXECUTE format('ALTER TABLE %%s ALTER COLUMN %%I TYPE %[1]s USING %%I::text::%[1]s',
+            col.table_name, col.column_name, col.column_name);
+    END LOOP;
+END
+$migrate$;
+DROP TYPE %[2]s;
+`
+)
+
+// quote string as SQL literal
+func quoteSQLLiteral(value string) string {
+    return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// quote list of values as SQL literals, separated by comma
+func quoteSQLLiterals(values []string) string {
+    var quotedValues []string
+    for _, value := range values {
+        quotedValues = append(quotedValues, quoteSQLLiteral(value))
+    }
+
+    return strings.Join(quotedValues, ", ")
+}
+
+// fetch values of enum type in their sort order, second return value is false if type does not exist
+func getEnumValuesFromDatabase(typeName string) ([]string, bool) {
+    var typeType string
+    err := postgreSQLConnection.QueryRow(context.Background(),
+        "SELECT COALESCE((SELECT typtype::text FROM pg_type WHERE oid = to_regtype($1)), '')",
+        typeName).Scan(&typeType)
+    if err != nil {
+        logError("Error: Could not look up type %s", typeName)
+        panic(err)
+    }
+
+    if len(typeType) == 0 {
+        return nil, false
+    }
+
+    if typeType != "e" {
+        logError("Error: Type %s exists, but it is not an enum type", typeName)
+        os.Exit(1)
+    }
+
+    rows, err := postgreSQLConnection.Query(context.Background(),
+        "SELECT enumlabel FROM pg_enum WHERE enumtypid = to_regtype($1) ORDER BY enumsortorder",
+        typeName)
+    if err != nil {
+        logError("Error: Could not read values of enum type %s", typeName)
+        panic(err)
+    }
+    defer rows.Close()
+
+    var value string
+    var values []string
+    for rows.Next() {
+        err := rows.Scan(&value)
+        if err != nil {
+            logError("Error: Could not read values of enum type %s: unable to scan row", typeName)
+            panic(err)
+        }
+
+        values = append(values, value)
+    }
+
+    err = rows.Err()
+    if err != nil {
+        logError("Error: Could not read values of enum type %s: row error", typeName)
+        panic(err)
+    }
+
+    return values, true
+}
+
+// check if all current values are still there, in the same order
+func isEnumOnlyExtended(currentValues []string, newValues []string) bool {
+    index := 0
+    for _, value := range newValues {
+        if index < len(currentValues) && currentValues[index] == value {
+            index++
+        }
+    }
+
+    return index == len(currentValues)
+}
+
+// generate sql which replaces enum type with a new one with given values
+func getEnumRebuildSQL(typeName string, values []string) string {
+    // keep schema of type for the temporary name
+    schemaPrefix := ""
+    unqualifiedTypeName := typeName
+    if dot := strings.LastIndex(typeName, "."); dot >= 0 {
+        schemaPrefix = typeName[:dot+1]
+        unqualifiedTypeName = typeName[dot+1:]
+    }
+
+    oldTypeName := unqualifiedTypeName + "__old"
+
+    return fmt.Sprintf(CONST_ENUM_REBUILD_TEMPLATE,
+        typeName, schemaPrefix+oldTypeName, oldTypeName, quoteSQLLiterals(values))
+}
+
+// generate ADD VALUE statements for values which are new (cannot run in a transaction block)
+func getEnumAddValuesSQL(typeName string, currentValues []string, newValues []string) string {
+    isCurrentValue := make(map[string]bool)
+    for _, value := range currentValues {
+        isCurrentValue[value] = true
+    }
+
+    // first existing value, new values at the start are inserted before it
+    firstCurrentValue := ""
+    for _, value := range newValues {
+        if isCurrentValue[value] {
+            firstCurrentValue = value
+            break
+        }
+    }
+
+    sql := "-- migrate:" + CONST_ANNOTATION_NO_TRANSACTION + "\n"
+    previousValue := ""
+    for _, value := range newValues {
+        if !isCurrentValue[value] {
+            sql += fmt.Sprintf("ALTER TYPE %s ADD VALUE IF NOT EXISTS %s", typeName, quoteSQLLiteral(value))
+            if len(previousValue) > 0 {
+                sql += " AFTER " + quoteSQLLiteral(previousValue)
+            } else if len(firstCurrentValue) > 0 {
+                sql += " BEFORE " + quoteSQLLiteral(firstCurrentValue)
+            }
+            sql += ";\n"
+        }
+
+        previousValue = value
+    }
+
+    return sql
+}
+
+// create migration which changes enum type to exactly the given values
+func cmd_enum(typeName string, values []string) {
+    checkDatabaseConfigurationFileExists()
+
+    // check for duplicates
+    seen := make(map[string]bool)
+    for _, value := range values {
+        if seen[value] {
+            logError("Error: Value %s is given more than once", value)
+            os.Exit(1)
+        }
+        seen[value] = true
+    }
+
+    connectToStoredDatabaseConnection()
+    currentValues, typeExists := getEnumValuesFromDatabase(typeName)
+
+    var sqlForward, sqlBackward string
+    switch {
+    case !typeExists:
+        sqlForward = fmt.Sprintf("\nCREATE TYPE %s AS ENUM (%s);\n", typeName, quoteSQLLiterals(values))
+        sqlBackward = fmt.Sprintf("\nDROP TYPE %s;\n", typeName)
+
+    case strings.Join(currentValues, "\n") == strings.Join(values, "\n"):
+        fmt.Printf("Enum type %s already has these values, nothing to do.\n", typeName)
+        os.Exit(0)
+
+    // only new values: ADD VALUE is cheap, but cannot run in a transaction block
+    case isEnumOnlyExtended(currentValues, values):
+        sqlForward = getEnumAddValuesSQL(typeName, currentValues, values)
+        sqlBackward = getEnumRebuildSQL(typeName, currentValues)
+
+    // values removed or reordered: type needs to be rebuilt
+    default:
+        sqlForward = getEnumRebuildSQL(typeName, values)
+        sqlBackward = getEnumRebuildSQL(typeName, currentValues)
+    }
+
+    filePath := createMigrationFile(migrationsFolder, "enum-"+typeName, sqlForward, sqlBackward)
+
+    fmt.Println("created", filePath)
+
+    os.Exit(0)
+}
+
+// create migration which renames a value of an enum type
+func cmd_enum_rename_value(typeName string, oldValue string, newValue string) {
+    checkDatabaseConfigurationFileExists()
+
+    sqlForward := fmt.Sprintf("\nALTER TYPE %s RENAME VALUE %s TO %s;\n",
+        typeName, quoteSQLLiteral(oldValue), quoteSQLLiteral(newValue))
+    sqlBackward := fmt.Sprintf("\nALTER TYPE %s RENAME VALUE %s TO %s;\n",
+        typeName, quoteSQLLiteral(newValue), quoteSQLLiteral(oldValue))
+
+    filePath := createMigrationFile(migrationsFolder, "enum-"+typeName+"-rename-"+oldValue, sqlForward, sqlBackward)
+
+    fmt.Println("created", filePath)
+
+    os.Exit(0)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+    "testing"
+)
+
+func TestIsEnumOnlyExtended(t *testing.T) {
+    tests := []struct {
+        name          string
+        currentValues []string
+        newValues     []string
+        expected      bool
+    }{
+        {"same values", []string{"a", "b"}, []string{"a", "b"}, true},
+        {"value at the end", []string{"a", "b"}, []string{"a", "b", "c"}, true},
+        {"value at the start", []string{"a", "b"}, []string{"z", "a", "b"}, true},
+        {"values in between", []string{"a", "b"}, []string{"a", "x", "y", "b"}, true},
+        {"no current values", nil, []string{"a"}, true},
+        {"value removed", []string{"a", "b", "c"}, []string{"a", "c"}, false},
+        {"values reordered", []string{"a", "b"}, []string{"b", "a"}, false},
+        {"no new values", []string{"a"}, nil, false},
+        {"values differing in case", []string{"a"}, []string{"A"}, false},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            if result := isEnumOnlyExtended(test.currentValues, test.newValues); result != test.expected {
+                t.Errorf("isEnumOnlyExtended(%q, %q) = %v, want %v", test.currentValues, test.newValues, result, test.expected)
+            }
+        })
+    }
+}
+
+func TestGetEnumAddValuesSQL(t *testing.T) {
+    tests := []struct {
+        name          string
+        currentValues []string
+        newValues     []string
+        expected      string
+    }{
+        {
+            name:          "value at the end",
+            currentValues: []string{"new", "paid"},
+            newValues:     []string{"new", "paid", "shipped"},
+            expected:      "-- migrate:no-transaction\nALTER TYPE order_state ADD VALUE IF NOT EXISTS 'shipped' AFTER 'paid';\n",
+        },
+        {
+            name:          "values at the start",
+            currentValues: []string{"paid"},
+            newValues:     []string{"draft", "new", "paid"},
+            expected: "-- migrate:no-transaction\n" +
+                "ALTER TYPE order_state ADD VALUE IF NOT EXISTS 'draft' BEFORE 'paid';\n" +
+                "ALTER TYPE order_state ADD VALUE IF NOT EXISTS 'new' AFTER 'draft';\n",
+        },
+        {
+            name:          "no current values",
+            currentValues: nil,
+            newValues:     []string{"new"},
+            expected:      "-- migrate:no-transaction\nALTER TYPE order_state ADD VALUE IF NOT EXISTS 'new';\n",
+        },
+        {
+            name:          "nothing new",
+            currentValues: []string{"new"},
+            newValues:     []string{"new"},
+            expected:      "-- migrate:no-transaction\n",
+        },
+        {
+            name:          "quotes and backslashes",
+            currentValues: []string{"it's"},
+            newValues:     []string{"it's", `C:\orders`, "say \"hi\""},
+            expected: "-- migrate:no-transaction\n" +
+                `ALTER TYPE order_state ADD VALUE IF NOT EXISTS 'C:\orders' AFTER 'it''s';` + "\n" +
+                `ALTER TYPE order_state ADD VALUE IF NOT EXISTS 'say "hi"' AFTER 'C:\orders';` + "\n",
+        },
+        {
+            name:          "spaces in values",
+            currentValues: []string{"on hold"},
+            newValues:     []string{"on hold", " padded "},
+            expected:      "-- migrate:no-transaction\nALTER TYPE order_state ADD VALUE IF NOT EXISTS ' padded ' AFTER 'on hold';\n",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            if sql := getEnumAddValuesSQL("order_state", test.currentValues, test.newValues); sql != test.expected {
+                t.Errorf("got\n%s\nwant\n%s", sql, test.expected)
+            }
+        })
+    }
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "path"
+    "regexp"
+)
+
+const (
+    // test data for ephemeral databases, never applied by 'up'
+    CONST_SEEDS_FILENAME = "seeds.sql"
+)
+
+var flagTemplate = commandLineFlags.String("template", "", "for 'env create': create the database from this template database; for 'create': migration template, e.g. create-index-concurrently")
+
+var (
+    regexpEnvironmentDatabaseName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+)
+
+// path of the seeds file
+func getSeedsFilePath() string {
+    return path.Join(CONST_MIGRATIONS_FOLDER, CONST_SEEDS_FILENAME)
+}
+
+// exit unless the name can be a database of an ephemeral environment, never the configured database itself
+func checkEnvironmentDatabaseName(name string) {
+    if !regexpEnvironmentDatabaseName.MatchString(name) {
+        logError("Error: Invalid database name %s, use lower case letters, digits and underscores", name)
+        os.Exit(1)
+    }
+
+    if name == getConfigValue("database") || name == CONST_MAINTENANCE_DATABASE {
+        logError("Error: Database %s is not an ephemeral environment", name)
+        os.Exit(1)
+    }
+}
+
+// run seeds file in the database of an ephemeral environment
+func applySeeds(database string) {
+    fileContentBytes, err := ioutil.ReadFile(getSeedsFilePath())
+    if os.IsNotExist(err) {
+        return
+    }
+    if err != nil {
+        logError("Error: Could not read file %s", getSeedsFilePath())
+        panic(err)
+    }
+
+    connection := openPostgreSQLConnection(getConnectionStringForDatabase(database))
+    defer closePostgreSQLConnection(connection)
+
+    tx, err := connection.Begin(context.Background())
+    if err != nil {
+        logError("Error: Failed to start seeds transaction")
+        panic(err)
+    }
+
+    defer tx.Rollback(context.Background())
+
+    _, err = tx.Exec(context.Background(), cleanUpSQLString(string(fileContentBytes)))
+    if err != nil {
+        logError("Error: Applying seeds failed")
+        logError("Error while processing file: %s", getSeedsFilePath())
+        panic(err)
+    }
+
+    err = tx.Commit(context.Background())
+    if err != nil {
+        logError("Error: Failed to commit seeds transaction")
+        panic(err)
+    }
+
+    fmt.Println("applied seeds:", getSeedsFilePath())
+}
+
+// drop database of an ephemeral environment, disconnecting everyone who still uses it
+func dropEnvironmentDatabase(database string) {
+    connection := openPostgreSQLConnection(getConnectionStringForDatabase(CONST_MAINTENANCE_DATABASE))
+    defer closePostgreSQLConnection(connection)
+
+    _, err := connection.Exec(context.Background(),
+        "SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()", database)
+    if err != nil {
+        logError("Error: Could not disconnect sessions of database %s", database)
+        panic(err)
+    }
+
+    _, err = connection.Exec(context.Background(), "DROP DATABASE IF EXISTS "+quoteSQLIdentifier(database))
+    if err != nil {
+        logError("Error: Could not drop database %s", database)
+        panic(err)
+    }
+
+    fmt.Println("dropped database", database)
+}
+
+// create database for an ephemeral environment (e.g. a pull request preview), run all migrations and the seeds
+func cmd_env_create(database string) {
+    checkEnvironmentDatabaseName(database)
+
+    // CREATE DATABASE cannot run inside the database which is created or copied
+    connection := openPostgreSQLConnection(getConnectionStringForDatabase(CONST_MAINTENANCE_DATABASE))
+    sql := "CREATE DATABASE " + quoteSQLIdentifier(database)
+    if len(*flagTemplate) > 0 {
+        sql += " TEMPLATE " + quoteSQLIdentifier(*flagTemplate)
+    }
+
+    _, err := connection.Exec(context.Background(), sql)
+    closePostgreSQLConnection(connection)
+    if err != nil {
+        logError("Error: Could not create database %s: %s", database, err)
+        if len(*flagTemplate) > 0 {
+            logError("Hint: A template must not have other connections")
+        }
+        os.Exit(1)
+    }
+    fmt.Println("created database", database)
+
+    // 'up' in a child process, so connections and state of this process stay untouched
+    command := exec.Command(os.Args[0], getChildCommandLineArgs("up", map[string]bool{"template": true},
+        map[string]string{"database": database})...)
+    command.Stdout = os.Stdout
+    command.Stderr = os.Stderr
+    err = command.Run()
+    if err != nil {
+        logError("Error: Migrations failed in database %s: %s", database, err)
+        dropEnvironmentDatabase(database)
+        os.Exit(1)
+    }
+
+    applySeeds(database)
+
+    fmt.Printf("Environment %s is ready.\n", database)
+    os.Exit(0)
+}
+
+// tear down database of an ephemeral environment
+func cmd_env_drop(database string) {
+    checkEnvironmentDatabaseName(database)
+
+    dropEnvironmentDatabase(database)
+    os.Exit(0)
+}
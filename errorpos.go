@@ -0,0 +1,113 @@
+package main
+
+import (
+    "errors"
+    "path"
+    "regexp"
+    "strings"
+    "unicode"
+
+    "github.com/jackc/pgconn"
+)
+
+const (
+    // lines shown before the line with the error
+    CONST_ERROR_SNIPPET_CONTEXT_LINES = 2
+)
+
+// where cleaned up sql comes from, to map error positions back to the file
+type sqlSource struct {
+    filePath  string
+    rawSQL    string // as in the file, before cleanUpSQLString
+    startLine int    // line of the file where rawSQL starts
+}
+
+// get source of up or down part of a migration file
+func getMigrationPartSource(fileName string, forward bool) sqlSource {
+    rawMigrationForward, rawMigrationBackward := readMigrationPartsFromFile(fileName)
+    filePath := path.Join(migrationsFolder, fileName)
+
+    if forward {
+        return sqlSource{filePath, rawMigrationForward, 1}
+    }
+
+    startLine := 1 + strings.Count(rawMigrationForward+CONST_TEMPLATE_UNDO_MARKER, "\n")
+    return sqlSource{filePath, rawMigrationBackward, startLine}
+}
+
+// get character offset of statement within cleaned up sql, statements are executed one by one
+func getStatementOffset(sql string, statement string, searchFrom int) (int, int) {
+    index := strings.Index(sql[searchFrom:], statement)
+    if index < 0 {
+        return 0, searchFrom
+    }
+
+    byteOffset := searchFrom + index
+    return len([]rune(sql[:byteOffset])), byteOffset + len(statement)
+}
+
+// map character position (1-based, as reported by PostgreSQL) in cleaned up sql to line & column in the file
+func getFilePosition(source sqlSource, position int) (int, int) {
+    // removing comments keeps lines, trimming removes leading lines & whitespace
+    reSQLComments := regexp.MustCompile("(?m)^--[^\n]*$")
+    withoutComments := reSQLComments.ReplaceAllString(source.rawSQL, "")
+    leadingWhitespace := len(withoutComments) - len(strings.TrimLeftFunc(withoutComments, unicode.IsSpace))
+
+    byteOffset := len(withoutComments)
+    for index := range withoutComments[leadingWhitespace:] {
+        if position <= 1 {
+            byteOffset = leadingWhitespace + index
+            break
+        }
+        position--
+    }
+
+    lineStart := strings.LastIndex(withoutComments[:byteOffset], "\n") + 1
+    line := source.startLine + strings.Count(withoutComments[:byteOffset], "\n")
+    column := len([]rune(withoutComments[lineStart:byteOffset])) + 1
+
+    return line, column
+}
+
+// print file, line and source snippet with a caret for errors with a position,
+// returns false if the error has no position
+func printErrorLocation(source sqlSource, err error, statementOffset int) bool {
+    var pgError *pgconn.PgError
+    if !errors.As(err, &pgError) || pgError.Position <= 0 {
+        return false
+    }
+
+    line, column := getFilePosition(source, statementOffset+int(pgError.Position))
+    logError("Error at %s:%d:%d", source.filePath, line, column)
+
+    lines := strings.Split(source.rawSQL, "\n")
+    lineInSource := line - source.startLine
+    if lineInSource >= len(lines) {
+        return true
+    }
+
+    firstLine := lineInSource - CONST_ERROR_SNIPPET_CONTEXT_LINES
+    if firstLine < 0 {
+        firstLine = 0
+    }
+
+    for index := firstLine; index <= lineInSource; index++ {
+        logError("%5d | %s", source.startLine+index, lines[index])
+    }
+
+    // keep tabs, so the caret lines up
+    var caret strings.Builder
+    for index, character := range []rune(lines[lineInSource]) {
+        if index >= column-1 {
+            break
+        }
+        if character == '\t' {
+            caret.WriteRune('\t')
+        } else {
+            caret.WriteRune(' ')
+        }
+    }
+    logError("      | %s^", caret.String())
+
+    return true
+}
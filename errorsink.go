@@ -0,0 +1,160 @@
+package main
+
+import (
+    "bytes"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "path"
+    "time"
+
+    "github.com/jackc/pgconn"
+)
+
+const (
+    CONST_ENV_VAR_ERROR_SINK = "MIGRATE_ERROR_SINK"
+
+    CONST_ERROR_SINK_TIMEOUT = 10 * time.Second
+
+    // store API of Sentry and compatible trackers (e.g. GlitchTip)
+    CONST_SENTRY_PROTOCOL_VERSION = "7"
+)
+
+var flagErrorSink = commandLineFlags.String("error-sink", "", "report failed migrations to this Sentry DSN, or POST them as JSON to this URL")
+
+// migration which is being applied or reverted, until it has been committed
+var failingMigrationFileName string
+
+// failed migration as reported to the error tracker, without sql or connection details
+type errorSinkEvent struct {
+    EventId     string            `json:"event_id"`
+    Timestamp   string            `json:"timestamp"`
+    Level       string            `json:"level"`
+    Logger      string            `json:"logger"`
+    Platform    string            `json:"platform"`
+    Release     string            `json:"release"`
+    Environment string            `json:"environment,omitempty"`
+    Message     string            `json:"message"`
+    Tags        map[string]string `json:"tags"`
+}
+
+// random id in the format Sentry expects, 32 hex characters
+func newErrorSinkEventId() string {
+    id := make([]byte, 16)
+    _, _ = rand.Read(id)
+
+    return hex.EncodeToString(id)
+}
+
+// build event for failed migration, the owner tag lets the tracker route the alert to the owning team
+func newErrorSinkEvent(command string, fileName string, err interface{}) errorSinkEvent {
+    event := errorSinkEvent{
+        EventId:     newErrorSinkEventId(),
+        Timestamp:   time.Now().UTC().Format(time.RFC3339),
+        Level:       "error",
+        Logger:      CONST_TOOL_NAME,
+        Platform:    "other",
+        Release:     getVersion(),
+        Environment: getConfigValue("environment"),
+        Message:     sanitizeSupportBundleText(fmt.Sprint(err)),
+        Tags:        map[string]string{"command": command, "database": getConfigValue("database")},
+    }
+
+    if len(fileName) > 0 {
+        event.Message = fileName + ": " + event.Message
+        event.Tags["migration"] = fileName
+        if owner, ok := readMigrationHeaderFromFile(fileName)[CONST_HEADER_OWNER]; ok {
+            event.Tags["owner"] = owner
+        }
+    }
+    if len(*flagComponent) > 0 {
+        event.Tags["component"] = *flagComponent
+    }
+
+    var pgError *pgconn.PgError
+    if recoveredErr, ok := err.(error); ok && errors.As(recoveredErr, &pgError) {
+        event.Tags["sqlstate"] = pgError.Code
+    }
+
+    return event
+}
+
+// request for the error sink: Sentry DSNs (https://key@host/project) go to the store API, other URLs get the event as is
+func newErrorSinkRequest(sink string, body []byte) (*http.Request, error) {
+    sinkURL, err := url.Parse(sink)
+    if err != nil {
+        return nil, err
+    }
+
+    if sinkURL.User == nil {
+        request, err := http.NewRequest(http.MethodPost, sink, bytes.NewReader(body))
+        if err != nil {
+            return nil, err
+        }
+        request.Header.Set("Content-Type", "application/json")
+        return request, nil
+    }
+
+    // e.g. https://key@o1.ingest.sentry.io/123 -> https://o1.ingest.sentry.io/api/123/store/
+    project := path.Base(sinkURL.Path)
+    storeURL := url.URL{Scheme: sinkURL.Scheme, Host: sinkURL.Host,
+        Path: path.Join(path.Dir(sinkURL.Path), "api", project, "store") + "/"}
+
+    request, err := http.NewRequest(http.MethodPost, storeURL.String(), bytes.NewReader(body))
+    if err != nil {
+        return nil, err
+    }
+    request.Header.Set("Content-Type", "application/json")
+    request.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=%s, sentry_client=%s, sentry_key=%s",
+        CONST_SENTRY_PROTOCOL_VERSION, getUserAgent(), sinkURL.User.Username()))
+
+    return request, nil
+}
+
+// report failed migration to the configured error sink, problems with the sink do not hide the failure itself
+func reportMigrationError(command string, fileName string, err interface{}) {
+    sink := getConfigValue("error-sink")
+    if len(sink) == 0 {
+        return
+    }
+
+    body, marshalErr := json.Marshal(newErrorSinkEvent(command, fileName, err))
+    if marshalErr != nil {
+        logError("Warning: Could not encode event for error sink: %s", marshalErr)
+        return
+    }
+
+    request, requestErr := newErrorSinkRequest(sink, body)
+    if requestErr != nil {
+        logError("Warning: Invalid error-sink: %s", sanitizeSupportBundleText(requestErr.Error()))
+        return
+    }
+    setUserAgent(request)
+
+    client := http.Client{Timeout: CONST_ERROR_SINK_TIMEOUT}
+    response, requestErr := client.Do(request)
+    if requestErr != nil {
+        logError("Warning: Could not report failure to error sink: %s", sanitizeSupportBundleText(requestErr.Error()))
+        return
+    }
+    defer response.Body.Close()
+
+    if response.StatusCode < 200 || response.StatusCode > 299 {
+        logError("Warning: Error sink returned %s", response.Status)
+    }
+}
+
+// report failure of the command, then fail as before; deferred by 'up' and 'down'
+func reportMigrationErrorOnPanic(command string) {
+    err := recover()
+    if err == nil {
+        return
+    }
+
+    reportMigrationError(command, failingMigrationFileName, err)
+    panic(err)
+}
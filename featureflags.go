@@ -0,0 +1,108 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "path"
+    "time"
+)
+
+const (
+    // http calls per environment, made after a migration has been applied
+    CONST_FEATURE_FLAGS_FILENAME = "feature-flags.json"
+
+    CONST_FEATURE_FLAG_TIMEOUT = 30 * time.Second
+)
+
+// http call which flips a feature flag (e.g. LaunchDarkly or Unleash webhook) after a migration,
+// url, headers and body may contain $ENV_VARS so tokens do not end up in the repository
+type featureFlagHook struct {
+    After   string            `json:"after"`
+    Method  string            `json:"method"`
+    URL     string            `json:"url"`
+    Headers map[string]string `json:"headers"`
+    Body    string            `json:"body"`
+}
+
+var featureFlagHooks map[string][]featureFlagHook
+
+// path of feature flag hooks
+func getFeatureFlagsFilePath() string {
+    return path.Join(CONST_MIGRATIONS_FOLDER, CONST_FEATURE_FLAGS_FILENAME)
+}
+
+// read hooks of the current environment, empty if there are none
+func getFeatureFlagHooks() []featureFlagHook {
+    if featureFlagHooks == nil {
+        featureFlagHooks = map[string][]featureFlagHook{}
+
+        fileContent, err := ioutil.ReadFile(getFeatureFlagsFilePath())
+        if os.IsNotExist(err) {
+            return nil
+        }
+        if err != nil {
+            logError("Error: Could not read file %s", getFeatureFlagsFilePath())
+            panic(err)
+        }
+
+        err = json.Unmarshal(fileContent, &featureFlagHooks)
+        if err != nil {
+            logError("Error: File %s is not valid JSON", getFeatureFlagsFilePath())
+            panic(err)
+        }
+    }
+
+    return featureFlagHooks[getConfigValue("environment")]
+}
+
+// call hook, fail on anything but 2xx
+func callFeatureFlagHook(hook featureFlagHook) error {
+    method := hook.Method
+    if len(method) == 0 {
+        method = http.MethodPost
+    }
+
+    request, err := http.NewRequest(method, os.ExpandEnv(hook.URL), bytes.NewBufferString(os.ExpandEnv(hook.Body)))
+    if err != nil {
+        return err
+    }
+    setUserAgent(request)
+    for name, value := range hook.Headers {
+        request.Header.Set(name, os.ExpandEnv(value))
+    }
+
+    client := http.Client{Timeout: CONST_FEATURE_FLAG_TIMEOUT}
+    response, err := client.Do(request)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+
+    if response.StatusCode < 200 || response.StatusCode > 299 {
+        return fmt.Errorf("%s %s returned %s", method, hook.URL, response.Status)
+    }
+
+    return nil
+}
+
+// flip feature flags which wait for the migration, e.g. to switch reads to a new column
+func runFeatureFlagHooks(fileName string) {
+    for _, hook := range getFeatureFlagHooks() {
+        if hook.After != fileName {
+            continue
+        }
+
+        err := callFeatureFlagHook(hook)
+        if err != nil {
+            logError("Error: Migration %s has been applied, but the feature flag hook failed", fileName)
+            logError("Hint: Flip the flag by hand before continuing the rollout")
+            panic(err)
+        }
+
+        fmt.Printf("feature flag hook: %s %s\n", fileName, hook.URL)
+    }
+}
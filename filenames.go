@@ -0,0 +1,105 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "regexp"
+    "strings"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    CONST_DEFAULT_FILENAME_PATTERN = migrate.DefaultFileNamePattern
+
+    CONST_ENV_VAR_FILENAME_PATTERN = "MIGRATE_FILENAME_PATTERN"
+
+    // comma separated, the first one is used for new files
+    CONST_DEFAULT_EXTENSIONS = migrate.DefaultExtension
+    CONST_ENV_VAR_EXTENSIONS = "MIGRATE_EXTENSIONS"
+)
+
+var flagFilenamePattern = commandLineFlags.String("filename-pattern", "", "regular expression for migration file names, a group named 'version' sorts by it (default "+CONST_DEFAULT_FILENAME_PATTERN+")")
+
+var flagExtensions = commandLineFlags.String("extensions", "", "comma separated file extensions of migrations, e.g. .sql,.psql,.pgsql (default "+CONST_DEFAULT_EXTENSIONS+")")
+
+var migrationFileNamePattern *regexp.Regexp
+
+// get accepted extensions of migration files, e.g. [.sql .psql]
+func getMigrationFileExtensions() []string {
+    var extensions []string
+    for _, extension := range strings.Split(getConfigValue("extensions"), ",") {
+        extension = strings.TrimSpace(extension)
+        if len(extension) == 0 {
+            continue
+        }
+        if !strings.HasPrefix(extension, ".") {
+            extension = "." + extension
+        }
+        extensions = append(extensions, extension)
+    }
+
+    if len(extensions) == 0 {
+        return []string{CONST_DEFAULT_EXTENSIONS}
+    }
+
+    return extensions
+}
+
+// get accepted extension of file name (the longest one which matches), empty if there is none
+func getMigrationFileExtension(fileName string) string {
+    return getMigrationSource().Extension(fileName)
+}
+
+// file name with .sql as extension, so filename-pattern and ordering do not depend on the extension
+func getCanonicalMigrationFileName(fileName string) string {
+    return getMigrationSource().CanonicalFileName(fileName)
+}
+
+// get compiled pattern of migration file names, from flag, environment or config file
+func getMigrationFileNamePattern() *regexp.Regexp {
+    pattern, err := compileMigrationFileNamePattern()
+    if err != nil {
+        logError("Error: %s", err)
+        os.Exit(1)
+    }
+
+    return pattern
+}
+
+// see getMigrationFileNamePattern, error instead of exit if the pattern is invalid
+func compileMigrationFileNamePattern() (*regexp.Regexp, error) {
+    if migrationFileNamePattern != nil {
+        return migrationFileNamePattern, nil
+    }
+
+    pattern := getConfigValue("filename-pattern")
+
+    compiledPattern, err := regexp.Compile(pattern)
+    if err != nil {
+        return nil, fmt.Errorf("Invalid filename-pattern %s: %s", pattern, err)
+    }
+    migrationFileNamePattern = compiledPattern
+
+    return migrationFileNamePattern, nil
+}
+
+// migration files of the migrations folder, with filename-pattern and extensions
+func getMigrationSource() *migrate.Source {
+    return migrate.NewSource(migrationFileSystem, migrationsFolder, getMigrationFileNamePattern(), getMigrationFileExtensions())
+}
+
+// check if file name is a migration file name, with one of the accepted extensions
+func isMigrationFileName(fileName string) bool {
+    return getMigrationSource().IsMigrationFileName(fileName)
+}
+
+// check if migration file a is applied before migration file b
+func isMigrationFileNameBefore(fileNameA string, fileNameB string) bool {
+    return getMigrationSource().Less(fileNameA, fileNameB)
+}
+
+// sort migration file names in the order they are applied
+func sortMigrationFileNames(fileNames []string) {
+    getMigrationSource().Sort(fileNames)
+}
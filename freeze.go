@@ -0,0 +1,125 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    // at most one row: while it exists, 'up', 'down' and 'ci' refuse to change the schema; one for all components
+    CONST_POSTGRESQL_FREEZE_TABLE_NAME   = CONST_POSTGRESQL_TABLE_NAME + "_freeze"
+    CONST_POSTGRESQL_FREEZE_TABLE_SCHEMA = "CREATE TABLE IF NOT EXISTS %s (frozen boolean PRIMARY KEY DEFAULT true CHECK (frozen), frozen_at timestamp with time zone NOT NULL DEFAULT NOW(), frozen_by text NOT NULL, role_name text NOT NULL DEFAULT current_user, reason text NOT NULL DEFAULT '')"
+
+    CONST_POSTGRESQL_FREEZE = `
+    INSERT INTO %s (frozen_by, reason) VALUES ($1, $2)
+    ON CONFLICT (frozen) DO UPDATE
+    SET frozen_at = NOW(), frozen_by = EXCLUDED.frozen_by, role_name = current_user, reason = EXCLUDED.reason`
+)
+
+// freeze of schema changes, e.g. during an incident or a release freeze
+type migrationFreeze struct {
+    frozenAt time.Time
+    frozenBy string
+    roleName string
+    reason   string
+}
+
+// describe freeze for error messages
+func (freeze migrationFreeze) String() string {
+    description := fmt.Sprintf("since %s by %s (role %s)", freeze.frozenAt.Local().Format("2006-01-02 15:04"), freeze.frozenBy, freeze.roleName)
+    if len(freeze.reason) > 0 {
+        description += ": " + freeze.reason
+    }
+
+    return description
+}
+
+// get current freeze, nil if schema changes are allowed (or the table has never been created)
+func getMigrationFreeze() *migrationFreeze {
+    connectToStoredDatabaseConnection()
+
+    var exists bool
+    err := postgreSQLConnection.QueryRow(context.Background(), "SELECT to_regclass($1) IS NOT NULL", CONST_POSTGRESQL_FREEZE_TABLE_NAME).Scan(&exists)
+    if err != nil {
+        logError("Error: Could not check for table %s", CONST_POSTGRESQL_FREEZE_TABLE_NAME)
+        panic(err)
+    }
+    if !exists {
+        return nil
+    }
+
+    var freeze migrationFreeze
+    err = postgreSQLConnection.QueryRow(context.Background(),
+        fmt.Sprintf("SELECT frozen_at, frozen_by, role_name, reason FROM %s", CONST_POSTGRESQL_FREEZE_TABLE_NAME)).Scan(
+        &freeze.frozenAt, &freeze.frozenBy, &freeze.roleName, &freeze.reason)
+    if err == pgx.ErrNoRows {
+        return nil
+    }
+    if err != nil {
+        logError("Error: Could not read table %s", CONST_POSTGRESQL_FREEZE_TABLE_NAME)
+        panic(err)
+    }
+
+    return &freeze
+}
+
+// refuse to change the schema while it is frozen
+func checkMigrationFreeze() {
+    freeze := getMigrationFreeze()
+    if freeze == nil {
+        return
+    }
+
+    logError("Error: Schema changes are frozen %s", freeze)
+    logError("Hint: Nothing has been applied, run 'unfreeze' when the freeze is over")
+    os.Exit(1)
+}
+
+// freeze schema changes, from any host which can reach the database
+func cmd_freeze(reason string) {
+    connectToStoredDatabaseConnection()
+
+    _, err := postgreSQLConnection.Exec(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_FREEZE_TABLE_SCHEMA, CONST_POSTGRESQL_FREEZE_TABLE_NAME))
+    if err != nil {
+        logError("Error: Failed to create table %s", CONST_POSTGRESQL_FREEZE_TABLE_NAME)
+        panic(err)
+    }
+
+    _, err = postgreSQLConnection.Exec(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_FREEZE, CONST_POSTGRESQL_FREEZE_TABLE_NAME), getOperatorName(), reason)
+    if err != nil {
+        logError("Error: Failed to freeze schema changes")
+        panic(err)
+    }
+
+    fmt.Printf("Schema changes are frozen %s\n", getMigrationFreeze())
+    os.Exit(0)
+}
+
+// allow schema changes again
+func cmd_unfreeze() {
+    freeze := getMigrationFreeze()
+    if freeze == nil {
+        fmt.Println("Schema changes are not frozen.")
+        os.Exit(0)
+    }
+
+    if isProtectedEnvironment() && !confirm(fmt.Sprintf("Schema changes are frozen %s. Allow them again?", freeze)) {
+        logError("Error: Aborted, schema changes are still frozen")
+        os.Exit(1)
+    }
+
+    _, err := postgreSQLConnection.Exec(context.Background(), fmt.Sprintf("DELETE FROM %s", CONST_POSTGRESQL_FREEZE_TABLE_NAME))
+    if err != nil {
+        logError("Error: Failed to unfreeze schema changes")
+        panic(err)
+    }
+
+    fmt.Println("Schema changes are allowed again.")
+    os.Exit(0)
+}
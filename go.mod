@@ -1,5 +1,12 @@
 module github.com/bf/go-simple-postgresql-migrate
 
-go 1.15
+go 1.16
 
-require github.com/jackc/pgx/v4 v4.9.2
+require (
+	github.com/jackc/pgconn v1.7.2
+	github.com/jackc/pgx/v4 v4.9.2
+	github.com/jackc/puddle v1.2.0 // indirect
+	github.com/pganalyze/pg_query_go/v5 v5.1.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/text v0.3.3
+)
@@ -0,0 +1,193 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path"
+    "sort"
+
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    CONST_GRANTS_FILENAME = "grants.sql"
+
+    // privileges on schemas, tables, views and sequences, RLS flags and policies (one line each)
+    CONST_POSTGRESQL_GRANTS_SNAPSHOT_QUERY = `
+        SELECT format('%s on schema %s to %s', a.privilege_type, n.nspname, COALESCE(r.rolname, 'PUBLIC'))
+        FROM pg_namespace n
+        CROSS JOIN LATERAL aclexplode(COALESCE(n.nspacl, acldefault('n', n.nspowner))) a
+        LEFT JOIN pg_roles r ON r.oid = a.grantee
+        WHERE n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+    UNION ALL
+        SELECT format('%s on %s.%s to %s', a.privilege_type, n.nspname, c.relname, COALESCE(r.rolname, 'PUBLIC'))
+        FROM pg_class c
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        CROSS JOIN LATERAL aclexplode(COALESCE(c.relacl, acldefault(CASE WHEN c.relkind = 'S' THEN 's' ELSE 'r' END::"char", c.relowner))) a
+        LEFT JOIN pg_roles r ON r.oid = a.grantee
+        WHERE c.relkind IN ('r', 'p', 'v', 'm', 'S', 'f')
+        AND n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+    UNION ALL
+        SELECT format('row level security on %s.%s (forced: %s)', n.nspname, c.relname, c.relforcerowsecurity)
+        FROM pg_class c
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        WHERE c.relrowsecurity
+    UNION ALL
+        SELECT format('policy %s on %s.%s as %s for %s to %s using (%s) with check (%s)',
+            policyname, schemaname, tablename, permissive, cmd, roles, qual, with_check)
+        FROM pg_policies`
+)
+
+// path of the file with grants & policies which is re-applied after each 'up'
+func getGrantsFilePath() string {
+    return path.Join(CONST_MIGRATIONS_FOLDER, CONST_GRANTS_FILENAME)
+}
+
+// read grants file, returns empty string if there is none
+func readGrantsFromFile() string {
+    fileContentBytes, err := ioutil.ReadFile(getGrantsFilePath())
+    if os.IsNotExist(err) {
+        return ""
+    }
+    if err != nil {
+        logError("Error: Could not read file %s", getGrantsFilePath())
+        panic(err)
+    }
+
+    return cleanUpSQLString(string(fileContentBytes))
+}
+
+// execute grants file within given transaction
+func executeGrants(tx pgx.Tx, sqlGrants string) {
+    currentMigrationFileName = CONST_GRANTS_FILENAME
+    defer func() { currentMigrationFileName = "" }()
+
+    _, err := tx.Exec(context.Background(), sqlGrants)
+    if err != nil {
+        logError("Error: Applying grants failed")
+        logError("Error while processing file: %s", getGrantsFilePath())
+        logError(sqlGrants)
+        panic(err)
+    }
+}
+
+// re-apply grants & policies, so they stay consistent even when migrations forget them
+func applyGrants() {
+    sqlGrants := readGrantsFromFile()
+    if len(sqlGrants) == 0 {
+        return
+    }
+
+    tx, err := postgreSQLConnection.Begin(context.Background())
+    if err != nil {
+        logError("Error: Failed to start grants transaction")
+        panic(err)
+    }
+
+    defer tx.Rollback(context.Background())
+
+    executeGrants(tx, sqlGrants)
+
+    err = tx.Commit(context.Background())
+    if err != nil {
+        logError("Error: Failed to commit grants transaction")
+        panic(err)
+    }
+
+    fmt.Println("re-applied grants:", getGrantsFilePath())
+}
+
+// fetch privileges & policies as sorted list of readable lines
+func getGrantsSnapshot(tx pgx.Tx) []string {
+    rows, err := tx.Query(context.Background(), CONST_POSTGRESQL_GRANTS_SNAPSHOT_QUERY)
+    if err != nil {
+        logError("Error: Could not read privileges from database")
+        panic(err)
+    }
+    defer rows.Close()
+
+    var line string
+    var grants []string
+    for rows.Next() {
+        err := rows.Scan(&line)
+        if err != nil {
+            logError("Error: Could not read privileges from database: unable to scan row")
+            panic(err)
+        }
+
+        grants = append(grants, line)
+    }
+
+    err = rows.Err()
+    if err != nil {
+        logError("Error: Could not read privileges from database: row error")
+        panic(err)
+    }
+
+    sort.Strings(grants)
+
+    return grants
+}
+
+// list entries of a which are missing in b
+func getMissingEntries(a []string, b []string) []string {
+    entriesInB := make(map[string]bool)
+    for _, entry := range b {
+        entriesInB[entry] = true
+    }
+
+    var missing []string
+    for _, entry := range a {
+        if !entriesInB[entry] {
+            missing = append(missing, entry)
+        }
+    }
+
+    return missing
+}
+
+// show what applying the grants file would change, without changing anything
+func cmd_check_grants() {
+    sqlGrants := readGrantsFromFile()
+    if len(sqlGrants) == 0 {
+        logError("Error: No grants found in %s", getGrantsFilePath())
+        os.Exit(1)
+    }
+
+    connectToStoredDatabaseConnection()
+
+    tx, err := postgreSQLConnection.Begin(context.Background())
+    if err != nil {
+        logError("Error: Failed to start grants transaction")
+        panic(err)
+    }
+
+    // never commit, we only want to see the difference
+    defer tx.Rollback(context.Background())
+
+    grantsBefore := getGrantsSnapshot(tx)
+    executeGrants(tx, sqlGrants)
+    grantsAfter := getGrantsSnapshot(tx)
+
+    missingInDatabase := getMissingEntries(grantsAfter, grantsBefore)
+    revokedByGrantsFile := getMissingEntries(grantsBefore, grantsAfter)
+
+    if len(missingInDatabase) == 0 && len(revokedByGrantsFile) == 0 {
+        fmt.Println("Grants in database match", getGrantsFilePath())
+        os.Exit(0)
+    }
+
+    for _, line := range missingInDatabase {
+        fmt.Println("+", line)
+    }
+
+    for _, line := range revokedByGrantsFile {
+        fmt.Println("-", line)
+    }
+
+    logError("Error: Grants in database differ from %s (+ missing in database, - would be removed)", getGrantsFilePath())
+    logError("Hint: Run 'up' to re-apply the grants")
+    os.Exit(1)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+    "fmt"
+    "path"
+    "strings"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+var flagMakeIdempotent = commandLineFlags.Bool("make-idempotent", false, "for 'create' and 'validate': use IF NOT EXISTS / IF EXISTS / OR REPLACE where possible ('validate' suggests, 'validate --fix' rewrites)")
+
+// statements which can be guarded: the guard is inserted after one of the key word sequences, unless it follows
+// already or the next key word is one of unguardable (e.g. CREATE INDEX ON table without name); with followedBy,
+// only if the next key word is one of them
+type idempotencyRule struct {
+    keywords    []string
+    guard       string
+    unguardable []string
+    followedBy  []string
+}
+
+// longer sequences first, e.g. INDEX CONCURRENTLY before INDEX
+var idempotencyRules = []idempotencyRule{
+    {[]string{"CREATE UNLOGGED TABLE", "CREATE TABLE", "CREATE MATERIALIZED VIEW", "CREATE SEQUENCE", "CREATE SCHEMA",
+        "CREATE EXTENSION", "CREATE UNIQUE INDEX CONCURRENTLY", "CREATE UNIQUE INDEX", "CREATE INDEX CONCURRENTLY",
+        "CREATE INDEX", "ADD COLUMN"}, "IF NOT EXISTS", []string{"ON", "AUTHORIZATION"}, nil},
+    {[]string{"DROP TABLE", "DROP VIEW", "DROP MATERIALIZED VIEW", "DROP INDEX CONCURRENTLY", "DROP INDEX", "DROP SEQUENCE",
+        "DROP SCHEMA", "DROP FUNCTION", "DROP PROCEDURE", "DROP TYPE", "DROP EXTENSION", "DROP TRIGGER", "DROP COLUMN",
+        "DROP CONSTRAINT"}, "IF EXISTS", nil, nil},
+    {[]string{"CREATE"}, "OR REPLACE", nil, []string{"FUNCTION", "PROCEDURE", "VIEW"}},
+}
+
+// check if the key words start at index of tokens
+func hasKeywordsAt(tokens []migrate.Token, index int, keywords []string) bool {
+    if index+len(keywords) > len(tokens) {
+        return false
+    }
+    for offset, keyword := range keywords {
+        if !tokens[index+offset].Is(keyword) {
+            return false
+        }
+    }
+
+    return true
+}
+
+// rewrite statements of migration sql to variants which do not fail when they run again;
+// tokens of migrate.Tokenize, so comments, string constants and function bodies are left alone
+func makeIdempotent(sql string) string {
+    for _, rule := range idempotencyRules {
+        var rewritten strings.Builder
+        position := 0
+
+        tokens := migrate.Tokenize(sql)
+        for index := range tokens {
+            for _, keywords := range rule.keywords {
+                words := strings.Fields(keywords)
+                if !hasKeywordsAt(tokens, index, words) {
+                    continue
+                }
+
+                // already guarded, cannot be guarded, or another kind of object
+                next := index + len(words)
+                guarded := hasKeywordsAt(tokens, next, strings.Fields(rule.guard))
+                unguardable := next < len(tokens) && tokens[next].Is(rule.unguardable...)
+                followed := len(rule.followedBy) == 0 || next < len(tokens) && tokens[next].Is(rule.followedBy...)
+                if guarded || unguardable || !followed {
+                    break
+                }
+
+                last := tokens[next-1]
+                rewritten.WriteString(sql[position : last.Offset+len(last.Text)])
+                rewritten.WriteString(" " + rule.guard)
+                position = last.Offset + len(last.Text)
+                break
+            }
+        }
+
+        rewritten.WriteString(sql[position:])
+        sql = rewritten.String()
+    }
+
+    return sql
+}
+
+// suggest idempotent statements for a migration file, rewrite it if asked to,
+// returns if there were suggestions
+func suggestIdempotentStatements(fileName string, rewrite bool) bool {
+    filePath := path.Join(migrationsFolder, fileName)
+    fileContentBytes, err := readMigrationFile(fileName)
+    if err != nil {
+        logError("Error: Could not read file %s", filePath)
+        panic(err)
+    }
+
+    fileContent := string(fileContentBytes)
+    idempotentContent := makeIdempotent(fileContent)
+    if idempotentContent == fileContent {
+        return false
+    }
+
+    // guards are inserted within lines, so lines still correspond
+    lines := strings.Split(fileContent, "\n")
+    for index, line := range strings.Split(idempotentContent, "\n") {
+        if line != lines[index] {
+            fmt.Printf("%s:%d\n  - %s\n  + %s\n", filePath, index+1, strings.TrimSpace(lines[index]), strings.TrimSpace(line))
+        }
+    }
+
+    if rewrite {
+        writeStringToFile(filePath, idempotentContent)
+    }
+
+    return true
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "strings"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    // statistics of a table, no rows if it does not exist (yet)
+    CONST_POSTGRESQL_TABLE_STATISTICS_QUERY = `
+        SELECT greatest(c.reltuples, coalesce(s.n_live_tup, 0))::bigint,
+            pg_total_relation_size(c.oid), pg_size_pretty(pg_total_relation_size(c.oid))
+        FROM pg_class c
+        LEFT JOIN pg_stat_user_tables s ON s.relid = c.oid
+        WHERE c.oid = to_regclass($1)`
+)
+
+// estimated impact of one statement of a pending migration, for 'plan'
+type statementImpact struct {
+    FileName      string `json:"filename"`
+    Statement     string `json:"statement"`
+    Table         string `json:"table"`
+    TableRows     *int64 `json:"table_rows,omitempty"`
+    TableBytes    *int64 `json:"table_bytes,omitempty"`
+    TableSize     string `json:"table_size,omitempty"`
+    EstimatedRows *int64 `json:"estimated_rows,omitempty"`
+}
+
+// estimate impact of all statements of pending migrations from table statistics, without executing them
+func estimateImpactOfMigrations(pendingMigrations []string) []statementImpact {
+    impacts := []statementImpact{}
+    for _, fileName := range pendingMigrations {
+        sqlMigrationForward, _ := readMigrationFromFile(fileName)
+        for _, statement := range splitSQLStatements(sqlMigrationForward) {
+            impact, ok := estimateImpactOfStatement(statement)
+            if !ok {
+                continue
+            }
+
+            impact.FileName = fileName
+            impacts = append(impacts, impact)
+        }
+    }
+
+    return impacts
+}
+
+// estimate impact of a single statement, false if it does not touch an existing table
+func estimateImpactOfStatement(statement string) (statementImpact, bool) {
+    statement = strings.TrimSpace(statement)
+
+    // statements which touch an existing table, see migrate.Statement.TouchedTable
+    kind, table := migrate.ParseStatement(statement).TouchedTable()
+    if len(kind) == 0 {
+        return statementImpact{}, false
+    }
+
+    impact := statementImpact{Statement: kind, Table: table}
+
+    var tableRows, tableBytes int64
+    err := postgreSQLConnection.QueryRow(context.Background(), CONST_POSTGRESQL_TABLE_STATISTICS_QUERY,
+        table).Scan(&tableRows, &tableBytes, &impact.TableSize)
+    if err != nil {
+        // table created by an earlier pending migration, or not visible with this search_path
+        return impact, true
+    }
+
+    // never analyzed tables report -1 since PostgreSQL 14
+    if tableRows < 0 {
+        tableRows = 0
+    }
+    impact.TableRows = &tableRows
+    impact.TableBytes = &tableBytes
+
+    // the planner knows how many rows a WHERE clause matches
+    if kind == "UPDATE" || kind == "DELETE" || kind == "INSERT" {
+        if estimatedRows, ok := explainEstimatedRows(statement); ok {
+            impact.EstimatedRows = &estimatedRows
+        }
+    }
+
+    return impact, true
+}
+
+// rows the planner expects a statement to touch, EXPLAIN without ANALYZE does not execute it
+func explainEstimatedRows(statement string) (int64, bool) {
+    var planJSON string
+    err := postgreSQLConnection.QueryRow(context.Background(), "EXPLAIN (FORMAT JSON) "+statement).Scan(&planJSON)
+    if err != nil {
+        return 0, false
+    }
+
+    var plans []struct {
+        Plan struct {
+            NodeType string  `json:"Node Type"`
+            Rows     float64 `json:"Plan Rows"`
+            Plans    []struct {
+                Rows float64 `json:"Plan Rows"`
+            } `json:"Plans"`
+        } `json:"Plan"`
+    }
+    if err := json.Unmarshal([]byte(planJSON), &plans); err != nil || len(plans) == 0 {
+        return 0, false
+    }
+
+    // rows of ModifyTable itself are the RETURNING rows, the scan below it has the touched rows
+    plan := plans[0].Plan
+    if plan.NodeType == "ModifyTable" && len(plan.Plans) > 0 {
+        return int64(plan.Plans[0].Rows), true
+    }
+
+    return int64(plan.Rows), true
+}
+
+// e.g. "UPDATE public.orders: ~1200 of 400000000 rows (52 GB)"
+func (impact statementImpact) String() string {
+    if impact.TableRows == nil {
+        return fmt.Sprintf("%s %s: no statistics (table does not exist yet)", impact.Statement, impact.Table)
+    }
+
+    if impact.EstimatedRows != nil {
+        return fmt.Sprintf("%s %s: ~%d of %d rows (%s)",
+            impact.Statement, impact.Table, *impact.EstimatedRows, *impact.TableRows, impact.TableSize)
+    }
+
+    return fmt.Sprintf("%s %s: table has %d rows (%s)", impact.Statement, impact.Table, *impact.TableRows, impact.TableSize)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    // progress of CREATE INDEX and REINDEX, PostgreSQL 12 and later
+    CONST_POSTGRESQL_INDEX_PROGRESS = `
+    SELECT
+        phase,
+        blocks_done, blocks_total,
+        tuples_done, tuples_total,
+        relid::regclass::text,
+        COALESCE(NULLIF(index_relid, 0)::regclass::text, '')
+    FROM pg_stat_progress_create_index
+    WHERE pid = $1`
+
+    CONST_POSTGRESQL_VERSION_INDEX_PROGRESS = 120000
+)
+
+var flagIndexProgressInterval = commandLineFlags.Duration("index-progress-interval", 30*time.Second, "while a migration builds indexes (PostgreSQL 12+), report their progress this often (0 disables)")
+
+// interval of index progress reports for migration sql, 0 if it builds no index or the server cannot tell
+func getIndexProgressInterval(sql string) time.Duration {
+    if *flagIndexProgressInterval <= 0 || postgreSQLBackendPID == 0 {
+        return 0
+    }
+
+    createsIndex := false
+    for _, object := range getCreatedObjects(sql) {
+        if object.kind == "index" {
+            createsIndex = true
+        }
+    }
+    if !createsIndex || getServerVersionNum() < CONST_POSTGRESQL_VERSION_INDEX_PROGRESS {
+        return 0
+    }
+
+    return *flagIndexProgressInterval
+}
+
+// get percentage done, based on blocks while scanning and on tuples while sorting and loading
+func getIndexProgressPercentage(blocksDone int64, blocksTotal int64, tuplesDone int64, tuplesTotal int64) string {
+    switch {
+    case blocksTotal > 0:
+        return fmt.Sprintf("%d%%", blocksDone*100/blocksTotal)
+    case tuplesTotal > 0:
+        return fmt.Sprintf("%d%%", tuplesDone*100/tuplesTotal)
+    default:
+        return "?%"
+    }
+}
+
+// print progress of the index the migration is building, nothing while it is doing something else
+func reportIndexProgress(monitoringConnection *pgx.Conn, fileName string) error {
+    var (
+        phase                   string
+        blocksDone, blocksTotal int64
+        tuplesDone, tuplesTotal int64
+        table, index            string
+    )
+
+    err := monitoringConnection.QueryRow(context.Background(), CONST_POSTGRESQL_INDEX_PROGRESS, int32(postgreSQLBackendPID)).Scan(
+        &phase, &blocksDone, &blocksTotal, &tuplesDone, &tuplesTotal, &table, &index)
+    if err == pgx.ErrNoRows {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    if len(index) == 0 {
+        index = "index"
+    }
+
+    fmt.Printf("%s: building %s on %s: %s (%s)\n", fileName, index, table,
+        getIndexProgressPercentage(blocksDone, blocksTotal, tuplesDone, tuplesTotal), phase)
+
+    return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "sort"
+)
+
+const (
+    // indexes left behind by failed CREATE INDEX CONCURRENTLY and constraints added with NOT VALID
+    CONST_POSTGRESQL_INVALID_OBJECTS = `
+    SELECT 'index', i.indexrelid::regclass::text, i.indrelid::regclass::text, ''
+    FROM pg_index i
+    WHERE NOT i.indisvalid
+    UNION ALL
+    SELECT 'constraint', c.conname::text, c.conrelid::regclass::text, c.conname::text
+    FROM pg_constraint c
+    WHERE NOT c.convalidated AND c.conrelid <> 0
+    ORDER BY 1, 3, 2`
+)
+
+var flagValidateConstraints = commandLineFlags.Bool("validate-constraints", false, "for 'up': validate constraints which the migrations added with NOT VALID, after all migrations")
+
+// invalid index or constraint which is not validated
+type invalidObject struct {
+    kind           string
+    name           string
+    table          string
+    constraintName string // unquoted, for VALIDATE CONSTRAINT
+}
+
+// invalid indexes and constraints which are not validated, by kind, table and name
+func getInvalidObjects() map[string]invalidObject {
+    rows, err := postgreSQLConnection.Query(context.Background(), CONST_POSTGRESQL_INVALID_OBJECTS)
+    if err != nil {
+        logError("Error: Could not read invalid indexes and constraints")
+        panic(err)
+    }
+    defer rows.Close()
+
+    objects := make(map[string]invalidObject)
+    for rows.Next() {
+        var object invalidObject
+        err = rows.Scan(&object.kind, &object.name, &object.table, &object.constraintName)
+        if err != nil {
+            panic(err)
+        }
+
+        objects[object.kind+" "+object.table+" "+object.name] = object
+    }
+    if err = rows.Err(); err != nil {
+        panic(err)
+    }
+
+    return objects
+}
+
+// report indexes and constraints which became invalid during this run, validate constraints if asked to
+func checkInvalidObjects(invalidBefore map[string]invalidObject) {
+    invalidAfter := getInvalidObjects()
+
+    var keys []string
+    for key := range invalidAfter {
+        if _, existed := invalidBefore[key]; !existed {
+            keys = append(keys, key)
+        }
+    }
+    sort.Strings(keys)
+
+    for _, key := range keys {
+        object := invalidAfter[key]
+
+        if object.kind == "index" {
+            logError("Warning: Index %s on %s is INVALID, queries do not use it", object.name, object.table)
+            logError("Hint: Drop it with DROP INDEX CONCURRENTLY and build it again, or REINDEX INDEX CONCURRENTLY %s (PostgreSQL 12+)", object.name)
+            continue
+        }
+
+        if !*flagValidateConstraints {
+            logError("Warning: Constraint %s on %s is NOT VALID, existing rows have not been checked", object.name, object.table)
+            logError("Hint: 'up --validate-constraints' validates it after the migrations, or validate it in a later migration")
+            continue
+        }
+
+        // only a SHARE UPDATE EXCLUSIVE lock: reads and writes go on while the rows are checked
+        _, err := postgreSQLConnection.Exec(context.Background(),
+            fmt.Sprintf("ALTER TABLE %s VALIDATE CONSTRAINT %s", object.table, quoteSQLIdentifier(object.constraintName)))
+        if err != nil {
+            logError("Error: Could not validate constraint %s on %s: %s", object.name, object.table, err)
+            logError("Hint: The migrations have been applied, fix the rows which violate the constraint and validate it again")
+            continue
+        }
+
+        fmt.Printf("validated constraint: %s on %s\n", object.name, object.table)
+    }
+}
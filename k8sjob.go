@@ -0,0 +1,91 @@
+package main
+
+import (
+    "fmt"
+    "os"
+)
+
+const (
+    // Job which runs 'up' before a deployment, password is mounted as file from the secret
+    CONST_K8S_JOB_TEMPLATE = `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: %[1]s%[4]s
+spec:
+  backoffLimit: 0
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+        - name: migrate
+          image: %[2]s
+          command: ["go-simple-postgresql-migrate", "up"]
+          env:
+            - name: POSTGRESQL_HOST
+              valueFrom:
+                secretKeyRef: {name: %[3]s, key: host}
+            - name: POSTGRESQL_PORT
+              valueFrom:
+                secretKeyRef: {name: %[3]s, key: port}
+            - name: POSTGRESQL_USER
+              valueFrom:
+                secretKeyRef: {name: %[3]s, key: user}
+            - name: POSTGRESQL_DATABASE
+              valueFrom:
+                secretKeyRef: {name: %[3]s, key: database}
+            - name: POSTGRESQL_PASSWORD_FILE
+              value: /run/secrets/postgresql/password
+          volumeMounts:
+            - name: postgresql-credentials
+              mountPath: /run/secrets/postgresql
+              readOnly: true
+      volumes:
+        - name: postgresql-credentials
+          secret:
+            secretName: %[3]s
+            items:
+              - {key: password, path: password}
+`
+
+    CONST_K8S_HELM_HOOK_ANNOTATIONS = `
+  annotations:
+    "helm.sh/hook": pre-install,pre-upgrade
+    "helm.sh/hook-weight": "-5"
+    "helm.sh/hook-delete-policy": before-hook-creation`
+
+    CONST_K8S_ARGO_HOOK_ANNOTATIONS = `
+  annotations:
+    argocd.argoproj.io/hook: PreSync
+    argocd.argoproj.io/hook-delete-policy: BeforeHookCreation`
+)
+
+var flagImage = commandLineFlags.String("image", "", "for 'generate k8s-job': container image with this tool and the migrations folder")
+var flagJobName = commandLineFlags.String("job-name", "postgresql-migrate", "for 'generate k8s-job': name of the job")
+var flagSecret = commandLineFlags.String("secret", "postgresql-credentials", "for 'generate k8s-job': secret with keys host, port, user, password and database")
+var flagHook = commandLineFlags.String("hook", "", "for 'generate k8s-job': run as 'helm' or 'argo' pre-deploy hook")
+
+// annotations per hook type
+var k8sHookAnnotations = map[string]string{
+    "":     "",
+    "helm": CONST_K8S_HELM_HOOK_ANNOTATIONS,
+    "argo": CONST_K8S_ARGO_HOOK_ANNOTATIONS,
+}
+
+// print Job manifest which runs 'up' as pre-deploy step
+func cmd_generate_k8s_job() {
+    if len(*flagImage) == 0 {
+        logError("Error: Container image is missing")
+        logError("Hint: Use --image to set the image which contains this tool and the %s folder", CONST_MIGRATIONS_FOLDER)
+        os.Exit(1)
+    }
+
+    annotations, ok := k8sHookAnnotations[*flagHook]
+    if !ok {
+        logError("Error: Unknown hook %s, use one of: helm, argo", *flagHook)
+        os.Exit(1)
+    }
+
+    fmt.Printf(CONST_K8S_JOB_TEMPLATE, *flagJobName, *flagImage, *flagSecret, annotations)
+
+    os.Exit(0)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+    "context"
+    "regexp"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    // sessions blocking the migration, with what they are doing and since when
+    CONST_POSTGRESQL_BLOCKING_SESSIONS = `
+    SELECT
+        blocking.pid,
+        COALESCE(blocking.usename::text, ''),
+        COALESCE(blocking.state, ''),
+        COALESCE(EXTRACT(epoch FROM now() - COALESCE(blocking.xact_start, blocking.query_start)), 0)::float8,
+        COALESCE(blocking.query, '')
+    FROM pg_stat_activity blocking
+    WHERE blocking.pid = ANY(pg_blocking_pids($1))
+    ORDER BY blocking.xact_start`
+
+    // queries of blocking sessions are shortened to this length
+    CONST_BLOCKING_QUERY_MAX_LENGTH = 200
+)
+
+var flagLockReportInterval = commandLineFlags.Duration("lock-report-interval", 5*time.Second, "while a migration waits for a lock, report blocking sessions this often (0 disables)")
+
+// connection migrations run on, to watch it from a second connection
+var (
+    postgreSQLConnectionString string
+    postgreSQLBackendPID       uint32
+)
+
+var regexpWhitespace = regexp.MustCompile(`\s+`)
+
+// remember which backend runs the migrations (not known for connections managed by the caller)
+func rememberBackendOf(connection *pgx.Conn, connectionString string) {
+    postgreSQLConnectionString = connectionString
+    postgreSQLBackendPID = connection.PgConn().PID()
+}
+
+// print sessions which block the migration (nothing while it is not waiting for a lock)
+func reportBlockingSessions(monitoringConnection *pgx.Conn, fileName string, waitingSince time.Time) error {
+    rows, err := monitoringConnection.Query(context.Background(), CONST_POSTGRESQL_BLOCKING_SESSIONS, int32(postgreSQLBackendPID))
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var (
+            pid        int32
+            userName   string
+            state      string
+            ageSeconds float64
+            query      string
+        )
+        err = rows.Scan(&pid, &userName, &state, &ageSeconds, &query)
+        if err != nil {
+            return err
+        }
+
+        query = shortenText(regexpWhitespace.ReplaceAllString(query, " "), CONST_BLOCKING_QUERY_MAX_LENGTH)
+
+        logError("Warning: %s is waiting for a lock (%s), blocked by pid %d (user %s, %s for %s): %s",
+            fileName, time.Since(waitingSince).Round(time.Second), pid, userName, state,
+            (time.Duration(ageSeconds) * time.Second).String(), query)
+    }
+
+    return rows.Err()
+}
+
+// ticker channel, nil (never ticks) if interval is not positive
+func getTickerChannel(interval time.Duration) (<-chan time.Time, func()) {
+    if interval <= 0 {
+        return nil, func() {}
+    }
+
+    ticker := time.NewTicker(interval)
+    return ticker.C, ticker.Stop
+}
+
+// watch migration from a second connection until the returned function is called:
+// report blocking sessions and the progress of index builds periodically
+func startMigrationMonitor(fileName string, sql string) func() {
+    lockReportInterval := *flagLockReportInterval
+    indexProgressInterval := getIndexProgressInterval(sql)
+    if postgreSQLBackendPID == 0 || (lockReportInterval <= 0 && indexProgressInterval <= 0) {
+        return func() {}
+    }
+
+    done := make(chan bool)
+    finished := make(chan bool)
+    startedAt := time.Now()
+
+    go func() {
+        defer close(finished)
+
+        lockReportTicks, stopLockReportTicker := getTickerChannel(lockReportInterval)
+        defer stopLockReportTicker()
+        indexProgressTicks, stopIndexProgressTicker := getTickerChannel(indexProgressInterval)
+        defer stopIndexProgressTicker()
+
+        var monitoringConnection *pgx.Conn
+        defer func() {
+            if monitoringConnection != nil {
+                closePostgreSQLConnection(monitoringConnection)
+            }
+        }()
+
+        for {
+            var report func(connection *pgx.Conn) error
+            select {
+            case <-done:
+                return
+            case <-lockReportTicks:
+                report = func(connection *pgx.Conn) error {
+                    return reportBlockingSessions(connection, fileName, startedAt)
+                }
+            case <-indexProgressTicks:
+                report = func(connection *pgx.Conn) error {
+                    return reportIndexProgress(connection, fileName)
+                }
+            }
+
+            // opened only for slow migrations, and only if --max-conns leaves room for it
+            if monitoringConnection == nil {
+                if !tryReserveConnection() {
+                    logError("Warning: Cannot watch migration, --max-conns %d leaves no room for a monitoring connection", *flagMaxConns)
+                    return
+                }
+
+                connectionConfig, err := pgx.ParseConfig(postgreSQLConnectionString)
+                if err == nil {
+                    connectionConfig.RuntimeParams["application_name"] = CONST_TOOL_NAME + "/monitor"
+                    monitoringConnection, err = pgx.ConnectConfig(context.Background(), connectionConfig)
+                }
+                if err != nil {
+                    releaseConnection()
+                    monitoringConnection = nil
+                    logError("Warning: Cannot watch migration, second database connection failed: %s", err)
+                    return
+                }
+            }
+
+            err := report(monitoringConnection)
+            if err != nil {
+                logError("Warning: Cannot watch migration: %s", err)
+                return
+            }
+        }
+    }()
+
+    return func() {
+        close(done)
+        <-finished
+    }
+}
@@ -3,15 +3,18 @@ package main
 import (
     "bufio"
     "context"
+    "flag"
     "fmt"
+    "io/fs"
     "io/ioutil"
     "os"
     "path"
     "regexp"
-    "sort"
     "strings"
     "time"
 
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+    "github.com/jackc/pgconn"
     "github.com/jackc/pgx/v4"
 )
 
@@ -26,47 +29,165 @@ const (
     CONST_ENV_VAR_POSTGRESQL_HOST = "POSTGRESQL_HOST"
     CONST_ENV_VAR_POSTGRESQL_PORT = "POSTGRESQL_PORT"
     CONST_ENV_VAR_POSTGRESQL_PASSWORD = "POSTGRESQL_PASSWORD"
-    CONST_ENV_VAR_POSTGRESQL_PASSWORD_FILE = "POSTGRESQL_PASSWORD_FILE"
     CONST_ENV_VAR_POSTGRESQL_DATABASE = "POSTGRESQL_DATABASE"
 
-    CONST_MIGRATIONS_FOLDER      = "postgresql-migrations"
+    // suffix for reading a value from a (mounted secret) file instead, e.g. POSTGRESQL_PASSWORD_FILE
+    CONST_ENV_VAR_FILE_SUFFIX = "_FILE"
+
+    CONST_MIGRATIONS_FOLDER      = migrate.DefaultFolder
     CONST_DATABASE_INFO_FILENAME = "postgresql-connection-string.txt"
 
-    CONST_POSTGRESQL_TABLE_NAME   = "_go_simple_postgresql_migrate"
-    CONST_POSTGRESQL_TABLE_SCHEMA = "CREATE TABLE IF NOT EXISTS %s (id serial, created_at timestamp with time zone DEFAULT NOW(), filename text, UNIQUE(filename))"
+    // file format and tracking table are shared with the library
+    CONST_POSTGRESQL_TABLE_NAME   = migrate.DefaultTrackingTable
+    CONST_POSTGRESQL_TABLE_SCHEMA = migrate.TrackingTableSchema
 
     CONST_TEMPLATE             = "--\n--   %s\n--\n-- created: %s\n--\n-- FORWARD (UP) migration is below this line:\n--\n\n\n%s\n\n"
-    CONST_TEMPLATE_UNDO_MARKER = "\n--\n-- UNDO (DOWN) migration is below this line:\n-- (do not change this block!)\n--\n"
+    CONST_TEMPLATE_UNDO_MARKER = migrate.UndoMarker
 )
 
-var postgreSQLConnection *pgx.Conn
+// connection all migrations run on; --rollback-at-end replaces it by its transaction
+var postgreSQLConnection databaseConnection
+
+// what migrations need from a connection, satisfied by *pgx.Conn and by pgx.Tx
+// (migrations then run in savepoints, e.g. within transaction-scoped test fixtures)
+type databaseConnection interface {
+    Begin(ctx context.Context) (pgx.Tx, error)
+    Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+    Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+    QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+    Prepare(ctx context.Context, name string, sql string) (*pgconn.StatementDescription, error)
+}
+
+// command line flags, can be given anywhere after the command
+var commandLineFlags = flag.NewFlagSet("go-simple-postgresql-migrate", flag.ContinueOnError)
+
+var flagVerbose = commandLineFlags.Bool("verbose", false, "log what the database driver does (queries, round trips, errors) to STDERR")
+var flagDir = commandLineFlags.String("dir", "", "for 'create': migrations folder (or the folder containing it) to create the file in")
+var flagPrefix = commandLineFlags.String("prefix", "", "for 'create': prefix of the description, e.g. the module name in a monorepo")
 
 // output help
 func cmd_help() {
-    fmt.Printf("%v {init|up|down|create name..|destroy}\n", os.Args[0])
+    fmt.Printf("%v {init|up|down|create name..|destroy} [flags]\n", os.Args[0])
 
     fmt.Println(`
     init        ask for database credentials and create migrations folder
     create      add a new migration file
+                (with --template create-index-concurrently: non-transactional index build with INVALID index check)
+                (with --template add-foreign-key or add-check-constraint: add it NOT VALID,
+                 and validate it in a linked post-deploy migration)
+                (with --template change-column-type: new column synced by a trigger, a backfill file,
+                 and a linked post-deploy migration which swaps the columns)
+                (with --check-remote: warn if it sorts before the latest migration applied to the database,
+                 or listed in --remote-lock-file, e.g. origin/main:migrations.lock)
+                (with --dir folder and --prefix module: in another migrations folder, e.g. in a monorepo)
     create-here add a new migration file in current folder (no checks)
-    up          do forward migrations until database is up to date
+    up          do forward migrations until database is up to date,
+                then re-apply grants.sql (if present)
+                (with --to-script: write SQL script for psql instead)
+                (with --rollback-at-end: roll everything back at the end)
+                (with --validate-constraints: validate constraints the migrations added with NOT VALID)
+                (with --summary-file summary.md: write a Markdown deployment summary)
+                (with --progress-file file: write progress events as JSON lines, e.g. for a progress UI)
+                (with --deadline 10m: give up after this long, the running statement is cancelled on the server)
+                (with --rollback-at-end --verify-down: run down migrations too, record them as verified)
+                (with --schemas or --schemas-query: migrate many schemas concurrently)
+    rehearse    run pending migrations on a scratch copy of the database, then drop it
+    env create database [--template database]
+                create database for an ephemeral environment (e.g. a pull request preview),
+                run all migrations and seeds.sql
+    env drop database
+                drop database of an ephemeral environment
+    export-schema [--for sqlc|sql]
+                write the schema (without the tables of this tool) to the schema-export file or STDOUT,
+                e.g. as schema file for sqlc; with schema-export set, 'up' refreshes it after applying migrations
+    test-database
+                start a disposable PostgreSQL in docker, run all migrations and print its connection string
+                (with --postgres-image image: use this image, default postgres:13-alpine)
+                (with --clone dump: copy schema with pg_dump instead of CREATE DATABASE ... TEMPLATE)
+    status      show applied & pending migrations and who is running migrations right now
+    assert-current [--expect migration|lockfile]
+                for readiness probes: exit 0 only if the database has exactly the expected migrations
+                (default: the local migration files)
+    history     show applied migrations with time, duration and owner
+    at time     show migrations applied at this time, e.g. "2024-06-01T00:00", including archived ones
+                (with --dump: print their up parts, which recreate the schema of that time)
+    changelog [--since migration|YYYY-MM-DD]
+                summarize schema changes of migrations as Markdown, e.g. for release notes
+    plan        show pending migrations and their plan hash (for 'up --expected-plan-hash')
+    request-apply
+                record pending migrations for approval by another database role
+    approve id  approve a request, then 'up --approved id' applies it (needed with require-approval)
     down        do exactly ONE backwards migration
     destroy     do all backwards migrations at once
+                (with --drop-objects: drop objects created by migrations instead, e.g. for test databases)
+    cancel      cancel the statement of a running 'up', 'down' or 'ci' (e.g. from another terminal)
+    freeze [reason..]
+                refuse 'up', 'down' and 'ci' until 'unfreeze' (e.g. during an incident or a release freeze)
+    unfreeze    allow schema changes again
+    validate    check all migration files (without database connection)
+                (with --make-idempotent: suggest IF NOT EXISTS / IF EXISTS / OR REPLACE, with --fix: rewrite files)
+    ci          for pipelines: validate, plan & up, JSON on STDOUT, Markdown summary (see README)
+    prune-history [--keep 500]
+                move all but the newest applied migrations into a history table
+    export-durations
+                print durations of applied migrations as JSON (for durations.json of other environments)
+    post-restore
+                fix up tracking table after restoring a pg_dump and compare it with local files
+    config show
+                show effective configuration and where each value comes from
+    support-bundle
+                write tarball with config, status, audit log and versions for bug reports (no credentials)
+    support-bundle replay <file>
+                print a support bundle and compare its migration files with the local folder
+    version     show version of this tool
+    self-update replace this executable with the latest release (checksum & signature verified)
+    verify-connection
+                show which connection settings are used, connect and show server & role
+    partitions  apply partitions.sql (run it regularly, e.g. with a cron job)
+    partitions-template table day|week|month|year count
+                print sql which creates upcoming partitions of a table
+    generate k8s-job --image image [--hook helm|argo]
+                print kubernetes Job manifest which runs 'up' before a deployment
+    generate rollback --batch n|--since migration
+                print one psql script with the down parts of the last migrations and the tracking table deletes,
+                for rollbacks which are reviewed and run by hand (also: generate-rollback)
+    compare --a connection-string --b connection-string
+                show schema differences between two databases
+    owners      list objects created by migrations with their owners and grants
+    check-grants
+                show how grants in database differ from grants.sql
+    apply -     read a migration (or a tar archive of migrations) from STDIN,
+                add it to the migrations folder and run 'up'
+    enum type value..
+                create migration which changes enum type to exactly these values
+    enum-rename-value type old new
+                create migration which renames a value of an enum type
+    backfill    run a backfill file in batches, each batch in its own transaction
+    backfill-template
+                print an example backfill file
     `)
 
+    fmt.Println("Flags:")
+    commandLineFlags.SetOutput(os.Stdout)
+    commandLineFlags.PrintDefaults()
+
     fmt.Printf(`
     Hint: Provide the PostgreSQL connection string via environment variables:
         %s (default: "%s")
-        %s (default: "%s") or from file via %s
         %s (default: "%s")
         %s (default: "%s")
         %s (default: "%s")
+        %s (default: "%s")
+
+    Each of them can also be read from a file (e.g. a mounted secret) by
+    appending %s to the variable name, e.g. %s%s
     `, 
     CONST_ENV_VAR_POSTGRESQL_USER, DEFAULT_USER, 
-    CONST_ENV_VAR_POSTGRESQL_PASSWORD, DEFAULT_PASSWORD, CONST_ENV_VAR_POSTGRESQL_PASSWORD_FILE,
+    CONST_ENV_VAR_POSTGRESQL_PASSWORD, DEFAULT_PASSWORD,
     CONST_ENV_VAR_POSTGRESQL_DATABASE, DEFAULT_DATABASE,
     CONST_ENV_VAR_POSTGRESQL_HOST, DEFAULT_HOST, 
-    CONST_ENV_VAR_POSTGRESQL_PORT, DEFAULT_PORT)
+    CONST_ENV_VAR_POSTGRESQL_PORT, DEFAULT_PORT,
+    CONST_ENV_VAR_FILE_SUFFIX, CONST_ENV_VAR_POSTGRESQL_PASSWORD, CONST_ENV_VAR_FILE_SUFFIX)
 
     os.Exit(0)
 }
@@ -74,6 +195,7 @@ func cmd_help() {
 // log error messages
 func logError(message string, args ...interface{}) {
     fmt.Fprintf(os.Stderr, message+"\n", args...)
+    recordSummaryWarning(fmt.Sprintf(message, args...))
 }
 
 // read user input from STDIN (allows default value)
@@ -115,8 +237,7 @@ func getDatabaseConnectionStringFromUser() string {
     database := readFromStdIn("database", DEFAULT_DATABASE)
 
     // convert into PostgreSQL connection string
-    connectionString := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s",
-        user, password, host, port, database)
+    connectionString := buildConnectionString(host, port, user, password, database, "")
 
     // if successful, return connection string
     return connectionString
@@ -134,57 +255,26 @@ func writeStringToFile(filePath string, strData string) {
     file.Close()
 }
 
-// get connection string from environment
-func getDatabaseConnectionStringFromEnvironment() string {
-    useConnectionStringFromEnvironment := false
-
-    user := DEFAULT_USER
-    if len(os.Getenv(CONST_ENV_VAR_POSTGRESQL_USER)) > 0 {
-        user = os.Getenv(CONST_ENV_VAR_POSTGRESQL_USER)
-        useConnectionStringFromEnvironment = true
-    }
-
-    password := DEFAULT_PASSWORD
-    if len(os.Getenv(CONST_ENV_VAR_POSTGRESQL_PASSWORD)) > 0 {
-        password = os.Getenv(CONST_ENV_VAR_POSTGRESQL_PASSWORD)
-        useConnectionStringFromEnvironment = true
-    }
-
-    if len(os.Getenv(CONST_ENV_VAR_POSTGRESQL_PASSWORD_FILE)) > 0 {
-        filePath := os.Getenv(CONST_ENV_VAR_POSTGRESQL_PASSWORD_FILE)
-        fileContent, err := ioutil.ReadFile(filePath)
-
-        if err != nil {
-            panic(err)
-        }
-
-        password = string(fileContent)
-    }
-    
-    host := DEFAULT_HOST
-    if len(os.Getenv(CONST_ENV_VAR_POSTGRESQL_HOST)) > 0 {
-        host = os.Getenv(CONST_ENV_VAR_POSTGRESQL_HOST)
-        useConnectionStringFromEnvironment = true
+// read value from environment variable, or from the file referenced by
+// the variable with _FILE suffix (convention of the official docker images)
+func getValueFromEnvironment(envVarName string) (string, bool) {
+    if len(os.Getenv(envVarName)) > 0 {
+        return os.Getenv(envVarName), true
     }
 
-    port := DEFAULT_PORT
-    if len(os.Getenv(CONST_ENV_VAR_POSTGRESQL_PORT)) > 0 {
-        port = os.Getenv(CONST_ENV_VAR_POSTGRESQL_PORT)
-        useConnectionStringFromEnvironment = true
+    filePath := os.Getenv(envVarName + CONST_ENV_VAR_FILE_SUFFIX)
+    if len(filePath) == 0 {
+        return "", false
     }
 
-    database := DEFAULT_DATABASE
-    if len(os.Getenv(CONST_ENV_VAR_POSTGRESQL_DATABASE)) > 0 {
-        database = os.Getenv(CONST_ENV_VAR_POSTGRESQL_DATABASE)
-        useConnectionStringFromEnvironment = true
-    }
-    
-
-    if !useConnectionStringFromEnvironment {
-        return ""
+    fileContent, err := ioutil.ReadFile(filePath)
+    if err != nil {
+        logError("Error: Could not read %s from file: %s", envVarName, filePath)
+        panic(err)
     }
 
-    return "postgresql://" + user + ":" + password + "@" + host + ":" + port + "/" + database
+    // mounted secrets usually end with a newline
+    return strings.TrimRight(string(fileContent), "\r\n"), true
 }
 
 // initiate the versioning
@@ -209,12 +299,14 @@ func cmd_init() {
         os.Exit(1)
     }
 
-    // get connection info from environment variable
-    connectionString := getDatabaseConnectionStringFromEnvironment()
+    // get connection info from flags, environment variables or config file
+    connectionString := ""
     storeConnectionStringAsFile := false
 
-    // ask user for connection info
-    if len(connectionString) == 0 {
+    if isDatabaseConnectionConfigured() {
+        connectionString, _ = getDatabaseConnectionString()
+    } else {
+        // ask user for connection info
         connectionString = getDatabaseConnectionStringFromUser()
         storeConnectionStringAsFile = true
     }
@@ -231,466 +323,1004 @@ func cmd_init() {
     connectToStoredDatabaseConnection()
 
     // create initial tables
-    _, err = postgreSQLConnection.Exec(
-        context.Background(),
-        fmt.Sprintf(CONST_POSTGRESQL_TABLE_SCHEMA, CONST_POSTGRESQL_TABLE_NAME))
-    if err != nil {
-        logError("Error: Failed to create initial table")
-        panic(err)
-    }
+    createTrackingTable()
 
-    fmt.Println("Successfully set up migrations table at", CONST_POSTGRESQL_TABLE_NAME)
+    fmt.Println("Successfully set up migrations table at", trackingTableName)
 
     os.Exit(0)
 }
 
-// get connection string from file
-func getDatabaseConnectionStringFromFile() string {
-    filePath := path.Join(CONST_MIGRATIONS_FOLDER, CONST_DATABASE_INFO_FILENAME)
-    connectionString, err := ioutil.ReadFile(filePath)
+// attempt PostgreSQL connection and return db object
+func connectToPostgreSQL(connectionString string) {
+    connection := openPostgreSQLConnection(connectionString)
+    rememberBackendOf(connection, connectionString)
+
+    // write commands would fail late and cryptic on a read replica
+    checkReplicaConnection(connection)
 
-    // file does not exist or cannot be read
+    postgreSQLConnection = connection
+}
+
+// open new PostgreSQL connection
+func openPostgreSQLConnection(connectionString string) *pgx.Conn {
+    connectionConfig, err := pgx.ParseConfig(connectionString)
     if err != nil {
-        logError("Error: Could not read connection details from: %s", filePath)
-        logError("Hint: Maybe you should run 'init' first?")
+        logError("Error: Invalid connection string %s", connectionString)
         panic(err)
     }
 
-    return string(connectionString)
-}
+    // released by closePostgreSQLConnection, the main connection is kept until the process exits
+    reserveConnection()
+
+    // print RAISE NOTICE/WARNING output of migrations
+    connectionConfig.OnNotice = handleServerNotice
+
+    // server logs and pg_stat_activity show which tool (and version) is connected, unless the connection string says otherwise
+    if _, ok := connectionConfig.RuntimeParams["application_name"]; !ok {
+        connectionConfig.RuntimeParams["application_name"] = getApplicationName("")
+        stampApplicationName = true
+    }
+
+    // database only reachable through a jump host or a proxy, its name is resolved on the other side
+    if dialFunc := getTunnelDialFunc(); dialFunc != nil {
+        connectionConfig.DialFunc = dialFunc
+        connectionConfig.LookupFunc = func(ctx context.Context, host string) ([]string, error) {
+            return []string{host}, nil
+        }
+    }
+
+    // nothing can be written by accident with --replica, even if it points at the primary
+    if *flagReplica {
+        connectionConfig.RuntimeParams["default_transaction_read_only"] = "on"
+    }
+
+    // separate schema per tenant
+    if len(*flagSchema) > 0 {
+        connectionConfig.RuntimeParams["search_path"] = getSchemaSearchPath(*flagSchema)
+    }
+
+    // show what the driver is doing
+    if *flagVerbose {
+        connectionConfig.Logger = &driverLogger{}
+        connectionConfig.LogLevel = pgx.LogLevelDebug
+    }
+
+    connection, err := pgx.ConnectConfig(context.Background(), connectionConfig)
+
+    // e.g. during an incident the application took all connection slots, reserved ones are left for the maintenance role
+    if err != nil && isTooManyConnectionsError(err) && isMaintenanceConnectionConfigured() {
+        maintenanceConnectionString := getMaintenanceConnectionString(connectionString)
+        if maintenanceConnectionString != connectionString {
+            logError("Warning: Connection limit reached, connecting with the maintenance settings instead")
+            releaseConnection()
+            return openPostgreSQLConnection(maintenanceConnectionString)
+        }
+    }
 
-// attempt PostgreSQL connection and return db object
-func connectToPostgreSQL(connectionString string) {
-    var err error
-    postgreSQLConnection, err = pgx.Connect(context.Background(), connectionString)
     if err != nil {
         logError("Error: Failed to create database connection with connection string %s", connectionString)
         panic(err)
     }
+
+    return connection
 }
 
-// retrieve database cursor
+// retrieve database cursor, connects only once
 func connectToStoredDatabaseConnection() {
-    // get connection info from environment variable
-    connectionString := getDatabaseConnectionStringFromEnvironment()
-
-    // fallback: attempt to read from file
-    if len(connectionString) == 0 {
-        connectionString = getDatabaseConnectionStringFromFile()
+    if postgreSQLConnection != nil {
+        return
     }
 
-    connectToPostgreSQL(connectionString)
-}
+    connectionString, _ := getDatabaseConnectionString()
 
-// create new migration file
-func cmd_create(fileName string) {
-    // check if DB config file already exists
-    filePath := path.Join(CONST_MIGRATIONS_FOLDER, CONST_DATABASE_INFO_FILENAME)
-    _, err := os.Stat(filePath)
-    if os.IsNotExist(err) {
-        logError("Error: Database configuration file not found: %s", filePath)
-        logError("Hint: Did you run the 'init' command? Are you in the wrong folder?")
-        os.Exit(1)
+    if *flagMaintenanceConnection {
+        if !isMaintenanceConnectionConfigured() {
+            logError("Error: --maintenance-connection needs maintenance-user or maintenance-parameters")
+            os.Exit(1)
+        }
+        connectionString = getMaintenanceConnectionString(connectionString)
     }
 
-    // sanitize filename
-    reFileName := regexp.MustCompile("[^a-zA-Z0-9-_]")
-    sanitizedFileName := string(reFileName.ReplaceAll([]byte(strings.TrimSpace(fileName)), []byte("")))
-
-    reTimestamp := regexp.MustCompile("[^0-9]")
-    timestamp := time.Now().UTC()
-
-    timestampForFileName := timestamp.Format(time.RFC3339)
-    timestampForFileName = string(reTimestamp.ReplaceAll([]byte(timestampForFileName), []byte("")))
+    connectToPostgreSQL(connectionString)
+}
 
-    migrationFileName := timestampForFileName + "-" + sanitizedFileName + ".sql"
+// write new migration file with given up/down sql into folder, returns path of file
+func createMigrationFile(folderPath string, fileName string, sqlForward string, sqlBackward string) string {
+    return createMigrationFileAt(folderPath, fileName, sqlForward, sqlBackward, time.Now().UTC())
+}
 
-    // check if file already exists
-    filePath = path.Join(CONST_MIGRATIONS_FOLDER, migrationFileName)
-    _, err = os.Stat(filePath)
-    if !os.IsNotExist(err) {
-        logError("Error: migration file does already exist: %s", filePath)
-        os.Exit(1)
+// write new migration file with the given timestamp, e.g. one second after a migration it follows up on
+func createMigrationFileAt(folderPath string, fileName string, sqlForward string, sqlBackward string, timestamp time.Time) string {
+    if *flagMakeIdempotent {
+        sqlForward = makeIdempotent(sqlForward)
+        sqlBackward = makeIdempotent(sqlBackward)
     }
 
+    sanitizedFileName, filePath := getNewMigrationFilePath(folderPath, fileName, timestamp)
+
     // write template to file
     writeStringToFile(filePath, fmt.Sprintf(CONST_TEMPLATE,
         sanitizedFileName,
         timestamp.Format(time.RFC850),
-        CONST_TEMPLATE_UNDO_MARKER))
-
-    fmt.Println("created", filePath)
+        sqlForward+CONST_TEMPLATE_UNDO_MARKER+sqlBackward))
 
-    os.Exit(0)
+    return filePath
 }
 
-// create new migration file right here in this folder
-func cmd_create_here(fileName string) {
+// get sanitized description and path for new migration file, exits if file already exists
+func getNewMigrationFilePath(folderPath string, fileName string, timestamp time.Time) (string, string) {
     // sanitize filename
-    reFileName := regexp.MustCompile("[^a-zA-Z0-9-_]")
-    sanitizedFileName := string(reFileName.ReplaceAll([]byte(strings.TrimSpace(fileName)), []byte("")))
+    sanitizedFileName := sanitizeMigrationDescription(fileName)
 
     reTimestamp := regexp.MustCompile("[^0-9]")
-    timestamp := time.Now().UTC()
 
     timestampForFileName := timestamp.Format(time.RFC3339)
     timestampForFileName = string(reTimestamp.ReplaceAll([]byte(timestampForFileName), []byte("")))
 
-    migrationFileName := timestampForFileName + "-" + sanitizedFileName + ".sql"
+    migrationFileName := timestampForFileName + "-" + sanitizedFileName + getMigrationFileExtensions()[0]
+
+    if !isMigrationFileName(migrationFileName) {
+        logError("Error: migration file name %s does not match filename-pattern %s",
+            migrationFileName, getMigrationFileNamePattern())
+        logError("Hint: Create migration files with your naming convention by hand")
+        os.Exit(1)
+    }
 
     // check if file already exists
-    workDir, _ := os.Getwd()
-    filePath := path.Join(workDir, migrationFileName)
+    filePath := path.Join(folderPath, migrationFileName)
     _, err := os.Stat(filePath)
     if !os.IsNotExist(err) {
         logError("Error: migration file does already exist: %s", filePath)
         os.Exit(1)
     }
 
-    // write template to file
-    writeStringToFile(filePath, fmt.Sprintf(CONST_TEMPLATE,
-        sanitizedFileName,
-        timestamp.Format(time.RFC850),
-        CONST_TEMPLATE_UNDO_MARKER))
+    return sanitizedFileName, filePath
+}
 
-    fmt.Println("created", filePath)
+// exit if 'init' has not been run in this folder (and connection is not configured otherwise)
+func checkDatabaseConfigurationFileExists() {
+    filePath := path.Join(CONST_MIGRATIONS_FOLDER, CONST_DATABASE_INFO_FILENAME)
+    _, err := os.Stat(filePath)
+    if os.IsNotExist(err) {
+        // connection given by flags, environment variables or config file
+        if _, err := os.Stat(CONST_MIGRATIONS_FOLDER); err == nil && isDatabaseConnectionConfigured() {
+            return
+        }
 
-    os.Exit(0)
+        logError("Error: Database configuration file not found: %s", filePath)
+        logError("Hint: Did you run the 'init' command? Are you in the wrong folder?")
+        os.Exit(1)
+    }
 }
 
+// get migrations folder given with --dir, either the folder itself or a project folder containing it
+func getMigrationsFolderOf(dir string) string {
+    for _, folderPath := range []string{path.Join(dir, CONST_MIGRATIONS_FOLDER), dir} {
+        stat, err := os.Stat(folderPath)
+        if err == nil && stat.IsDir() && path.Base(path.Clean(folderPath)) == CONST_MIGRATIONS_FOLDER {
+            return folderPath
+        }
+    }
 
-// fetch  migrations from database
-func getMigrationsFromDatabase() []string {
-    connectToStoredDatabaseConnection()
+    logError("Error: No migrations folder %s found in %s", CONST_MIGRATIONS_FOLDER, dir)
+    logError("Hint: Use --dir with a folder named %s or the folder which contains it", CONST_MIGRATIONS_FOLDER)
+    os.Exit(1)
+    return ""
+}
 
-    rows, err := postgreSQLConnection.Query(context.Background(),
-        fmt.Sprintf("SELECT filename FROM %s ORDER BY id ASC", CONST_POSTGRESQL_TABLE_NAME))
-    if err != nil {
-        logError("Error: could not read migrations from database table %s", CONST_POSTGRESQL_TABLE_NAME)
-        panic(err)
+// create new migration file
+func cmd_create(fileName string) {
+    folderPath := migrationsFolder
+    if len(*flagDir) > 0 {
+        folderPath = getMigrationsFolderOf(*flagDir)
+    } else {
+        // check if DB config file already exists
+        checkDatabaseConfigurationFileExists()
     }
 
-    var filename string
-    var migrationsInDatabase []string
-    for rows.Next() {
-        err := rows.Scan(&filename)
-        if err != nil {
-            logError("Error: could not read migrations from database table %s: unable to scan row into filename", CONST_POSTGRESQL_TABLE_NAME)
-            panic(err)
-        }
+    // e.g. module of a monorepo
+    if len(*flagPrefix) > 0 {
+        fileName = *flagPrefix + "-" + fileName
+    }
 
-        migrationsInDatabase = append(migrationsInDatabase, filename)
+    if len(*flagTemplate) > 0 {
+        createMigrationFilesFromTemplate(folderPath, *flagTemplate, fileName)
+        os.Exit(0)
     }
 
-    err = rows.Err()
-    if err != nil {
-        logError("Error: could not read migrations from database table %s: row error", CONST_POSTGRESQL_TABLE_NAME)
-        panic(err)
+    filePath := createMigrationFile(folderPath, fileName, "", "")
+
+    fmt.Println("created", filePath)
+    checkRemoteMigrationOrder(filePath)
+
+    os.Exit(0)
+}
+
+// create new migration file right here in this folder
+func cmd_create_here(fileName string) {
+    workDir, _ := os.Getwd()
+    filePath := createMigrationFile(workDir, fileName, "", "")
+
+    fmt.Println("created", filePath)
+
+    os.Exit(0)
+}
+
+// fetch  migrations from database
+func getMigrationsFromDatabase() []string {
+    var migrationsInDatabase []string
+    for _, migration := range getAppliedMigrations() {
+        migrationsInDatabase = append(migrationsInDatabase, migration.FileName)
     }
 
     return migrationsInDatabase
 }
 
+// file system the migrations folder is read from; a binary which embeds its migrations sets it to
+// its embed.FS, e.g. with "//go:embed postgresql-migrations" in a file of package main
+var migrationFileSystem fs.FS = os.DirFS(".")
+
+// read file of the migrations folder
+func readMigrationFile(fileName string) ([]byte, error) {
+    return fs.ReadFile(migrationFileSystem, path.Join(migrationsFolder, fileName))
+}
+
 // fetch migrations from filesystem
 func getMigrationsFromFileSystem() []string {
-    files, err := ioutil.ReadDir(CONST_MIGRATIONS_FOLDER)
+    // exits on an invalid filename-pattern
+    getMigrationFileNamePattern()
+
+    migrationsInFileSystem, err := listMigrationsFromFileSystem()
     if err != nil {
-        panic(err)
+        logError("Error: %s", err)
+        logError("Hint: A migration must not exist with two extensions, remove one of them")
+        os.Exit(1)
     }
 
-    reMigrationFile := regexp.MustCompile("^[0-9]{14}-[a-zA-Z0-9_-]+.sql$")
+    return migrationsInFileSystem
+}
 
-    var migrationsInFileSystem []string
-    for _, file := range files {
-        if reMigrationFile.MatchString(file.Name()) {
-            migrationsInFileSystem = append(migrationsInFileSystem, file.Name())
-        }
+// see getMigrationsFromFileSystem, error instead of exit
+func listMigrationsFromFileSystem() ([]string, error) {
+    pattern, err := compileMigrationFileNamePattern()
+    if err != nil {
+        return nil, err
     }
 
-    sort.Strings(migrationsInFileSystem)
+    migrationsInFileSystem, err := migrate.NewSource(migrationFileSystem, migrationsFolder, pattern, getMigrationFileExtensions()).List()
+    if err != nil {
+        return nil, fmt.Errorf("Could not read migrations from local folder %s: %s", migrationsFolder, err)
+    }
 
-    return migrationsInFileSystem
+    return migrationsInFileSystem, nil
 }
 
-// read migration from file
-func readMigrationFromFile(fileName string) (string, string) {
-    filePath := path.Join(CONST_MIGRATIONS_FOLDER, fileName)
-    fileContentBytes, err := ioutil.ReadFile(filePath)
+// read migration from file, split into raw up/down parts (including comments)
+func readMigrationPartsFromFile(fileName string) (string, string) {
+    filePath := path.Join(migrationsFolder, fileName)
+    fileContentBytes, err := readMigrationFile(fileName)
 
     if err != nil {
         logError("Error: Could not read file %s", filePath)
         panic(err)
     }
 
-    fileContent := string(fileContentBytes)
-
-    // check if separator exists in in file
-    if !strings.Contains(fileContent, CONST_TEMPLATE_UNDO_MARKER) {
-        logError("Error: Could not find the separator in file %s", filePath)
+    // split file content into up/down migration
+    rawMigrationForward, rawMigrationBackward, err := migrate.SplitMigration(string(fileContentBytes))
+    if err != nil {
+        logError("Error: Invalid file %s: %s", filePath, err)
         logError("Hint: Make sure this string splits up the up/down migration in the file:")
         logError(CONST_TEMPLATE_UNDO_MARKER)
         os.Exit(1)
     }
 
-    // split file content into up/down migration
-    arrParts := strings.Split(fileContent, CONST_TEMPLATE_UNDO_MARKER)
+    return rawMigrationForward, rawMigrationBackward
+}
 
-    // check if array has sane length
-    if len(arrParts) != 2 {
-        logError("Error: Found separator in file %s, but after splitting there is an array with %d elements instead of 2 as we expected.",
-            filePath, len(arrParts))
-        os.Exit(2)
-    }
+// read migration from file
+func readMigrationFromFile(fileName string) (string, string) {
+    filePath := path.Join(migrationsFolder, fileName)
+    rawMigrationForward, rawMigrationBackward := readMigrationPartsFromFile(fileName)
 
-    sqlMigrationForward := cleanUpSQLString(arrParts[0])
-    if len(sqlMigrationForward) == 0 {
+    sqlMigrationForward := expandTemplateVariables(cleanUpSQLString(rawMigrationForward), fileName)
+    if len(sqlMigrationForward) == 0 && !hasAnnotation(parseAnnotations(rawMigrationForward), CONST_ANNOTATION_NOOP) {
         logError("Error: Forward (UP) migration is empty in file %s", filePath)
+        logError("Hint: Mark it with '-- migrate:noop' if it is intentionally empty")
         os.Exit(3)
     }
 
-    sqlMigrationBackward := cleanUpSQLString(arrParts[1])
-    if len(sqlMigrationBackward) == 0 {
+    sqlMigrationBackward := expandTemplateVariables(cleanUpSQLString(rawMigrationBackward), fileName)
+    if len(sqlMigrationBackward) == 0 && !hasAnnotation(parseAnnotations(rawMigrationBackward), CONST_ANNOTATION_NOOP) {
         logError("Error: Backward (DOWN) migration is empty in file %s", filePath)
+        logError("Hint: Mark it with '-- migrate:noop' if it is intentionally empty")
         os.Exit(3)
     }
 
     return sqlMigrationForward, sqlMigrationBackward
 }
 
-// clean up SQL string read from migration file
+// clean up SQL string read from migration file: without comments and surrounding whitespace
 func cleanUpSQLString(sqlString string) string {
-    // remove SQL comments
-    reSQLComments := regexp.MustCompile("(?m)^--[^\n]*$")
-    sqlString = string(reSQLComments.ReplaceAll([]byte(sqlString), []byte("")))
-
-    // remove whitespace
-    sqlString = strings.TrimSpace(sqlString)
+    return migrate.CleanUpSQL(sqlString)
+}
 
-    return sqlString
+// remember under which name local migrations are stored in the database, for renamed ones
+func rememberDatabaseFileNames(status *migrate.Status) {
+    for _, migration := range status.Applied {
+        if len(migration.LocalFileName) > 0 {
+            databaseFileNames[migration.LocalFileName] = migration.FileName
+        }
+    }
 }
 
-// check consistency of migrations in database & local filesystem
+// check consistency of migrations in database & local filesystem,
+// returns local files (applied ones first) and applied migrations by local file name
 func checkConsistencyOfDatabaseAndLocalFileSystem() ([]string, []string) {
-    // read migrations files from local folder
-    migrationsInFileSystem := getMigrationsFromFileSystem()
+    return checkMigrationStatus(getMigrationStatus())
+}
 
-    // check if we have migrations at all
-    if len(migrationsInFileSystem) == 0 {
-        logError("Error: No migration files found in local folder %s", CONST_MIGRATIONS_FOLDER)
-        logError("Hint: Maybe you need to run 'create' first?")
-        os.Exit(1)
-    }
+// check local files of status, returns local files (applied ones first) and applied migrations by local file name
+func checkMigrationStatus(status *migrate.Status) ([]string, []string) {
+    rememberDatabaseFileNames(status)
 
-    // check if local migration files are well-formed
-    for _, fileNameFromFileSystem := range migrationsInFileSystem {
-        _, _ = readMigrationFromFile(fileNameFromFileSystem)
-    }
+    migrationsInDatabase := status.AppliedFiles
+    migrationsInFileSystem := append(append([]string{}, status.AppliedFiles...), status.Pending...)
+
+    // check if pending migration files are well-formed,
+    // applied ones have been checked before they were applied
+    validateMigrationFiles(status.Pending)
+    warnAboutNewerToolRequirements(migrationsInDatabase)
+
+    return migrationsInFileSystem, migrationsInDatabase
+}
+
+// migrations 'up' and 'ci' work on
+type upPlan struct {
+    migrationsInFileSystem []string
+    migrationsInDatabase   []string
+
+    // what 'up' applies, for plan hash and approvals
+    migrationPlan *migrate.Plan
 
-    // read migrations from database
-    migrationsInDatabase := getMigrationsFromDatabase()
+    // pending migrations until the phase of --until-phase
+    pendingMigrations []string
 
-    // check if # of migrations makes sense
-    if len(migrationsInDatabase) > len(migrationsInFileSystem) {
-        logError("Error: Missing local migration files. There are more migrations stored in the database (%d) than in local folder %s (%d)",
-            len(migrationsInDatabase), CONST_MIGRATIONS_FOLDER, len(migrationsInFileSystem))
+    // skipped migrations which the tags select now, and pending ones which they skip
+    catchUpMigrations []string
+    skippedBy         map[string]string
+
+    // migrations which will run: catch-up and pending ones which are not skipped
+    delta []string
+}
+
+// check consistency and select the migrations to apply, with every check which can fail before anything is applied
+// (except approvals: 'ci' only needs them when it applies); needs the run lock and the tracking table
+func planUp() upPlan {
+    var plan upPlan
+
+    if isTagSelectionActive() && *flagVerifyDown {
+        logError("Error: --verify-down cannot be used together with --skip-tag or --only-tag")
         os.Exit(1)
     }
 
-    // check if migrations listed in database also exist in file system
-    for index, filenameFromDatabase := range migrationsInDatabase {
-        if filenameFromDatabase != migrationsInFileSystem[index] {
-            logError("Error: Migration stored in database at position #%d (%s) does not match local migration file %s",
-                index, filenameFromDatabase, migrationsInFileSystem[index])
-            os.Exit(2)
-        }
-    }
+    // perform consistency checks; blue/green deployments: e.g. only pre-deploy migrations before the new code ships;
+    // with --skip-tag & --only-tag, migrations skipped before might run now and pending ones might only be recorded as skipped
+    migrationPlan := getMigrationPlan()
+    plan.migrationPlan = migrationPlan
+    plan.migrationsInFileSystem, plan.migrationsInDatabase = checkMigrationStatus(migrationPlan.Status)
+    plan.pendingMigrations = migrationPlan.Pending
+    plan.catchUpMigrations, plan.skippedBy = migrationPlan.CatchUp, migrationPlan.SkippedBy
 
-    return migrationsInFileSystem, migrationsInDatabase
+    // applied files which have been edited since
+    checkChecksumsOfAppliedMigrations(migrationPlan.Status)
+
+    // objects created by hand (e.g. a hotfix) let migrations fail halfway
+    checkExistingObjects(withoutSkippedMigrations(plan.pendingMigrations, plan.skippedBy), plan.skippedBy)
+    plan.delta = migrationPlan.Migrations()
+
+    // a syntax error in the last pending migration would leave the ones before it applied
+    checkSyntaxOfMigrations(plan.delta)
+
+    // apply only what has been planned
+    checkExpectedPlanHash(migrationPlan)
+
+    // slow in staging is slow in production
+    checkDurationBudget(plan.delta)
+
+    // e.g. MERGE needs PostgreSQL 15, fail before anything has been applied
+    checkServerVersionRequirements(plan.delta, true)
+
+    // e.g. analytics views on tables of the core component
+    checkRequiredMigrations(plan.delta)
+
+    // dropped published columns break CDC pipelines silently
+    checkLogicalReplication(plan.delta, true)
+
+    return plan
 }
 
 // migrate towards latest version of db
 func cmd_up() {
-    // perform consistency checks
-    migrationsInFileSystem, migrationsInDatabase := checkConsistencyOfDatabaseAndLocalFileSystem()
+    // tracking table per schema
+    if len(*flagSchema) > 0 {
+        prepareSchema()
+    }
+
+    // page the owning team when a migration fails
+    defer reportMigrationErrorOnPanic("up")
+    defer emitProgressEventOnPanic()
+
+    // deployment summary of failed runs as well
+    defer writeDeploymentSummaryOnPanic()
+
+    // concurrent runs wait, and find nothing pending afterwards; taken first, so they do not create the tracking table at once
+    defer lockRun()()
+
+    // incident response or release freeze, checked with the lock held so a freeze cannot slip in before the run
+    checkMigrationFreeze()
+
+    // first run, e.g. in a container with connection settings from environment variables
+    createTrackingTable()
+
+    // 'cancel' from another terminal finds this run
+    recordRun()
+
+    // everything which can fail before anything is applied
+    plan := planUp()
+    migrationsInFileSystem, migrationsInDatabase := plan.migrationsInFileSystem, plan.migrationsInDatabase
+    pendingMigrations, catchUpMigrations, skippedBy, delta := plan.pendingMigrations, plan.catchUpMigrations, plan.skippedBy, plan.delta
+
+    // four-eyes control in protected environments
+    checkApproval(plan.migrationPlan)
 
     // is there anything to do?
-    if len(migrationsInDatabase) == len(migrationsInFileSystem) {
-        fmt.Printf("Database already up to date, with %d migrations applied.\nMost recent migration is %s\n",
-            len(migrationsInDatabase), migrationsInDatabase[len(migrationsInDatabase)-1])
+    if len(delta) == 0 && len(skippedBy) == 0 {
+        recordPendingChecksumsWithoutMigration()
+        if len(migrationsInDatabase)+len(pendingMigrations) < len(migrationsInFileSystem) {
+            fmt.Printf("Nothing to apply until phase %s is over.\n", *flagUntilPhase)
+        } else {
+            fmt.Printf("Database already up to date, with %d migrations applied.\nMost recent migration is %s\n",
+                len(migrationsInDatabase), migrationsInDatabase[len(migrationsInDatabase)-1])
+        }
+        printSkippedMigrationsHint()
+        applyGrants()
+        writeDeploymentSummary("")
         os.Exit(0)
     }
 
-    // calculate delta
-    delta := migrationsInFileSystem[len(migrationsInDatabase):]
-    // fmt.Println("delta", delta)
+    // only prove that migrations execute cleanly, without persisting anything
+    var rollbackAtEndTx pgx.Tx
+    if *flagRollbackAtEnd {
+        rollbackAtEndTx = beginRollbackAtEnd(delta)
+    } else if *flagVerifyDown {
+        logError("Error: --verify-down only works together with --rollback-at-end")
+        os.Exit(1)
+    }
+
+    // only report what this run left invalid
+    invalidBefore := getInvalidObjects()
+
+    progressTotal = len(catchUpMigrations) + len(pendingMigrations)
+    for index, fileName := range append(append([]string{}, catchUpMigrations...), pendingMigrations...) {
+        progressIndex = index + 1
 
-    for _, fileName := range delta {
-        // get sql for forward migration
-        sqlMigrationForward, _ := readMigrationFromFile(fileName)
+        // keep the order of positions, but do not run it
+        if reason, skipped := skippedBy[fileName]; skipped {
+            insertedId := skipMigration(fileName, reason)
+            fmt.Printf("skipped migration: %s (%s, database id: %d)\n", fileName, reason, insertedId)
+            recordSummaryMigration(fileName, 0, reason)
+            continue
+        }
 
         // perform migration
-        insertedId := migrateForward(fileName, sqlMigrationForward)
+        queryStatsBefore := getQueryStatsSnapshot()
+        summaryCurrentFile = fileName
+        startedAt := time.Now()
+        insertedId := migrateForward(fileName)
+        recordSummaryMigration(fileName, time.Since(startedAt), "")
+        summaryCurrentFile = ""
 
         fmt.Printf("forward migration: %s (database id: %d)\n", fileName, insertedId)
+        printQueryStats(fileName, queryStatsBefore, getQueryStatsSnapshot())
+
+        // only committed migrations may flip flags
+        if rollbackAtEndTx == nil {
+            runFeatureFlagHooks(fileName)
+        }
     }
-}
 
-// migrate forward
-func migrateForward(fileName string, sqlMigrationForward string) int {
-    tx, err := postgreSQLConnection.Begin(context.Background())
-    if err != nil {
-        logError("Error: Failed to start forward transaction")
-        logError("Error while processing file: %s", fileName)
-        panic(err)
+    // only skipped migrations, their rows are recorded without transaction
+    recordPendingChecksumsWithoutMigration()
+
+    // keep grants & policies consistent
+    applyGrants()
+
+    // e.g. failed CREATE INDEX CONCURRENTLY, constraints added with NOT VALID
+    if rollbackAtEndTx == nil {
+        checkInvalidObjects(invalidBefore)
     }
 
-    defer tx.Rollback(context.Background())
+    // keep codegen inputs in sync with committed migrations
+    if rollbackAtEndTx == nil {
+        refreshSchemaExport()
+    }
 
-    // execute sql code of migration
-    _, err = tx.Exec(context.Background(), sqlMigrationForward)
-    if err != nil {
-        logError("Error: Forward transaction failed")
-        logError("Error while processing file: %s", fileName)
-        logError(sqlMigrationForward)
-        panic(err)
+    if !isTagSelectionActive() {
+        printSkippedMigrationsHint()
     }
 
-    // store migration in table
-    var insertedId int
-    err = tx.QueryRow(context.Background(),
-        fmt.Sprintf("INSERT INTO %s (filename) VALUES ($1) RETURNING id", CONST_POSTGRESQL_TABLE_NAME),
-        fileName).Scan(&insertedId)
-    if err != nil {
-        logError("Error: Failed to store forward migration info in %s", CONST_POSTGRESQL_TABLE_NAME)
-        logError("Error while processing file: %s", fileName)
-        panic(err)
+    if rollbackAtEndTx != nil {
+        if *flagVerifyDown {
+            verifyDownMigrations(delta)
+        }
+
+        finishRollbackAtEnd(rollbackAtEndTx, len(delta))
+
+        if *flagVerifyDown {
+            recordVerifiedDownMigrations(delta)
+        }
     }
 
-    err = tx.Commit(context.Background())
+    writeDeploymentSummary("")
+}
+
+// record migration as applied without running it, returns its id
+func skipMigration(fileName string, reason string) int {
+    insertedId, err := getMigrator().Skip(context.Background(), fileName, reason)
     if err != nil {
-        logError("Error: Failed to commit forward transaction")
-        logError("Error while processing file: %s", fileName)
+        logError("Error: Failed to store skipped migration in %s", trackingTableName)
+        logError("Error while processing file: %s", describeMigrationFile(fileName))
         panic(err)
     }
 
     return insertedId
 }
 
-// migrate backwards
-func migrateBackward(fileName string, sqlMigrationBackward string) {
-    tx, err := postgreSQLConnection.Begin(context.Background())
-    if err != nil {
-        logError("Error: Failed to start backward transaction")
-        logError("Error while processing file: %s", fileName)
-        panic(err)
-    }
+// migrate forward, returns the id of the migration in the tracking table
+func migrateForward(fileName string) int {
+    // e.g. --deadline or SIGTERM: no further migrations
+    checkRunContext()
 
-    defer tx.Rollback(context.Background())
+    // checks template variables of other environments as well
+    sqlMigrationForward, _ := readMigrationFromFile(fileName)
 
-    // check that most recent transaction is the one we are trying to undo
-    var mostRecentMigrationFileName string
-    var mostRecentMigrationId int
-    err = tx.QueryRow(context.Background(),
-        fmt.Sprintf(
-            "SELECT id, filename FROM %s ORDER BY created_at DESC LIMIT 1",
-            CONST_POSTGRESQL_TABLE_NAME)).Scan(
-        &mostRecentMigrationId, &mostRecentMigrationFileName)
-    if err != nil {
-        logError("Error: Cannot fetch most recent migration")
-        logError("Error while processing file: %s", fileName)
-        panic(err)
-    }
+    startMigrationWarnings(fileName)
+    defer func() { currentMigrationFileName = "" }()
+    failingMigrationFileName = fileName
+    setApplicationName(fileName)
+    defer setApplicationName("")
+    recordRunFile(fileName)
+    defer startMigrationMonitor(fileName, sqlMigrationForward)()
 
-    // execute sql code of migration
-    _, err = tx.Exec(context.Background(), sqlMigrationBackward)
-    if err != nil {
-        logError("Error: background migration failed")
-        logError("Error while processing file: %s", fileName)
-        logError(sqlMigrationBackward)
-        panic(err)
-    }
+    // the running migration is cancelled on the server, e.g. after --deadline or SIGTERM
+    defer cancelOnServerWhenDone(getRunContext(), postgreSQLConnection)()
 
-    // store migration in table
-    _, err = tx.Exec(context.Background(),
-        fmt.Sprintf("DELETE FROM %s WHERE id = $1", CONST_POSTGRESQL_TABLE_NAME),
-        mostRecentMigrationId)
+    insertedId, err := getMigrator().Apply(context.Background(), fileName)
     if err != nil {
-        logError("Error: Failed to remove backward migration #%d from database table %s",
-            mostRecentMigrationId, CONST_POSTGRESQL_TABLE_NAME)
-        logError("Error while processing file: %s", fileName)
-        panic(err)
+        exitOnMigrationError(fileName, true, err)
     }
 
-    err = tx.Commit(context.Background())
+    failingMigrationFileName = ""
+    adviseVacuum(fileName, migrationLargeDMLTables)
+
+    return insertedId
+}
+
+// migrate backwards, migration has to be the most recent one
+func migrateBackward(migration migrate.AppliedMigration) {
+    fileName := migration.LocalFileName
+
+    // e.g. --deadline or SIGTERM: no further migrations
+    checkRunContext()
+
+    // checks template variables of other environments as well
+    _, sqlMigrationBackward := readMigrationFromFile(fileName)
+
+    startMigrationWarnings(fileName)
+    defer func() { currentMigrationFileName = "" }()
+    failingMigrationFileName = fileName
+    setApplicationName(fileName)
+    defer setApplicationName("")
+    recordRunFile(fileName)
+    defer startMigrationMonitor(fileName, sqlMigrationBackward)()
+
+    // the running migration is cancelled on the server, e.g. after --deadline or SIGTERM
+    defer cancelOnServerWhenDone(getRunContext(), postgreSQLConnection)()
+
+    err := getMigrator().Revert(context.Background(), migration)
     if err != nil {
-        logError("Error: Failed to commit backward transaction")
-        logError("Error while processing file: %s", fileName)
-        panic(err)
+        exitOnMigrationError(fileName, false, err)
     }
+
+    failingMigrationFileName = ""
+    adviseVacuum(fileName, migrationLargeDMLTables)
 }
 
 // migrate one step backwards
 func cmd_down() {
+    // page the owning team when a migration fails
+    defer reportMigrationErrorOnPanic("down")
+    defer emitProgressEventOnPanic()
+
+    // concurrent runs wait, and find nothing pending afterwards
+    defer lockRun()()
+
+    // incident response or release freeze
+    checkMigrationFreeze()
+
+    // 'cancel' from another terminal finds this run
+    recordRun()
+
     // perform consistency checks
-    _, migrationsInDatabase := checkConsistencyOfDatabaseAndLocalFileSystem()
+    status := getMigrationStatus()
+    checkMigrationStatus(status)
 
     // is there anything to do?
-    if len(migrationsInDatabase) == 0 {
+    if len(status.Applied) == 0 {
         fmt.Println("There are no further migrations that can be reverted.")
         os.Exit(0)
     }
 
-    // get filename of last migration from array
-    mostRecentMigrationFileName := migrationsInDatabase[len(migrationsInDatabase)-1]
+    // the last remaining row tells how many migrations have been archived
+    if status.Archived > 0 && len(status.Applied) <= 1 {
+        logError("Error: Cannot revert further, older migrations have been archived by 'prune-history'")
+        os.Exit(1)
+    }
+
+    mostRecentMigration := status.Applied[len(status.Applied)-1]
+
+    // skipped by tag: it has never run, so there is nothing to undo
+    if len(mostRecentMigration.SkippedBy) > 0 {
+        err := getMigrator().Revert(context.Background(), mostRecentMigration)
+        if err != nil {
+            logError("Error: Failed to remove skipped migration %s from %s", mostRecentMigration.FileName, trackingTableName)
+            panic(err)
+        }
+
+        fmt.Printf("undo: %s (skipped by %s, only removed from %s)\n", mostRecentMigration.FileName, mostRecentMigration.SkippedBy, trackingTableName)
+        return
+    }
+
+    // file name of the most recent migration, under which it is known locally
+    mostRecentMigrationFileName := mostRecentMigration.LocalFileName
+    if len(mostRecentMigrationFileName) == 0 {
+        logError("Error: Most recent migration %s is missing locally, it cannot be reverted", mostRecentMigration.FileName)
+        os.Exit(1)
+    }
 
-    // get the sql query
-    _, sqlMigrationBackward := readMigrationFromFile(mostRecentMigrationFileName)
+    // down migrations are rarely run before they are needed
+    checkDownMigrationVerified(mostRecentMigrationFileName)
+    checkServerVersionRequirements([]string{mostRecentMigrationFileName}, false)
+    checkLogicalReplication([]string{mostRecentMigrationFileName}, false)
 
     // perform backwards migration with database transaction
-    migrateBackward(mostRecentMigrationFileName, sqlMigrationBackward)
+    progressIndex, progressTotal = 1, 1
+    queryStatsBefore := getQueryStatsSnapshot()
+    migrateBackward(mostRecentMigration)
 
     fmt.Println("undo:", mostRecentMigrationFileName)
+    printQueryStats(mostRecentMigrationFileName, queryStatsBefore, getQueryStatsSnapshot())
 }
 
 // migrate all steps backwards
 func cmd_destroy() {
+    if *flagDropObjects {
+        unlock := lockRun()
+        checkMigrationFreeze()
+        destroyCreatedObjects()
+        unlock()
+    }
+
     for {
         cmd_down()
     }
 }
 
+// command line to run a command in a child process with the flags of this run,
+// except excluded flags, overridden flags get the given values
+func getChildCommandLineArgs(command string, excludedFlagNames map[string]bool, overriddenFlags map[string]string) []string {
+    args := []string{command}
+
+    // the child gets the connections this process does not use
+    if maxConns, ok := getChildMaxConnsFlag(overriddenFlags); ok {
+        withMaxConns := map[string]string{"max-conns": maxConns}
+        for name, value := range overriddenFlags {
+            withMaxConns[name] = value
+        }
+        overriddenFlags = withMaxConns
+    }
+
+    commandLineFlags.Visit(func(f *flag.Flag) {
+        _, overridden := overriddenFlags[f.Name]
+        if !excludedFlagNames[f.Name] && !overridden {
+            args = append(args, "--"+f.Name+"="+f.Value.String())
+        }
+    })
+
+    for name, value := range overriddenFlags {
+        args = append(args, "--"+name+"="+value)
+    }
+
+    return args
+}
+
+// parse flags from command line arguments and return the remaining arguments
+func parseCommandLineFlags(args []string) []string {
+    var positionalArgs []string
+
+    for len(args) > 0 {
+        err := commandLineFlags.Parse(args)
+        if err == flag.ErrHelp {
+            cmd_help()
+        }
+        if err != nil {
+            logError("Hint: run '%s help' to list all flags", os.Args[0])
+            os.Exit(1)
+        }
+
+        // everything after "--" is a positional argument
+        remainingArgs := commandLineFlags.Args()
+        parsedArgs := args[:len(args)-len(remainingArgs)]
+        if len(parsedArgs) > 0 && parsedArgs[len(parsedArgs)-1] == "--" {
+            positionalArgs = append(positionalArgs, remainingArgs...)
+            break
+        }
+
+        if len(remainingArgs) > 0 {
+            positionalArgs = append(positionalArgs, remainingArgs[0])
+            remainingArgs = remainingArgs[1:]
+        }
+
+        args = remainingArgs
+    }
+
+    return positionalArgs
+}
+
 func main() {
-    if len(os.Args) < 2 {
+    args := parseCommandLineFlags(os.Args[1:])
+
+    if *flagVersion {
+        cmd_version()
+    }
+
+    if len(args) < 1 {
         cmd_help()
     }
+    currentCommand = args[0]
+    checkReplicaCommand(args[0])
+    selectComponent()
 
-    switch os.Args[1] {
+    switch args[0] {
     case "init":
-        if len(os.Args) == 2 {
+        if len(args) == 1 {
             cmd_init()
         }
 
     case "create":
-        cmd_create(strings.Join(os.Args[2:], "-"))
+        cmd_create(strings.Join(args[1:], "-"))
 
     case "create-here":
-        cmd_create_here(strings.Join(os.Args[2:], "-"))
+        cmd_create_here(strings.Join(args[1:], "-"))
 
     case "up":
-        if len(os.Args) == 2 {
+        if len(args) == 1 && (len(*flagSchemas) > 0 || len(*flagSchemasQuery) > 0) {
+            cmd_up_schemas()
+        }
+
+        if len(args) == 1 && len(*flagToScript) > 0 {
+            cmd_up_to_script(*flagToScript)
+        }
+
+        if len(args) == 1 {
             cmd_up()
         }
 
+    case "rehearse":
+        if len(args) == 1 {
+            cmd_rehearse()
+        }
+
+    case "status":
+        if len(args) == 1 {
+            cmd_status()
+        }
+
+    case "assert-current":
+        if len(args) == 1 {
+            cmd_assert_current()
+        }
+
+    case "history":
+        if len(args) == 1 {
+            cmd_history()
+        }
+
+    case "at":
+        if len(args) == 2 {
+            cmd_at(args[1])
+        }
+
+    case "changelog":
+        if len(args) == 1 {
+            cmd_changelog()
+        }
+
+    case "plan":
+        if len(args) == 1 {
+            cmd_plan()
+        }
+
     case "down":
-        if len(os.Args) == 2 {
+        if len(args) == 1 {
             cmd_down()
         }
 
     case "destroy":
-        if len(os.Args) == 2 {
+        if len(args) == 1 {
             cmd_destroy()
         }
 
+    case "env":
+        if len(args) == 3 && args[1] == "create" {
+            cmd_env_create(args[2])
+        }
+
+        if len(args) == 3 && args[1] == "drop" {
+            cmd_env_drop(args[2])
+        }
+
+    case "export-schema":
+        if len(args) == 1 {
+            cmd_export_schema()
+        }
+
+    case "test-database":
+        if len(args) == 1 {
+            cmd_test_database()
+        }
+
+    case "partitions":
+        if len(args) == 1 {
+            cmd_partitions()
+        }
+
+    case "partitions-template":
+        if len(args) == 4 {
+            cmd_partitions_template(args[1], args[2], args[3])
+        }
+
+    case "generate":
+        if len(args) == 2 && args[1] == "k8s-job" {
+            cmd_generate_k8s_job()
+        }
+        if len(args) == 2 && args[1] == "rollback" {
+            cmd_generate_rollback()
+        }
+
+    case "generate-rollback":
+        if len(args) == 1 {
+            cmd_generate_rollback()
+        }
+
+    case "compare":
+        if len(args) == 1 {
+            cmd_compare(*flagCompareA, *flagCompareB)
+        }
+
+    case "owners":
+        if len(args) == 1 {
+            cmd_owners()
+        }
+
+    case "check-grants":
+        if len(args) == 1 {
+            cmd_check_grants()
+        }
+
+    case "prune-history":
+        if len(args) == 1 {
+            cmd_prune_history()
+        }
+
+    case "export-durations":
+        if len(args) == 1 {
+            cmd_export_durations()
+        }
+
+    case "cancel":
+        if len(args) == 1 {
+            cmd_cancel()
+        }
+
+    case "freeze":
+        if len(args) >= 1 {
+            cmd_freeze(strings.Join(args[1:], " "))
+        }
+
+    case "unfreeze":
+        if len(args) == 1 {
+            cmd_unfreeze()
+        }
+
+    case "request-apply":
+        if len(args) == 1 {
+            cmd_request_apply()
+        }
+
+    case "approve":
+        if len(args) == 2 {
+            cmd_approve(args[1])
+        }
+
+    case "support-bundle":
+        if len(args) == 1 {
+            cmd_support_bundle()
+        }
+        if len(args) == 3 && args[1] == "replay" {
+            cmd_support_bundle_replay(args[2])
+        }
+
+    case "self-update":
+        if len(args) == 1 {
+            cmd_self_update()
+        }
+
+    case "version":
+        if len(args) == 1 {
+            cmd_version()
+        }
+
+    case "post-restore":
+        if len(args) == 1 {
+            cmd_post_restore()
+        }
+
+    case "config":
+        if len(args) == 2 && args[1] == "show" {
+            cmd_config_show()
+        }
+
+    case "verify-connection":
+        if len(args) == 1 {
+            cmd_verify_connection()
+        }
+
+    case "ci":
+        if len(args) == 1 {
+            cmd_ci()
+        }
+
+    case "validate":
+        if len(args) == 1 {
+            cmd_validate()
+        }
+
+    case "apply":
+        if len(args) == 2 {
+            cmd_apply(args[1])
+        }
+
+    case "enum":
+        if len(args) >= 3 {
+            cmd_enum(args[1], args[2:])
+        }
+
+    case "enum-rename-value":
+        if len(args) == 4 {
+            cmd_enum_rename_value(args[1], args[2], args[3])
+        }
+
+    case "backfill":
+        if len(args) == 2 {
+            cmd_backfill(args[1])
+        }
+
+    case "backfill-template":
+        if len(args) == 1 {
+            cmd_backfill_template()
+        }
+
     default:
         cmd_help()
     }
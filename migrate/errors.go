@@ -0,0 +1,31 @@
+// Package migrate is the library behind go-simple-postgresql-migrate, for applications which run
+// their migrations themselves, e.g. at startup.
+package migrate
+
+import (
+    "errors"
+)
+
+// failure modes, returned wrapped with details: test them with errors.Is instead of matching messages
+var (
+    // a migration without transaction failed halfway, some of its statements have been applied
+    ErrDirty = errors.New("database is dirty, a migration without transaction failed halfway")
+
+    // an applied migration file has been changed after it was applied
+    ErrChecksumMismatch = errors.New("applied migration file has been changed")
+
+    // migrations in the database do not match the migration files in order
+    ErrOutOfOrder = errors.New("applied migrations do not match the order of the migration files")
+
+    // another run is applying migrations right now
+    ErrLocked = errors.New("migrations are locked by another run")
+
+    // there are no migration files at all, e.g. a wrong folder
+    ErrNoMigrations = errors.New("no migration files found")
+
+    // CheckSyntax: the parser of PostgreSQL rejects the SQL
+    ErrSyntax = errors.New("syntax error")
+
+    // CheckSyntax: built without -tags pg_query, there is no parser to check the syntax with
+    ErrNoParser = errors.New("built without the parser of PostgreSQL (-tags pg_query)")
+)
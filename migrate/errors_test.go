@@ -0,0 +1,61 @@
+package migrate
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "testing/fstest"
+)
+
+func TestErrors(t *testing.T) {
+    t.Run("dirty", func(t *testing.T) {
+        migrator := newTestMigrator(t, &fakeConn{failOn: "a_d"}, Options{})
+
+        _, err := migrator.Apply(context.Background(), "20240101130000-concurrently.sql")
+        if !errors.Is(err, ErrDirty) {
+            t.Errorf("got error %v, want %v", err, ErrDirty)
+        }
+    })
+
+    t.Run("checksum mismatch", func(t *testing.T) {
+        migrator := newTestMigrator(t, &fakeConn{}, Options{})
+
+        err := migrator.VerifyChecksums([]AppliedMigration{{FileName: "20240101120000-index.sql",
+            LocalFileName: "20240101120000-index.sql", Checksum: Checksum([]byte("edited since"))}})
+
+        var checksumError *ChecksumError
+        if !errors.Is(err, ErrChecksumMismatch) || !errors.As(err, &checksumError) || len(checksumError.Changed) != 1 {
+            t.Errorf("got error %v, want %v", err, ErrChecksumMismatch)
+        }
+    })
+
+    t.Run("out of order", func(t *testing.T) {
+        _, err := compareMigrations([]string{"1-a.sql", "2-b.sql"}, appliedMigrations("2-b.sql"), 0, nil, lessByName)
+        if !errors.Is(err, ErrOutOfOrder) {
+            t.Errorf("got error %v, want %v", err, ErrOutOfOrder)
+        }
+    })
+
+    t.Run("locked", func(t *testing.T) {
+        conn := &fakeConn{locked: true}
+        migrator := newTestMigrator(t, conn, Options{NoWait: true})
+
+        if err := migrator.Up(context.Background()); !errors.Is(err, ErrLocked) {
+            t.Errorf("got error %v, want %v", err, ErrLocked)
+        }
+        if len(conn.executed) != 1 {
+            t.Errorf("got %q, only the lock should have been tried", conn.executed)
+        }
+    })
+
+    t.Run("no migrations", func(t *testing.T) {
+        migrator, err := New(&fakeConn{}, Options{FS: fstest.MapFS{"migrations/README.md": {}}, Folder: "migrations"})
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        if _, err := migrator.Status(context.Background()); !errors.Is(err, ErrNoMigrations) {
+            t.Errorf("got error %v, want %v", err, ErrNoMigrations)
+        }
+    })
+}
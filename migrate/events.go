@@ -0,0 +1,40 @@
+package migrate
+
+import (
+    "time"
+)
+
+// what happened, see Event
+type EventKind string
+
+const (
+    EventMigrationStarted  EventKind = "migration_started"
+    EventStatementExecuted EventKind = "statement_executed"
+    EventMigrationApplied  EventKind = "migration_applied"
+    EventMigrationReverted EventKind = "migration_reverted"
+    EventMigrationFailed   EventKind = "migration_failed"
+)
+
+// progress of a run, for host applications which render their own progress UI, see Options.OnEvent and
+// Migrator.UpWithProgress; statements are reported one by one only for migrations without transaction,
+// which run them separately
+type Event struct {
+    Kind     EventKind `json:"kind"`
+    FileName string    `json:"filename"`
+
+    // position of the migration in this run and number of migrations in this run, from 1
+    Index int `json:"index"`
+    Total int `json:"total"`
+
+    // statement events: position in the migration, from 1, and the statement, shortened
+    StatementIndex int    `json:"statement_index,omitempty"`
+    StatementTotal int    `json:"statement_total,omitempty"`
+    Statement      string `json:"statement,omitempty"`
+
+    // since the migration (or statement) started
+    Duration time.Duration `json:"duration_ns"`
+
+    // failure of EventMigrationFailed; FileName is empty if the run failed between migrations, e.g. canceled
+    Err   error  `json:"-"`
+    Error string `json:"error,omitempty"`
+}
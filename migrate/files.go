@@ -0,0 +1,144 @@
+package migrate
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io/fs"
+    "regexp"
+    "strings"
+)
+
+// format of migration files and the tracking table, shared with the command line tool
+const (
+    // folder with the migration files, relative to the working directory
+    DefaultFolder = "postgresql-migrations"
+
+    // table which records applied migrations
+    DefaultTrackingTable = "_go_simple_postgresql_migrate"
+
+    // tracking table with all columns, %s is the table name
+    TrackingTableSchema = "CREATE TABLE IF NOT EXISTS %s (id serial, created_at timestamp with time zone DEFAULT NOW(), filename text, position integer, duration_ms integer, skipped_by text, checksum text, created_objects text, UNIQUE(filename), UNIQUE(position))"
+
+    // separates up and down part of a migration file
+    UndoMarker = "\n--\n-- UNDO (DOWN) migration is below this line:\n-- (do not change this block!)\n--\n"
+
+    // e.g. 20240101120000-add-users.sql
+    DefaultFileNamePattern = "^[0-9]{14}-[a-zA-Z0-9_-]+.sql$"
+
+    // extension of migration files, file name patterns see every accepted extension as this one
+    DefaultExtension = ".sql"
+
+    // part of a migration which runs statement by statement, e.g. for CREATE INDEX CONCURRENTLY
+    AnnotationNoTransaction = "no-transaction"
+
+    // part of a migration which is intentionally empty, e.g. the down part of a data-only change
+    AnnotationNoop = "noop"
+
+    // "-- migrate:set maintenance_work_mem='2GB'" changes a setting for this part of the migration only
+    AnnotationSet = "set"
+
+    // header fields, e.g. "-- phase: post-deploy" and "-- tags: reporting, heavy" at the top of the file
+    HeaderPhase = "phase"
+    HeaderTags  = "tags"
+
+    // phases of a blue/green deployment: migrations without phase expand the schema before the new code ships
+    PhasePreDeploy  = "pre-deploy"
+    PhasePostDeploy = "post-deploy"
+)
+
+// phases in the order of a deployment
+var Phases = []string{PhasePreDeploy, PhasePostDeploy}
+
+var (
+    regexpLineComments = regexp.MustCompile("(?m)^--[^\n]*$")
+    regexpAnnotation   = regexp.MustCompile("(?m)^--[ \t]*migrate:([a-z0-9-]+)[ \t]*([^\n]*)$")
+
+    // header fields like "-- owner: team-payments" in the comment block at the top of a migration file
+    regexpHeaderField = regexp.MustCompile(`^--[ \t]*([a-z][a-z0-9-]*):[ \t]*(.*)$`)
+)
+
+// PhaseIndex returns the position of phase in Phases, -1 if it is unknown
+func PhaseIndex(phase string) int {
+    for index, deploymentPhase := range Phases {
+        if phase == deploymentPhase {
+            return index
+        }
+    }
+
+    return -1
+}
+
+// CleanUpSQL removes line comments and surrounding whitespace from part of a migration, this is what runs
+func CleanUpSQL(sql string) string {
+    return strings.TrimSpace(regexpLineComments.ReplaceAllString(sql, ""))
+}
+
+// ParseAnnotations parses annotations like "-- migrate:no-transaction" from part of a migration file,
+// name -> value; of an annotation given twice the last one counts
+func ParseAnnotations(migrationPart string) map[string]string {
+    annotations := make(map[string]string)
+    for _, match := range regexpAnnotation.FindAllStringSubmatch(migrationPart, -1) {
+        annotations[match[1]] = strings.TrimSpace(match[2])
+    }
+
+    return annotations
+}
+
+// ParseHeader parses header fields from the comment block at the top of the up part, until the first SQL line
+func ParseHeader(rawUp string) map[string]string {
+    fields := make(map[string]string)
+
+    for _, line := range strings.Split(rawUp, "\n") {
+        line = strings.TrimSpace(line)
+        if len(line) == 0 {
+            continue
+        }
+        if !strings.HasPrefix(line, "--") {
+            break
+        }
+
+        // annotations look alike, but belong to their part
+        match := regexpHeaderField.FindStringSubmatch(line)
+        if match != nil && match[1] != "migrate" {
+            fields[match[1]] = strings.TrimSpace(match[2])
+        }
+    }
+
+    return fields
+}
+
+// ParseTags splits a comma separated list of tags, e.g. of the "tags" header field
+func ParseTags(tags string) []string {
+    var parsedTags []string
+    for _, tag := range strings.Split(tags, ",") {
+        tag = strings.TrimSpace(tag)
+        if len(tag) > 0 {
+            parsedTags = append(parsedTags, tag)
+        }
+    }
+
+    return parsedTags
+}
+
+// SplitMigration splits the content of a migration file into its raw up and down part
+func SplitMigration(content string) (string, string, error) {
+    parts := strings.Split(content, UndoMarker)
+    if len(parts) != 2 {
+        return "", "", fmt.Errorf("migration needs exactly one separator between up and down part, found %d", len(parts)-1)
+    }
+
+    return parts[0], parts[1], nil
+}
+
+// ReadMigrationFiles lists the migration files in folder of fsys whose names match pattern, in the order they are applied;
+// fsys is e.g. os.DirFS(".") or an embed.FS. NewSource accepts other extensions than .sql as well
+func ReadMigrationFiles(fsys fs.FS, folder string, pattern *regexp.Regexp) ([]string, error) {
+    return NewSource(fsys, folder, pattern, nil).List()
+}
+
+// Checksum is the SHA-256 of the content of a migration file, recorded in the tracking table when it is applied
+func Checksum(content []byte) string {
+    checksum := sha256.Sum256(content)
+    return hex.EncodeToString(checksum[:])
+}
@@ -0,0 +1,36 @@
+package migrate
+
+import (
+    "context"
+    "fmt"
+)
+
+// LockName is the name of the advisory lock held while migrations of trackingTable are applied or reverted,
+// the key is hashtext of it; the command line tool uses the same one, so runs of both wait for each other
+func LockName(trackingTable string) string {
+    return trackingTable + ":migrate"
+}
+
+// take the advisory lock of options.LockName, returns a function which releases it
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+    if m.options.NoWait {
+        var locked bool
+        err := m.conn.QueryRow(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", m.options.LockName).Scan(&locked)
+        if err != nil {
+            return nil, fmt.Errorf("lock %s: %w", m.options.LockName, err)
+        }
+        if !locked {
+            return nil, fmt.Errorf("%w: advisory lock %s is held", ErrLocked, m.options.LockName)
+        }
+    } else {
+        // canceling ctx cancels the wait
+        if _, err := m.conn.Exec(ctx, "SELECT pg_advisory_lock(hashtext($1))", m.options.LockName); err != nil {
+            return nil, fmt.Errorf("lock %s: %w", m.options.LockName, err)
+        }
+    }
+
+    return func() {
+        // also after ctx has been canceled, a session lock stays until it is released
+        m.conn.Exec(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", m.options.LockName)
+    }, nil
+}
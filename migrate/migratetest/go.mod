@@ -0,0 +1,9 @@
+module github.com/bf/go-simple-postgresql-migrate/migrate/migratetest
+
+go 1.16
+
+require (
+	github.com/bf/go-simple-postgresql-migrate v0.1.0
+	github.com/jackc/pgx/v4 v4.9.2
+	github.com/testcontainers/testcontainers-go v0.14.0
+)
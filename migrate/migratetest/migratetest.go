@@ -0,0 +1,127 @@
+// Package migratetest starts disposable PostgreSQL databases with all migrations applied, for integration tests.
+// It is a module of its own, so applications which import migrate do not depend on docker and testcontainers-go.
+// The command line tool does the same with 'test-database' (container.go), with the same default image.
+package migratetest
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "io/fs"
+    "net"
+    "time"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+    "github.com/jackc/pgx/v4"
+    "github.com/testcontainers/testcontainers-go"
+    "github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+    // default of --postgres-image of 'test-database' as well
+    DefaultImage = "postgres:13-alpine"
+
+    // the image initializes the database before it listens on TCP
+    DefaultStartupTimeout = 60 * time.Second
+
+    database = "test"
+    user     = "postgres"
+
+    // logged once by the server which initializes the database, and once by the one which stays up
+    readyLog = "database system is ready to accept connections"
+)
+
+// Options configures StartTestDatabase
+type Options struct {
+    // docker image of the database, DefaultImage if empty
+    Image string
+
+    // DefaultStartupTimeout if 0
+    StartupTimeout time.Duration
+
+    // how the migrations are applied, e.g. Folder and Variables; FS is the fs.FS given to StartTestDatabase
+    Migrate migrate.Options
+}
+
+// StartTestDatabase starts PostgreSQL in a docker container with testcontainers-go, applies all migrations of fsys
+// with migrate.Migrator.Up and returns the connection string of the database; stop removes the container.
+// Failures are returned, e.g. without a docker daemon or of a migration, and leave no container behind
+func StartTestDatabase(ctx context.Context, fsys fs.FS, options Options) (dsn string, stop func(), err error) {
+    if len(options.Image) == 0 {
+        options.Image = DefaultImage
+    }
+    if options.StartupTimeout == 0 {
+        options.StartupTimeout = DefaultStartupTimeout
+    }
+    options.Migrate.FS = fsys
+
+    passwordBytes := make([]byte, 16)
+    if _, err := rand.Read(passwordBytes); err != nil {
+        return "", nil, err
+    }
+    password := hex.EncodeToString(passwordBytes)
+
+    container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+        ContainerRequest: testcontainers.ContainerRequest{
+            Image:        options.Image,
+            Env:          map[string]string{"POSTGRES_USER": user, "POSTGRES_PASSWORD": password, "POSTGRES_DB": database},
+            ExposedPorts: []string{"5432/tcp"},
+            WaitingFor:   wait.ForLog(readyLog).WithOccurrence(2).WithStartupTimeout(options.StartupTimeout),
+        },
+        Started: true,
+    })
+    // a container which has been created but failed to start is returned as well
+    if container != nil {
+        stop = func() {
+            container.Terminate(context.Background())
+        }
+    }
+    if err != nil {
+        if stop != nil {
+            stop()
+        }
+        return "", nil, fmt.Errorf("start container from image %s: %w", options.Image, err)
+    }
+
+    dsn, err = getConnectionString(ctx, container, password)
+    if err == nil {
+        err = applyMigrations(ctx, dsn, options.Migrate)
+    }
+    if err != nil {
+        stop()
+        return "", nil, err
+    }
+
+    return dsn, stop, nil
+}
+
+// connection string of the database in container, on the port mapped to the host
+func getConnectionString(ctx context.Context, container testcontainers.Container, password string) (string, error) {
+    host, err := container.Host(ctx)
+    if err != nil {
+        return "", fmt.Errorf("read host of container %s: %w", container.GetContainerID(), err)
+    }
+    port, err := container.MappedPort(ctx, "5432/tcp")
+    if err != nil {
+        return "", fmt.Errorf("read port of container %s: %w", container.GetContainerID(), err)
+    }
+
+    return fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", user, password, net.JoinHostPort(host, port.Port()), database), nil
+}
+
+// apply all migrations on a connection of its own
+func applyMigrations(ctx context.Context, dsn string, options migrate.Options) error {
+    conn, err := pgx.Connect(ctx, dsn)
+    if err != nil {
+        return fmt.Errorf("connect to test database: %w", err)
+    }
+    defer conn.Close(context.Background())
+
+    migrator, err := migrate.New(conn, options)
+    if err != nil {
+        return err
+    }
+
+    return migrator.Up(ctx)
+}
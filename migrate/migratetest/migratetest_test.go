@@ -0,0 +1,51 @@
+//go:build integration
+// +build integration
+
+package migratetest
+
+import (
+    "context"
+    "testing"
+    "testing/fstest"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+    "github.com/jackc/pgx/v4"
+)
+
+// needs a docker daemon: go test -tags integration
+func TestStartTestDatabase(t *testing.T) {
+    ctx := context.Background()
+    fsys := fstest.MapFS{
+        "migrations/20240101120000-create-orders.sql": {
+            Data: []byte("CREATE TABLE orders (id int PRIMARY KEY);\n" + migrate.UndoMarker + "DROP TABLE orders;\n"),
+        },
+    }
+
+    dsn, stop, err := StartTestDatabase(ctx, fsys, Options{Migrate: migrate.Options{Folder: "migrations"}})
+    if err != nil {
+        t.Fatalf("StartTestDatabase() failed: %v", err)
+    }
+    defer stop()
+
+    conn, err := pgx.Connect(ctx, dsn)
+    if err != nil {
+        t.Fatalf("connect to %s: %v", dsn, err)
+    }
+    defer conn.Close(ctx)
+
+    if _, err := conn.Exec(ctx, "INSERT INTO orders (id) VALUES (1)"); err != nil {
+        t.Errorf("table of the migration is missing: %v", err)
+    }
+
+    migrator, err := migrate.New(conn, migrate.Options{FS: fsys, Folder: "migrations"})
+    if err != nil {
+        t.Fatalf("migrate.New() failed: %v", err)
+    }
+    appliedMigrations, err := migrator.AppliedMigrations(ctx)
+    if err != nil {
+        t.Fatalf("AppliedMigrations() failed: %v", err)
+    }
+    if len(appliedMigrations) != 1 || appliedMigrations[0].FileName != "20240101120000-create-orders.sql" {
+        t.Errorf("got applied migrations %+v, want 20240101120000-create-orders.sql only", appliedMigrations)
+    }
+}
@@ -0,0 +1,185 @@
+package migrate
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// Migration is a parsed migration file
+type Migration struct {
+    FileName string
+
+    // Checksum of the content of the file
+    Checksum string
+
+    // fields of the comment block at the top of the file, e.g. "-- owner: team-payments"
+    Header map[string]string
+
+    Up   Part
+    Down Part
+}
+
+// Part is the up or the down part of a migration
+type Part struct {
+    // as in the file, with comments
+    Raw string
+
+    // what runs: without comments and surrounding whitespace, template variables are expanded when it runs
+    SQL string
+
+    // e.g. "-- migrate:no-transaction", see ParseAnnotations
+    Annotations map[string]string
+}
+
+// Setting is a setting of the session, changed for one migration only, e.g. maintenance_work_mem=1GB
+type Setting struct {
+    Name  string
+    Value string
+}
+
+// resources and timeouts, not settings which change what statements do (e.g. search_path)
+const DefaultSetAllowlist = "maintenance_work_mem,work_mem,max_parallel_maintenance_workers," +
+    "max_parallel_workers_per_gather,statement_timeout,lock_timeout,idle_in_transaction_session_timeout,synchronous_commit"
+
+var (
+    // e.g. ${ANALYTICS_DB}, other uses of $ in SQL (parameters, dollar quoting) do not look like this
+    regexpVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+    // annotation lines, ParseAnnotations keeps only the last one of a name
+    regexpSetAnnotation = regexp.MustCompile("(?m)^--[ \t]*migrate:" + AnnotationSet + "[ \t]+([^\n]*)$")
+
+    // name of a setting, custom settings contain a dot
+    regexpSettingName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)?$`)
+)
+
+// ParseMigration splits the content of a migration file into its parts and parses them
+func ParseMigration(fileName string, content []byte) (*Migration, error) {
+    up, down, err := SplitMigration(string(content))
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", fileName, err)
+    }
+
+    return &Migration{
+        FileName: fileName,
+        Checksum: Checksum(content),
+        Header:   ParseHeader(up),
+        Up:       Part{Raw: up, SQL: CleanUpSQL(up), Annotations: ParseAnnotations(up)},
+        Down:     Part{Raw: down, SQL: CleanUpSQL(down), Annotations: ParseAnnotations(down)},
+    }, nil
+}
+
+// Part returns the up part for forward, the down part otherwise
+func (m *Migration) Part(forward bool) Part {
+    if forward {
+        return m.Up
+    }
+
+    return m.Down
+}
+
+// Phase returns the phase of the migration, PhasePreDeploy if it has none
+func (m *Migration) Phase() string {
+    phase, ok := m.Header[HeaderPhase]
+    if !ok {
+        return PhasePreDeploy
+    }
+
+    return phase
+}
+
+// Tags returns the tags of the migration, e.g. "-- tags: reporting, heavy"
+func (m *Migration) Tags() []string {
+    return ParseTags(m.Header[HeaderTags])
+}
+
+// HasAnnotation checks if the part has an annotation, e.g. AnnotationNoTransaction
+func (p Part) HasAnnotation(name string) bool {
+    _, ok := p.Annotations[name]
+    return ok
+}
+
+// VariableNames returns the names of the template variables SQL uses, e.g. ANALYTICS_DB for ${ANALYTICS_DB}
+func VariableNames(sql string) []string {
+    var names []string
+    for _, match := range regexpVariable.FindAllStringSubmatch(sql, -1) {
+        names = append(names, match[1])
+    }
+
+    return names
+}
+
+// ExpandVariables replaces ${NAME} with the value of NAME in variables, names which are not defined are left alone
+func ExpandVariables(sql string, variables map[string]string) string {
+    if len(variables) == 0 {
+        return sql
+    }
+
+    return regexpVariable.ReplaceAllStringFunc(sql, func(reference string) string {
+        if value, ok := variables[regexpVariable.FindStringSubmatch(reference)[1]]; ok {
+            return value
+        }
+
+        return reference
+    })
+}
+
+// ParseSettings parses a comma separated list of settings, e.g. "maintenance_work_mem=1GB,synchronous_commit=off"
+func ParseSettings(list string) ([]Setting, error) {
+    var settings []Setting
+    for _, field := range strings.Split(list, ",") {
+        field = strings.TrimSpace(field)
+        if len(field) == 0 {
+            continue
+        }
+
+        nameValue := strings.SplitN(field, "=", 2)
+        name := strings.TrimSpace(nameValue[0])
+        if len(nameValue) != 2 || !regexpSettingName.MatchString(name) {
+            return nil, fmt.Errorf("invalid setting '%s', use name=value pairs separated by commas, e.g. maintenance_work_mem=1GB,synchronous_commit=off", field)
+        }
+
+        settings = append(settings, Setting{name, strings.TrimSpace(nameValue[1])})
+    }
+
+    return settings, nil
+}
+
+// ParseSetAnnotations parses the "-- migrate:set name=value" annotations of part of a migration file,
+// values may be quoted like in SET
+func ParseSetAnnotations(migrationPart string) ([]Setting, error) {
+    var settings []Setting
+    for _, match := range regexpSetAnnotation.FindAllStringSubmatch(migrationPart, -1) {
+        nameValue := strings.SplitN(match[1], "=", 2)
+        name := strings.TrimSpace(nameValue[0])
+        if len(nameValue) != 2 || !regexpSettingName.MatchString(name) {
+            return nil, fmt.Errorf("invalid annotation '-- migrate:%s %s', use e.g. -- migrate:%s maintenance_work_mem='2GB'",
+                AnnotationSet, strings.TrimSpace(match[1]), AnnotationSet)
+        }
+
+        value := strings.TrimSpace(nameValue[1])
+        if len(value) >= 2 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
+            value = strings.Replace(value[1:len(value)-1], "''", "'", -1)
+        }
+
+        settings = append(settings, Setting{strings.ToLower(name), value})
+    }
+
+    return settings, nil
+}
+
+// CheckSettings checks that settings are in allowlist (names, case-insensitive)
+func CheckSettings(settings []Setting, allowlist []string) error {
+    allowed := make(map[string]bool)
+    for _, name := range allowlist {
+        allowed[strings.ToLower(strings.TrimSpace(name))] = true
+    }
+
+    for _, setting := range settings {
+        if !allowed[strings.ToLower(setting.Name)] {
+            return fmt.Errorf("setting %s is not allowed, allowed are: %s", setting.Name, strings.Join(allowlist, ","))
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,739 @@
+package migrate
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path"
+    "regexp"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgconn"
+    "github.com/jackc/pgx/v4"
+    "github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Conn is the connection migrations run on, e.g. *pgx.Conn, a *pgxpool.Conn acquired from a pool or a *pgxpool.Pool;
+// of a pool, Up, Down, Apply and Revert acquire one connection for the whole call and release it afterwards:
+// the advisory lock and the settings of migrations without transaction belong to one session
+type Conn interface {
+    Begin(ctx context.Context) (pgx.Tx, error)
+    Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+    Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+    QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Options of a Migrator, the zero value uses the defaults of the command line tool
+type Options struct {
+    // folder with the migration files, default DefaultFolder;
+    // with FS a path inside of it, e.g. the folder of "//go:embed postgresql-migrations"
+    Folder string
+
+    // file system to read migration files from, e.g. an embed.FS; default the local file system
+    FS fs.FS
+
+    // table which records applied migrations, default DefaultTrackingTable
+    TrackingTable string
+
+    // names of migration files, default DefaultFileNamePattern; see NewSource for the order of files
+    FileNamePattern *regexp.Regexp
+
+    // extensions of migration files, default DefaultExtension
+    Extensions []string
+
+    // advisory lock held by Up and Down, default LockName(TrackingTable) like the command line tool
+    LockName string
+
+    // fail with ErrLocked instead of waiting while another run holds the lock
+    NoWait bool
+
+    // values of template variables, e.g. ANALYTICS_DB for ${ANALYTICS_DB}; names which are not defined are left alone
+    Variables map[string]string
+
+    // settings for each migration only, e.g. maintenance_work_mem=1GB, see ParseSettings;
+    // "-- migrate:set" annotations of a migration override them
+    Settings []Setting
+
+    // settings which "-- migrate:set" annotations may change, default DefaultSetAllowlist
+    SetAllowlist []string
+
+    // mismatches between tracking table and migration files which pass, nil to fail on any mismatch; see ParseAllowlist
+    Allowlist *Allowlist
+
+    // Up stops before the first migration of a later phase, e.g. PhasePreDeploy before the new code ships; default all phases
+    UntilPhase string
+
+    // Up records pending migrations with one of these tags as skipped instead of running them
+    SkipTags []string
+
+    // Up only runs migrations with one of these tags, including ones skipped before, and records the others as skipped
+    OnlyTags []string
+
+    // called for every Event of Up and Down, e.g. to render progress; see also UpWithProgress
+    OnEvent func(Event)
+
+    // called in the transaction of every migration after it has been recorded, before it is committed,
+    // e.g. to notify listeners; an error rolls the migration back (unless it runs without transaction)
+    InTransaction func(ctx context.Context, tx pgx.Tx, step Step) error
+}
+
+// Step is a migration which has been applied or reverted, see Options.InTransaction
+type Step struct {
+    FileName string
+    Forward  bool
+
+    // row of the tracking table which has been written or deleted
+    ID int
+
+    // since the migration started
+    Duration time.Duration
+}
+
+// Migrator applies the migrations of a folder to the database of one connection
+type Migrator struct {
+    conn    Conn
+    options Options
+    source  *Source
+
+    // set if conn is a pool, see acquire
+    pool connectionPool
+}
+
+// hands out connections, e.g. *pgxpool.Pool; release returns the connection to the pool
+type connectionPool interface {
+    acquire(ctx context.Context) (conn Conn, release func(), err error)
+}
+
+// *pgxpool.Pool as connectionPool
+type pgxPool struct {
+    *pgxpool.Pool
+}
+
+func (p pgxPool) acquire(ctx context.Context) (Conn, func(), error) {
+    conn, err := p.Acquire(ctx)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    return conn, conn.Release, nil
+}
+
+// MigrationError is a failed migration, errors.Is(err, ErrDirty) holds if it failed halfway
+type MigrationError struct {
+    FileName string
+    Forward  bool
+
+    // a statement of a migration without transaction failed: the statement, its offset (in characters) in the SQL
+    // of the migration, and its position in the migration, from 1
+    Statement      string
+    Offset         int
+    StatementIndex int
+    StatementTotal int
+
+    // the migration ran, but recording it in the tracking table failed
+    Recording bool
+
+    // statements have been applied before the failure, they need to be cleaned up manually
+    Dirty bool
+
+    Err error
+}
+
+func (e *MigrationError) Error() string {
+    message := fmt.Sprintf("%s: %v", e.FileName, e.Err)
+    if e.StatementTotal > 0 {
+        message = fmt.Sprintf("%s: statement %d of %d failed: %v", e.FileName, e.StatementIndex, e.StatementTotal, e.Err)
+    } else if e.Recording {
+        message = fmt.Sprintf("%s: recording failed: %v", e.FileName, e.Err)
+    }
+
+    if e.Dirty {
+        return fmt.Sprintf("%s: %s", ErrDirty, message)
+    }
+
+    return message
+}
+
+func (e *MigrationError) Is(target error) bool {
+    return target == ErrDirty && e.Dirty
+}
+
+func (e *MigrationError) Unwrap() error {
+    return e.Err
+}
+
+// ChecksumError is returned by VerifyChecksums, errors.Is(err, ErrChecksumMismatch) holds
+type ChecksumError struct {
+    // applied migrations whose files have been edited since
+    Changed []AppliedMigration
+}
+
+func (e *ChecksumError) Error() string {
+    var fileNames []string
+    for _, migration := range e.Changed {
+        fileNames = append(fileNames, migration.FileName)
+    }
+
+    return fmt.Sprintf("%s: %s", ErrChecksumMismatch, strings.Join(fileNames, ", "))
+}
+
+func (e *ChecksumError) Is(target error) bool {
+    return target == ErrChecksumMismatch
+}
+
+// New creates a Migrator for the migrations in options.Folder, nothing is read or written yet
+func New(conn Conn, options Options) (*Migrator, error) {
+    if conn == nil {
+        return nil, errors.New("migrate: connection is nil")
+    }
+
+    if len(options.Folder) == 0 {
+        options.Folder = DefaultFolder
+    }
+    if len(options.TrackingTable) == 0 {
+        options.TrackingTable = DefaultTrackingTable
+    }
+    if options.FileNamePattern == nil {
+        options.FileNamePattern = regexp.MustCompile(DefaultFileNamePattern)
+    }
+    if len(options.LockName) == 0 {
+        options.LockName = LockName(options.TrackingTable)
+    }
+    if options.SetAllowlist == nil {
+        options.SetAllowlist = strings.Split(DefaultSetAllowlist, ",")
+    }
+
+    // names end up in RESET, which takes no parameters
+    for _, setting := range options.Settings {
+        if !regexpSettingName.MatchString(setting.Name) {
+            return nil, fmt.Errorf("migrate: invalid setting name %s", setting.Name)
+        }
+    }
+
+    // absolute paths and paths with .. are fine on the local file system, but not as fs.FS paths
+    files, folder := options.FS, path.Clean(options.Folder)
+    if files == nil {
+        files, folder = os.DirFS(options.Folder), "."
+    }
+    if !fs.ValidPath(folder) {
+        return nil, fmt.Errorf("migrate: invalid folder %s in file system, use a path like %s", options.Folder, DefaultFolder)
+    }
+
+    migrator := &Migrator{conn: conn, options: options, source: NewSource(files, folder, options.FileNamePattern, options.Extensions)}
+    switch pool := conn.(type) {
+    case *pgxpool.Pool:
+        migrator.pool = pgxPool{pool}
+    case connectionPool:
+        migrator.pool = pool
+    }
+
+    return migrator, nil
+}
+
+// get Migrator on one connection for a call which needs a single session: of a pool, a copy of m on a connection
+// acquired from it, otherwise m; call release when the call has ended
+func (m *Migrator) acquire(ctx context.Context) (*Migrator, func(), error) {
+    if m.pool == nil {
+        return m, func() {}, nil
+    }
+
+    conn, release, err := m.pool.acquire(ctx)
+    if err != nil {
+        return nil, nil, fmt.Errorf("migrate: acquire connection: %w", err)
+    }
+
+    session := *m
+    session.conn, session.pool = conn, nil
+
+    return &session, release, nil
+}
+
+// Source returns the migration files of the Migrator
+func (m *Migrator) Source() *Source {
+    return m.source
+}
+
+// report event to options.OnEvent
+func (m *Migrator) emit(event Event) {
+    if m.options.OnEvent == nil {
+        return
+    }
+
+    if event.Err != nil {
+        event.Error = event.Err.Error()
+    }
+    m.options.OnEvent(event)
+}
+
+// Up applies all pending migrations in order, see Plan, each in its own transaction unless it is annotated
+// "-- migrate:no-transaction"; it stops at the first failure, migrations before it stay applied
+func (m *Migrator) Up(ctx context.Context) error {
+    session, release, err := m.acquire(ctx)
+    if err != nil {
+        return err
+    }
+    defer release()
+
+    unlock, plan, err := session.prepareUp(ctx)
+    if err != nil {
+        return err
+    }
+    defer unlock()
+
+    return session.up(ctx, plan)
+}
+
+// UpWithProgress is Up in the background: it returns once the lock is taken and the plan is checked,
+// then sends the events of the run (also to Options.OnEvent) and closes the channel when the run has ended.
+// A failed run ends with EventMigrationFailed, its Err is what Up would have returned.
+// Per-statement events (EventStatementExecuted) are only sent for migrations without transaction.
+// Receive until the channel is closed, the run waits for each event to be received; canceling ctx stops the run
+func (m *Migrator) UpWithProgress(ctx context.Context) (<-chan Event, error) {
+    session, release, err := m.acquire(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    events := make(chan Event)
+
+    // a copy, so m keeps reporting to Options.OnEvent only
+    run, onEvent, failed := *session, m.options.OnEvent, false
+    run.options.OnEvent = func(event Event) {
+        if onEvent != nil {
+            onEvent(event)
+        }
+        failed = failed || event.Kind == EventMigrationFailed
+
+        select {
+        case events <- event:
+        case <-ctx.Done():
+        }
+    }
+
+    unlock, plan, err := run.prepareUp(ctx)
+    if err != nil {
+        release()
+        return nil, err
+    }
+
+    go func() {
+        defer close(events)
+        defer release()
+        defer unlock()
+
+        // e.g. skipping failed or ctx has been canceled between migrations
+        if err := run.up(ctx, plan); err != nil && !failed {
+            run.emit(Event{Kind: EventMigrationFailed, Err: err})
+        }
+    }()
+
+    return events, nil
+}
+
+// take the lock, create the tracking table and plan Up; returns a function which releases the lock
+func (m *Migrator) prepareUp(ctx context.Context) (func(), *Plan, error) {
+    // e.g. several replicas starting at once: the others find nothing pending after waiting
+    unlock, err := m.lock(ctx)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    err = m.CreateTrackingTable(ctx)
+    if err == nil {
+        _, err = m.UpgradeTrackingTable(ctx)
+    }
+    var plan *Plan
+    if err == nil {
+        plan, err = m.Plan(ctx)
+    }
+    if err == nil {
+        err = m.VerifyChecksums(plan.Status.Applied)
+    }
+    if err != nil {
+        unlock()
+        return nil, nil, err
+    }
+
+    return unlock, plan, nil
+}
+
+// apply plan of Up, the lock is held
+func (m *Migrator) up(ctx context.Context, plan *Plan) error {
+    index, total := 0, len(plan.Migrations())
+    for _, fileName := range append(append([]string{}, plan.CatchUp...), plan.Pending...) {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+
+        // keep the order of positions, but do not run it
+        if reason, skipped := plan.SkippedBy[fileName]; skipped {
+            if _, err := m.Skip(ctx, fileName, reason); err != nil {
+                return err
+            }
+            continue
+        }
+
+        index++
+        if _, err := m.apply(ctx, fileName, index, total); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Down reverts the most recently applied migration, nothing if there is none
+func (m *Migrator) Down(ctx context.Context) error {
+    session, release, err := m.acquire(ctx)
+    if err != nil {
+        return err
+    }
+    defer release()
+
+    unlock, err := session.lock(ctx)
+    if err != nil {
+        return err
+    }
+    defer unlock()
+
+    if _, err := session.UpgradeTrackingTable(ctx); err != nil {
+        return err
+    }
+
+    status, err := session.Status(ctx)
+    if err != nil {
+        return err
+    }
+    if len(status.Applied) == 0 {
+        return nil
+    }
+
+    migration := status.Applied[len(status.Applied)-1]
+    if len(status.Applied) == 1 && status.Archived > 0 {
+        return fmt.Errorf("cannot revert %s, older migrations have been archived by 'prune-history'", migration.FileName)
+    }
+
+    return session.revert(ctx, migration, 1, 1)
+}
+
+// Apply applies one migration file and records it, without checks of Status or Plan; a migration skipped by tag
+// before gets its row back. Returns the id of its row in the tracking table
+func (m *Migrator) Apply(ctx context.Context, fileName string) (int, error) {
+    session, release, err := m.acquire(ctx)
+    if err != nil {
+        return 0, err
+    }
+    defer release()
+
+    return session.apply(ctx, fileName, 0, 0)
+}
+
+// apply migration, index and total of events are 0 outside of Up
+func (m *Migrator) apply(ctx context.Context, fileName string, index int, total int) (int, error) {
+    migration, err := m.source.Read(fileName)
+    if err != nil {
+        return 0, err
+    }
+
+    m.emit(Event{Kind: EventMigrationStarted, FileName: fileName, Index: index, Total: total})
+    startedAt := time.Now()
+
+    // objects which exist already were not created by it, e.g. found by IF NOT EXISTS or replaced by OR REPLACE
+    sql := ExpandVariables(migration.Up.SQL, m.options.Variables)
+    existingObjects, err := findObjects(ctx, m.conn, sql)
+    if err != nil {
+        m.emit(Event{Kind: EventMigrationFailed, FileName: fileName, Index: index, Total: total, Duration: time.Since(startedAt), Err: err})
+        return 0, &MigrationError{FileName: fileName, Forward: true, Err: err}
+    }
+
+    id, err := m.run(ctx, migration, true, func(tx pgx.Tx) (int, error) {
+        var id int
+        durationMs := time.Since(startedAt).Milliseconds()
+
+        // skipped by tag before: keep its position
+        err := tx.QueryRow(ctx, fmt.Sprintf(
+            "UPDATE %s SET skipped_by = NULL, created_at = NOW(), duration_ms = $2, checksum = $3 WHERE filename = $1 AND skipped_by IS NOT NULL RETURNING id",
+            m.options.TrackingTable), fileName, durationMs, migration.Checksum).Scan(&id)
+        if errors.Is(err, pgx.ErrNoRows) {
+            err = tx.QueryRow(ctx, fmt.Sprintf(InsertMigrationSQL, m.options.TrackingTable, "$1::text", "$2::integer", "$3::text"),
+                fileName, durationMs, migration.Checksum).Scan(&id)
+        }
+        if err != nil {
+            return 0, err
+        }
+
+        // while the names still match the file, later migrations may rename them; without transaction
+        // the statements have been committed one by one before, so they are found by name here as well
+        objects, err := captureCreatedObjects(ctx, tx, sql, existingObjects)
+        if err != nil {
+            return 0, err
+        }
+        _, err = tx.Exec(ctx, fmt.Sprintf("UPDATE %s SET created_objects = $2 WHERE id = $1", m.options.TrackingTable),
+            id, formatCreatedObjects(objects))
+        return id, err
+    })
+    if err != nil {
+        m.emit(Event{Kind: EventMigrationFailed, FileName: fileName, Index: index, Total: total, Duration: time.Since(startedAt), Err: err})
+        return 0, err
+    }
+
+    m.emit(Event{Kind: EventMigrationApplied, FileName: fileName, Index: index, Total: total, Duration: time.Since(startedAt)})
+
+    return id, nil
+}
+
+// Skip records a migration file as applied without running it, reason is e.g. "skip-tag heavy";
+// returns the id of its row in the tracking table
+func (m *Migrator) Skip(ctx context.Context, fileName string, reason string) (int, error) {
+    var id int
+    err := m.conn.QueryRow(ctx, fmt.Sprintf(
+        "INSERT INTO %[1]s (filename, position, skipped_by) SELECT $1::text, COALESCE(MAX(position), 0) + 1, $2::text FROM %[1]s RETURNING id",
+        m.options.TrackingTable), fileName, reason).Scan(&id)
+    if err != nil {
+        return 0, fmt.Errorf("%s: record as skipped in %s: %w", fileName, m.options.TrackingTable, err)
+    }
+
+    return id, nil
+}
+
+// Revert runs the down part of an applied migration (of Status.Applied) and removes its row, it has to be the most recent one;
+// a skipped migration has never run, only its row is removed
+func (m *Migrator) Revert(ctx context.Context, migration AppliedMigration) error {
+    session, release, err := m.acquire(ctx)
+    if err != nil {
+        return err
+    }
+    defer release()
+
+    return session.revert(ctx, migration, 0, 0)
+}
+
+// revert migration, index and total of events are 0 outside of Down
+func (m *Migrator) revert(ctx context.Context, appliedMigration AppliedMigration, index int, total int) error {
+    fileName := appliedMigration.LocalFileName
+    if len(fileName) == 0 {
+        fileName = appliedMigration.FileName
+    }
+
+    // nothing to undo, and its file might not exist locally
+    migration := &Migration{FileName: fileName, Down: Part{Annotations: map[string]string{AnnotationNoop: ""}}}
+    if len(appliedMigration.SkippedBy) == 0 {
+        var err error
+        migration, err = m.source.Read(fileName)
+        if err != nil {
+            return err
+        }
+    }
+
+    m.emit(Event{Kind: EventMigrationStarted, FileName: fileName, Index: index, Total: total})
+    startedAt := time.Now()
+
+    _, err := m.run(ctx, migration, false, func(tx pgx.Tx) (int, error) {
+        result, err := tx.Exec(ctx, fmt.Sprintf(
+            "DELETE FROM %[1]s WHERE id = $1 AND position = (SELECT MAX(position) FROM %[1]s)", m.options.TrackingTable), appliedMigration.ID)
+        if err == nil && result.RowsAffected() != 1 {
+            err = fmt.Errorf("%w: %s is not the most recent migration anymore", ErrOutOfOrder, appliedMigration.FileName)
+        }
+        return appliedMigration.ID, err
+    })
+    if err != nil {
+        m.emit(Event{Kind: EventMigrationFailed, FileName: fileName, Index: index, Total: total, Duration: time.Since(startedAt), Err: err})
+        return err
+    }
+
+    m.emit(Event{Kind: EventMigrationReverted, FileName: fileName, Index: index, Total: total, Duration: time.Since(startedAt)})
+
+    return nil
+}
+
+// VerifyChecksums checks that the files of applied migrations (of Status.Applied) have not been edited since,
+// a *ChecksumError lists all which have; migrations without checksum, skipped ones and ones without local file are not checked
+func (m *Migrator) VerifyChecksums(appliedMigrations []AppliedMigration) error {
+    var changed []AppliedMigration
+    for _, migration := range appliedMigrations {
+        if len(migration.Checksum) == 0 || len(migration.SkippedBy) > 0 || len(migration.LocalFileName) == 0 {
+            continue
+        }
+
+        content, err := m.source.ReadFile(migration.LocalFileName)
+        if err != nil {
+            return err
+        }
+        if Checksum(content) != migration.Checksum {
+            changed = append(changed, migration)
+        }
+    }
+
+    if len(changed) > 0 {
+        return &ChecksumError{Changed: changed}
+    }
+
+    return nil
+}
+
+// RecordChecksum stores the checksum of the local file of an applied migration (of Status.Applied), e.g. of one applied
+// before checksums were stored, or of an edited one whose changes are accepted
+func (m *Migrator) RecordChecksum(ctx context.Context, migration AppliedMigration) error {
+    return m.recordChecksum(ctx, m.conn, migration)
+}
+
+// RecordChecksumInTransaction is RecordChecksum within tx, e.g. the one of Options.InTransaction, so the checksum
+// is only stored together with the migration applied in it
+func (m *Migrator) RecordChecksumInTransaction(ctx context.Context, tx pgx.Tx, migration AppliedMigration) error {
+    return m.recordChecksum(ctx, tx, migration)
+}
+
+func (m *Migrator) recordChecksum(ctx context.Context, conn Conn, migration AppliedMigration) error {
+    if len(migration.LocalFileName) == 0 {
+        return fmt.Errorf("record checksum of %s: migration is missing locally", migration.FileName)
+    }
+
+    content, err := m.source.ReadFile(migration.LocalFileName)
+    if err != nil {
+        return err
+    }
+
+    _, err = conn.Exec(ctx, fmt.Sprintf("UPDATE %s SET checksum = $2::text WHERE id = $1", m.options.TrackingTable),
+        migration.ID, Checksum(content))
+    if err != nil {
+        return fmt.Errorf("record checksum of %s in %s: %w", migration.FileName, m.options.TrackingTable, err)
+    }
+
+    return nil
+}
+
+// Options.Settings followed by the "-- migrate:set" annotations of part, which override them
+func (m *Migrator) getSettings(part Part) ([]Setting, error) {
+    annotatedSettings, err := ParseSetAnnotations(part.Raw)
+    if err != nil {
+        return nil, err
+    }
+    if err := CheckSettings(annotatedSettings, m.options.SetAllowlist); err != nil {
+        return nil, err
+    }
+
+    return append(append([]Setting{}, m.options.Settings...), annotatedSettings...), nil
+}
+
+// run part of a migration and record it in the same transaction, returns what record returns;
+// without transaction the statements run one by one before it, with the settings for the session meanwhile
+func (m *Migrator) run(ctx context.Context, migration *Migration, forward bool, record func(tx pgx.Tx) (int, error)) (int, error) {
+    part := migration.Part(forward)
+    sql := ExpandVariables(part.SQL, m.options.Variables)
+    useTransaction := !part.HasAnnotation(AnnotationNoTransaction)
+    failed := func(err error) *MigrationError {
+        return &MigrationError{FileName: migration.FileName, Forward: forward, Dirty: !useTransaction, Err: err}
+    }
+
+    if len(sql) == 0 && !part.HasAnnotation(AnnotationNoop) {
+        return 0, &MigrationError{FileName: migration.FileName, Forward: forward,
+            Err: errors.New("migration is empty, mark it with '-- migrate:noop' if it is intentionally empty")}
+    }
+
+    settings, err := m.getSettings(part)
+    if err != nil {
+        return 0, &MigrationError{FileName: migration.FileName, Forward: forward, Err: err}
+    }
+
+    startedAt := time.Now()
+    if !useTransaction {
+        if err := m.runWithoutTransaction(ctx, migration, forward, sql, settings); err != nil {
+            return 0, err
+        }
+    }
+
+    tx, err := m.conn.Begin(ctx)
+    if err != nil {
+        return 0, failed(err)
+    }
+    defer tx.Rollback(ctx)
+
+    if useTransaction {
+        // SET LOCAL, they end with the transaction
+        for _, setting := range settings {
+            if _, err := tx.Exec(ctx, "SELECT set_config($1, $2, true)", setting.Name, setting.Value); err != nil {
+                return 0, failed(fmt.Errorf("set %s to %s: %w", setting.Name, setting.Value, err))
+            }
+        }
+
+        if len(sql) > 0 {
+            if _, err := tx.Exec(ctx, sql); err != nil {
+                return 0, failed(err)
+            }
+        }
+    }
+
+    id, err := record(tx)
+    if err != nil {
+        migrationError := failed(fmt.Errorf("%s: %w", m.options.TrackingTable, err))
+        migrationError.Recording = true
+        return 0, migrationError
+    }
+
+    if m.options.InTransaction != nil {
+        err := m.options.InTransaction(ctx, tx, Step{FileName: migration.FileName, Forward: forward, ID: id, Duration: time.Since(startedAt)})
+        if err != nil {
+            return 0, failed(err)
+        }
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        migrationError := failed(err)
+        migrationError.Recording = true
+        return 0, migrationError
+    }
+
+    return id, nil
+}
+
+// run statements one by one, each in its own implicit transaction, with settings for the session which are RESET afterwards
+func (m *Migrator) runWithoutTransaction(ctx context.Context, migration *Migration, forward bool, sql string, settings []Setting) error {
+    for _, setting := range settings {
+        if _, err := m.conn.Exec(ctx, "SELECT set_config($1, $2, false)", setting.Name, setting.Value); err != nil {
+            return &MigrationError{FileName: migration.FileName, Forward: forward, Err: fmt.Errorf("set %s to %s: %w", setting.Name, setting.Value, err)}
+        }
+    }
+
+    // also if a statement fails, the session might be used for other things
+    defer func() {
+        for _, setting := range settings {
+            m.conn.Exec(context.Background(), "RESET "+setting.Name)
+        }
+    }()
+
+    statements := SplitStatements(sql)
+    searchFrom := 0
+    for index, statement := range statements {
+        offset := 0
+        if position := strings.Index(sql[searchFrom:], statement); position >= 0 {
+            offset = len([]rune(sql[:searchFrom+position]))
+            searchFrom += position + len(statement)
+        }
+
+        statementStartedAt := time.Now()
+        if _, err := m.conn.Exec(ctx, statement); err != nil {
+            return &MigrationError{FileName: migration.FileName, Forward: forward, Statement: statement, Offset: offset,
+                StatementIndex: index + 1, StatementTotal: len(statements), Dirty: index > 0, Err: err}
+        }
+
+        m.emit(Event{Kind: EventStatementExecuted, FileName: migration.FileName, StatementIndex: index + 1,
+            StatementTotal: len(statements), Statement: shortenStatement(statement), Duration: time.Since(statementStartedAt)})
+    }
+
+    return nil
+}
+
+var regexpWhitespace = regexp.MustCompile(`\s+`)
+
+// statement for events: one line, at most 200 characters
+func shortenStatement(statement string) string {
+    statement = strings.TrimSpace(regexpWhitespace.ReplaceAllString(statement, " "))
+    if runes := []rune(statement); len(runes) > 200 {
+        statement = string(runes[:200]) + "..."
+    }
+
+    return statement
+}
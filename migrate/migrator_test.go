@@ -0,0 +1,587 @@
+package migrate
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "reflect"
+    "strings"
+    "testing"
+    "testing/fstest"
+    "unicode/utf8"
+
+    "github.com/jackc/pgconn"
+    "github.com/jackc/pgx/v4"
+)
+
+// connection which records what runs on it, statements containing failOn fail
+type fakeConn struct {
+    executed []string
+    failOn   string
+
+    // file names with a row skipped by tag
+    skipped map[string]bool
+
+    // rows DELETE removes
+    deleted int
+
+    // oids which queries for created objects find, by name: before the migration ran and in its transaction;
+    // and what has been recorded
+    existing       map[string]int64
+    oids           map[string]int64
+    createdObjects string
+
+    // another session holds the advisory lock
+    locked bool
+}
+
+// transaction of fakeConn, methods which migrations do not use are left to the embedded interface
+type fakeTx struct {
+    pgx.Tx
+    conn *fakeConn
+}
+
+// pool which hands out conn, like *pgxpool.Pool it has the methods of a connection itself
+type fakePool struct {
+    fakeConn
+    conn fakeConn
+
+    acquired int
+    released int
+}
+
+func (p *fakePool) acquire(ctx context.Context) (Conn, func(), error) {
+    p.acquired++
+    return &p.conn, func() { p.released++ }, nil
+}
+
+// rows of fakeConn.Query with one oid each; none for the tracking table, which does not exist yet
+type fakeRows struct {
+    pgx.Rows
+    oids []int64
+}
+
+func (r *fakeRows) Next() bool {
+    return len(r.oids) > 0
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+    *dest[0].(*int64), r.oids = r.oids[0], r.oids[1:]
+    return nil
+}
+
+func (r *fakeRows) Err() error {
+    return nil
+}
+
+func (r *fakeRows) Close() {
+}
+
+// row of fakeConn.QueryRow, scans id or whether the lock has been taken
+type fakeRow struct {
+    id     int
+    locked bool
+    err    error
+}
+
+func (c *fakeConn) exec(prefix string, sql string, arguments []interface{}) error {
+    statement := prefix + sql
+    if len(arguments) > 0 && strings.HasPrefix(sql, "SELECT set_config") {
+        statement += fmt.Sprint(" ", arguments)
+    }
+    c.executed = append(c.executed, statement)
+
+    if len(c.failOn) > 0 && strings.Contains(sql, c.failOn) {
+        return errors.New("failed: " + sql)
+    }
+
+    return nil
+}
+
+func (c *fakeConn) Begin(ctx context.Context) (pgx.Tx, error) {
+    c.executed = append(c.executed, "BEGIN")
+    return &fakeTx{conn: c}, nil
+}
+
+func (c *fakeConn) Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error) {
+    return nil, c.exec("", sql, arguments)
+}
+
+func (c *fakeConn) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+    if err := c.exec("", sql, nil); err != nil {
+        return nil, err
+    }
+
+    rows := &fakeRows{}
+    if oid, found := c.existing[fmt.Sprint(args...)]; found {
+        rows.oids = append(rows.oids, oid)
+    }
+    return rows, nil
+}
+
+func (c *fakeConn) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+    if err := c.exec("", sql, args); err != nil {
+        return fakeRow{err: err}
+    }
+
+    return fakeRow{id: 1, locked: !c.locked}
+}
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error) {
+    if err := tx.conn.exec("tx: ", sql, arguments); err != nil {
+        return nil, err
+    }
+
+    if strings.Contains(sql, "SET created_objects") {
+        tx.conn.createdObjects = arguments[1].(string)
+    }
+
+    if strings.HasPrefix(sql, "DELETE") {
+        return pgconn.CommandTag(fmt.Sprintf("DELETE %d", tx.conn.deleted)), nil
+    }
+
+    return nil, nil
+}
+
+func (tx *fakeTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+    if err := tx.conn.exec("tx: ", sql, args); err != nil {
+        return fakeRow{err: err}
+    }
+
+    switch {
+    case strings.HasPrefix(sql, "UPDATE") && !tx.conn.skipped[args[0].(string)]:
+        return fakeRow{err: pgx.ErrNoRows}
+    case strings.HasPrefix(sql, "UPDATE"):
+        return fakeRow{id: 3}
+    }
+
+    return fakeRow{id: 7}
+}
+
+func (tx *fakeTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+    if err := tx.conn.exec("tx: ", sql, nil); err != nil {
+        return nil, err
+    }
+
+    rows := &fakeRows{}
+    if oid, found := tx.conn.oids[args[0].(string)]; found {
+        rows.oids = append(rows.oids, oid)
+    }
+    return rows, nil
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+    tx.conn.executed = append(tx.conn.executed, "COMMIT")
+    return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+    return nil
+}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+    if r.err != nil {
+        return r.err
+    }
+
+    switch dest := dest[0].(type) {
+    case *bool:
+        *dest = r.locked
+    default:
+        *dest.(*int) = r.id
+    }
+    return nil
+}
+
+// what ran, without the statements which record migrations
+func withoutRecording(executed []string) []string {
+    var statements []string
+    for _, statement := range executed {
+        if !strings.Contains(statement, DefaultTrackingTable) {
+            statements = append(statements, statement)
+        }
+    }
+
+    return statements
+}
+
+func newTestMigrator(t *testing.T, conn *fakeConn, options Options) *Migrator {
+    options.FS = fstest.MapFS{
+        "migrations/20240101120000-index.sql": migrationFile(
+            "-- migrate:set maintenance_work_mem='2GB'\nCREATE INDEX a_b ON ${SCHEMA}.a (b);\n",
+            "DROP INDEX a_b;\n"),
+        "migrations/20240101130000-concurrently.sql": migrationFile(
+            "-- migrate:no-transaction\nCREATE INDEX CONCURRENTLY a_c ON a (c);\nCREATE INDEX CONCURRENTLY a_d ON a (d);\n",
+            "-- migrate:noop\n"),
+        "migrations/20240101140000-empty.sql": migrationFile("-- nothing yet\n", "-- migrate:noop\n"),
+    }
+    options.Folder = "migrations"
+
+    migrator, err := New(conn, options)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    return migrator
+}
+
+func TestPool(t *testing.T) {
+    pool := &fakePool{}
+    migrator, err := New(pool, Options{FS: newTestMigrator(t, &fakeConn{}, Options{}).source.fsys, Folder: "migrations"})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    err = migrator.Up(context.Background())
+    if err == nil {
+        t.Fatal("got no error, the empty migration should fail")
+    }
+
+    // lock, migrations and unlock share one session, which goes back to the pool
+    if pool.acquired != 1 || pool.released != 1 {
+        t.Errorf("acquired %d and released %d connections, want 1 each", pool.acquired, pool.released)
+    }
+    if len(pool.executed) > 0 {
+        t.Errorf("got %q on the pool itself", pool.executed)
+    }
+    executed := pool.conn.executed
+    if !strings.HasPrefix(executed[0], "SELECT pg_advisory_lock") || !strings.HasPrefix(executed[len(executed)-1], "SELECT pg_advisory_unlock") {
+        t.Errorf("got %q, want everything between lock and unlock", executed)
+    }
+    for _, statement := range []string{"tx: CREATE INDEX a_b ON ${SCHEMA}.a (b);", "CREATE INDEX CONCURRENTLY a_c ON a (c);"} {
+        if !containsString(executed, statement) {
+            t.Errorf("got %q, want %q on the acquired connection", executed, statement)
+        }
+    }
+}
+
+func TestApply(t *testing.T) {
+    conn := &fakeConn{oids: map[string]int64{"a_b": 16384}}
+    var steps []Step
+    migrator := newTestMigrator(t, conn, Options{
+        Variables: map[string]string{"SCHEMA": "analytics"},
+        Settings:  []Setting{{"work_mem", "64MB"}},
+        InTransaction: func(ctx context.Context, tx pgx.Tx, step Step) error {
+            step.Duration = 0
+            steps = append(steps, step)
+            return nil
+        },
+    })
+
+    id, err := migrator.Apply(context.Background(), "20240101120000-index.sql")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if id != 7 {
+        t.Errorf("got id %d, want 7", id)
+    }
+
+    expected := []string{
+        findRelation,
+        "BEGIN",
+        "tx: SELECT set_config($1, $2, true) [work_mem 64MB]",
+        "tx: SELECT set_config($1, $2, true) [maintenance_work_mem 2GB]",
+        "tx: CREATE INDEX a_b ON analytics.a (b);",
+        "tx: " + findRelation,
+        "COMMIT",
+    }
+    if statements := withoutRecording(conn.executed); !reflect.DeepEqual(statements, expected) {
+        t.Errorf("got %q, want %q", statements, expected)
+    }
+
+    if expectedSteps := []Step{{FileName: "20240101120000-index.sql", Forward: true, ID: 7}}; !reflect.DeepEqual(steps, expectedSteps) {
+        t.Errorf("got steps %+v, want %+v", steps, expectedSteps)
+    }
+    if conn.createdObjects != "index 16384" {
+        t.Errorf("got created objects %q, want %q", conn.createdObjects, "index 16384")
+    }
+}
+
+func TestRecordChecksumInTransaction(t *testing.T) {
+    conn := &fakeConn{}
+    var migrator *Migrator
+    migrator = newTestMigrator(t, conn, Options{
+        Variables: map[string]string{"SCHEMA": "analytics"},
+        InTransaction: func(ctx context.Context, tx pgx.Tx, step Step) error {
+            return migrator.RecordChecksumInTransaction(ctx, tx, AppliedMigration{ID: 3, FileName: "20240101130000-concurrently.sql",
+                LocalFileName: "20240101130000-concurrently.sql"})
+        },
+    })
+
+    if _, err := migrator.Apply(context.Background(), "20240101120000-index.sql"); err != nil {
+        t.Fatal(err)
+    }
+
+    expected := "tx: UPDATE " + DefaultTrackingTable + " SET checksum = $2::text WHERE id = $1"
+    for index, statement := range conn.executed {
+        if statement == expected {
+            if conn.executed[index+1] != "COMMIT" {
+                t.Errorf("got %q after the checksum, want it to be committed with the migration", conn.executed[index+1])
+            }
+            return
+        }
+    }
+    t.Errorf("got %q, want %q", conn.executed, expected)
+}
+
+func TestCaptureCreatedObjects(t *testing.T) {
+    conn := &fakeConn{oids: map[string]int64{"public.users": 16384, "f": 16390, "reporting": 2200, "users_email": 16400, "v": 16410}}
+    sql := `
+CREATE TABLE public.users (id int);
+CREATE TABLE IF NOT EXISTS public.users (id int);
+CREATE SCHEMA IF NOT EXISTS reporting;
+CREATE OR REPLACE VIEW v AS SELECT 1;
+CREATE FUNCTION public.f() RETURNS void LANGUAGE sql AS $$ CREATE TABLE inner_table (); $$;
+DO $$ BEGIN CREATE INDEX users_email ON users (email); END $$;
+CREATE TEMP TABLE gone (id int);
+`
+
+    // the schema existed before, the view did not: OR REPLACE created it
+    objects, err := captureCreatedObjects(context.Background(), &fakeTx{conn: conn}, sql, []CreatedObject{{"schema", 2200}})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := []CreatedObject{{"table", 16384}, {"view", 16410}, {"function", 16390}}
+    if !reflect.DeepEqual(objects, expected) {
+        t.Errorf("got %+v, want %+v", objects, expected)
+    }
+
+    parsed, err := parseCreatedObjects(formatCreatedObjects(append(objects, CreatedObject{"materialized view", 16500})))
+    if err != nil || !reflect.DeepEqual(parsed, append(expected, CreatedObject{"materialized view", 16500})) {
+        t.Errorf("got %+v and error %v after formatting and parsing", parsed, err)
+    }
+
+    if _, err := parseCreatedObjects("table"); err == nil {
+        t.Error("got no error for an object without oid")
+    }
+}
+
+func TestUpWithProgress(t *testing.T) {
+    conn := &fakeConn{}
+    var onEvent []EventKind
+    migrator := newTestMigrator(t, conn, Options{OnEvent: func(event Event) {
+        onEvent = append(onEvent, event.Kind)
+    }})
+
+    events, err := migrator.UpWithProgress(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var kinds []EventKind
+    var last Event
+    for event := range events {
+        kinds = append(kinds, event.Kind)
+        last = event
+    }
+
+    // statements are only reported for the migration without transaction, the empty migration fails
+    expected := []EventKind{
+        EventMigrationStarted, EventMigrationApplied,
+        EventMigrationStarted, EventStatementExecuted, EventStatementExecuted, EventMigrationApplied,
+        EventMigrationStarted, EventMigrationFailed,
+    }
+    if !reflect.DeepEqual(kinds, expected) {
+        t.Errorf("got events %v, want %v", kinds, expected)
+    }
+    if !reflect.DeepEqual(onEvent, expected) {
+        t.Errorf("got events %v in Options.OnEvent, want %v", onEvent, expected)
+    }
+    if last.FileName != "20240101140000-empty.sql" || last.Err == nil || last.Index != 3 || last.Total != 3 {
+        t.Errorf("got last event %+v", last)
+    }
+
+    // the lock is released when the channel is closed
+    if unlock := conn.executed[len(conn.executed)-1]; !strings.HasPrefix(unlock, "SELECT pg_advisory_unlock") {
+        t.Errorf("got %q as last statement, want unlock", unlock)
+    }
+}
+
+func TestUpWithProgressFailsBeforeRun(t *testing.T) {
+    conn := &fakeConn{failOn: "pg_advisory_lock"}
+    migrator := newTestMigrator(t, conn, Options{})
+
+    if events, err := migrator.UpWithProgress(context.Background()); err == nil || events != nil {
+        t.Errorf("got events %v and error %v, want error of the lock", events, err)
+    }
+}
+
+func TestShortenStatement(t *testing.T) {
+    statement := shortenStatement("COMMENT ON TABLE a IS\n    '" + strings.Repeat("ä", 300) + "'")
+    if !utf8.ValidString(statement) {
+        t.Errorf("got invalid UTF-8 %q", statement)
+    }
+    if expected := "COMMENT ON TABLE a IS '" + strings.Repeat("ä", 177) + "..."; statement != expected {
+        t.Errorf("got %q, want %q", statement, expected)
+    }
+}
+
+func TestApplySkippedMigration(t *testing.T) {
+    conn := &fakeConn{skipped: map[string]bool{"20240101120000-index.sql": true}}
+    migrator := newTestMigrator(t, conn, Options{})
+
+    id, err := migrator.Apply(context.Background(), "20240101120000-index.sql")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // the row of the skipped migration keeps its position
+    if id != 3 {
+        t.Errorf("got id %d, want 3", id)
+    }
+    for _, statement := range conn.executed {
+        if strings.Contains(statement, "INSERT") {
+            t.Errorf("got %q, the row exists already", statement)
+        }
+    }
+}
+
+func TestApplyWithoutTransaction(t *testing.T) {
+    t.Run("statements run one by one before the migration is recorded", func(t *testing.T) {
+        conn := &fakeConn{oids: map[string]int64{"a_c": 16384, "a_d": 16390}, existing: map[string]int64{"a_d": 16390}}
+        var events []Event
+        migrator := newTestMigrator(t, conn, Options{
+            Settings: []Setting{{"maintenance_work_mem", "1GB"}},
+            OnEvent: func(event Event) {
+                if event.Kind == EventStatementExecuted {
+                    event.Duration = 0
+                    events = append(events, event)
+                }
+            },
+        })
+
+        if _, err := migrator.Apply(context.Background(), "20240101130000-concurrently.sql"); err != nil {
+            t.Fatal(err)
+        }
+
+        expected := []string{
+            findRelation,
+            findRelation,
+            "SELECT set_config($1, $2, false) [maintenance_work_mem 1GB]",
+            "CREATE INDEX CONCURRENTLY a_c ON a (c);",
+            "CREATE INDEX CONCURRENTLY a_d ON a (d);",
+            "RESET maintenance_work_mem",
+            "BEGIN",
+            "tx: " + findRelation,
+            "tx: " + findRelation,
+            "COMMIT",
+        }
+        if statements := withoutRecording(conn.executed); !reflect.DeepEqual(statements, expected) {
+            t.Errorf("got %q, want %q", statements, expected)
+        }
+
+        if len(events) != 2 || events[1].StatementIndex != 2 || events[1].StatementTotal != 2 || events[1].Statement != expected[4] {
+            t.Errorf("got statement events %+v", events)
+        }
+
+        // committed before the record transaction, found by name; a_d existed before
+        if conn.createdObjects != "index 16384" {
+            t.Errorf("got created objects %q, want %q", conn.createdObjects, "index 16384")
+        }
+    })
+
+    t.Run("failure halfway is dirty", func(t *testing.T) {
+        conn := &fakeConn{failOn: "a_d"}
+        migrator := newTestMigrator(t, conn, Options{})
+
+        _, err := migrator.Apply(context.Background(), "20240101130000-concurrently.sql")
+
+        var migrationError *MigrationError
+        if !errors.As(err, &migrationError) || !errors.Is(err, ErrDirty) {
+            t.Fatalf("got error %v, want dirty migration error", err)
+        }
+        if migrationError.StatementIndex != 2 || migrationError.StatementTotal != 2 || migrationError.Statement != "CREATE INDEX CONCURRENTLY a_d ON a (d);" {
+            t.Errorf("got %+v", migrationError)
+        }
+        if offset := strings.Index(migrator.source.mustRead(t, "20240101130000-concurrently.sql").Up.SQL, "CREATE INDEX CONCURRENTLY a_d"); migrationError.Offset != offset {
+            t.Errorf("got offset %d, want %d", migrationError.Offset, offset)
+        }
+        for _, statement := range conn.executed {
+            if statement == "BEGIN" {
+                t.Error("got BEGIN, the failed migration must not be recorded")
+            }
+        }
+    })
+
+    t.Run("failure of the first statement is not dirty", func(t *testing.T) {
+        conn := &fakeConn{failOn: "a_c"}
+        migrator := newTestMigrator(t, conn, Options{})
+
+        _, err := migrator.Apply(context.Background(), "20240101130000-concurrently.sql")
+        if err == nil || errors.Is(err, ErrDirty) {
+            t.Errorf("got error %v, want failure which is not dirty", err)
+        }
+    })
+}
+
+func TestApplyEmptyMigration(t *testing.T) {
+    conn := &fakeConn{}
+    migrator := newTestMigrator(t, conn, Options{})
+
+    if _, err := migrator.Apply(context.Background(), "20240101140000-empty.sql"); err == nil {
+        t.Error("got no error for an empty migration without '-- migrate:noop'")
+    }
+    if len(conn.executed) > 0 {
+        t.Errorf("got %q, nothing should run", conn.executed)
+    }
+}
+
+func TestApplyRejectsSettingsOutsideOfAllowlist(t *testing.T) {
+    conn := &fakeConn{}
+    migrator := newTestMigrator(t, conn, Options{SetAllowlist: []string{"work_mem"}})
+
+    if _, err := migrator.Apply(context.Background(), "20240101120000-index.sql"); err == nil {
+        t.Error("got no error for maintenance_work_mem, which is not in the allowlist")
+    }
+}
+
+func TestRevert(t *testing.T) {
+    t.Run("most recent migration", func(t *testing.T) {
+        conn := &fakeConn{deleted: 1}
+        migrator := newTestMigrator(t, conn, Options{})
+
+        err := migrator.Revert(context.Background(), AppliedMigration{FileName: "20240101120000-index.sql", LocalFileName: "20240101120000-index.sql", ID: 5})
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        if expected := []string{"BEGIN", "tx: DROP INDEX a_b;", "COMMIT"}; !reflect.DeepEqual(withoutRecording(conn.executed), expected) {
+            t.Errorf("got %q, want %q", withoutRecording(conn.executed), expected)
+        }
+    })
+
+    t.Run("not the most recent migration anymore", func(t *testing.T) {
+        conn := &fakeConn{deleted: 0}
+        migrator := newTestMigrator(t, conn, Options{})
+
+        err := migrator.Revert(context.Background(), AppliedMigration{FileName: "20240101120000-index.sql", ID: 5})
+        if !errors.Is(err, ErrOutOfOrder) {
+            t.Errorf("got error %v, want %v", err, ErrOutOfOrder)
+        }
+    })
+
+    t.Run("skipped migration only loses its row", func(t *testing.T) {
+        conn := &fakeConn{deleted: 1}
+        migrator := newTestMigrator(t, conn, Options{})
+
+        err := migrator.Revert(context.Background(), AppliedMigration{FileName: "20231231000000-deleted.sql", SkippedBy: "skip-tag heavy", ID: 5})
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        if expected := []string{"BEGIN", "COMMIT"}; !reflect.DeepEqual(withoutRecording(conn.executed), expected) {
+            t.Errorf("got %q, want %q", withoutRecording(conn.executed), expected)
+        }
+    })
+}
+
+// read migration of a test
+func (s *Source) mustRead(t *testing.T, fileName string) *Migration {
+    migration, err := s.Read(fileName)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    return migration
+}
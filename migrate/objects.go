@@ -0,0 +1,214 @@
+package migrate
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+
+    "github.com/jackc/pgx/v4"
+)
+
+// CreatedObject is a database object which an applied migration created, by oid: renames later on do not lose it
+type CreatedObject struct {
+    // see Object.Kind, e.g. "table" or "function"
+    Kind string
+    OID  uint32
+}
+
+// catalogs of the kinds of objects, with the query which finds an object created by a statement ($1 is its name as written)
+// and the query which names it today ($1 is its oid), quoted as needed for DROP
+var createdObjectCatalogs = map[string]struct {
+    find    string
+    current string
+}{
+    "table":             {findRelation, currentRelation},
+    "view":              {findRelation, currentRelation},
+    "materialized view": {findRelation, currentRelation},
+    "sequence":          {findRelation, currentRelation},
+    "index":             {findRelation, currentRelation},
+    "schema": {"SELECT oid::bigint FROM pg_namespace WHERE oid = to_regnamespace($1)",
+        "SELECT quote_ident(nspname) FROM pg_namespace WHERE oid = $1"},
+    "type": {"SELECT oid::bigint FROM pg_type WHERE oid = to_regtype($1)",
+        "SELECT oid::regtype::text FROM pg_type WHERE oid = $1"},
+
+    // overloads share the name, those which existed before do not count ($1 is the name unquoted)
+    "function":  {findRoutine, currentRoutine},
+    "procedure": {findRoutine, currentRoutine},
+}
+
+const (
+    findRelation    = "SELECT oid::bigint FROM pg_class WHERE oid = to_regclass($1)"
+    currentRelation = "SELECT oid::regclass::text FROM pg_class WHERE oid = $1"
+    findRoutine     = "SELECT oid::bigint FROM pg_proc WHERE proname = $1"
+    currentRoutine  = "SELECT oid::regprocedure::text FROM pg_proc WHERE oid = $1"
+)
+
+// find the objects which sql has created on conn (a transaction, or the session after migrations without transaction):
+// those its statements name, without the ones which existed before, found by findObjects before it ran;
+// objects found by IF NOT EXISTS or replaced by OR REPLACE do not count, neither do statements in function bodies and DO blocks
+func captureCreatedObjects(ctx context.Context, conn Conn, sql string, existing []CreatedObject) ([]CreatedObject, error) {
+    found, err := findObjects(ctx, conn, sql)
+    if err != nil {
+        return nil, err
+    }
+
+    existed := make(map[CreatedObject]bool)
+    for _, object := range existing {
+        existed[object] = true
+    }
+
+    objects := []CreatedObject{}
+    for _, object := range found {
+        if !existed[object] {
+            objects = append(objects, object)
+        }
+    }
+
+    return objects, nil
+}
+
+// find the objects which the statements of sql create by their names, as far as they exist now;
+// functions and procedures by name only, with all overloads
+func findObjects(ctx context.Context, conn Conn, sql string) ([]CreatedObject, error) {
+    seen := make(map[CreatedObject]bool)
+    objects := []CreatedObject{}
+    for _, lookup := range getCreatedObjectLookups(sql) {
+        oids, err := queryOIDs(ctx, conn, lookup.find, lookup.name)
+        if err != nil {
+            return nil, fmt.Errorf("find %s %s: %w", lookup.object.Kind, lookup.object.Name, err)
+        }
+
+        // none if it is gone again, e.g. a temporary table
+        for _, oid := range oids {
+            object := CreatedObject{Kind: lookup.object.Kind, OID: oid}
+            if !seen[object] {
+                seen[object] = true
+                objects = append(objects, object)
+            }
+        }
+    }
+
+    return objects, nil
+}
+
+// CreatedObjectsSQL returns a query for the created_objects column of a migration which is applied without Migrator,
+// e.g. by a script: the objects which the statements of sql name, without those in existingObjects, an SQL expression
+// with the result of the same query before the migration ran (e.g. a psql variable); CreatedObjectsSQL(sql, "''") is that query
+func CreatedObjectsSQL(sql string, existingObjects string) string {
+    var finds []string
+    for index, lookup := range getCreatedObjectLookups(sql) {
+        finds = append(finds, fmt.Sprintf("SELECT %d AS n, %s AS kind, oid FROM (%s) found (oid)", index,
+            quoteLiteral(lookup.object.Kind), strings.Replace(lookup.find, "$1", quoteLiteral(lookup.name), 1)))
+    }
+
+    // nothing created is recorded as empty, not NULL
+    if len(finds) == 0 {
+        return "SELECT ''"
+    }
+
+    return fmt.Sprintf("SELECT COALESCE(string_agg(kind || ' ' || oid, E'\\n' ORDER BY n), '') FROM "+
+        "(SELECT kind, oid, MIN(n) AS n FROM (%s) finds GROUP BY kind, oid) objects "+
+        "WHERE kind || ' ' || oid <> ALL (string_to_array(%s, E'\\n'))", strings.Join(finds, " UNION ALL "), existingObjects)
+}
+
+// statement which creates an object, with the query which finds it in its catalog and the name to find it by
+type createdObjectLookup struct {
+    object *Object
+    find   string
+    name   string
+}
+
+func getCreatedObjectLookups(sql string) []createdObjectLookup {
+    var lookups []createdObjectLookup
+    for _, statement := range SplitStatements(sql) {
+        object := ParseStatement(statement).CreatedObject()
+        if object == nil || len(object.Name) == 0 {
+            continue
+        }
+
+        catalog := createdObjectCatalogs[object.Kind]
+        name := object.Name
+        if catalog.find == findRoutine {
+            _, name, _ = SplitQualifiedName(object.Name)
+        }
+
+        lookups = append(lookups, createdObjectLookup{object: object, find: catalog.find, name: name})
+    }
+
+    return lookups
+}
+
+// quote string as SQL literal, with standard_conforming_strings on
+func quoteLiteral(value string) string {
+    return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func queryOIDs(ctx context.Context, conn Conn, query string, name string) ([]uint32, error) {
+    rows, err := conn.Query(ctx, query, name)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var oids []uint32
+    for rows.Next() {
+        var oid int64
+        if err := rows.Scan(&oid); err != nil {
+            return nil, err
+        }
+        oids = append(oids, uint32(oid))
+    }
+
+    return oids, rows.Err()
+}
+
+// store created objects in the created_objects column, one "kind oid" per line
+func formatCreatedObjects(objects []CreatedObject) string {
+    var lines []string
+    for _, object := range objects {
+        lines = append(lines, fmt.Sprintf("%s %d", object.Kind, object.OID))
+    }
+
+    return strings.Join(lines, "\n")
+}
+
+// read created_objects column, see formatCreatedObjects
+func parseCreatedObjects(column string) ([]CreatedObject, error) {
+    objects := []CreatedObject{}
+    for _, line := range strings.Split(column, "\n") {
+        if len(strings.TrimSpace(line)) == 0 {
+            continue
+        }
+
+        separator := strings.LastIndex(line, " ")
+        if separator < 0 {
+            return nil, fmt.Errorf("invalid created object %q", line)
+        }
+        oid, err := strconv.ParseUint(line[separator+1:], 10, 32)
+        if err != nil {
+            return nil, fmt.Errorf("invalid created object %q", line)
+        }
+        objects = append(objects, CreatedObject{Kind: line[:separator], OID: uint32(oid)})
+    }
+
+    return objects, nil
+}
+
+// CurrentName returns the name of a created object today (quoted as needed, with arguments of functions),
+// empty if it does not exist anymore, e.g. dropped by a later migration
+func (m *Migrator) CurrentName(ctx context.Context, object CreatedObject) (string, error) {
+    catalog, ok := createdObjectCatalogs[object.Kind]
+    if !ok {
+        return "", fmt.Errorf("unknown kind of object %s", object.Kind)
+    }
+
+    var name string
+    err := m.conn.QueryRow(ctx, catalog.current, object.OID).Scan(&name)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return "", nil
+    }
+
+    return name, err
+}
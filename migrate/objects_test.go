@@ -0,0 +1,78 @@
+package migrate
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestCreatedObjectsSQL(t *testing.T) {
+    tests := []struct {
+        name        string
+        sql         string
+        existing    string
+        contains    []string
+        notContains []string
+    }{
+        {
+            name:     "nothing created",
+            sql:      "UPDATE orders SET state = 'new';",
+            contains: []string{"SELECT ''"},
+        },
+        {
+            name: "table and index",
+            sql:  "CREATE TABLE public.orders (id int);\nCREATE INDEX orders_id_idx ON public.orders (id);",
+            contains: []string{
+                "'table' AS kind",
+                "to_regclass('public.orders')",
+                "'index' AS kind",
+                "to_regclass('orders_id_idx')",
+            },
+        },
+        {
+            name:     "may have existed before",
+            sql:      "CREATE TABLE IF NOT EXISTS orders (id int);\nCREATE OR REPLACE VIEW open_orders AS SELECT 1;",
+            existing: ":'migrate_existing_objects'",
+            contains: []string{
+                "to_regclass('orders')",
+                "to_regclass('open_orders')",
+                "<> ALL (string_to_array(:'migrate_existing_objects', E'\\n'))",
+            },
+        },
+        {
+            name:        "statements in a DO block",
+            sql:         "DO $$ BEGIN CREATE TABLE orders (id int); END $$;",
+            contains:    []string{"SELECT ''"},
+            notContains: []string{"to_regclass"},
+        },
+        {
+            name:     "function by name without schema",
+            sql:      "CREATE FUNCTION app.total() RETURNS int AS $$ SELECT 1 $$ LANGUAGE sql;",
+            contains: []string{"'function' AS kind", "proname = 'total'"},
+        },
+        {
+            name:     "quotes in names",
+            sql:      `CREATE TABLE "o'rders" (id int);`,
+            contains: []string{`to_regclass('"o''rders"')`},
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            if len(test.existing) == 0 {
+                test.existing = "''"
+            }
+
+            query := CreatedObjectsSQL(test.sql, test.existing)
+            for _, expected := range test.contains {
+                if !strings.Contains(query, expected) {
+                    t.Errorf("CreatedObjectsSQL() = %q, does not contain %q", query, expected)
+                }
+            }
+            for _, unexpected := range test.notContains {
+                if strings.Contains(query, unexpected) {
+                    t.Errorf("CreatedObjectsSQL() = %q, contains %q", query, unexpected)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,39 @@
+package migrate
+
+import (
+    "fmt"
+)
+
+// the parser of PostgreSQL itself (libpg_query through pg_query_go, needs cgo), set by pgquery.go if built with
+// -tags pg_query; without it, and for statements it cannot parse (e.g. syntax of a later PostgreSQL version),
+// the tokenizer of this package is used
+var (
+    // syntax error of sql, nil if it parses
+    pgQueryParse func(sql string) error
+
+    // byte offsets of the semicolons which end statements, as the scanner of PostgreSQL finds them
+    pgQuerySemicolons func(sql string) ([]int, error)
+
+    // see Statement.DestroysData and Statement.TouchedTable; false if statement does not parse
+    pgQueryDestroysData func(statement string) (bool, bool)
+    pgQueryTouchedTable func(statement string) (string, string, bool)
+)
+
+// HasParser checks if the parser of PostgreSQL is built in (-tags pg_query), see CheckSyntax
+func HasParser() bool {
+    return pgQueryParse != nil
+}
+
+// CheckSyntax parses sql with the parser of PostgreSQL, without a database server; ErrNoParser
+// unless built with -tags pg_query. The parser is the one of the PostgreSQL version pg_query_go bundles
+func CheckSyntax(sql string) error {
+    if pgQueryParse == nil {
+        return ErrNoParser
+    }
+
+    if err := pgQueryParse(sql); err != nil {
+        return fmt.Errorf("%w: %v", ErrSyntax, err)
+    }
+
+    return nil
+}
@@ -0,0 +1,22 @@
+package migrate
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestCheckSyntax(t *testing.T) {
+    if !HasParser() {
+        if err := CheckSyntax("SELECT 1"); !errors.Is(err, ErrNoParser) {
+            t.Errorf("got error %v, want %v", err, ErrNoParser)
+        }
+        return
+    }
+
+    if err := CheckSyntax("CREATE TABLE orders (id int PRIMARY KEY);\nCREATE INDEX ON orders (id);"); err != nil {
+        t.Errorf("got error %v, want none", err)
+    }
+    if err := CheckSyntax("CREATE TABLE orders (id int PRIMARY KEY"); !errors.Is(err, ErrSyntax) {
+        t.Errorf("got error %v, want %v", err, ErrSyntax)
+    }
+}
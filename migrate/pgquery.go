@@ -0,0 +1,118 @@
+//go:build pg_query
+// +build pg_query
+
+package migrate
+
+import (
+    "strings"
+
+    pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+// the parser of PostgreSQL, see parser.go: go build -tags pg_query (needs cgo and a C compiler)
+func init() {
+    pgQueryParse = func(sql string) error {
+        _, err := pg_query.Parse(sql)
+        return err
+    }
+    pgQuerySemicolons = getPgQuerySemicolons
+    pgQueryDestroysData = getPgQueryDestroysData
+    pgQueryTouchedTable = getPgQueryTouchedTable
+}
+
+// semicolons which end statements, from the scanner of PostgreSQL; none in strings, comments and bodies
+func getPgQuerySemicolons(sql string) ([]int, error) {
+    result, err := pg_query.Scan(sql)
+    if err != nil {
+        return nil, err
+    }
+
+    var semicolons []int
+    for _, token := range result.GetTokens() {
+        if token.GetToken() == pg_query.Token_ASCII_59 {
+            semicolons = append(semicolons, int(token.GetStart()))
+        }
+    }
+
+    return semicolons, nil
+}
+
+// parse a single statement, nil if it does not parse
+func parseSingleStatement(statement string) *pg_query.Node {
+    result, err := pg_query.Parse(statement)
+    if err != nil || len(result.GetStmts()) != 1 {
+        return nil
+    }
+
+    return result.GetStmts()[0].GetStmt()
+}
+
+// TRUNCATE, DROP TABLE, SCHEMA or DATABASE and ALTER TABLE ... DROP COLUMN
+func getPgQueryDestroysData(statement string) (bool, bool) {
+    node := parseSingleStatement(statement)
+    if node == nil {
+        return false, false
+    }
+
+    switch {
+    case node.GetTruncateStmt() != nil, node.GetDropdbStmt() != nil:
+        return true, true
+    case node.GetDropStmt() != nil:
+        removeType := node.GetDropStmt().GetRemoveType()
+        return removeType == pg_query.ObjectType_OBJECT_TABLE || removeType == pg_query.ObjectType_OBJECT_SCHEMA, true
+    case node.GetAlterTableStmt() != nil:
+        for _, command := range node.GetAlterTableStmt().GetCmds() {
+            if command.GetAlterTableCmd().GetSubtype() == pg_query.AlterTableType_AT_DropColumn {
+                return true, true
+            }
+        }
+    }
+
+    return false, true
+}
+
+// see Statement.TouchedTable
+func getPgQueryTouchedTable(statement string) (string, string, bool) {
+    node := parseSingleStatement(statement)
+    if node == nil {
+        return "", "", false
+    }
+
+    var kind string
+    var table *pg_query.RangeVar
+    switch {
+    case node.GetUpdateStmt() != nil:
+        kind, table = "UPDATE", node.GetUpdateStmt().GetRelation()
+    case node.GetDeleteStmt() != nil:
+        kind, table = "DELETE", node.GetDeleteStmt().GetRelation()
+    case node.GetInsertStmt() != nil:
+        kind, table = "INSERT", node.GetInsertStmt().GetRelation()
+    case node.GetAlterTableStmt() != nil && node.GetAlterTableStmt().GetObjtype() == pg_query.ObjectType_OBJECT_TABLE:
+        kind, table = "ALTER TABLE", node.GetAlterTableStmt().GetRelation()
+    case node.GetIndexStmt() != nil:
+        kind, table = "CREATE INDEX", node.GetIndexStmt().GetRelation()
+    case node.GetTruncateStmt() != nil && len(node.GetTruncateStmt().GetRelations()) > 0:
+        kind, table = "TRUNCATE", node.GetTruncateStmt().GetRelations()[0].GetRangeVar()
+    }
+
+    if table == nil {
+        return "", "", true
+    }
+
+    name := quoteIdentifierIfNeeded(table.GetRelname())
+    if len(table.GetSchemaname()) > 0 {
+        name = quoteIdentifierIfNeeded(table.GetSchemaname()) + "." + name
+    }
+
+    return kind, name, true
+}
+
+// quote identifier unless it reads the same without quotes, e.g. public but "Users"
+func quoteIdentifierIfNeeded(identifier string) string {
+    tokens := Tokenize(identifier)
+    if len(tokens) == 1 && tokens[0].Kind == TokenKeyword && tokens[0].Text == identifier && tokens[0].Identifier() == identifier {
+        return identifier
+    }
+
+    return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
@@ -0,0 +1,128 @@
+package migrate
+
+import (
+    "context"
+    "fmt"
+    "strings"
+)
+
+// reasons of migrations recorded without running them because of Options.SkipTags and Options.OnlyTags,
+// followed by the tag(s), e.g. "skip-tag heavy"
+const (
+    SkippedBySkipTag = "skip-tag"
+    SkippedByOnlyTag = "only-tag"
+)
+
+// Plan is what Up does, see Migrator.Plan
+type Plan struct {
+    Status *Status
+
+    // pending migrations until Options.UntilPhase, in order; the ones in SkippedBy are only recorded
+    Pending []string
+
+    // pending migrations from the first one of a later phase on, they wait until after the deployment
+    Waiting []string
+
+    // migrations skipped by tag before which Options.OnlyTags selects now, oldest first
+    CatchUp []string
+
+    // why pending migrations are skipped, e.g. "skip-tag heavy"
+    SkippedBy map[string]string
+}
+
+// IsSkippedByTag checks if a migration has been skipped because of its tags, other skipped migrations (e.g. of objects
+// which existed already) never run
+func IsSkippedByTag(skippedBy string) bool {
+    return strings.HasPrefix(skippedBy, SkippedBySkipTag+" ") || strings.HasPrefix(skippedBy, SkippedByOnlyTag+" ")
+}
+
+// Migrations returns the migrations which run, in order: catch-up ones and pending ones which are not skipped
+func (p *Plan) Migrations() []string {
+    migrations := append([]string{}, p.CatchUp...)
+    for _, fileName := range p.Pending {
+        if _, skipped := p.SkippedBy[fileName]; !skipped {
+            migrations = append(migrations, fileName)
+        }
+    }
+
+    return migrations
+}
+
+// get first tag of migration which is in tags, empty if there is none
+func getMatchingTag(migration *Migration, tags []string) string {
+    for _, migrationTag := range migration.Tags() {
+        if containsString(tags, migrationTag) {
+            return migrationTag
+        }
+    }
+
+    return ""
+}
+
+// Plan compares the tracking table with the migration files like Status, and selects the migrations Up applies:
+// pending ones until Options.UntilPhase, with Options.SkipTags and Options.OnlyTags applied
+func (m *Migrator) Plan(ctx context.Context) (*Plan, error) {
+    untilPhaseIndex := len(Phases)
+    if len(m.options.UntilPhase) > 0 {
+        untilPhaseIndex = PhaseIndex(m.options.UntilPhase)
+        if untilPhaseIndex < 0 {
+            return nil, fmt.Errorf("unknown phase '%s', use one of: %s", m.options.UntilPhase, strings.Join(Phases, ", "))
+        }
+    }
+
+    status, err := m.Status(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    plan := &Plan{Status: status, Pending: status.Pending, SkippedBy: make(map[string]string)}
+
+    // migrations run in order, so the ones after the first migration of a later phase have to wait as well
+    for index, fileName := range status.Pending {
+        migration, err := m.source.Read(fileName)
+        if err != nil {
+            return nil, err
+        }
+
+        if PhaseIndex(migration.Phase()) > untilPhaseIndex {
+            plan.Pending, plan.Waiting = status.Pending[:index], status.Pending[index:]
+            break
+        }
+    }
+
+    if len(m.options.SkipTags) == 0 && len(m.options.OnlyTags) == 0 {
+        return plan, nil
+    }
+
+    // optional subsystem is rolled out now
+    if len(m.options.OnlyTags) > 0 {
+        for _, appliedMigration := range status.Applied {
+            if !IsSkippedByTag(appliedMigration.SkippedBy) || len(appliedMigration.LocalFileName) == 0 {
+                continue
+            }
+
+            migration, err := m.source.Read(appliedMigration.LocalFileName)
+            if err != nil {
+                return nil, err
+            }
+            if len(getMatchingTag(migration, m.options.OnlyTags)) > 0 {
+                plan.CatchUp = append(plan.CatchUp, appliedMigration.LocalFileName)
+            }
+        }
+    }
+
+    for _, fileName := range plan.Pending {
+        migration, err := m.source.Read(fileName)
+        if err != nil {
+            return nil, err
+        }
+
+        if tag := getMatchingTag(migration, m.options.SkipTags); len(tag) > 0 {
+            plan.SkippedBy[fileName] = SkippedBySkipTag + " " + tag
+        } else if len(m.options.OnlyTags) > 0 && len(getMatchingTag(migration, m.options.OnlyTags)) == 0 {
+            plan.SkippedBy[fileName] = SkippedByOnlyTag + " " + strings.Join(m.options.OnlyTags, ",")
+        }
+    }
+
+    return plan, nil
+}
@@ -0,0 +1,159 @@
+package migrate
+
+import (
+    "fmt"
+    "io/fs"
+    "path"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Source lists and reads the migration files of a folder, in the order they are applied
+type Source struct {
+    fsys       fs.FS
+    folder     string
+    pattern    *regexp.Regexp
+    extensions []string
+}
+
+// split into runs of digits and non-digits, e.g. V1.10__x -> V, 1, ., 10, __x
+var regexpVersionParts = regexp.MustCompile(`[0-9]+|[^0-9]+`)
+
+// NewSource reads migration files from folder of fsys, e.g. os.DirFS(".") or an embed.FS;
+// names of migration files match pattern once their extension (one of extensions, default DefaultExtension) is replaced by .sql,
+// a group of pattern named "version" orders them by version (so V2 comes before V10), otherwise they are ordered by name
+func NewSource(fsys fs.FS, folder string, pattern *regexp.Regexp, extensions []string) *Source {
+    if len(extensions) == 0 {
+        extensions = []string{DefaultExtension}
+    }
+
+    return &Source{fsys: fsys, folder: path.Clean(folder), pattern: pattern, extensions: extensions}
+}
+
+// Extension returns the accepted extension of fileName (the longest one which matches), empty if there is none
+func (s *Source) Extension(fileName string) string {
+    matchingExtension := ""
+    for _, extension := range s.extensions {
+        if strings.HasSuffix(fileName, extension) && len(fileName) > len(extension) && len(extension) > len(matchingExtension) {
+            matchingExtension = extension
+        }
+    }
+
+    return matchingExtension
+}
+
+// CanonicalFileName returns fileName with .sql as extension, so the pattern and the order do not depend on the extension
+func (s *Source) CanonicalFileName(fileName string) string {
+    extension := s.Extension(fileName)
+    if len(extension) == 0 {
+        return fileName
+    }
+
+    return strings.TrimSuffix(fileName, extension) + DefaultExtension
+}
+
+// IsMigrationFileName checks if fileName is the name of a migration file, with one of the accepted extensions
+func (s *Source) IsMigrationFileName(fileName string) bool {
+    if len(s.Extension(fileName)) == 0 {
+        return false
+    }
+
+    return s.pattern.MatchString(s.CanonicalFileName(fileName))
+}
+
+// compare versions part by part, digits by their numeric value (so 2 sorts before 10)
+func isVersionLess(versionA string, versionB string) bool {
+    partsA := regexpVersionParts.FindAllString(versionA, -1)
+    partsB := regexpVersionParts.FindAllString(versionB, -1)
+
+    for i := 0; i < len(partsA) && i < len(partsB); i++ {
+        if partsA[i] == partsB[i] {
+            continue
+        }
+
+        numberA, errA := strconv.ParseUint(partsA[i], 10, 64)
+        numberB, errB := strconv.ParseUint(partsB[i], 10, 64)
+        if errA == nil && errB == nil && numberA != numberB {
+            return numberA < numberB
+        }
+
+        return partsA[i] < partsB[i]
+    }
+
+    return len(partsA) < len(partsB)
+}
+
+// Less checks if migration file a is applied before migration file b
+func (s *Source) Less(fileNameA string, fileNameB string) bool {
+    // same order whatever the extensions are, e.g. for a.psql and a-b.sql
+    canonicalA := s.CanonicalFileName(fileNameA)
+    canonicalB := s.CanonicalFileName(fileNameB)
+    if canonicalA == canonicalB {
+        return fileNameA < fileNameB
+    }
+
+    versionGroup := s.pattern.SubexpIndex("version")
+    matchA := s.pattern.FindStringSubmatch(canonicalA)
+    matchB := s.pattern.FindStringSubmatch(canonicalB)
+    if versionGroup < 0 || matchA == nil || matchB == nil || matchA[versionGroup] == matchB[versionGroup] {
+        return canonicalA < canonicalB
+    }
+
+    return isVersionLess(matchA[versionGroup], matchB[versionGroup])
+}
+
+// Sort sorts migration file names in the order they are applied
+func (s *Source) Sort(fileNames []string) {
+    sort.SliceStable(fileNames, func(i, j int) bool {
+        return s.Less(fileNames[i], fileNames[j])
+    })
+}
+
+// List returns the names of the migration files in the order they are applied;
+// a migration with two extensions (e.g. a.sql and a.psql) is an error, which one would run is not obvious
+func (s *Source) List() ([]string, error) {
+    files, err := fs.ReadDir(s.fsys, s.folder)
+    if err != nil {
+        return nil, err
+    }
+
+    var fileNames []string
+    for _, file := range files {
+        if !file.IsDir() && s.IsMigrationFileName(file.Name()) {
+            fileNames = append(fileNames, file.Name())
+        }
+    }
+
+    s.Sort(fileNames)
+
+    for index := 1; index < len(fileNames); index++ {
+        if s.CanonicalFileName(fileNames[index-1]) == s.CanonicalFileName(fileNames[index]) {
+            return nil, fmt.Errorf("migration exists with two extensions: %s and %s", fileNames[index-1], fileNames[index])
+        }
+    }
+
+    return fileNames, nil
+}
+
+// ReadFile reads a file of the folder
+func (s *Source) ReadFile(fileName string) ([]byte, error) {
+    return fs.ReadFile(s.fsys, path.Join(s.folder, fileName))
+}
+
+// Exists checks if the folder has a file, e.g. for applied migrations whose file has been deleted
+func (s *Source) Exists(fileName string) bool {
+    _, err := fs.Stat(s.fsys, path.Join(s.folder, fileName))
+    return err == nil
+}
+
+// Read reads and parses a migration file
+func (s *Source) Read(fileName string) (*Migration, error) {
+    content, err := s.ReadFile(fileName)
+    if err != nil {
+        return nil, err
+    }
+
+    return ParseMigration(fileName, content)
+}
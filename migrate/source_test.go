@@ -0,0 +1,91 @@
+package migrate
+
+import (
+    "reflect"
+    "regexp"
+    "testing"
+    "testing/fstest"
+)
+
+// content of a migration file
+func migrationFile(up string, down string) *fstest.MapFile {
+    return &fstest.MapFile{Data: []byte(up + UndoMarker + down)}
+}
+
+func TestSourceList(t *testing.T) {
+    files := fstest.MapFS{
+        "migrations/20240101120000-b.sql":  migrationFile("SELECT 1;", "SELECT 2;"),
+        "migrations/20240101110000-a.psql": migrationFile("SELECT 1;", "SELECT 2;"),
+        "migrations/20240101130000-c.txt":  migrationFile("SELECT 1;", "SELECT 2;"),
+        "migrations/README.md":             &fstest.MapFile{Data: []byte("migrations")},
+    }
+
+    source := NewSource(files, "migrations", regexp.MustCompile(DefaultFileNamePattern), []string{".sql", ".psql"})
+    fileNames, err := source.List()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if expected := []string{"20240101110000-a.psql", "20240101120000-b.sql"}; !reflect.DeepEqual(fileNames, expected) {
+        t.Errorf("got %v, want %v", fileNames, expected)
+    }
+
+    files["migrations/20240101120000-b.psql"] = migrationFile("SELECT 1;", "SELECT 2;")
+    if _, err := source.List(); err == nil {
+        t.Error("got no error for a migration with two extensions")
+    }
+}
+
+func TestSourceOrdersByVersion(t *testing.T) {
+    pattern := regexp.MustCompile(`^V(?P<version>[0-9]+(\.[0-9]+)*)__[a-z_]+\.sql$`)
+    source := NewSource(fstest.MapFS{}, ".", pattern, nil)
+
+    fileNames := []string{"V10__c.sql", "V2__b.sql", "V1.10__a.sql", "V1.2__a.sql", "V1__a.sql"}
+    source.Sort(fileNames)
+
+    if expected := []string{"V1__a.sql", "V1.2__a.sql", "V1.10__a.sql", "V2__b.sql", "V10__c.sql"}; !reflect.DeepEqual(fileNames, expected) {
+        t.Errorf("got %v, want %v", fileNames, expected)
+    }
+
+    // without version group by name
+    source = NewSource(fstest.MapFS{}, ".", regexp.MustCompile(`^V[0-9]+__[a-z_]+\.sql$`), nil)
+    fileNames = []string{"V10__c.sql", "V2__b.sql"}
+    source.Sort(fileNames)
+    if expected := []string{"V10__c.sql", "V2__b.sql"}; !reflect.DeepEqual(fileNames, expected) {
+        t.Errorf("got %v, want %v", fileNames, expected)
+    }
+}
+
+func TestParseMigration(t *testing.T) {
+    migration, err := ParseMigration("20240101120000-a.sql", []byte(
+        "-- owner: team-payments\n-- phase: post-deploy\n-- tags: reporting, heavy\n\n"+
+            "-- migrate:set maintenance_work_mem='2GB'\nCREATE INDEX ON ${SCHEMA}.a (b);\n"+
+            UndoMarker+"-- migrate:noop\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if migration.Phase() != PhasePostDeploy || !reflect.DeepEqual(migration.Tags(), []string{"reporting", "heavy"}) {
+        t.Errorf("got phase %s and tags %v", migration.Phase(), migration.Tags())
+    }
+    if migration.Up.SQL != "CREATE INDEX ON ${SCHEMA}.a (b);" {
+        t.Errorf("got up SQL %q", migration.Up.SQL)
+    }
+    if len(migration.Down.SQL) != 0 || !migration.Down.HasAnnotation(AnnotationNoop) {
+        t.Errorf("got down part %+v", migration.Down)
+    }
+
+    settings, err := ParseSetAnnotations(migration.Up.Raw)
+    if err != nil || !reflect.DeepEqual(settings, []Setting{{"maintenance_work_mem", "2GB"}}) {
+        t.Errorf("got settings %v, error %v", settings, err)
+    }
+
+    sql := ExpandVariables(migration.Up.SQL, map[string]string{"SCHEMA": "analytics"})
+    if sql != "CREATE INDEX ON analytics.a (b);" {
+        t.Errorf("got expanded SQL %q", sql)
+    }
+
+    if _, err := ParseMigration("20240101120000-a.sql", []byte("SELECT 1;")); err == nil {
+        t.Error("got no error for a migration without separator")
+    }
+}
@@ -0,0 +1,460 @@
+package migrate
+
+import (
+    "strings"
+)
+
+// what an action of ALTER TABLE does, see AlterTableAction
+type ActionKind string
+
+const (
+    ActionAddColumn       ActionKind = "add column"
+    ActionDropColumn      ActionKind = "drop column"
+    ActionAlterColumn     ActionKind = "alter column"
+    ActionAlterColumnType ActionKind = "alter column type"
+    ActionRenameColumn    ActionKind = "rename column"
+    ActionRenameTable     ActionKind = "rename table"
+    ActionAddConstraint   ActionKind = "add constraint"
+    ActionDropConstraint  ActionKind = "drop constraint"
+    ActionReplicaIdentity ActionKind = "replica identity"
+
+    // e.g. SET (fillfactor = 70), OWNER TO or ENABLE TRIGGER
+    ActionOther ActionKind = "other"
+)
+
+// kinds of objects which CreatedObject and DroppedObjects know, multi word kinds with a single space
+var objectKinds = []string{"table", "materialized view", "view", "sequence", "function", "procedure", "type", "schema", "index"}
+
+// key words after ADD or DROP which start a constraint instead of naming a column
+var constraintKeywords = []string{"CONSTRAINT", "PRIMARY", "UNIQUE", "FOREIGN", "CHECK", "EXCLUDE"}
+
+// Statement is a single SQL statement split into tokens, see ParseStatement
+type Statement struct {
+    SQL    string
+    Tokens []Token
+}
+
+// Object is a database object which a statement creates or drops
+type Object struct {
+    // lower case, e.g. "table" or "materialized view"
+    Kind string
+
+    // possibly qualified name as written, quotes included, e.g. public."Users"; empty for an index without name
+    Name string
+
+    // table of an index
+    Table string
+
+    Unique bool
+
+    // CREATE ... IF NOT EXISTS or CREATE OR REPLACE: the object may have existed before
+    IfNotExists bool
+    OrReplace   bool
+}
+
+// AlterTable is an ALTER TABLE statement
+type AlterTable struct {
+    // possibly qualified name as written
+    Table   string
+    Actions []AlterTableAction
+}
+
+// AlterTableAction is one of the comma separated actions of ALTER TABLE
+type AlterTableAction struct {
+    Kind ActionKind
+
+    // column or constraint, as written; empty for constraints without name, e.g. ADD PRIMARY KEY (id)
+    Name string
+
+    // new name of renames
+    NewName string
+
+    // new type of ActionAlterColumnType as written, and if it has a USING clause
+    Type     string
+    HasUsing bool
+
+    // first key word of ActionOther, e.g. "SET" or "OWNER"
+    Text string
+}
+
+// ParseStatement tokenizes a single statement, e.g. one of SplitStatements
+func ParseStatement(sql string) *Statement {
+    return &Statement{SQL: sql, Tokens: Tokenize(sql)}
+}
+
+// cursor on tokens of a statement
+type tokenCursor struct {
+    statement *Statement
+    tokens    []Token
+    position  int
+}
+
+func (s *Statement) cursor() *tokenCursor {
+    return &tokenCursor{statement: s, tokens: s.Tokens}
+}
+
+// next token, an empty operator at the end
+func (c *tokenCursor) peek() Token {
+    if c.position >= len(c.tokens) {
+        return Token{Kind: TokenOperator}
+    }
+
+    return c.tokens[c.position]
+}
+
+// consume the next tokens if they are the key words or operators, in this order
+func (c *tokenCursor) accept(texts ...string) bool {
+    if c.position+len(texts) > len(c.tokens) {
+        return false
+    }
+    for index, text := range texts {
+        if !c.tokens[c.position+index].Is(text) {
+            return false
+        }
+    }
+
+    c.position += len(texts)
+    return true
+}
+
+// consume the first of the key words which is next, empty if none is
+func (c *tokenCursor) acceptOneOf(texts ...string) string {
+    for _, text := range texts {
+        if c.accept(strings.Fields(text)...) {
+            return text
+        }
+    }
+
+    return ""
+}
+
+// consume a possibly qualified name, e.g. public."Users", as written; empty if there is none
+func (c *tokenCursor) name() string {
+    if !c.peek().IsIdentifier() {
+        return ""
+    }
+
+    name := c.peek().Text
+    c.position++
+    for c.peek().Is(".") && c.position+1 < len(c.tokens) && c.tokens[c.position+1].IsIdentifier() {
+        name += "." + c.tokens[c.position+1].Text
+        c.position += 2
+    }
+
+    return name
+}
+
+// skip a parenthesized list, e.g. arguments of a function, if it is next
+func (c *tokenCursor) skipParentheses() {
+    if !c.peek().Is("(") {
+        return
+    }
+
+    depth := 0
+    for ; c.position < len(c.tokens); c.position++ {
+        if c.tokens[c.position].Is("(") {
+            depth++
+        } else if c.tokens[c.position].Is(")") {
+            depth--
+            if depth == 0 {
+                c.position++
+                return
+            }
+        }
+    }
+}
+
+// text of the statement from the token at start up to the token before end, as written
+func (c *tokenCursor) text(start int, end int) string {
+    if start >= end {
+        return ""
+    }
+
+    last := c.tokens[end-1]
+    return c.statement.SQL[c.tokens[start].Offset : last.Offset+len(last.Text)]
+}
+
+// CreatedObject returns the object which a CREATE statement creates, nil for other statements
+// and kinds of objects which are not in objectKinds (e.g. triggers)
+func (s *Statement) CreatedObject() *Object {
+    c := s.cursor()
+    if !c.accept("CREATE") {
+        return nil
+    }
+
+    object := &Object{OrReplace: c.accept("OR", "REPLACE")}
+    c.acceptOneOf("GLOBAL", "LOCAL")
+    c.acceptOneOf("TEMPORARY", "TEMP", "UNLOGGED")
+    object.Unique = c.accept("UNIQUE")
+    c.accept("RECURSIVE")
+
+    object.Kind = c.acceptOneOf(objectKinds...)
+    if len(object.Kind) == 0 {
+        return nil
+    }
+
+    c.accept("CONCURRENTLY")
+    object.IfNotExists = c.accept("IF", "NOT", "EXISTS")
+
+    // CREATE SCHEMA AUTHORIZATION joe creates schema joe
+    if object.Kind == "schema" && c.accept("AUTHORIZATION") {
+        object.Name = c.name()
+        return object
+    }
+
+    // CREATE INDEX ON table names the index itself
+    if !(object.Kind == "index" && c.peek().Is("ON")) {
+        object.Name = c.name()
+    }
+    if object.Kind == "index" {
+        if !c.accept("ON") {
+            return nil
+        }
+        c.accept("ONLY")
+        object.Table = c.name()
+    }
+
+    if len(object.Name) == 0 && object.Kind != "index" {
+        return nil
+    }
+
+    return object
+}
+
+// DroppedObjects returns the objects which a DROP statement drops, nil for other statements
+func (s *Statement) DroppedObjects() []Object {
+    c := s.cursor()
+    if !c.accept("DROP") {
+        return nil
+    }
+
+    kind := c.acceptOneOf(objectKinds...)
+    if len(kind) == 0 {
+        return nil
+    }
+
+    c.accept("CONCURRENTLY")
+    c.accept("IF", "EXISTS")
+
+    var objects []Object
+    for {
+        name := c.name()
+        if len(name) == 0 {
+            return objects
+        }
+        objects = append(objects, Object{Kind: kind, Name: name})
+
+        // arguments of functions
+        c.skipParentheses()
+        if !c.accept(",") {
+            return objects
+        }
+    }
+}
+
+// AlteredType returns the type of ALTER TYPE, empty for other statements
+func (s *Statement) AlteredType() string {
+    c := s.cursor()
+    if !c.accept("ALTER", "TYPE") {
+        return ""
+    }
+
+    return c.name()
+}
+
+// AlterTable parses ALTER TABLE, nil for other statements
+func (s *Statement) AlterTable() *AlterTable {
+    c := s.cursor()
+    if !c.accept("ALTER", "TABLE") {
+        return nil
+    }
+    c.accept("IF", "EXISTS")
+    c.accept("ONLY")
+
+    alterTable := &AlterTable{Table: c.name()}
+    if len(alterTable.Table) == 0 {
+        return nil
+    }
+    c.accept("*")
+
+    // actions are separated by commas outside of parentheses
+    depth, start := 0, c.position
+    for ; c.position <= len(c.tokens); c.position++ {
+        token := c.peek()
+        switch {
+        case token.Is("("):
+            depth++
+        case token.Is(")"):
+            depth--
+        case c.position == len(c.tokens) || token.Is(";") || (depth == 0 && token.Is(",")):
+            if start < c.position {
+                action := parseAlterTableAction(&tokenCursor{statement: s, tokens: c.tokens[:c.position], position: start})
+                alterTable.Actions = append(alterTable.Actions, action)
+            }
+            start = c.position + 1
+        }
+    }
+
+    return alterTable
+}
+
+// parse one action of ALTER TABLE, c ends with the action
+func parseAlterTableAction(c *tokenCursor) AlterTableAction {
+    start := c.position
+    switch {
+    case c.accept("RENAME", "TO"):
+        return AlterTableAction{Kind: ActionRenameTable, NewName: c.name()}
+
+    case c.accept("RENAME", "CONSTRAINT"):
+        name := c.name()
+        c.accept("TO")
+        return AlterTableAction{Kind: ActionOther, Text: "RENAME", Name: name, NewName: c.name()}
+
+    case c.accept("RENAME"):
+        c.accept("COLUMN")
+        name := c.name()
+        if !c.accept("TO") {
+            break
+        }
+        return AlterTableAction{Kind: ActionRenameColumn, Name: name, NewName: c.name()}
+
+    case c.accept("REPLICA", "IDENTITY"):
+        return AlterTableAction{Kind: ActionReplicaIdentity}
+
+    case c.accept("ADD", "CONSTRAINT"):
+        return AlterTableAction{Kind: ActionAddConstraint, Name: c.name()}
+
+    case c.accept("DROP", "CONSTRAINT"):
+        c.accept("IF", "EXISTS")
+        return AlterTableAction{Kind: ActionDropConstraint, Name: c.name()}
+
+    case c.accept("ADD"):
+        if c.acceptOneOf(constraintKeywords...) != "" {
+            return AlterTableAction{Kind: ActionAddConstraint}
+        }
+        c.accept("COLUMN")
+        c.accept("IF", "NOT", "EXISTS")
+        return AlterTableAction{Kind: ActionAddColumn, Name: c.name()}
+
+    case c.accept("DROP"):
+        // e.g. DROP NOT NULL is only valid after ALTER COLUMN, but do not take it for a column
+        if c.acceptOneOf(constraintKeywords...) != "" || c.peek().Is("NOT", "DEFAULT", "EXPRESSION", "IDENTITY") {
+            break
+        }
+        c.accept("COLUMN")
+        c.accept("IF", "EXISTS")
+        return AlterTableAction{Kind: ActionDropColumn, Name: c.name()}
+
+    case c.accept("ALTER"):
+        if c.peek().Is("CONSTRAINT") {
+            break
+        }
+        c.accept("COLUMN")
+        action := AlterTableAction{Kind: ActionAlterColumn, Name: c.name()}
+
+        if !c.accept("SET", "DATA", "TYPE") && !c.accept("TYPE") {
+            return action
+        }
+        action.Kind = ActionAlterColumnType
+
+        // new type until COLLATE or USING
+        typeStart := c.position
+        for c.position < len(c.tokens) && !c.peek().Is("COLLATE", "USING") {
+            c.position++
+        }
+        action.Type = c.text(typeStart, c.position)
+        for c.position < len(c.tokens) && !c.peek().Is("USING") {
+            c.position++
+        }
+        action.HasUsing = c.position < len(c.tokens)
+
+        return action
+    }
+
+    c.position = start
+    return AlterTableAction{Kind: ActionOther, Text: strings.ToUpper(c.peek().Text)}
+}
+
+// DestroysData checks if the statement deletes data for good: TRUNCATE, DROP TABLE, SCHEMA or DATABASE
+// and ALTER TABLE ... DROP COLUMN
+func (s *Statement) DestroysData() bool {
+    if pgQueryDestroysData != nil {
+        if destroysData, ok := pgQueryDestroysData(s.SQL); ok {
+            return destroysData
+        }
+    }
+
+    c := s.cursor()
+    switch {
+    case c.accept("TRUNCATE"):
+        return true
+    case c.accept("DROP"):
+        return len(c.acceptOneOf("TABLE", "SCHEMA", "DATABASE")) > 0
+    }
+
+    if alterTable := s.AlterTable(); alterTable != nil {
+        for _, action := range alterTable.Actions {
+            if action.Kind == ActionDropColumn {
+                return true
+            }
+        }
+    }
+
+    return false
+}
+
+// TouchedTable returns the kind of statement and the existing table which UPDATE, DELETE, INSERT, ALTER TABLE,
+// CREATE INDEX or TRUNCATE touches, e.g. "CREATE INDEX" and public.users; empty for other statements
+func (s *Statement) TouchedTable() (string, string) {
+    if pgQueryTouchedTable != nil {
+        if kind, table, ok := pgQueryTouchedTable(s.SQL); ok {
+            return kind, table
+        }
+    }
+
+    kind, table := "", ""
+
+    c := s.cursor()
+    switch {
+    case c.accept("UPDATE"):
+        c.accept("ONLY")
+        kind, table = "UPDATE", c.name()
+    case c.accept("DELETE", "FROM"):
+        c.accept("ONLY")
+        kind, table = "DELETE", c.name()
+    case c.accept("INSERT", "INTO"):
+        kind, table = "INSERT", c.name()
+    case c.accept("ALTER", "TABLE"):
+        c.accept("IF", "EXISTS")
+        c.accept("ONLY")
+        kind, table = "ALTER TABLE", c.name()
+    case c.accept("TRUNCATE"):
+        c.accept("TABLE")
+        c.accept("ONLY")
+        kind, table = "TRUNCATE", c.name()
+    default:
+        if object := s.CreatedObject(); object != nil && object.Kind == "index" {
+            kind, table = "CREATE INDEX", object.Table
+        }
+    }
+
+    if len(table) == 0 {
+        return "", ""
+    }
+
+    return kind, table
+}
+
+// SplitQualifiedName splits a possibly qualified name into schema (empty if not qualified) and name,
+// resolved like PostgreSQL does (see Token.Identifier); false if it is no name
+func SplitQualifiedName(name string) (string, string, bool) {
+    tokens := Tokenize(name)
+    switch {
+    case len(tokens) == 1 && tokens[0].IsIdentifier():
+        return "", tokens[0].Identifier(), true
+    case len(tokens) == 3 && tokens[0].IsIdentifier() && tokens[1].Is(".") && tokens[2].IsIdentifier():
+        return tokens[0].Identifier(), tokens[2].Identifier(), true
+    }
+
+    return "", "", false
+}
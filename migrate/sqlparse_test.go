@@ -0,0 +1,232 @@
+package migrate
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestTokenize(t *testing.T) {
+    tokens := Tokenize(`SELECT E'a\'b', "Quoted ""x""".id::text, $1 <> 1.5e-3 -- comment
+/* block /* nested */ */ FROM t WHERE body = $fn$ CREATE TABLE x (); $fn$;`)
+
+    expected := []Token{
+        {TokenKeyword, "SELECT", 0},
+        {TokenString, `E'a\'b'`, 7},
+        {TokenOperator, ",", 14},
+        {TokenQuotedIdentifier, `"Quoted ""x"""`, 16},
+        {TokenOperator, ".", 30},
+        {TokenKeyword, "id", 31},
+        {TokenOperator, "::", 33},
+        {TokenKeyword, "text", 35},
+        {TokenOperator, ",", 39},
+        {TokenParameter, "$1", 41},
+        {TokenOperator, "<>", 44},
+        {TokenNumber, "1.5e-3", 47},
+        {TokenKeyword, "FROM", 90},
+        {TokenKeyword, "t", 95},
+        {TokenKeyword, "WHERE", 97},
+        {TokenKeyword, "body", 103},
+        {TokenOperator, "=", 108},
+        {TokenString, "$fn$ CREATE TABLE x (); $fn$", 110},
+        {TokenOperator, ";", 138},
+    }
+    if !reflect.DeepEqual(tokens, expected) {
+        t.Errorf("got %v, want %v", tokens, expected)
+    }
+
+    if identifier := tokens[3].Identifier(); identifier != `Quoted "x"` {
+        t.Errorf("got identifier %q", identifier)
+    }
+    if identifier := tokens[0].Identifier(); identifier != "select" {
+        t.Errorf("got identifier %q", identifier)
+    }
+}
+
+func TestCreatedObject(t *testing.T) {
+    tests := []struct {
+        sql      string
+        expected *Object
+    }{
+        {"CREATE TABLE public.users (id int)", &Object{Kind: "table", Name: "public.users"}},
+        {`create unlogged table if not exists "Users" (id int)`, &Object{Kind: "table", Name: `"Users"`, IfNotExists: true}},
+        {"CREATE OR REPLACE FUNCTION f(a int) RETURNS int AS $$ CREATE TABLE x (); $$ LANGUAGE sql",
+            &Object{Kind: "function", Name: "f", OrReplace: true}},
+        {"CREATE MATERIALIZED VIEW v AS SELECT 1", &Object{Kind: "materialized view", Name: "v"}},
+        {"CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS users_email ON ONLY users (email)",
+            &Object{Kind: "index", Name: "users_email", Table: "users", Unique: true, IfNotExists: true}},
+        {"CREATE INDEX ON users (email)", &Object{Kind: "index", Table: "users"}},
+        {"CREATE SCHEMA AUTHORIZATION reporting", &Object{Kind: "schema", Name: "reporting"}},
+        {"-- leading comment\nCREATE SEQUENCE s", &Object{Kind: "sequence", Name: "s"}},
+        {"CREATE TRIGGER t BEFORE INSERT ON users FOR EACH ROW EXECUTE PROCEDURE f()", nil},
+        {"DO $$ BEGIN CREATE TABLE x (); END $$", nil},
+        {"SELECT 'CREATE TABLE x'", nil},
+    }
+
+    for _, test := range tests {
+        t.Run(test.sql, func(t *testing.T) {
+            if object := ParseStatement(test.sql).CreatedObject(); !reflect.DeepEqual(object, test.expected) {
+                t.Errorf("got %+v, want %+v", object, test.expected)
+            }
+        })
+    }
+}
+
+func TestDroppedObjects(t *testing.T) {
+    objects := ParseStatement("DROP FUNCTION IF EXISTS f(int, text), public.g() CASCADE").DroppedObjects()
+    if expected := []Object{{Kind: "function", Name: "f"}, {Kind: "function", Name: "public.g"}}; !reflect.DeepEqual(objects, expected) {
+        t.Errorf("got %+v, want %+v", objects, expected)
+    }
+
+    objects = ParseStatement("DROP MATERIALIZED VIEW a, b;").DroppedObjects()
+    if expected := []Object{{Kind: "materialized view", Name: "a"}, {Kind: "materialized view", Name: "b"}}; !reflect.DeepEqual(objects, expected) {
+        t.Errorf("got %+v, want %+v", objects, expected)
+    }
+
+    if objects := ParseStatement("DROP TRIGGER t ON users").DroppedObjects(); objects != nil {
+        t.Errorf("got %+v for a trigger", objects)
+    }
+}
+
+func TestAlterTable(t *testing.T) {
+    tests := []struct {
+        name     string
+        sql      string
+        table    string
+        expected []AlterTableAction
+    }{
+        {
+            name:  "columns",
+            sql:   "ALTER TABLE IF EXISTS ONLY public.orders ADD COLUMN IF NOT EXISTS note text DEFAULT 'a, b', DROP COLUMN old, RENAME amount TO total;",
+            table: "public.orders",
+            expected: []AlterTableAction{
+                {Kind: ActionAddColumn, Name: "note"},
+                {Kind: ActionDropColumn, Name: "old"},
+                {Kind: ActionRenameColumn, Name: "amount", NewName: "total"},
+            },
+        },
+        {
+            name:  "column types",
+            sql:   "ALTER TABLE orders ALTER COLUMN amount TYPE numeric(12, 2) USING amount::numeric(12, 2), ALTER code SET DATA TYPE varchar(20), ALTER note SET NOT NULL",
+            table: "orders",
+            expected: []AlterTableAction{
+                {Kind: ActionAlterColumnType, Name: "amount", Type: "numeric(12, 2)", HasUsing: true},
+                {Kind: ActionAlterColumnType, Name: "code", Type: "varchar(20)"},
+                {Kind: ActionAlterColumn, Name: "note"},
+            },
+        },
+        {
+            name:  "constraints are no columns",
+            sql:   "ALTER TABLE orders ADD CONSTRAINT orders_total CHECK (total > 0), ADD PRIMARY KEY (id), DROP CONSTRAINT IF EXISTS orders_old",
+            table: "orders",
+            expected: []AlterTableAction{
+                {Kind: ActionAddConstraint, Name: "orders_total"},
+                {Kind: ActionAddConstraint},
+                {Kind: ActionDropConstraint, Name: "orders_old"},
+            },
+        },
+        {
+            name:     "rename table",
+            sql:      `ALTER TABLE "Orders" RENAME TO orders`,
+            table:    `"Orders"`,
+            expected: []AlterTableAction{{Kind: ActionRenameTable, NewName: "orders"}},
+        },
+        {
+            name:  "other actions",
+            sql:   "ALTER TABLE orders REPLICA IDENTITY FULL, SET (fillfactor = 70), OWNER TO app",
+            table: "orders",
+            expected: []AlterTableAction{
+                {Kind: ActionReplicaIdentity},
+                {Kind: ActionOther, Text: "SET"},
+                {Kind: ActionOther, Text: "OWNER"},
+            },
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            alterTable := ParseStatement(test.sql).AlterTable()
+            if alterTable == nil {
+                t.Fatal("got no ALTER TABLE")
+            }
+            if alterTable.Table != test.table || !reflect.DeepEqual(alterTable.Actions, test.expected) {
+                t.Errorf("got %s %+v, want %s %+v", alterTable.Table, alterTable.Actions, test.table, test.expected)
+            }
+        })
+    }
+
+    if alterTable := ParseStatement("ALTER TYPE mood ADD VALUE 'meh'").AlterTable(); alterTable != nil {
+        t.Errorf("got %+v for ALTER TYPE", alterTable)
+    }
+}
+
+func TestTouchedTable(t *testing.T) {
+    tests := []struct {
+        sql   string
+        kind  string
+        table string
+    }{
+        {"UPDATE ONLY public.orders SET total = 0 WHERE id = 1", "UPDATE", "public.orders"},
+        {`delete from "Orders" where true`, "DELETE", `"Orders"`},
+        {"INSERT INTO orders (id) VALUES (1)", "INSERT", "orders"},
+        {"ALTER TABLE IF EXISTS ONLY orders ADD COLUMN note text", "ALTER TABLE", "orders"},
+        {"CREATE UNIQUE INDEX CONCURRENTLY orders_note ON ONLY orders (note)", "CREATE INDEX", "orders"},
+        {"-- comment\nTRUNCATE TABLE orders", "TRUNCATE", "orders"},
+        {"CREATE TABLE orders (id int)", "", ""},
+        {"SELECT 'UPDATE orders SET total = 0'", "", ""},
+    }
+
+    for _, test := range tests {
+        if kind, table := ParseStatement(test.sql).TouchedTable(); kind != test.kind || table != test.table {
+            t.Errorf("got %q, %q for %s, want %q, %q", kind, table, test.sql, test.kind, test.table)
+        }
+    }
+}
+
+func TestSplitQualifiedName(t *testing.T) {
+    tests := []struct {
+        name   string
+        schema string
+        object string
+        ok     bool
+    }{
+        {"Users", "", "users", true},
+        {`public."Users"`, "public", "Users", true},
+        {`"my schema".t`, "my schema", "t", true},
+        {"a.b.c", "", "", false},
+        {"f()", "", "", false},
+    }
+
+    for _, test := range tests {
+        schema, object, ok := SplitQualifiedName(test.name)
+        if schema != test.schema || object != test.object || ok != test.ok {
+            t.Errorf("got %q, %q, %v for %s, want %q, %q, %v", schema, object, ok, test.name, test.schema, test.object, test.ok)
+        }
+    }
+}
+
+func TestDestroysData(t *testing.T) {
+    tests := []struct {
+        sql      string
+        expected bool
+    }{
+        {"TRUNCATE orders", true},
+        {"drop table if exists orders", true},
+        {"DROP SCHEMA archive CASCADE", true},
+        {"DROP DATABASE old", true},
+        {"ALTER TABLE orders DROP COLUMN note", true},
+        {"ALTER TABLE orders DROP note", true},
+        {"ALTER TABLE orders DROP CONSTRAINT orders_note_check", false},
+        {"ALTER TABLE orders ALTER COLUMN note DROP NOT NULL", false},
+        {"DROP INDEX orders_note", false},
+        {"DROP VIEW open_orders", false},
+        {"COMMENT ON TABLE orders IS 'DROP TABLE orders'", false},
+        {"DO $$ BEGIN RAISE NOTICE 'TRUNCATE'; END $$", false},
+        {"-- DROP TABLE orders\nSELECT 1", false},
+    }
+
+    for _, test := range tests {
+        if destroysData := ParseStatement(test.sql).DestroysData(); destroysData != test.expected {
+            t.Errorf("got %v for %s, want %v", destroysData, test.sql, test.expected)
+        }
+    }
+}
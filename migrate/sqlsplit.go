@@ -0,0 +1,118 @@
+package migrate
+
+import (
+    "strings"
+)
+
+// SplitStatements splits SQL into single statements at the semicolons between tokens (see Tokenize),
+// so semicolons in string constants, function bodies and comments do not split; also aware of COPY data.
+// Built with -tags pg_query, the scanner of PostgreSQL finds the semicolons
+func SplitStatements(sql string) []string {
+    if statements, ok := splitStatementsWithScanner(sql); ok {
+        return statements
+    }
+
+    var statements []string
+
+    statementStart := 0
+    for position := 0; ; {
+        token, ok := nextToken(sql, position)
+        if !ok {
+            break
+        }
+        position = token.Offset + len(token.Text)
+
+        if token.Kind != TokenOperator || token.Text != ";" {
+            continue
+        }
+
+        // data of COPY ... FROM stdin follows the statement, up to a line with \.
+        if IsCopyFromStdin(sql[statementStart:position]) {
+            position = getCopyDataEnd(sql, position)
+        }
+
+        statements = appendStatement(statements, sql[statementStart:position])
+        statementStart = position
+    }
+
+    // last statement does not need to end with a semicolon
+    if statementStart < len(sql) {
+        statements = appendStatement(statements, sql[statementStart:])
+    }
+
+    return statements
+}
+
+// split at the semicolons the scanner of PostgreSQL finds, false without -tags pg_query, if it fails
+// or for COPY data, which is no SQL
+func splitStatementsWithScanner(sql string) ([]string, bool) {
+    if pgQuerySemicolons == nil {
+        return nil, false
+    }
+
+    semicolons, err := pgQuerySemicolons(sql)
+    if err != nil {
+        return nil, false
+    }
+
+    var statements []string
+    statementStart := 0
+    for _, semicolon := range append(semicolons, len(sql)-1) {
+        if semicolon < statementStart {
+            continue
+        }
+
+        statement := sql[statementStart : semicolon+1]
+        if IsCopyFromStdin(statement) {
+            return nil, false
+        }
+
+        statements = appendStatement(statements, statement)
+        statementStart = semicolon + 1
+    }
+
+    return statements, true
+}
+
+// IsCopyFromStdin checks if statement reads data inline, as in dumps of pg_dump: COPY ... FROM stdin
+// before the first semicolon, the data after it is not read
+func IsCopyFromStdin(statement string) bool {
+    var previous Token
+    for position := 0; ; {
+        token, ok := nextToken(statement, position)
+        if !ok || token.Is(";") {
+            return false
+        }
+        position = token.Offset + len(token.Text)
+
+        switch {
+        case token.Kind == TokenComment:
+            continue
+        case len(previous.Text) == 0 && !token.Is("COPY"):
+            return false
+        case token.Is("STDIN") && previous.Is("FROM"):
+            return true
+        }
+        previous = token
+    }
+}
+
+// get end of inline data of COPY ... FROM stdin which starts at position
+func getCopyDataEnd(sql string, position int) int {
+    end := strings.Index(sql[position:], "\n\\.")
+    if end < 0 {
+        return len(sql)
+    }
+
+    return position + end + len("\n\\.")
+}
+
+// append statement unless it is empty or only consists of comments
+func appendStatement(statements []string, statement string) []string {
+    statement = strings.TrimSpace(statement)
+    if len(strings.TrimSpace(strings.TrimSuffix(CleanUpSQL(statement), ";"))) == 0 {
+        return statements
+    }
+
+    return append(statements, statement)
+}
@@ -0,0 +1,100 @@
+package migrate
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+    tests := []struct {
+        name     string
+        sql      string
+        expected []string
+    }{
+        {
+            name:     "statements with and without trailing semicolon",
+            sql:      "CREATE TABLE a (id int);\nCREATE TABLE b (id int)",
+            expected: []string{"CREATE TABLE a (id int);", "CREATE TABLE b (id int)"},
+        },
+        {
+            name:     "semicolon in string constant and escaped quote",
+            sql:      "INSERT INTO a VALUES ('x;y', 'it''s;');SELECT 1;",
+            expected: []string{"INSERT INTO a VALUES ('x;y', 'it''s;');", "SELECT 1;"},
+        },
+        {
+            name:     "backslash escape in E string",
+            sql:      `SELECT E'a\';b';SELECT 2;`,
+            expected: []string{`SELECT E'a\';b';`, "SELECT 2;"},
+        },
+        {
+            name:     "quoted identifier",
+            sql:      `CREATE TABLE "a;b" (id int);SELECT 1;`,
+            expected: []string{`CREATE TABLE "a;b" (id int);`, "SELECT 1;"},
+        },
+        {
+            name: "dollar quoted function body",
+            sql: "CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql;\n" +
+                "DO $$ BEGIN PERFORM 1; END $$;",
+            expected: []string{
+                "CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql;",
+                "DO $$ BEGIN PERFORM 1; END $$;",
+            },
+        },
+        {
+            name:     "parameters are not dollar quotes",
+            sql:      "PREPARE p AS SELECT $1;EXECUTE p(1);",
+            expected: []string{"PREPARE p AS SELECT $1;", "EXECUTE p(1);"},
+        },
+        {
+            name:     "comments",
+            sql:      "SELECT 1; -- first; still a comment\n/* block; /* nested; */ */ SELECT 2;",
+            expected: []string{"SELECT 1;", "-- first; still a comment\n/* block; /* nested; */ */ SELECT 2;"},
+        },
+        {
+            name:     "empty statements and comment only statements are left out",
+            sql:      ";;\n-- nothing\n;SELECT 1;",
+            expected: []string{"SELECT 1;"},
+        },
+        {
+            name:     "data of COPY FROM stdin",
+            sql:      "COPY a (id, name) FROM stdin;\n1\tx;y\n\\.\nSELECT 1;",
+            expected: []string{"COPY a (id, name) FROM stdin;\n1\tx;y\n\\.", "SELECT 1;"},
+        },
+        {
+            name:     "nothing",
+            sql:      "  \n",
+            expected: nil,
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            statements := SplitStatements(test.sql)
+            if !reflect.DeepEqual(statements, test.expected) {
+                t.Errorf("got %q, want %q", statements, test.expected)
+            }
+        })
+    }
+}
+
+func TestIsCopyFromStdin(t *testing.T) {
+    tests := []struct {
+        statement string
+        expected  bool
+    }{
+        {"COPY a (id, name) FROM stdin;\n1\tx\n\\.", true},
+        {"copy a from STDIN with (format csv);", true},
+        {"-- data of a\nCOPY a FROM /* inline */ stdin;", true},
+        {"COPY a TO stdout;", false},
+        {"COPY a FROM '/tmp/a.csv';", false},
+        {"COPY a FROM stdin_file;", false},
+        {"SELECT 'COPY a FROM stdin';", false},
+        {"INSERT INTO a VALUES (1);\nCOPY a FROM stdin;", false},
+    }
+
+    for _, test := range tests {
+        if isCopyFromStdin := IsCopyFromStdin(test.statement); isCopyFromStdin != test.expected {
+            t.Errorf("got %v for %q, want %v", isCopyFromStdin, test.statement, test.expected)
+        }
+    }
+}
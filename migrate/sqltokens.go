@@ -0,0 +1,274 @@
+package migrate
+
+import (
+    "strings"
+)
+
+// kind of a Token
+type TokenKind int
+
+const (
+    // key word or unquoted identifier, e.g. CREATE or users
+    TokenKeyword TokenKind = iota
+
+    // e.g. "Users"
+    TokenQuotedIdentifier
+
+    // string constant, e.g. 'a', E'a\n' or a dollar quoted function body
+    TokenString
+
+    // e.g. 42 or 1.5e3
+    TokenNumber
+
+    // positional parameter, e.g. $1
+    TokenParameter
+
+    // operator or punctuation, e.g. ( , ; . :: or <>
+    TokenOperator
+
+    // -- line comment or /* block comment */
+    TokenComment
+)
+
+// characters of operators which consist of several characters, e.g. <> or ->>
+const operatorCharacters = "+-*/<>=~!@#%^&|`?"
+
+// Token is a lexical token of SQL, see Tokenize
+type Token struct {
+    Kind TokenKind
+    Text string
+
+    // in bytes from the start of the tokenized SQL
+    Offset int
+}
+
+// Is checks if token is one of the key words (case insensitive) or operators
+func (t Token) Is(texts ...string) bool {
+    for _, text := range texts {
+        if (t.Kind == TokenKeyword && strings.EqualFold(t.Text, text)) || (t.Kind == TokenOperator && t.Text == text) {
+            return true
+        }
+    }
+
+    return false
+}
+
+// IsIdentifier checks if token can be an identifier, quoted or not
+func (t Token) IsIdentifier() bool {
+    return t.Kind == TokenKeyword || t.Kind == TokenQuotedIdentifier
+}
+
+// Identifier returns the name of an identifier token like PostgreSQL resolves it: quoted identifiers are unquoted,
+// others are folded to lower case
+func (t Token) Identifier() string {
+    if t.Kind == TokenQuotedIdentifier && len(t.Text) >= 2 {
+        return strings.ReplaceAll(t.Text[1:len(t.Text)-1], `""`, `"`)
+    }
+
+    return strings.ToLower(t.Text)
+}
+
+// Tokenize splits SQL into tokens, without comments; a lexer written in Go, so string constants, dollar quoted
+// bodies of functions and DO blocks and quoted identifiers are single tokens (works without -tags pg_query)
+func Tokenize(sql string) []Token {
+    var tokens []Token
+    for position := 0; ; {
+        token, ok := nextToken(sql, position)
+        if !ok {
+            return tokens
+        }
+        position = token.Offset + len(token.Text)
+
+        if token.Kind != TokenComment {
+            tokens = append(tokens, token)
+        }
+    }
+}
+
+// get next token at or after position, false at the end of sql; unterminated strings and comments end with sql
+func nextToken(sql string, position int) (Token, bool) {
+    for position < len(sql) && strings.IndexByte(" \t\r\n\f", sql[position]) >= 0 {
+        position++
+    }
+    if position >= len(sql) {
+        return Token{}, false
+    }
+
+    end := getTokenEnd(sql, position)
+    token := Token{Kind: TokenOperator, Text: sql[position:end], Offset: position}
+
+    c := sql[position]
+    switch {
+    case strings.HasPrefix(token.Text, "--") || strings.HasPrefix(token.Text, "/*"):
+        token.Kind = TokenComment
+    case c == '\'' || (c == '$' && len(token.Text) > 1 && !isDigit(sql[position+1])):
+        token.Kind = TokenString
+    case c == '$':
+        token.Kind = TokenParameter
+    case c == '"':
+        token.Kind = TokenQuotedIdentifier
+    case isDigit(c):
+        token.Kind = TokenNumber
+    case isIdentifierStart(c):
+        token.Kind = TokenKeyword
+
+        // E'...' and other prefixed strings, e.g. B'101'
+        if end-position == 1 && strings.IndexByte("EeBbXxNn", c) >= 0 && end < len(sql) && sql[end] == '\'' {
+            token.Kind = TokenString
+            token.Text = sql[position:getStringEnd(sql, end, c == 'E' || c == 'e')]
+        }
+    }
+
+    return token, true
+}
+
+// get end of token which starts at position
+func getTokenEnd(sql string, position int) int {
+    c := sql[position]
+    switch {
+    // line comment
+    case strings.HasPrefix(sql[position:], "--"):
+        end := strings.Index(sql[position:], "\n")
+        if end < 0 {
+            return len(sql)
+        }
+        return position + end
+
+    // block comment, may be nested
+    case strings.HasPrefix(sql[position:], "/*"):
+        depth := 0
+        for ; position < len(sql); position++ {
+            if strings.HasPrefix(sql[position:], "/*") {
+                depth++
+                position++
+            } else if strings.HasPrefix(sql[position:], "*/") {
+                depth--
+                position++
+                if depth == 0 {
+                    return position + 1
+                }
+            }
+        }
+        return len(sql)
+
+    case c == '\'':
+        return getStringEnd(sql, position, false)
+
+    // quoted identifier, "" is an escaped quote
+    case c == '"':
+        for position++; position < len(sql); position++ {
+            if sql[position] == '"' {
+                if position+1 < len(sql) && sql[position+1] == '"' {
+                    position++
+                } else {
+                    return position + 1
+                }
+            }
+        }
+        return len(sql)
+
+    // parameter, e.g. $1
+    case c == '$' && position+1 < len(sql) && isDigit(sql[position+1]):
+        position++
+        for position < len(sql) && isDigit(sql[position]) {
+            position++
+        }
+        return position
+
+    // dollar quoted string, e.g. $$ ... $$ or $body$ ... $body$
+    case c == '$':
+        tag := getDollarQuoteTag(sql[position:])
+        if len(tag) == 0 {
+            return position + 1
+        }
+        end := strings.Index(sql[position+len(tag):], tag)
+        if end < 0 {
+            return len(sql)
+        }
+        return position + len(tag) + end + len(tag)
+
+    // digits, decimal point and exponent, e.g. 1.5e-3
+    case isDigit(c):
+        for position++; position < len(sql); position++ {
+            c := sql[position]
+            isExponentSign := (c == '-' || c == '+') && (sql[position-1] == 'e' || sql[position-1] == 'E')
+            if !isDigit(c) && c != '.' && c != 'e' && c != 'E' && c != '_' && !isExponentSign {
+                break
+            }
+        }
+        return position
+
+    case isIdentifierStart(c):
+        for position++; isIdentifierCharacter(sql, position); position++ {
+        }
+        return position
+
+    case c == ':' && strings.HasPrefix(sql[position:], "::"):
+        return position + 2
+
+    // e.g. <>, >= or ->>, but not the start of a comment
+    case strings.IndexByte(operatorCharacters, c) >= 0:
+        for position++; position < len(sql) && strings.IndexByte(operatorCharacters, sql[position]) >= 0; position++ {
+            if strings.HasPrefix(sql[position:], "--") || strings.HasPrefix(sql[position:], "/*") {
+                break
+            }
+        }
+        return position
+    }
+
+    return position + 1
+}
+
+// get end of string constant whose quote is at position, E'' strings allow backslash escapes
+func getStringEnd(sql string, position int, allowBackslashEscapes bool) int {
+    for position++; position < len(sql); position++ {
+        if allowBackslashEscapes && sql[position] == '\\' {
+            position++
+        } else if sql[position] == '\'' {
+            // '' is an escaped quote
+            if position+1 < len(sql) && sql[position+1] == '\'' {
+                position++
+            } else {
+                return position + 1
+            }
+        }
+    }
+
+    return len(sql)
+}
+
+func isDigit(c byte) bool {
+    return c >= '0' && c <= '9'
+}
+
+// check if identifiers can start with character
+func isIdentifierStart(c byte) bool {
+    return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+// check if character at position belongs to an identifier (or parameter like $1)
+func isIdentifierCharacter(sql string, position int) bool {
+    if position < 0 || position >= len(sql) {
+        return false
+    }
+
+    c := sql[position]
+    return isIdentifierStart(c) || c == '$' || isDigit(c)
+}
+
+// get opening tag of dollar quoted string, e.g. "$body$", empty if there is none
+func getDollarQuoteTag(sql string) string {
+    for position := 1; position < len(sql); position++ {
+        c := sql[position]
+        if c == '$' {
+            return sql[:position+1]
+        }
+
+        // tag must not start with a digit
+        if !isIdentifierStart(c) && !(isDigit(c) && position > 1) {
+            return ""
+        }
+    }
+
+    return ""
+}
@@ -0,0 +1,278 @@
+package migrate
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "io"
+    "strings"
+)
+
+// kinds of Mismatch
+const (
+    // applied in the database, the local file has been deleted
+    MismatchMissing = "missing"
+
+    // applied in the database under another name, see Allowlist.Renamed
+    MismatchRenamed = "renamed"
+
+    // pending local file which sorts before an applied migration, e.g. from a branch merged late
+    MismatchOutOfOrder = "out-of-order"
+
+    // without Allowlist: the migration applied at a position is not the local file at that position
+    MismatchDifferent = "different"
+)
+
+// Allowlist lists mismatches between tracking table and migration files which Status lets pass;
+// with an allowlist (even an empty one) Status compares leniently: it reports all mismatches, and pending
+// migrations run after the applied ones even if they sort before them
+type Allowlist struct {
+    // file names in the database
+    Missing map[string]bool
+
+    // file name in the database -> local file name
+    Renamed map[string]string
+
+    // local file names
+    OutOfOrder map[string]bool
+}
+
+// Mismatch is a difference between tracking table and migration files
+type Mismatch struct {
+    Kind string
+
+    // file name in the database, for MismatchOutOfOrder the pending local file
+    FileName string
+
+    // MismatchRenamed: the new name; MismatchOutOfOrder: the most recent applied migration it sorts before;
+    // MismatchDifferent: the local file at Position
+    LocalFileName string
+
+    // MismatchDifferent and MismatchMissing without Allowlist: position in the order of migrations, from 1
+    Position int
+
+    // listed in Allowlist
+    Allowed bool
+}
+
+// MismatchError is returned by Status if there are mismatches which are not allowed, errors.Is(err, ErrOutOfOrder) holds;
+// it lists the allowed ones as well
+type MismatchError struct {
+    Mismatches []Mismatch
+}
+
+// Status compares the tracking table with the migration files, see Migrator.Status
+type Status struct {
+    // rows of the tracking table, in the order they were applied
+    Applied []AppliedMigration
+
+    // number of oldest migrations whose rows have been archived by 'prune-history', they are the first migration files
+    Archived int
+
+    // local files of the applied migrations (archived ones first) and pending local files, in the order they run
+    AppliedFiles []string
+    Pending      []string
+
+    // mismatches, all of them allowed by Options.Allowlist
+    Mismatches []Mismatch
+}
+
+// ParseAllowlist reads an allowlist, one mismatch per line: 'missing file', 'renamed old-file new-file' or 'out-of-order file';
+// empty lines and lines starting with # are ignored
+func ParseAllowlist(reader io.Reader) (*Allowlist, error) {
+    allowlist := &Allowlist{
+        Missing:    make(map[string]bool),
+        Renamed:    make(map[string]string),
+        OutOfOrder: make(map[string]bool),
+    }
+
+    scanner := bufio.NewScanner(reader)
+    lineNumber := 0
+    for scanner.Scan() {
+        lineNumber++
+
+        fields := strings.Fields(scanner.Text())
+        if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+            continue
+        }
+
+        switch {
+        case fields[0] == MismatchMissing && len(fields) == 2:
+            allowlist.Missing[fields[1]] = true
+        case fields[0] == MismatchRenamed && len(fields) == 3:
+            allowlist.Renamed[fields[1]] = fields[2]
+        case fields[0] == MismatchOutOfOrder && len(fields) == 2:
+            allowlist.OutOfOrder[fields[1]] = true
+        default:
+            return nil, fmt.Errorf("invalid line %d: %s, use 'missing file', 'renamed old-file new-file' or 'out-of-order file'",
+                lineNumber, scanner.Text())
+        }
+    }
+
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+
+    return allowlist, nil
+}
+
+func (m Mismatch) String() string {
+    switch m.Kind {
+    case MismatchMissing:
+        return fmt.Sprintf("migration %s is applied in the database, but missing locally", m.FileName)
+    case MismatchRenamed:
+        return fmt.Sprintf("migration %s has been renamed to %s", m.FileName, m.LocalFileName)
+    case MismatchOutOfOrder:
+        return fmt.Sprintf("pending migration %s sorts before applied migration %s", m.FileName, m.LocalFileName)
+    default:
+        return fmt.Sprintf("migration stored in database at position #%d (%s) does not match local migration file %s",
+            m.Position, m.FileName, m.LocalFileName)
+    }
+}
+
+func (e *MismatchError) Error() string {
+    var notAllowed []string
+    for _, mismatch := range e.Mismatches {
+        if !mismatch.Allowed {
+            notAllowed = append(notAllowed, mismatch.String())
+        }
+    }
+
+    return fmt.Sprintf("%s: %s", ErrOutOfOrder, strings.Join(notAllowed, "; "))
+}
+
+func (e *MismatchError) Is(target error) bool {
+    return target == ErrOutOfOrder
+}
+
+// compare migration files with applied migrations (after the archived ones), without database;
+// sets LocalFileName of a copy of applied
+func compareMigrations(fileNames []string, applied []AppliedMigration, archived int, allowlist *Allowlist,
+    less func(string, string) bool) (*Status, error) {
+    // archived migrations are the oldest files, they have been checked before
+    if archived > len(fileNames) {
+        return nil, fmt.Errorf("%w: %d migrations have been archived by 'prune-history', but there are only %d migration files",
+            ErrOutOfOrder, archived, len(fileNames))
+    }
+
+    status := &Status{Applied: append([]AppliedMigration{}, applied...), Archived: archived}
+    if allowlist == nil {
+        return compareMigrationsStrictly(status, fileNames)
+    }
+
+    localFiles := make(map[string]bool)
+    for _, fileName := range fileNames {
+        localFiles[fileName] = true
+    }
+
+    appliedFiles := make(map[string]bool)
+    mostRecentAppliedFile := ""
+    status.AppliedFiles = append([]string{}, fileNames[:archived]...)
+    for _, fileName := range status.AppliedFiles {
+        appliedFiles[fileName] = true
+        mostRecentAppliedFile = fileName
+    }
+
+    notAllowed := 0
+    for index := range status.Applied {
+        migration := &status.Applied[index]
+
+        fileName := migration.FileName
+        if renamedFileName, ok := allowlist.Renamed[migration.FileName]; ok {
+            status.Mismatches = append(status.Mismatches, Mismatch{Kind: MismatchRenamed, FileName: migration.FileName,
+                LocalFileName: renamedFileName, Allowed: true})
+            fileName = renamedFileName
+        }
+
+        if !localFiles[fileName] {
+            allowed := allowlist.Missing[migration.FileName]
+            status.Mismatches = append(status.Mismatches, Mismatch{Kind: MismatchMissing, FileName: migration.FileName, Allowed: allowed})
+            if !allowed {
+                notAllowed++
+            }
+            continue
+        }
+
+        migration.LocalFileName = fileName
+        appliedFiles[fileName] = true
+        status.AppliedFiles = append(status.AppliedFiles, fileName)
+        if len(mostRecentAppliedFile) == 0 || less(mostRecentAppliedFile, fileName) {
+            mostRecentAppliedFile = fileName
+        }
+    }
+
+    // pending files are applied after all others, even if they sort before them
+    for _, fileName := range fileNames {
+        if appliedFiles[fileName] {
+            continue
+        }
+
+        if len(mostRecentAppliedFile) > 0 && less(fileName, mostRecentAppliedFile) {
+            allowed := allowlist.OutOfOrder[fileName]
+            status.Mismatches = append(status.Mismatches, Mismatch{Kind: MismatchOutOfOrder, FileName: fileName,
+                LocalFileName: mostRecentAppliedFile, Allowed: allowed})
+            if !allowed {
+                notAllowed++
+            }
+        }
+
+        status.Pending = append(status.Pending, fileName)
+    }
+
+    if notAllowed > 0 {
+        return nil, &MismatchError{Mismatches: status.Mismatches}
+    }
+
+    return status, nil
+}
+
+// applied migrations are the first migration files in the same order, the first mismatch fails
+func compareMigrationsStrictly(status *Status, fileNames []string) (*Status, error) {
+    databaseFileNames := append([]string{}, fileNames[:status.Archived]...)
+    for _, migration := range status.Applied {
+        databaseFileNames = append(databaseFileNames, migration.FileName)
+    }
+
+    for index, fileName := range databaseFileNames {
+        if index >= len(fileNames) {
+            return nil, &MismatchError{Mismatches: []Mismatch{{Kind: MismatchMissing, FileName: fileName, Position: index + 1}}}
+        }
+        if fileName != fileNames[index] {
+            return nil, &MismatchError{Mismatches: []Mismatch{
+                {Kind: MismatchDifferent, FileName: fileName, LocalFileName: fileNames[index], Position: index + 1}}}
+        }
+    }
+
+    for index := range status.Applied {
+        status.Applied[index].LocalFileName = status.Applied[index].FileName
+    }
+    status.AppliedFiles = databaseFileNames
+    status.Pending = append([]string{}, fileNames[len(databaseFileNames):]...)
+
+    return status, nil
+}
+
+// Status compares the tracking table with the migration files, it only reads (see AppliedMigrations).
+// Without Options.Allowlist any mismatch fails with a *MismatchError
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+    fileNames, err := m.source.List()
+    if err != nil {
+        return nil, fmt.Errorf("read folder %s: %w", m.options.Folder, err)
+    }
+    if len(fileNames) == 0 {
+        return nil, fmt.Errorf("%w in folder %s", ErrNoMigrations, m.options.Folder)
+    }
+
+    appliedMigrations, err := m.AppliedMigrations(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    // rows archived by 'prune-history': the remaining ones continue after the files of the archived ones
+    archived := 0
+    if len(appliedMigrations) > 0 {
+        archived = appliedMigrations[0].Position - 1
+    }
+
+    return compareMigrations(fileNames, appliedMigrations, archived, m.options.Allowlist, m.source.Less)
+}
@@ -0,0 +1,189 @@
+package migrate
+
+import (
+    "errors"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// applied migrations with file names as in the tracking table
+func appliedMigrations(fileNames ...string) []AppliedMigration {
+    var migrations []AppliedMigration
+    for _, fileName := range fileNames {
+        migrations = append(migrations, AppliedMigration{FileName: fileName})
+    }
+
+    return migrations
+}
+
+func lessByName(a string, b string) bool {
+    return a < b
+}
+
+func TestCompareMigrationsStrictly(t *testing.T) {
+    files := []string{"1-a.sql", "2-b.sql", "3-c.sql", "4-d.sql"}
+
+    tests := []struct {
+        name         string
+        applied      []AppliedMigration
+        archived     int
+        appliedFiles []string
+        pending      []string
+        mismatch     *Mismatch
+    }{
+        {
+            name:         "nothing applied",
+            appliedFiles: []string{},
+            pending:      files,
+        },
+        {
+            name:         "some applied",
+            applied:      appliedMigrations("1-a.sql", "2-b.sql"),
+            appliedFiles: []string{"1-a.sql", "2-b.sql"},
+            pending:      []string{"3-c.sql", "4-d.sql"},
+        },
+        {
+            name:         "oldest archived by prune-history",
+            applied:      appliedMigrations("3-c.sql"),
+            archived:     2,
+            appliedFiles: []string{"1-a.sql", "2-b.sql", "3-c.sql"},
+            pending:      []string{"4-d.sql"},
+        },
+        {
+            name:     "applied migration differs from file",
+            applied:  appliedMigrations("1-a.sql", "2-x.sql"),
+            mismatch: &Mismatch{Kind: MismatchDifferent, FileName: "2-x.sql", LocalFileName: "2-b.sql", Position: 2},
+        },
+        {
+            name:     "archived migrations are counted",
+            applied:  appliedMigrations("2-x.sql"),
+            archived: 1,
+            mismatch: &Mismatch{Kind: MismatchDifferent, FileName: "2-x.sql", LocalFileName: "2-b.sql", Position: 2},
+        },
+        {
+            name:     "more applied migrations than files",
+            applied:  appliedMigrations("1-a.sql", "2-b.sql", "3-c.sql", "4-d.sql", "5-e.sql"),
+            mismatch: &Mismatch{Kind: MismatchMissing, FileName: "5-e.sql", Position: 5},
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            status, err := compareMigrations(files, test.applied, test.archived, nil, lessByName)
+
+            if test.mismatch != nil {
+                var mismatchError *MismatchError
+                if !errors.As(err, &mismatchError) || !errors.Is(err, ErrOutOfOrder) {
+                    t.Fatalf("got error %v, want mismatch", err)
+                }
+                if !reflect.DeepEqual(mismatchError.Mismatches, []Mismatch{*test.mismatch}) {
+                    t.Errorf("got mismatches %+v, want %+v", mismatchError.Mismatches, *test.mismatch)
+                }
+                return
+            }
+
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(status.AppliedFiles, test.appliedFiles) || !reflect.DeepEqual(status.Pending, test.pending) {
+                t.Errorf("got applied %v and pending %v, want %v and %v", status.AppliedFiles, status.Pending, test.appliedFiles, test.pending)
+            }
+            for _, migration := range status.Applied {
+                if migration.LocalFileName != migration.FileName {
+                    t.Errorf("got local file name %s for %s", migration.LocalFileName, migration.FileName)
+                }
+            }
+        })
+    }
+}
+
+func TestCompareMigrationsArchivedMoreThanFiles(t *testing.T) {
+    _, err := compareMigrations([]string{"1-a.sql"}, appliedMigrations("3-c.sql"), 2, nil, lessByName)
+    if !errors.Is(err, ErrOutOfOrder) {
+        t.Errorf("got error %v, want %v", err, ErrOutOfOrder)
+    }
+}
+
+func TestCompareMigrationsLeniently(t *testing.T) {
+    allowlist, err := ParseAllowlist(strings.NewReader(`
+# deleted after it had been applied everywhere
+missing 1-gone.sql
+renamed 2-old.sql 2-new.sql
+out-of-order 3-late.sql
+`))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    t.Run("allowed mismatches", func(t *testing.T) {
+        files := []string{"2-new.sql", "3-late.sql", "4-d.sql", "5-e.sql"}
+        status, err := compareMigrations(files, appliedMigrations("1-gone.sql", "2-old.sql", "4-d.sql"), 0, allowlist, lessByName)
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        if expected := []string{"2-new.sql", "4-d.sql"}; !reflect.DeepEqual(status.AppliedFiles, expected) {
+            t.Errorf("got applied %v, want %v", status.AppliedFiles, expected)
+        }
+
+        // pending migrations run after the applied ones, even if they sort before them
+        if expected := []string{"3-late.sql", "5-e.sql"}; !reflect.DeepEqual(status.Pending, expected) {
+            t.Errorf("got pending %v, want %v", status.Pending, expected)
+        }
+
+        expectedMismatches := []Mismatch{
+            {Kind: MismatchMissing, FileName: "1-gone.sql", Allowed: true},
+            {Kind: MismatchRenamed, FileName: "2-old.sql", LocalFileName: "2-new.sql", Allowed: true},
+            {Kind: MismatchOutOfOrder, FileName: "3-late.sql", LocalFileName: "4-d.sql", Allowed: true},
+        }
+        if !reflect.DeepEqual(status.Mismatches, expectedMismatches) {
+            t.Errorf("got mismatches %+v, want %+v", status.Mismatches, expectedMismatches)
+        }
+
+        localFileNames := []string{"", "2-new.sql", "4-d.sql"}
+        for index, migration := range status.Applied {
+            if migration.LocalFileName != localFileNames[index] {
+                t.Errorf("got local file name %q for %s, want %q", migration.LocalFileName, migration.FileName, localFileNames[index])
+            }
+        }
+    })
+
+    t.Run("mismatches which are not allowed are all reported", func(t *testing.T) {
+        files := []string{"1-early.sql", "4-d.sql"}
+        _, err := compareMigrations(files, appliedMigrations("0-deleted.sql", "4-d.sql"), 0, allowlist, lessByName)
+
+        var mismatchError *MismatchError
+        if !errors.As(err, &mismatchError) {
+            t.Fatalf("got error %v, want mismatches", err)
+        }
+
+        expectedMismatches := []Mismatch{
+            {Kind: MismatchMissing, FileName: "0-deleted.sql"},
+            {Kind: MismatchOutOfOrder, FileName: "1-early.sql", LocalFileName: "4-d.sql"},
+        }
+        if !reflect.DeepEqual(mismatchError.Mismatches, expectedMismatches) {
+            t.Errorf("got mismatches %+v, want %+v", mismatchError.Mismatches, expectedMismatches)
+        }
+    })
+
+    t.Run("archived migrations count as applied", func(t *testing.T) {
+        files := []string{"1-a.sql", "2-b.sql", "3-c.sql"}
+        status, err := compareMigrations(files, appliedMigrations("2-b.sql"), 1, allowlist, lessByName)
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        if !reflect.DeepEqual(status.AppliedFiles, files[:2]) || !reflect.DeepEqual(status.Pending, files[2:]) {
+            t.Errorf("got applied %v and pending %v", status.AppliedFiles, status.Pending)
+        }
+    })
+}
+
+func TestParseAllowlistRejectsInvalidLines(t *testing.T) {
+    for _, line := range []string{"missing", "renamed a.sql", "ignored a.sql", "out-of-order a.sql b.sql"} {
+        if _, err := ParseAllowlist(strings.NewReader(line)); err == nil {
+            t.Errorf("got no error for %q", line)
+        }
+    }
+}
@@ -0,0 +1,255 @@
+package migrate
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "time"
+)
+
+// records an applied migration, %[1]s is the table name and %[2]s to %[4]s are file name, duration in milliseconds and checksum;
+// position is maintained by the tool and only ever increases
+const InsertMigrationSQL = "INSERT INTO %[1]s (filename, position, duration_ms, checksum) SELECT %[2]s, COALESCE(MAX(position), 0) + 1, %[3]s, %[4]s FROM %[1]s RETURNING id"
+
+// TrackingTableUpgrade is a column added to the tracking table after its first version, with idempotent statements which add it
+type TrackingTableUpgrade struct {
+    Column string
+
+    // %[1]s is the table name
+    Statements []string
+}
+
+// upgrades of the tracking table, in order
+var TrackingTableUpgrades = []TrackingTableUpgrade{
+    // order by position maintained by the tool instead of created_at, which suffers from clock skew
+    {"position", []string{
+        "ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS position integer",
+        `UPDATE %[1]s SET position = numbered.position
+         FROM (SELECT id, (SELECT COALESCE(MAX(position), 0) FROM %[1]s) + row_number() OVER (ORDER BY id) AS position
+               FROM %[1]s WHERE position IS NULL) numbered
+         WHERE %[1]s.id = numbered.id`,
+        "CREATE UNIQUE INDEX IF NOT EXISTS %[1]s_position_key ON %[1]s (position)",
+    }},
+    // how long the migration took, to warn other environments about slow migrations
+    {"duration_ms", []string{
+        "ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS duration_ms integer",
+    }},
+    // migrations recorded without running them, e.g. "skip-tag heavy"
+    {"skipped_by", []string{
+        "ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS skipped_by text",
+    }},
+    // applied migration files must not be edited afterwards
+    {"checksum", []string{
+        "ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS checksum text",
+    }},
+    // objects the migration created, for 'destroy --drop-objects'
+    {"created_objects", []string{
+        "ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS created_objects text",
+    }},
+}
+
+// AppliedMigration is a migration recorded in the tracking table
+type AppliedMigration struct {
+    // id of its row, and its position in the order of migrations, from 1 (rows archived by 'prune-history' included)
+    ID       int
+    Position int
+
+    FileName  string
+    AppliedAt time.Time
+
+    // local file of the migration, set by Status: FileName unless it has been renamed, empty if the file is missing
+    LocalFileName string
+
+    // unknown for migrations applied by old versions
+    Duration *time.Duration
+
+    // recorded without running it, e.g. by "up --skip-tag", empty otherwise
+    SkippedBy string
+
+    // Checksum of the file when it was applied, empty for migrations applied by old versions
+    Checksum string
+
+    // objects the migration created, recorded when it was applied; nil for migrations applied by old versions
+    // and skipped migrations
+    CreatedObjects []CreatedObject
+}
+
+// read columns of the tracking table, none if it does not exist
+func (m *Migrator) getTrackingTableColumns(ctx context.Context) (map[string]bool, error) {
+    rows, err := m.conn.Query(ctx,
+        "SELECT attname::text FROM pg_attribute WHERE attrelid = to_regclass($1) AND attnum > 0 AND NOT attisdropped",
+        m.options.TrackingTable)
+    if err != nil {
+        return nil, fmt.Errorf("read columns of %s: %w", m.options.TrackingTable, err)
+    }
+    defer rows.Close()
+
+    columns := make(map[string]bool)
+    for rows.Next() {
+        var column string
+        if err := rows.Scan(&column); err != nil {
+            return nil, fmt.Errorf("read columns of %s: %w", m.options.TrackingTable, err)
+        }
+        columns[column] = true
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("read columns of %s: %w", m.options.TrackingTable, err)
+    }
+
+    return columns, nil
+}
+
+// MissingTrackingTableColumns returns the columns which a tracking table of an old version lacks,
+// none if the table does not exist yet
+func (m *Migrator) MissingTrackingTableColumns(ctx context.Context) ([]string, error) {
+    columns, err := m.getTrackingTableColumns(ctx)
+    if err != nil || len(columns) == 0 {
+        return nil, err
+    }
+
+    var missingColumns []string
+    for _, upgrade := range TrackingTableUpgrades {
+        if !columns[upgrade.Column] {
+            missingColumns = append(missingColumns, upgrade.Column)
+        }
+    }
+
+    return missingColumns, nil
+}
+
+// UpgradeTrackingTable adds the columns which a tracking table of an old version lacks, each in its own transaction;
+// returns the added columns. Up and Down upgrade it, call it before Apply, Skip, Revert and RecordChecksum
+func (m *Migrator) UpgradeTrackingTable(ctx context.Context) ([]string, error) {
+    missingColumns, err := m.MissingTrackingTableColumns(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    var addedColumns []string
+    for _, upgrade := range TrackingTableUpgrades {
+        if !containsString(missingColumns, upgrade.Column) {
+            continue
+        }
+
+        if err := m.upgradeTrackingTable(ctx, upgrade); err != nil {
+            return addedColumns, fmt.Errorf("add column %s to %s: %w", upgrade.Column, m.options.TrackingTable, err)
+        }
+        addedColumns = append(addedColumns, upgrade.Column)
+    }
+
+    return addedColumns, nil
+}
+
+// run statements of one upgrade in a transaction
+func (m *Migrator) upgradeTrackingTable(ctx context.Context, upgrade TrackingTableUpgrade) error {
+    tx, err := m.conn.Begin(ctx)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback(ctx)
+
+    for _, statement := range upgrade.Statements {
+        if _, err := tx.Exec(ctx, fmt.Sprintf(statement, m.options.TrackingTable)); err != nil {
+            return err
+        }
+    }
+
+    return tx.Commit(ctx)
+}
+
+// CreateTrackingTable creates the tracking table if it is missing, concurrent first runs wait for each other
+func (m *Migrator) CreateTrackingTable(ctx context.Context) error {
+    tx, err := m.conn.Begin(ctx)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback(ctx)
+
+    if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", m.options.TrackingTable); err != nil {
+        return fmt.Errorf("lock creation of %s: %w", m.options.TrackingTable, err)
+    }
+    if _, err := tx.Exec(ctx, fmt.Sprintf(TrackingTableSchema, m.options.TrackingTable)); err != nil {
+        return fmt.Errorf("create %s: %w", m.options.TrackingTable, err)
+    }
+
+    return tx.Commit(ctx)
+}
+
+// columns added by TrackingTableUpgrades as read by AppliedMigrations, and what is read instead from a tracking table of
+// an old version which lacks them: the order of ids is what position replaced
+var trackingTableColumnFallbacks = []struct{ column, fallback string }{
+    {"position", "(row_number() OVER (ORDER BY id))::integer"},
+    {"duration_ms", "NULL::integer"},
+    {"skipped_by", "NULL::text"},
+    {"checksum", "NULL::text"},
+    {"created_objects", "NULL::text"},
+}
+
+// AppliedMigrations reads the tracking table in the order migrations were applied, none if there is no tracking table;
+// it only reads, columns which a tracking table of an old version lacks are read as unknown
+func (m *Migrator) AppliedMigrations(ctx context.Context) ([]AppliedMigration, error) {
+    columns, err := m.getTrackingTableColumns(ctx)
+    if err != nil || len(columns) == 0 {
+        return nil, err
+    }
+
+    selected := []string{"id", "filename", "created_at"}
+    for _, column := range trackingTableColumnFallbacks {
+        if columns[column.column] {
+            selected = append(selected, column.column)
+        } else {
+            selected = append(selected, column.fallback)
+        }
+    }
+
+    // 4 is position
+    rows, err := m.conn.Query(ctx, fmt.Sprintf("SELECT %s FROM %s ORDER BY 4 ASC", strings.Join(selected, ", "), m.options.TrackingTable))
+    if err != nil {
+        return nil, fmt.Errorf("read %s: %w", m.options.TrackingTable, err)
+    }
+    defer rows.Close()
+
+    var appliedMigrations []AppliedMigration
+    for rows.Next() {
+        var migration AppliedMigration
+        var durationMs *int64
+        var skippedBy, checksum, createdObjects *string
+        err := rows.Scan(&migration.ID, &migration.FileName, &migration.AppliedAt, &migration.Position, &durationMs, &skippedBy, &checksum, &createdObjects)
+        if err != nil {
+            return nil, fmt.Errorf("read %s: %w", m.options.TrackingTable, err)
+        }
+
+        if durationMs != nil {
+            duration := time.Duration(*durationMs) * time.Millisecond
+            migration.Duration = &duration
+        }
+        if skippedBy != nil {
+            migration.SkippedBy = *skippedBy
+        }
+        if checksum != nil {
+            migration.Checksum = *checksum
+        }
+        if createdObjects != nil {
+            if migration.CreatedObjects, err = parseCreatedObjects(*createdObjects); err != nil {
+                return nil, fmt.Errorf("read %s: %s: %w", m.options.TrackingTable, migration.FileName, err)
+            }
+        }
+        appliedMigrations = append(appliedMigrations, migration)
+    }
+
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("read %s: %w", m.options.TrackingTable, err)
+    }
+
+    return appliedMigrations, nil
+}
+
+func containsString(values []string, value string) bool {
+    for _, candidate := range values {
+        if candidate == value {
+            return true
+        }
+    }
+
+    return false
+}
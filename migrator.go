@@ -0,0 +1,169 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "os"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+    "github.com/jackc/pgx/v4"
+)
+
+// library which applies, reverts and compares migrations, for the current connection
+var currentMigrator *migrate.Migrator
+var currentMigratorConnection databaseConnection
+
+// tables with large updates and deletes of the migration which has just been applied or reverted, for adviseVacuum
+var migrationLargeDMLTables []tableDML
+
+// get migrator for the current connection, configured like this run; connects to the database if not done yet
+func getMigrator() *migrate.Migrator {
+    connectToStoredDatabaseConnection()
+
+    if currentMigrator != nil && currentMigratorConnection == postgreSQLConnection {
+        return currentMigrator
+    }
+
+    migrator, err := migrate.New(postgreSQLConnection, migrate.Options{
+        Folder:          migrationsFolder,
+        FS:              migrationFileSystem,
+        TrackingTable:   trackingTableName,
+        FileNamePattern: getMigrationFileNamePattern(),
+        Extensions:      getMigrationFileExtensions(),
+        Variables:       getEnvironmentTemplateVariables(),
+        Settings:        getMigrationSettings(),
+        SetAllowlist:    getSetAllowlist(),
+        Allowlist:       getConsistencyAllowlist(),
+        UntilPhase:      *flagUntilPhase,
+        SkipTags:        migrate.ParseTags(*flagSkipTag),
+        OnlyTags:        migrate.ParseTags(*flagOnlyTag),
+
+        // failures are reported when the run fails, see emitProgressEventOnPanic
+        OnEvent: func(event migrate.Event) {
+            if event.Kind != migrate.EventMigrationFailed {
+                emitProgressEvent(event)
+            }
+        },
+
+        InTransaction: func(ctx context.Context, tx pgx.Tx, step migrate.Step) error {
+            // warnings fail the migration with --strict-warnings
+            checkStrictWarnings(step.FileName)
+
+            // large updates and deletes leave dead rows behind
+            migrationLargeDMLTables = getLargeDMLTables(tx)
+
+            // downstream consumers (e.g. Debezium) learn about the new schema
+            signalSchemaChange(tx, step.FileName, step.Forward)
+
+            notifyMigration(tx, step.ID, step.FileName, step.Forward, step.Duration.Milliseconds())
+
+            // checksums found while planning, only stored if the run changes the database
+            return recordPendingChecksums(ctx, tx)
+        },
+    })
+    if err != nil {
+        logError("Error: %s", err)
+        os.Exit(1)
+    }
+
+    // before anything reads the table
+    upgradeTrackingTable(migrator)
+
+    currentMigrator, currentMigratorConnection = migrator, postgreSQLConnection
+
+    return currentMigrator
+}
+
+// compare database and local files, exits on mismatches which do not pass
+func getMigrationStatus() *migrate.Status {
+    status, err := getMigrator().Status(context.Background())
+    exitOnStatusError(err)
+
+    printConsistencyMismatches(status.Mismatches)
+
+    return status
+}
+
+// select what 'up' applies, see migrate.Migrator.Plan
+func getMigrationPlan() *migrate.Plan {
+    plan, err := getMigrator().Plan(context.Background())
+    exitOnStatusError(err)
+
+    printConsistencyMismatches(plan.Status.Mismatches)
+    printWaitingMigrations(plan)
+
+    return plan
+}
+
+// report why database and local files could not be compared
+func exitOnStatusError(err error) {
+    if err == nil {
+        return
+    }
+
+    var mismatchError *migrate.MismatchError
+    if errors.As(err, &mismatchError) {
+        exitOnConsistencyMismatches(mismatchError)
+    }
+
+    if errors.Is(err, migrate.ErrNoMigrations) {
+        logError("Error: No migration files found in local folder %s", migrationsFolder)
+        logError("Hint: Maybe you need to run 'create' first?")
+        os.Exit(1)
+    }
+
+    logError("Error: %s", err)
+    os.Exit(1)
+}
+
+// report failed migration with the location of the error in the file, then fail
+func exitOnMigrationError(fileName string, forward bool, err error) {
+    direction := "Forward"
+    if !forward {
+        direction = "Backward"
+    }
+
+    var migrationError *migrate.MigrationError
+    if !errors.As(err, &migrationError) {
+        logError("Error: %s migration failed: %s", direction, err)
+        logError("Error while processing file: %s", describeMigrationFile(fileName))
+        panic(err)
+    }
+
+    source := getMigrationPartSource(fileName, forward)
+    switch {
+    case migrationError.StatementTotal > 0:
+        logError("Error: Statement %d of %d failed (migration is not running in a transaction)",
+            migrationError.StatementIndex, migrationError.StatementTotal)
+        logError("Error while processing file: %s", describeMigrationFile(fileName))
+        if !printErrorLocation(source, migrationError.Err, migrationError.Offset) {
+            logError(migrationError.Statement)
+        }
+
+    case errors.Is(err, migrate.ErrOutOfOrder):
+        logError("Error: %s", migrationError.Err)
+
+    case migrationError.Recording:
+        logError("Error: Failed to store %s migration info in %s", direction, trackingTableName)
+        logError("Error while processing file: %s", describeMigrationFile(fileName))
+
+    default:
+        logError("Error: %s transaction failed", direction)
+        logError("Error while processing file: %s", describeMigrationFile(fileName))
+        if !printErrorLocation(source, migrationError.Err, 0) {
+            sqlMigrationForward, sqlMigrationBackward := readMigrationFromFile(fileName)
+            if forward {
+                logError(sqlMigrationForward)
+            } else {
+                logError(sqlMigrationBackward)
+            }
+        }
+    }
+
+    printSQLStateHint(migrationError.Err)
+    if migrationError.Dirty {
+        logError("Hint: The statements before have already been executed, you need to clean up manually")
+    }
+
+    panic(err)
+}
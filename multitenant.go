@@ -0,0 +1,306 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "fmt"
+    "os"
+    "os/exec"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    // state of multi-schema runs, so a crashed run can be resumed
+    CONST_POSTGRESQL_ROLLOUTS_TABLE_SCHEMA = "CREATE TABLE IF NOT EXISTS %s (rollout_id text, schema_name text, status text, finished_at timestamp with time zone DEFAULT NOW(), PRIMARY KEY (rollout_id, schema_name))"
+
+    CONST_ROLLOUT_STATUS_DONE   = "done"
+    CONST_ROLLOUT_STATUS_FAILED = "failed"
+)
+
+// get rollouts table of the tracking table (of the component)
+func getRolloutsTableName() string {
+    return trackingTableName + "_rollouts"
+}
+
+var flagSchema = commandLineFlags.String("schema", "", "migrate this schema: sets search_path and keeps a tracking table per schema")
+var flagSchemas = commandLineFlags.String("schemas", "", "for 'up': migrate these schemas (comma separated), e.g. one per tenant")
+var flagSchemasQuery = commandLineFlags.String("schemas-query", "", "for 'up': migrate all schemas returned by this query, e.g. \"SELECT nspname FROM pg_namespace WHERE nspname LIKE 'tenant\\_%'\"")
+var flagResumeRollout = commandLineFlags.String("resume-rollout", "", "for 'up --schemas': continue this rollout, skipping schemas it has already migrated")
+var flagParallel = commandLineFlags.Int("parallel", 4, "for 'up --schemas': number of schemas migrated concurrently")
+
+// flags which only make sense for the parent process of a multi-schema run
+var multiSchemaFlagNames = map[string]bool{"schemas": true, "schemas-query": true, "parallel": true, "resume-rollout": true}
+
+// outcome of migrating one schema
+type schemaResult struct {
+    schema string
+    output []byte
+    err    error
+}
+
+// quote identifier, e.g. schema name for search_path
+func quoteSQLIdentifier(identifier string) string {
+    return `"` + strings.Replace(identifier, `"`, `""`, -1) + `"`
+}
+
+// get search_path for --schema, public stays reachable for extensions
+func getSchemaSearchPath(schema string) string {
+    return quoteSQLIdentifier(schema) + ", public"
+}
+
+// lock and create schema for this session, called before 'up' with --schema (which creates the tracking table)
+func prepareSchema() {
+    connectToStoredDatabaseConnection()
+
+    // held until this process exits, concurrent runs on the same schema fail instead of waiting
+    var locked bool
+    err := postgreSQLConnection.QueryRow(context.Background(),
+        "SELECT pg_try_advisory_lock(hashtext($1))", trackingTableName+"."+*flagSchema).Scan(&locked)
+    if err != nil {
+        logError("Error: Could not lock schema %s", *flagSchema)
+        panic(err)
+    }
+
+    if !locked {
+        logError("Error: Schema %s is being migrated by another process", *flagSchema)
+        os.Exit(1)
+    }
+
+    _, err = postgreSQLConnection.Exec(context.Background(), "CREATE SCHEMA IF NOT EXISTS "+quoteSQLIdentifier(*flagSchema))
+    if err != nil {
+        logError("Error: Failed to create schema %s", *flagSchema)
+        panic(err)
+    }
+
+}
+
+// get schemas from --schemas or --schemas-query
+func getSchemasToMigrate() []string {
+    var schemas []string
+
+    for _, schema := range strings.Split(*flagSchemas, ",") {
+        schema = strings.TrimSpace(schema)
+        if len(schema) > 0 {
+            schemas = append(schemas, schema)
+        }
+    }
+
+    if len(*flagSchemasQuery) > 0 {
+        connectToStoredDatabaseConnection()
+
+        rows, err := postgreSQLConnection.Query(context.Background(), *flagSchemasQuery)
+        if err != nil {
+            logError("Error: Could not run --schemas-query")
+            panic(err)
+        }
+        defer rows.Close()
+
+        for rows.Next() {
+            var schema string
+            err := rows.Scan(&schema)
+            if err != nil {
+                logError("Error: --schemas-query needs to return one text column with schema names")
+                panic(err)
+            }
+            schemas = append(schemas, schema)
+        }
+
+        err = rows.Err()
+        if err != nil {
+            logError("Error: Could not read result of --schemas-query")
+            panic(err)
+        }
+    }
+
+    return schemas
+}
+
+// --max-conns of each child process of 'up --schemas', empty if there is no limit
+var schemaMaxConns string
+
+// command line for migrating one schema in a child process, with all flags of this run
+func getSchemaCommandLineArgs(schema string) []string {
+    overriddenFlags := map[string]string{"schema": schema}
+    if len(schemaMaxConns) > 0 {
+        overriddenFlags["max-conns"] = schemaMaxConns
+    }
+
+    return getChildCommandLineArgs("up", multiSchemaFlagNames, overriddenFlags)
+}
+
+// migrate one schema in a child process, so each schema has its own connection and state
+func migrateSchema(schema string) schemaResult {
+    command := exec.Command(os.Args[0], getSchemaCommandLineArgs(schema)...)
+    output, err := command.CombinedOutput()
+
+    return schemaResult{schema: schema, output: output, err: err}
+}
+
+// print output of a child process, each line tagged with its schema
+func printSchemaOutput(result schemaResult) {
+    scanner := bufio.NewScanner(bytes.NewReader(result.output))
+    for scanner.Scan() {
+        fmt.Printf("[%s] %s\n", result.schema, scanner.Text())
+    }
+}
+
+// create rollouts table in the schema of the connection without --schema
+func createRolloutsTable() {
+    connectToStoredDatabaseConnection()
+
+    _, err := postgreSQLConnection.Exec(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_ROLLOUTS_TABLE_SCHEMA, getRolloutsTableName()))
+    if err != nil {
+        logError("Error: Failed to create table %s", getRolloutsTableName())
+        panic(err)
+    }
+}
+
+// get schemas which a rollout has already migrated
+func getSchemasDoneInRollout(rolloutId string) map[string]bool {
+    rows, err := postgreSQLConnection.Query(context.Background(),
+        fmt.Sprintf("SELECT schema_name FROM %s WHERE rollout_id = $1 AND status = $2", getRolloutsTableName()),
+        rolloutId, CONST_ROLLOUT_STATUS_DONE)
+    if err != nil {
+        logError("Error: Could not read state of rollout %s", rolloutId)
+        panic(err)
+    }
+    defer rows.Close()
+
+    schemasDone := make(map[string]bool)
+    for rows.Next() {
+        var schema string
+        err := rows.Scan(&schema)
+        if err != nil {
+            logError("Error: Could not read state of rollout %s: unable to scan row", rolloutId)
+            panic(err)
+        }
+        schemasDone[schema] = true
+    }
+
+    err = rows.Err()
+    if err != nil {
+        logError("Error: Could not read state of rollout %s: row error", rolloutId)
+        panic(err)
+    }
+
+    return schemasDone
+}
+
+// record outcome of one schema in a rollout
+func storeRolloutState(rolloutId string, schema string, status string) {
+    _, err := postgreSQLConnection.Exec(context.Background(),
+        fmt.Sprintf(`INSERT INTO %s (rollout_id, schema_name, status) VALUES ($1, $2, $3)
+            ON CONFLICT (rollout_id, schema_name) DO UPDATE SET status = EXCLUDED.status, finished_at = NOW()`,
+            getRolloutsTableName()),
+        rolloutId, schema, status)
+    if err != nil {
+        logError("Error: Could not store state of schema %s in rollout %s", schema, rolloutId)
+        panic(err)
+    }
+}
+
+// migrate many schemas concurrently with a pool of child processes
+func cmd_up_schemas() {
+    schemas := getSchemasToMigrate()
+    if len(schemas) == 0 {
+        logError("Error: No schemas to migrate")
+        logError("Hint: Check --schemas or --schemas-query")
+        os.Exit(1)
+    }
+
+    // a freeze of the whole database, schemas may be frozen on their own as well
+    checkMigrationFreeze()
+
+    createRolloutsTable()
+
+    // new rollout, or continue where a crashed one stopped
+    rolloutId := *flagResumeRollout
+    if len(rolloutId) == 0 {
+        rolloutId = time.Now().UTC().Format("20060102150405")
+        logError("starting rollout %s (continue it with --resume-rollout %s)", rolloutId, rolloutId)
+    } else {
+        schemasDone := getSchemasDoneInRollout(rolloutId)
+
+        var remainingSchemas []string
+        for _, schema := range schemas {
+            if !schemasDone[schema] {
+                remainingSchemas = append(remainingSchemas, schema)
+            }
+        }
+
+        logError("resuming rollout %s: %d schema(s) done before, %d remaining",
+            rolloutId, len(schemas)-len(remainingSchemas), len(remainingSchemas))
+        schemas = remainingSchemas
+    }
+
+    if *flagParallel < 1 {
+        logError("Error: --parallel needs to be at least 1, got: %d", *flagParallel)
+        os.Exit(1)
+    }
+
+    // the connections this process does not use are split between the schemas migrated concurrently
+    if remaining := getRemainingConnections(); remaining > 0 {
+        if *flagParallel > remaining {
+            logError("Warning: Migrating %d schemas concurrently instead of %d, --max-conns %d leaves %d connection(s)",
+                remaining, *flagParallel, *flagMaxConns, remaining)
+            *flagParallel = remaining
+        }
+        schemaMaxConns = strconv.Itoa(remaining / *flagParallel)
+    }
+
+    schemaNames := make(chan string)
+    results := make(chan schemaResult)
+
+    var workers sync.WaitGroup
+    for i := 0; i < *flagParallel; i++ {
+        workers.Add(1)
+        go func() {
+            defer workers.Done()
+            for schema := range schemaNames {
+                results <- migrateSchema(schema)
+            }
+        }()
+    }
+
+    go func() {
+        for _, schema := range schemas {
+            schemaNames <- schema
+        }
+        close(schemaNames)
+        workers.Wait()
+        close(results)
+    }()
+
+    // aggregate progress, output of each schema is printed as one block
+    var failedSchemas []string
+    done := 0
+    for result := range results {
+        done++
+        printSchemaOutput(result)
+
+        status := "ok"
+        rolloutStatus := CONST_ROLLOUT_STATUS_DONE
+        if result.err != nil {
+            status = "FAILED: " + result.err.Error()
+            rolloutStatus = CONST_ROLLOUT_STATUS_FAILED
+            failedSchemas = append(failedSchemas, result.schema)
+        }
+        storeRolloutState(rolloutId, result.schema, rolloutStatus)
+        logError("[%d/%d] %s %s", done, len(schemas), result.schema, status)
+    }
+
+    fmt.Printf("Migrated %d schema(s), %d failed.\n", len(schemas)-len(failedSchemas), len(failedSchemas))
+
+    if len(failedSchemas) > 0 {
+        logError("Error: Migrations failed in schemas: %s", strings.Join(failedSchemas, ", "))
+        logError("Hint: Fix them and run again with --resume-rollout %s", rolloutId)
+        os.Exit(1)
+    }
+
+    os.Exit(0)
+}
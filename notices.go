@@ -0,0 +1,62 @@
+package main
+
+import (
+    "fmt"
+    "os"
+
+    "github.com/jackc/pgconn"
+)
+
+// migration file which is currently executed, used to tag server notices
+var currentMigrationFileName string
+
+var flagStrictWarnings = commandLineFlags.Bool("strict-warnings", false, "fail a migration if the server sends a WARNING while it runs")
+
+// warnings sent by the server while the current migration runs
+var currentMigrationWarnings []string
+
+// print notices sent by the server (e.g. RAISE NOTICE/WARNING in DO blocks)
+func handleServerNotice(_ *pgconn.PgConn, notice *pgconn.Notice) {
+    source := currentMigrationFileName
+    if len(source) == 0 {
+        source = "server"
+    }
+
+    // warnings go to STDERR, everything else is progress output
+    output := os.Stdout
+    if notice.Severity == "WARNING" {
+        output = os.Stderr
+    }
+
+    fmt.Fprintf(output, "[%s] %s: %s\n", source, notice.Severity, notice.Message)
+
+    if notice.Severity == "WARNING" && len(currentMigrationFileName) > 0 {
+        currentMigrationWarnings = append(currentMigrationWarnings, notice.Message)
+    }
+
+    if len(notice.Detail) > 0 {
+        fmt.Fprintf(output, "[%s] DETAIL: %s\n", source, notice.Detail)
+    }
+
+    if len(notice.Hint) > 0 {
+        fmt.Fprintf(output, "[%s] HINT: %s\n", source, notice.Hint)
+    }
+}
+
+// start collecting warnings of a migration
+func startMigrationWarnings(fileName string) {
+    currentMigrationFileName = fileName
+    currentMigrationWarnings = nil
+}
+
+// exit before the migration is committed if the server sent warnings and --strict-warnings is given
+func checkStrictWarnings(fileName string) {
+    if !*flagStrictWarnings || len(currentMigrationWarnings) == 0 {
+        return
+    }
+
+    logError("Error: Server sent %d warning(s) while running %s, failing because of --strict-warnings",
+        len(currentMigrationWarnings), fileName)
+    logError("Hint: Statements which ran without transaction ('-- migrate:no-transaction') have already been executed")
+    os.Exit(1)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    // channel for LISTEN, e.g. for cache invalidation or schema registries
+    CONST_NOTIFY_CHANNEL = "schema_migrations"
+)
+
+var flagNotify = commandLineFlags.Bool("notify", false, "for 'up' and 'down': pg_notify('"+CONST_NOTIFY_CHANNEL+"', json) after each migration")
+
+// payload of the notification
+type migrationNotification struct {
+    Id          int    `json:"id"`
+    FileName    string `json:"file_name"`
+    Owner       string `json:"owner,omitempty"`
+    Direction   string `json:"direction"`
+    DurationMs  int64  `json:"duration_ms"`
+    Environment string `json:"environment,omitempty"`
+}
+
+// notify listeners about a migration, sent inside the migration transaction and therefore delivered when it commits
+func notifyMigration(tx pgx.Tx, id int, fileName string, forward bool, durationMs int64) {
+    if !*flagNotify {
+        return
+    }
+
+    notification := migrationNotification{
+        Id:          id,
+        FileName:    fileName,
+        Owner:       getMigrationOwner(fileName),
+        Direction:   "up",
+        DurationMs:  durationMs,
+        Environment: getConfigValue("environment"),
+    }
+    if !forward {
+        notification.Direction = "down"
+    }
+
+    payload, err := json.Marshal(notification)
+    if err != nil {
+        logError("Error: Could not encode notification")
+        panic(err)
+    }
+
+    _, err = tx.Exec(context.Background(), "SELECT pg_notify($1, $2)", CONST_NOTIFY_CHANNEL, string(payload))
+    if err != nil {
+        logError("Error: Could not notify channel %s", CONST_NOTIFY_CHANNEL)
+        panic(err)
+    }
+}
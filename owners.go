@@ -0,0 +1,94 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "text/tabwriter"
+
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    // owner and privileges of an object by kind, schema (empty: search path) and name
+    CONST_POSTGRESQL_OWNER_QUERY = `
+    SELECT pg_get_userbyid(owner), COALESCE(acl::text, '') FROM (
+            SELECT c.relowner AS owner, c.relacl AS acl
+            FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+            WHERE $1 IN ('table', 'view', 'materialized view', 'sequence', 'index') AND c.relname = $3
+            AND (n.nspname = $2 OR ($2 = '' AND n.nspname = ANY (current_schemas(false))))
+        UNION ALL
+            SELECT p.proowner, p.proacl
+            FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+            WHERE $1 IN ('function', 'procedure') AND p.proname = $3
+            AND (n.nspname = $2 OR ($2 = '' AND n.nspname = ANY (current_schemas(false))))
+        UNION ALL
+            SELECT t.typowner, t.typacl
+            FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace
+            WHERE $1 = 'type' AND t.typname = $3
+            AND (n.nspname = $2 OR ($2 = '' AND n.nspname = ANY (current_schemas(false))))
+        UNION ALL
+            SELECT n.nspowner, n.nspacl
+            FROM pg_namespace n
+            WHERE $1 = 'schema' AND n.nspname = $3
+    ) objects
+    LIMIT 1`
+)
+
+var flagExpectedOwner = commandLineFlags.String("expected-owner", "", "for 'owners': role which should own all objects (default: current user)")
+
+// list objects created by applied migrations with their owners & grants, flag unexpected owners
+func cmd_owners() {
+    migrationsInDatabase := getMigrationsFromDatabase()
+
+    expectedOwner := *flagExpectedOwner
+    if len(expectedOwner) == 0 {
+        err := postgreSQLConnection.QueryRow(context.Background(), "SELECT current_user").Scan(&expectedOwner)
+        if err != nil {
+            logError("Error: Could not determine current user")
+            panic(err)
+        }
+    }
+
+    writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(writer, "\tKIND\tOBJECT\tOWNER\tGRANTS\tMIGRATION")
+
+    unexpectedOwners := 0
+    for _, fileName := range migrationsInDatabase {
+        sqlMigrationForward, _ := readMigrationFromFile(fileName)
+
+        for _, object := range getCreatedObjects(sqlMigrationForward) {
+            schema, name := splitQualifiedName(object.name)
+
+            var owner, grants string
+            err := postgreSQLConnection.QueryRow(context.Background(), CONST_POSTGRESQL_OWNER_QUERY,
+                object.kind, schema, name).Scan(&owner, &grants)
+            if err == pgx.ErrNoRows {
+                // dropped by a later migration
+                continue
+            }
+            if err != nil {
+                logError("Error: Could not look up owner of %s %s", object.kind, object.name)
+                panic(err)
+            }
+
+            flag := ""
+            if owner != expectedOwner {
+                flag = "!"
+                unexpectedOwners++
+            }
+
+            fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", flag, object.kind, object.name, owner, grants, fileName)
+        }
+    }
+
+    writer.Flush()
+
+    if unexpectedOwners > 0 {
+        logError("Error: %d objects are not owned by %s (marked with !)", unexpectedOwners, expectedOwner)
+        logError("Hint: ALTER ... OWNER TO %s", expectedOwner)
+        os.Exit(1)
+    }
+
+    os.Exit(0)
+}
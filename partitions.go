@@ -0,0 +1,167 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path"
+    "regexp"
+    "strconv"
+    "time"
+)
+
+const (
+    CONST_PARTITIONS_FILENAME = "partitions.sql"
+
+    CONST_POSTGRESQL_PARTITIONS_TABLE_SCHEMA = "CREATE TABLE IF NOT EXISTS %s (id serial, created_at timestamp with time zone DEFAULT NOW(), filename text, duration_ms integer)"
+
+    // create upcoming range partitions of a table, one per interval
+    CONST_PARTITIONS_TEMPLATE = `
+-- create partitions of %[1]s for the current and the next %[3]d %[2]s(s)
+DO $migrate$
+DECLARE
+    partition_start timestamp;
+BEGIN
+    FOR i IN 0..%[3]d LOOP
+        partition_start := date_trunc('%[2]s', now()) + (i || ' %[2]s')::interval;
+        EXECUTE format('CREATE TABLE IF NOT EXISTS %%I.%%I PARTITION OF %%I.%%I FOR VALUES FROM (%%L) TO (%%L)',
+            %[5]s, '%[6]s_' || to_char(partition_start, '%[4]s'), %[5]s, '%[6]s',
+            partition_start, partition_start + '1 %[2]s'::interval);
+    END LOOP;
+END
+$migrate$;
+`
+)
+
+// get partitions table of the tracking table (of the component)
+func getPartitionsTableName() string {
+    return trackingTableName + "_partitions"
+}
+
+// table to partition, optionally schema-qualified; unquoted names only, they are pasted into the template
+var regexpPartitionedTableName = regexp.MustCompile(`^(?:([a-z_][a-z0-9_]*)\.)?([a-z_][a-z0-9_]*)$`)
+
+// partition suffix format per interval
+var partitionNameFormats = map[string]string{
+    "day":   "YYYY_MM_DD",
+    "week":  "IYYY_IW",
+    "month": "YYYY_MM",
+    "year":  "YYYY",
+}
+
+// path of the repeatable partition maintenance file
+func getPartitionsFilePath() string {
+    return path.Join(CONST_MIGRATIONS_FOLDER, CONST_PARTITIONS_FILENAME)
+}
+
+// print partition maintenance block for a table, to be added to partitions.sql
+func cmd_partitions_template(tableName string, interval string, count string) {
+    nameFormat, ok := partitionNameFormats[interval]
+    if !ok {
+        logError("Error: Unknown interval %s, use one of: day, week, month, year", interval)
+        os.Exit(1)
+    }
+
+    partitionsAhead, err := strconv.Atoi(count)
+    if err != nil || partitionsAhead < 0 {
+        logError("Error: Number of partitions to create ahead must be a positive number, got: %s", count)
+        os.Exit(1)
+    }
+
+    match := regexpPartitionedTableName.FindStringSubmatch(tableName)
+    if match == nil {
+        logError("Error: Invalid table name %s, use lower case letters, digits and underscores, e.g. events or analytics.events", tableName)
+        os.Exit(1)
+    }
+
+    // partitions are created in the schema of the table, unqualified tables are in the current schema
+    schemaExpression := "current_schema()"
+    if len(match[1]) > 0 {
+        schemaExpression = "'" + match[1] + "'"
+    }
+
+    fmt.Printf(CONST_PARTITIONS_TEMPLATE, tableName, interval, partitionsAhead, nameFormat, schemaExpression, match[2])
+
+    os.Exit(0)
+}
+
+// apply partition maintenance file, tracked separately from versioned migrations
+func cmd_partitions() {
+    fileContentBytes, err := ioutil.ReadFile(getPartitionsFilePath())
+    if err != nil {
+        logError("Error: Could not read partition maintenance file %s", getPartitionsFilePath())
+        logError("Hint: Use 'partitions-template' to create its content")
+        panic(err)
+    }
+
+    sqlPartitions := cleanUpSQLString(string(fileContentBytes))
+    if len(sqlPartitions) == 0 {
+        logError("Error: Partition maintenance file %s is empty", getPartitionsFilePath())
+        os.Exit(3)
+    }
+
+    useTransaction := !hasAnnotation(parseAnnotations(string(fileContentBytes)), CONST_ANNOTATION_NO_TRANSACTION)
+
+    // not at the same time as migrations, and not during a freeze
+    defer lockRun()()
+    checkMigrationFreeze()
+
+    _, err = postgreSQLConnection.Exec(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_PARTITIONS_TABLE_SCHEMA, getPartitionsTableName()))
+    if err != nil {
+        logError("Error: Failed to create table %s", getPartitionsTableName())
+        panic(err)
+    }
+
+    currentMigrationFileName = CONST_PARTITIONS_FILENAME
+    startedAt := time.Now()
+
+    if !useTransaction {
+        executeWithoutTransaction(sqlSource{getPartitionsFilePath(), string(fileContentBytes), 1}, sqlPartitions)
+    }
+
+    tx, err := postgreSQLConnection.Begin(context.Background())
+    if err != nil {
+        logError("Error: Failed to start partition maintenance transaction")
+        panic(err)
+    }
+
+    defer tx.Rollback(context.Background())
+
+    if useTransaction {
+        _, err = tx.Exec(context.Background(), sqlPartitions)
+        if err != nil {
+            logError("Error: Partition maintenance failed")
+            logError("Error while processing file: %s", getPartitionsFilePath())
+            if !printErrorLocation(sqlSource{getPartitionsFilePath(), string(fileContentBytes), 1}, err, 0) {
+                logError(sqlPartitions)
+            }
+            printSQLStateHint(err)
+            panic(err)
+        }
+    }
+
+    duration := time.Since(startedAt)
+
+    // remember run
+    _, err = tx.Exec(context.Background(),
+        fmt.Sprintf("INSERT INTO %s (filename, duration_ms) VALUES ($1, $2)", getPartitionsTableName()),
+        CONST_PARTITIONS_FILENAME, duration.Milliseconds())
+    if err != nil {
+        logError("Error: Failed to store partition maintenance run in %s", getPartitionsTableName())
+        panic(err)
+    }
+
+    err = tx.Commit(context.Background())
+    if err != nil {
+        logError("Error: Failed to commit partition maintenance transaction")
+        panic(err)
+    }
+
+    currentMigrationFileName = ""
+
+    fmt.Printf("partition maintenance: %s (took %s)\n", getPartitionsFilePath(), duration.Round(time.Millisecond))
+
+    os.Exit(0)
+}
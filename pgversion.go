@@ -0,0 +1,122 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "regexp"
+    "strconv"
+)
+
+const (
+    // e.g. "-- migrate:requires-pg >=14" for a migration using MERGE
+    CONST_ANNOTATION_REQUIRES_PG = "requires-pg"
+)
+
+// operator and version, e.g. ">=14", "<13", "=9.6" or "14.2" (same as ">=14.2")
+var regexpVersionRequirement = regexp.MustCompile(`^(>=|<=|>|<|=)?\s*([0-9]+)(?:\.([0-9]+))?$`)
+
+var serverVersionNum int
+
+// get version of the server like 140005 (14.5) or 90624 (9.6.24)
+func getServerVersionNum() int {
+    if serverVersionNum > 0 {
+        return serverVersionNum
+    }
+
+    var versionNum string
+    err := postgreSQLConnection.QueryRow(context.Background(), "SHOW server_version_num").Scan(&versionNum)
+    if err != nil {
+        logError("Error: Could not read version of database server")
+        panic(err)
+    }
+
+    serverVersionNum, err = strconv.Atoi(versionNum)
+    if err != nil {
+        logError("Error: Could not parse version of database server: %s", versionNum)
+        panic(err)
+    }
+
+    return serverVersionNum
+}
+
+// get range of server_version_num a version stands for, e.g. 14 -> [140000, 150000), 14.2 -> [140002, 140003), 9.6 -> [90600, 90700)
+func getVersionNumRange(major int, minor int, hasMinor bool) (int, int) {
+    switch {
+    case major < 10 && hasMinor:
+        return major*10000 + minor*100, major*10000 + (minor+1)*100
+    case major < 10:
+        return major * 10000, (major + 1) * 10000
+    case hasMinor:
+        return major*10000 + minor, major*10000 + minor + 1
+    default:
+        return major * 10000, (major + 1) * 10000
+    }
+}
+
+// check if server version satisfies requirement like ">=14"
+func isServerVersionAllowed(requirement string, versionNum int) (bool, error) {
+    match := regexpVersionRequirement.FindStringSubmatch(requirement)
+    if match == nil {
+        return false, fmt.Errorf("invalid version requirement '%s', use e.g. '>=14' or '<13'", requirement)
+    }
+
+    major, _ := strconv.Atoi(match[2])
+    minor, _ := strconv.Atoi(match[3])
+    lower, upper := getVersionNumRange(major, minor, len(match[3]) > 0)
+
+    switch match[1] {
+    case ">=", "":
+        return versionNum >= lower, nil
+    case ">":
+        return versionNum >= upper, nil
+    case "<=":
+        return versionNum < upper, nil
+    case "<":
+        return versionNum < lower, nil
+    default:
+        return versionNum >= lower && versionNum < upper, nil
+    }
+}
+
+// format server_version_num for messages, e.g. 140005 -> 14.5
+func formatServerVersionNum(versionNum int) string {
+    if versionNum < 100000 {
+        return fmt.Sprintf("%d.%d.%d", versionNum/10000, versionNum/100%100, versionNum%100)
+    }
+
+    return fmt.Sprintf("%d.%d", versionNum/10000, versionNum%10000)
+}
+
+// exit before anything runs if a migration requires another server version
+func checkServerVersionRequirements(fileNames []string, forward bool) {
+    failures := 0
+
+    for _, fileName := range fileNames {
+        annotationsForward, annotationsBackward := readMigrationAnnotationsFromFile(fileName)
+        annotations := annotationsForward
+        if !forward {
+            annotations = annotationsBackward
+        }
+
+        requirement, ok := annotations[CONST_ANNOTATION_REQUIRES_PG]
+        if !ok {
+            continue
+        }
+
+        allowed, err := isServerVersionAllowed(requirement, getServerVersionNum())
+        if err != nil {
+            logError("Error: %s in file %s", err, fileName)
+            failures++
+        } else if !allowed {
+            logError("Error: Migration %s requires PostgreSQL %s, but the server runs %s",
+                fileName, requirement, formatServerVersionNum(getServerVersionNum()))
+            failures++
+        }
+    }
+
+    if failures > 0 {
+        logError("Hint: Nothing has been applied, upgrade the server or change the migrations")
+        os.Exit(1)
+    }
+}
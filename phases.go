@@ -0,0 +1,58 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    // when a migration runs in a blue/green deployment, e.g. "-- phase: post-deploy" in the header of the file
+    CONST_HEADER_PHASE = migrate.HeaderPhase
+
+    // migrations without phase expand the schema before the new code ships
+    CONST_PHASE_PRE_DEPLOY  = migrate.PhasePreDeploy
+    CONST_PHASE_POST_DEPLOY = migrate.PhasePostDeploy
+)
+
+// phases in the order of a deployment
+var deploymentPhases = migrate.Phases
+
+var flagUntilPhase = commandLineFlags.String("until-phase", "", "for 'up' and 'plan': stop before the first migration of a later phase, e.g. pre-deploy")
+
+// get position of phase in a deployment, -1 if unknown
+func getPhaseIndex(phase string) int {
+    return migrate.PhaseIndex(phase)
+}
+
+// check phase in header of up part
+func checkMigrationPhase(rawMigrationForward string) error {
+    phase, ok := parseHeaderFields(rawMigrationForward)[CONST_HEADER_PHASE]
+    if ok && getPhaseIndex(phase) < 0 {
+        return fmt.Errorf("unknown phase '%s', use one of: %s", phase, strings.Join(deploymentPhases, ", "))
+    }
+
+    return nil
+}
+
+// get phase of migration file, pre-deploy if it has none
+func getMigrationPhase(fileName string) string {
+    phase, ok := readMigrationHeaderFromFile(fileName)[CONST_HEADER_PHASE]
+    if !ok {
+        return CONST_PHASE_PRE_DEPLOY
+    }
+
+    return phase
+}
+
+// with --until-phase: tell about pending migrations which wait, from the first one of a later phase on
+// (migrations run in order, so the ones after it have to wait as well)
+func printWaitingMigrations(plan *migrate.Plan) {
+    if len(plan.Waiting) == 0 {
+        return
+    }
+
+    fmt.Printf("Stopping before %s (%s), %d pending migration(s) wait until after the deployment.\n",
+        plan.Waiting[0], getMigrationPhase(plan.Waiting[0]), len(plan.Waiting))
+}
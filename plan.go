@@ -0,0 +1,155 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "os"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+var flagExpectedPlanHash = commandLineFlags.String("expected-plan-hash", "", "for 'up': only apply if pending migrations still match this hash from 'plan'")
+
+// output of 'plan --json'
+type planReport struct {
+    // migrations skipped by tag before which the tags select now, they run first
+    CatchUp []reportMigration `json:"catch_up"`
+
+    // with skipped_by for the ones which are only recorded
+    Pending  []reportMigration `json:"pending"`
+    Impact   []statementImpact `json:"impact"`
+    PlanHash string            `json:"plan_hash"`
+}
+
+// migrations 'up' works through, in order: catch-up ones, then pending ones (the skipped ones are only recorded)
+func getPlannedMigrations(plan *migrate.Plan) []string {
+    return append(append([]string{}, plan.CatchUp...), plan.Pending...)
+}
+
+// what 'up' does with a planned migration besides applying it: "catch-up", "skipped: <reason>" or nothing
+func getPlanDecision(plan *migrate.Plan, fileName string) string {
+    if reason, skipped := plan.SkippedBy[fileName]; skipped {
+        return "skipped: " + reason
+    }
+    for _, catchUpFileName := range plan.CatchUp {
+        if catchUpFileName == fileName {
+            return "catch-up"
+        }
+    }
+
+    return ""
+}
+
+// planned migration with the decision for it, for approval requests
+func describePlannedMigration(plan *migrate.Plan, fileName string) string {
+    if decision := getPlanDecision(plan, fileName); len(decision) > 0 {
+        return fmt.Sprintf("%s (%s)", fileName, decision)
+    }
+
+    return fileName
+}
+
+// hash over names and contents of planned migrations with the skip decisions, and the grants file,
+// changes whenever 'up' would do something else
+func getPlanHash(plan *migrate.Plan) string {
+    hash := sha256.New()
+
+    for _, fileName := range getPlannedMigrations(plan) {
+        fileContent, err := readMigrationFile(fileName)
+        if err != nil {
+            logError("Error: Could not read migration file %s", fileName)
+            panic(err)
+        }
+
+        fmt.Fprintf(hash, "%s\n%s\n%s\n", fileName, getPlanDecision(plan, fileName), getChecksum(fileContent))
+    }
+
+    fmt.Fprintf(hash, "%s\n%s\n", CONST_GRANTS_FILENAME, getChecksum([]byte(readGrantsFromFile())))
+
+    return hex.EncodeToString(hash.Sum(nil))
+}
+
+// exit if --expected-plan-hash is given and does not match the planned migrations
+func checkExpectedPlanHash(plan *migrate.Plan) {
+    if len(*flagExpectedPlanHash) == 0 {
+        return
+    }
+
+    planHash := getPlanHash(plan)
+    if planHash != *flagExpectedPlanHash {
+        logError("Error: Plan has changed, expected plan hash %s but planned migrations have hash %s",
+            *flagExpectedPlanHash, planHash)
+        logError("Hint: Migration files, grants.sql, tags or the database changed since 'plan', run 'plan' again")
+        os.Exit(1)
+    }
+}
+
+// show planned migrations with their estimated impact and the hash which 'up --expected-plan-hash' checks
+func cmd_plan() {
+    format := getReportFormat(CONST_REPORT_FORMAT_TEXT, CONST_REPORT_FORMAT_JSON)
+
+    plan := getMigrationPlan()
+    checkMigrationStatus(plan.Status)
+    migrations := plan.Migrations()
+    checkRequiredMigrations(migrations)
+
+    for _, fileName := range migrations {
+        warnAboutColumnTypeChanges(fileName, true)
+    }
+
+    report := planReport{
+        CatchUp:  []reportMigration{},
+        Pending:  []reportMigration{},
+        Impact:   estimateImpactOfMigrations(migrations),
+        PlanHash: getPlanHash(plan),
+    }
+    for _, fileName := range plan.CatchUp {
+        report.CatchUp = append(report.CatchUp, newPendingReportMigration(fileName))
+    }
+    for _, fileName := range plan.Pending {
+        migration := newPendingReportMigration(fileName)
+        if reason, skipped := plan.SkippedBy[fileName]; skipped {
+            migration.SkippedBy = &reason
+        }
+        report.Pending = append(report.Pending, migration)
+    }
+
+    if format == CONST_REPORT_FORMAT_JSON {
+        printJSON(report)
+        os.Exit(0)
+    }
+
+    printPlanMigrations("migration(s) skipped before which run now", report.CatchUp, report.Impact)
+    if len(report.Pending) == 0 {
+        fmt.Println("Database up to date, no pending migrations.")
+    } else {
+        printPlanMigrations("pending migration(s)", report.Pending, report.Impact)
+    }
+
+    fmt.Println("plan hash:", report.PlanHash)
+
+    os.Exit(0)
+}
+
+// print migrations of a plan with their estimated impact
+func printPlanMigrations(title string, migrations []reportMigration, impacts []statementImpact) {
+    if len(migrations) == 0 {
+        return
+    }
+
+    fmt.Printf("%d %s:\n", len(migrations), title)
+    for _, migration := range migrations {
+        if migration.SkippedBy != nil {
+            fmt.Printf("    %s (skipped: %s)\n", migration, *migration.SkippedBy)
+            continue
+        }
+
+        fmt.Println("   ", migration)
+        for _, impact := range impacts {
+            if impact.FileName == migration.FileName {
+                fmt.Println("       ", impact)
+            }
+        }
+    }
+}
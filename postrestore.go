@@ -0,0 +1,142 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "time"
+)
+
+const (
+    // pg_dump restores rows with explicit ids, so the id sequence may lag behind and the next insert would collide
+    CONST_POSTGRESQL_RESET_ID_SEQUENCE = "SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL) FROM %[1]s"
+
+    // runs which were going on when the dump was taken, their backends belong to the dumped server
+    CONST_POSTGRESQL_ABORT_RESTORED_RUNS = "DELETE FROM %s RETURNING command, host_name, user_name, started_at, current_file"
+)
+
+// runs recorded in the dump ended with the dumped server: remove them, so 'status' and 'cancel' never take a
+// backend of this server with the same pid for them, and report them as aborted
+func abortRestoredRuns() {
+    var exists bool
+    err := postgreSQLConnection.QueryRow(context.Background(), "SELECT to_regclass($1) IS NOT NULL",
+        getRunsTableName()).Scan(&exists)
+    if err != nil || !exists {
+        return
+    }
+
+    rows, err := postgreSQLConnection.Query(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_ABORT_RESTORED_RUNS, getRunsTableName()))
+    if err != nil {
+        logError("Error: Could not clear runs in database table %s", getRunsTableName())
+        panic(err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var command, hostName, userName, currentFile string
+        var startedAt time.Time
+        if err := rows.Scan(&command, &hostName, &userName, &startedAt, &currentFile); err != nil {
+            logError("Error: Could not read runs from database table %s", getRunsTableName())
+            panic(err)
+        }
+
+        fmt.Printf("aborted '%s' by %s on %s, which was running since %s when the dump was taken\n",
+            command, userName, hostName, startedAt.Format("2006-01-02 15:04:05"))
+        if len(currentFile) > 0 {
+            fmt.Printf("  it was applying %s, which is in the dump only if it was recorded\n", currentFile)
+        }
+    }
+    if err := rows.Err(); err != nil {
+        logError("Error: Could not clear runs in database table %s", getRunsTableName())
+        panic(err)
+    }
+}
+
+// renamed migrations of the consistency allowlist, so their new local names are compared with the dump
+func rememberRenamedMigrations() {
+    allowlist := getConsistencyAllowlist()
+    if allowlist == nil {
+        return
+    }
+
+    for databaseFileName, localFileName := range allowlist.Renamed {
+        databaseFileNames[localFileName] = databaseFileName
+    }
+}
+
+// fix up tracking table after restoring a logical dump and compare it with local migration files
+func cmd_post_restore() {
+    // adds columns missing in dumps of older versions
+    getMigrator()
+
+    var nextId int
+    err := postgreSQLConnection.QueryRow(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_RESET_ID_SEQUENCE, trackingTableName)).Scan(&nextId)
+    if err != nil {
+        logError("Error: Could not reset id sequence of database table %s", trackingTableName)
+        panic(err)
+    }
+    fmt.Printf("reset id sequence of %s to %d\n", trackingTableName, nextId)
+
+    abortRestoredRuns()
+    rememberRenamedMigrations()
+
+    appliedMigrations := getAppliedMigrations()
+    problems := 0
+
+    // migrations archived by 'prune-history' are not compared
+    migrationsInFileSystem := getMigrationsFromFileSystem()
+    prunedCount := getPrunedMigrationCount()
+    if prunedCount > len(migrationsInFileSystem) {
+        prunedCount = len(migrationsInFileSystem)
+    }
+    migrationsInFileSystem = migrationsInFileSystem[prunedCount:]
+
+    // compare dump with local files, reporting everything instead of stopping at the first mismatch
+    for index, migration := range appliedMigrations {
+        if index >= len(migrationsInFileSystem) {
+            fmt.Printf("! %s (position %d) is applied in the database, but missing in %s\n",
+                migration.FileName, migration.Position, migrationsFolder)
+            problems++
+            continue
+        }
+
+        localFileName := migrationsInFileSystem[index]
+        if migration.FileName != getDatabaseFileName(localFileName) {
+            fmt.Printf("! %s (position %d) is applied in the database, but local file #%d is %s\n",
+                migration.FileName, migration.Position, prunedCount+index+1, localFileName)
+            problems++
+            continue
+        }
+
+        // revalidate files of applied migrations, a restore may pair the dump with a different checkout
+        _, err := validateMigrationFile(localFileName, migrationFileInfo{})
+        if err != nil {
+            fmt.Printf("! %s: %s\n", localFileName, err)
+            problems++
+            continue
+        }
+
+        // skipped migrations have not run, rows without checksum are from before checksums were stored
+        if len(migration.Checksum) > 0 && len(migration.SkippedBy) == 0 && migration.Checksum != getMigrationFileChecksum(localFileName) {
+            fmt.Printf("! %s has been changed since it was applied (%s), the checksum in the dump differs\n",
+                localFileName, migration.AppliedAt.Format("2006-01-02 15:04:05"))
+            problems++
+        }
+    }
+
+    if len(migrationsInFileSystem) > len(appliedMigrations) {
+        fmt.Printf("%d local migration(s) not applied in the restored database, run 'up' to apply them\n",
+            len(migrationsInFileSystem)-len(appliedMigrations))
+    }
+
+    if problems > 0 {
+        logError("Error: Restored database does not match local migration files (%d problem(s))", problems)
+        os.Exit(1)
+    }
+
+    fmt.Printf("Restored database matches local migration files, %d migrations applied.\n", prunedCount+len(appliedMigrations))
+
+    os.Exit(0)
+}
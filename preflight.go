@@ -0,0 +1,99 @@
+package main
+
+import (
+    "context"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    // recorded in skipped_by for migrations whose objects already existed
+    CONST_SKIPPED_BY_EXISTING = "skip-existing"
+)
+
+var flagSkipExisting = commandLineFlags.Bool("skip-existing", false, "for 'up': record pending migrations whose objects all exist already (e.g. after a manual hotfix) as skipped instead of running them")
+
+// get objects which a migration creates and which would fail if they exist
+func getObjectsCreatedByMigration(sql string) []sqlObject {
+    var objects []sqlObject
+
+    for _, statement := range splitSQLStatements(sql) {
+        parsed := migrate.ParseStatement(statement)
+
+        // overloads make functions hard to tell apart
+        if created := parsed.CreatedObject(); created != nil && len(created.Name) > 0 && !created.IfNotExists && !created.OrReplace &&
+            created.Kind != "function" && created.Kind != "procedure" {
+            objects = append(objects, sqlObject{kind: created.Kind, name: created.Name, table: created.Table})
+        }
+
+        if alterTable := parsed.AlterTable(); alterTable != nil {
+            for _, action := range alterTable.Actions {
+                if action.Kind == migrate.ActionAddConstraint && len(action.Name) > 0 {
+                    objects = append(objects, sqlObject{kind: "constraint", name: action.Name, table: alterTable.Table})
+                }
+            }
+        }
+    }
+
+    return objects
+}
+
+// check if object exists in the database, resolved with the search_path of the migrations
+func existsInDatabase(object sqlObject) bool {
+    var query string
+    var args []interface{}
+
+    switch object.kind {
+    case "schema":
+        _, name := splitQualifiedName(object.name)
+        query, args = "SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1)", []interface{}{name}
+    case "type":
+        query, args = "SELECT to_regtype($1) IS NOT NULL", []interface{}{object.name}
+    case "constraint":
+        _, name := splitQualifiedName(object.name)
+        query, args = "SELECT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = to_regclass($1) AND conname = $2)", []interface{}{object.table, name}
+    default:
+        query, args = "SELECT to_regclass($1) IS NOT NULL", []interface{}{object.name}
+    }
+
+    var exists bool
+    err := postgreSQLConnection.QueryRow(context.Background(), query, args...).Scan(&exists)
+    if err != nil {
+        // e.g. invalid name syntax, the migration reports it better
+        return false
+    }
+
+    return exists
+}
+
+// warn about pending migrations which create objects that already exist (e.g. after a manual hotfix),
+// with --skip-existing those whose objects all exist are skipped
+func checkExistingObjects(pendingMigrations []string, skippedBy map[string]string) {
+    for _, fileName := range pendingMigrations {
+        sqlMigrationForward, _ := readMigrationFromFile(fileName)
+        objects := getObjectsCreatedByMigration(sqlMigrationForward)
+
+        var existing []sqlObject
+        for _, object := range objects {
+            if existsInDatabase(object) {
+                existing = append(existing, object)
+            }
+        }
+
+        if len(existing) == 0 {
+            continue
+        }
+
+        if *flagSkipExisting && len(existing) == len(objects) {
+            skippedBy[fileName] = CONST_SKIPPED_BY_EXISTING
+            continue
+        }
+
+        for _, object := range existing {
+            logError("Warning: %s creates %s %s, which already exists", fileName, object.kind, object.name)
+        }
+        if len(existing) == len(objects) {
+            logError("Hint: Maybe it has been applied by hand? '--skip-existing' records it without running it")
+        }
+    }
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+var flagProgressFile = commandLineFlags.String("progress-file", "", "for 'up' and 'down': write progress events as JSON lines to this file (e.g. /dev/fd/3), for wrappers with their own progress UI")
+
+// where progress events go, nil without --progress-file
+var progressOutput *os.File
+
+// position of the current migration within this run and when it started, for events
+var (
+    progressIndex     int
+    progressTotal     int
+    progressStartedAt time.Time
+)
+
+// send progress event to --progress-file (if any), problems with it do not stop the migration
+func emitProgressEvent(event migrate.Event) {
+    if len(*flagProgressFile) == 0 {
+        return
+    }
+
+    if progressOutput == nil {
+        file, err := os.OpenFile(*flagProgressFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+        if err != nil {
+            logError("Error: Could not open progress file %s", *flagProgressFile)
+            panic(err)
+        }
+        progressOutput = file
+    }
+
+    if event.Err != nil {
+        event.Error = sanitizeSupportBundleText(event.Err.Error())
+    }
+    if event.Index == 0 {
+        event.Index, event.Total = progressIndex, progressTotal
+    }
+    if event.Kind == migrate.EventMigrationStarted {
+        progressStartedAt = time.Now()
+    } else if event.Duration == 0 && !progressStartedAt.IsZero() {
+        event.Duration = time.Since(progressStartedAt)
+    }
+
+    line, err := json.Marshal(event)
+    if err != nil {
+        return
+    }
+    _, _ = progressOutput.Write(append(line, '\n'))
+}
+
+// statement for events: one line, shortened like queries of blocking sessions
+func shortenStatementForProgress(statement string) string {
+    statement = strings.TrimSpace(regexpWhitespace.ReplaceAllString(statement, " "))
+
+    return shortenText(statement, CONST_BLOCKING_QUERY_MAX_LENGTH)
+}
+
+// report failed migration, then fail as before; deferred by 'up' and 'down'
+func emitProgressEventOnPanic() {
+    err := recover()
+    if err == nil {
+        return
+    }
+
+    if len(failingMigrationFileName) > 0 {
+        recoveredErr, ok := err.(error)
+        if !ok {
+            recoveredErr = fmt.Errorf("%v", err)
+        }
+        emitProgressEvent(migrate.Event{Kind: migrate.EventMigrationFailed, FileName: failingMigrationFileName, Err: recoveredErr})
+    }
+    panic(err)
+}
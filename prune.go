@@ -0,0 +1,69 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+)
+
+const (
+    // whole tracking rows are kept as jsonb, so columns added to the tracking table later are archived as well
+    CONST_POSTGRESQL_HISTORY_TABLE_SCHEMA = "CREATE TABLE IF NOT EXISTS %s (filename text, position integer, pruned_at timestamp with time zone DEFAULT NOW(), migration jsonb, UNIQUE(position))"
+
+    // move all but the newest $1 rows, positions of the remaining rows stay as they are
+    CONST_POSTGRESQL_PRUNE_HISTORY = `
+        WITH pruned AS (
+            DELETE FROM %[1]s WHERE position <= (SELECT MAX(position) FROM %[1]s) - $1 RETURNING *
+        )
+        INSERT INTO %[2]s (filename, position, migration) SELECT filename, position, to_jsonb(pruned) FROM pruned`
+)
+
+var flagKeep = commandLineFlags.Int("keep", 500, "for 'prune-history': number of newest applied migrations to keep in the tracking table")
+
+// get history table of the tracking table (of the component)
+func getHistoryTableName() string {
+    return trackingTableName + "_history"
+}
+
+// archive old rows of the tracking table into the history table
+func cmd_prune_history() {
+    if *flagKeep < 1 {
+        logError("Error: --keep needs to be at least 1, got: %d", *flagKeep)
+        os.Exit(1)
+    }
+
+    // tracking table needs all columns before rows are archived
+    getMigrator()
+
+    tx, err := postgreSQLConnection.Begin(context.Background())
+    if err != nil {
+        logError("Error: Failed to start prune transaction")
+        panic(err)
+    }
+
+    defer tx.Rollback(context.Background())
+
+    _, err = tx.Exec(context.Background(), fmt.Sprintf(CONST_POSTGRESQL_HISTORY_TABLE_SCHEMA, getHistoryTableName()))
+    if err != nil {
+        logError("Error: Failed to create table %s", getHistoryTableName())
+        panic(err)
+    }
+
+    result, err := tx.Exec(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_PRUNE_HISTORY, trackingTableName, getHistoryTableName()), *flagKeep)
+    if err != nil {
+        logError("Error: Failed to move migrations into %s", getHistoryTableName())
+        panic(err)
+    }
+
+    err = tx.Commit(context.Background())
+    if err != nil {
+        logError("Error: Failed to commit prune transaction")
+        panic(err)
+    }
+
+    fmt.Printf("archived %d migration(s) into %s, kept the newest %d in %s\n",
+        result.RowsAffected(), getHistoryTableName(), *flagKeep, trackingTableName)
+
+    os.Exit(0)
+}
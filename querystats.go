@@ -0,0 +1,158 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "strings"
+)
+
+const (
+    // pg_stat_statements renamed total_time to total_exec_time in PostgreSQL 13
+    CONST_POSTGRESQL_QUERY_STATS_QUERY = `
+        SELECT query, sum(calls)::bigint, sum(%s)::float8
+        FROM pg_stat_statements
+        WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+        AND query NOT LIKE '%%pg_stat_statements%%'
+        GROUP BY query`
+)
+
+var flagQueryStats = commandLineFlags.Int("query-stats", 0, "show the N slowest statements of each migration (requires pg_stat_statements)")
+
+// statistics of one statement from pg_stat_statements
+type queryStat struct {
+    query       string
+    calls       int64
+    totalTimeMs float64
+}
+
+// column with total execution time, empty if pg_stat_statements is not available
+var queryStatsTimeColumn string
+
+// turn --query-stats off for the rest of the run, warns once
+func disableQueryStats(err error) {
+    logError("Warning: pg_stat_statements is not available, --query-stats is ignored (%s)", err)
+    logError("Hint: CREATE EXTENSION pg_stat_statements (it also needs to be in shared_preload_libraries)")
+    *flagQueryStats = 0
+}
+
+// check if pg_stat_statements can be used, warn once if not
+func isQueryStatsAvailable() bool {
+    if *flagQueryStats <= 0 {
+        return false
+    }
+
+    if len(queryStatsTimeColumn) > 0 {
+        return true
+    }
+
+    // read it for real: without shared_preload_libraries the view exists, but reading it fails;
+    // in a transaction of its own, a savepoint with --rollback-at-end, so the failure aborts nothing
+    var timeColumn string
+    tx, err := postgreSQLConnection.Begin(context.Background())
+    if err == nil {
+        defer tx.Rollback(context.Background())
+
+        err = tx.QueryRow(context.Background(), `
+            SELECT attname FROM pg_attribute
+            WHERE attrelid = to_regclass('pg_stat_statements')
+            AND attname IN ('total_exec_time', 'total_time')`).Scan(&timeColumn)
+    }
+    if err == nil {
+        _, err = tx.Exec(context.Background(), "SELECT 1 FROM pg_stat_statements LIMIT 1")
+    }
+    if err != nil {
+        disableQueryStats(err)
+        return false
+    }
+
+    queryStatsTimeColumn = timeColumn
+
+    return true
+}
+
+// fetch current statistics of all statements in this database, none if they cannot be read
+func getQueryStatsSnapshot() map[string]queryStat {
+    snapshot := make(map[string]queryStat)
+    if !isQueryStatsAvailable() {
+        return snapshot
+    }
+
+    // like the check, a failure must not abort the transaction of --rollback-at-end
+    tx, err := postgreSQLConnection.Begin(context.Background())
+    if err != nil {
+        disableQueryStats(err)
+        return snapshot
+    }
+    defer tx.Rollback(context.Background())
+
+    rows, err := tx.Query(context.Background(), fmt.Sprintf(CONST_POSTGRESQL_QUERY_STATS_QUERY, queryStatsTimeColumn))
+    if err != nil {
+        disableQueryStats(err)
+        return map[string]queryStat{}
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var stat queryStat
+        err := rows.Scan(&stat.query, &stat.calls, &stat.totalTimeMs)
+        if err != nil {
+            disableQueryStats(err)
+            return map[string]queryStat{}
+        }
+
+        snapshot[stat.query] = stat
+    }
+
+    if err := rows.Err(); err != nil {
+        disableQueryStats(err)
+        return map[string]queryStat{}
+    }
+
+    return snapshot
+}
+
+// print slowest statements executed between two snapshots
+func printQueryStats(fileName string, before map[string]queryStat, after map[string]queryStat) {
+    if !isQueryStatsAvailable() {
+        return
+    }
+
+    var delta []queryStat
+    for query, statAfter := range after {
+        statBefore := before[query]
+        if statAfter.calls > statBefore.calls {
+            delta = append(delta, queryStat{
+                query:       query,
+                calls:       statAfter.calls - statBefore.calls,
+                totalTimeMs: statAfter.totalTimeMs - statBefore.totalTimeMs,
+            })
+        }
+    }
+
+    sort.Slice(delta, func(i, j int) bool {
+        return delta[i].totalTimeMs > delta[j].totalTimeMs
+    })
+
+    if len(delta) > *flagQueryStats {
+        delta = delta[:*flagQueryStats]
+    }
+
+    fmt.Printf("  slowest statements of %s:\n", fileName)
+    for _, stat := range delta {
+        // one line per statement
+        query := shortenText(strings.Join(strings.Fields(stat.query), " "), 77)
+
+        fmt.Printf("  %10.1f ms %6d calls  %s\n", stat.totalTimeMs, stat.calls, query)
+    }
+}
+
+// cut text after maxLength characters and mark it with "...", by runes: a byte in the middle of e.g. an umlaut
+// would leave invalid UTF-8 behind
+func shortenText(text string, maxLength int) string {
+    if runes := []rune(text); len(runes) > maxLength {
+        return string(runes[:maxLength]) + "..."
+    }
+
+    return text
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+    "testing"
+    "unicode/utf8"
+)
+
+func TestShortenText(t *testing.T) {
+    tests := []struct {
+        text      string
+        maxLength int
+        expected  string
+    }{
+        {"SELECT 1", 77, "SELECT 1"},
+        {"UPDATE orders SET note = 'x'", 13, "UPDATE orders..."},
+        {"UPDATE kunden SET straße = 'Müller'", 22, "UPDATE kunden SET stra..."},
+        {"UPDATE kunden SET straße = 'Müller'", 23, "UPDATE kunden SET straß..."},
+        {"INSERT INTO t VALUES ('日本語')", 25, "INSERT INTO t VALUES ('日本..."},
+        {"", 10, ""},
+    }
+
+    for _, test := range tests {
+        shortened := shortenText(test.text, test.maxLength)
+        if shortened != test.expected || !utf8.ValidString(shortened) {
+            t.Errorf("got %q for %q (%d), want %q", shortened, test.text, test.maxLength, test.expected)
+        }
+    }
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "os/exec"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    // database to connect to while creating and dropping the scratch database
+    CONST_MAINTENANCE_DATABASE = "postgres"
+
+    CONST_CLONE_TEMPLATE = "template"
+    CONST_CLONE_DUMP     = "dump"
+)
+
+var flagClone = commandLineFlags.String("clone", CONST_CLONE_TEMPLATE, "for 'rehearse': copy database with CREATE DATABASE ... 'template' (needs no other connections to it) or schema-only pg_dump 'dump'")
+
+// connection string of another database on the same server
+func getConnectionStringForDatabase(database string) string {
+    return buildConnectionString(getConfigValue("host"), getConfigValue("port"),
+        getConfigValue("user"), getConfigValue("password"), database, getConfigValue("parameters"))
+}
+
+// pipe pg_dump of the source database into psql of the target database
+func copyDatabaseWithDump(sourceDatabase string, targetDatabase string, pgDumpArgs ...string) {
+    dump := exec.Command("pg_dump", append(pgDumpArgs, "--dbname="+getConnectionStringForDatabase(sourceDatabase))...)
+    restore := exec.Command("psql", "--quiet", "--set=ON_ERROR_STOP=1", "--dbname="+getConnectionStringForDatabase(targetDatabase))
+
+    dumpOutput, err := dump.StdoutPipe()
+    if err != nil {
+        panic(err)
+    }
+    restore.Stdin = dumpOutput
+    dump.Stderr = os.Stderr
+    restore.Stderr = os.Stderr
+
+    err = restore.Start()
+    if err != nil {
+        logError("Error: Could not start psql")
+        logError("Hint: --clone %s needs pg_dump and psql in PATH", CONST_CLONE_DUMP)
+        panic(err)
+    }
+
+    err = dump.Run()
+    if err != nil {
+        logError("Error: pg_dump of database %s failed", sourceDatabase)
+        panic(err)
+    }
+
+    err = restore.Wait()
+    if err != nil {
+        logError("Error: Restoring dump into database %s failed", targetDatabase)
+        panic(err)
+    }
+}
+
+// create scratch database as copy of the target database
+func cloneDatabase(connection *pgx.Conn, sourceDatabase string, scratchDatabase string) {
+    switch *flagClone {
+    case CONST_CLONE_TEMPLATE:
+        _, err := connection.Exec(context.Background(), fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s",
+            quoteSQLIdentifier(scratchDatabase), quoteSQLIdentifier(sourceDatabase)))
+        if err != nil {
+            logError("Error: Could not create database %s from template %s: %s", scratchDatabase, sourceDatabase, err)
+            logError("Hint: A template must not have other connections, use --clone %s for databases in use", CONST_CLONE_DUMP)
+            os.Exit(1)
+        }
+
+    case CONST_CLONE_DUMP:
+        _, err := connection.Exec(context.Background(), "CREATE DATABASE "+quoteSQLIdentifier(scratchDatabase))
+        if err != nil {
+            logError("Error: Could not create database %s", scratchDatabase)
+            panic(err)
+        }
+
+        // structure, plus the applied migrations so only pending ones run
+        copyDatabaseWithDump(sourceDatabase, scratchDatabase, "--schema-only", "--no-owner", "--no-privileges")
+        copyDatabaseWithDump(sourceDatabase, scratchDatabase, "--data-only", "--table="+trackingTableName)
+
+    default:
+        logError("Error: Unknown clone method %s, use one of: %s, %s", *flagClone, CONST_CLONE_TEMPLATE, CONST_CLONE_DUMP)
+        os.Exit(1)
+    }
+}
+
+// run pending migrations on a scratch copy of the database, report timing and errors, then drop the copy
+func cmd_rehearse() {
+    sourceDatabase := getConfigValue("database")
+    scratchDatabase := fmt.Sprintf("%s_rehearsal_%s", sourceDatabase, time.Now().UTC().Format("20060102150405"))
+
+    // CREATE DATABASE cannot run on a connection to the database which is copied
+    connection := openPostgreSQLConnection(getConnectionStringForDatabase(CONST_MAINTENANCE_DATABASE))
+    defer closePostgreSQLConnection(connection)
+
+    fmt.Printf("cloning database %s into %s (--clone %s)\n", sourceDatabase, scratchDatabase, *flagClone)
+    startedAt := time.Now()
+    cloneDatabase(connection, sourceDatabase, scratchDatabase)
+    fmt.Printf("cloned in %s\n", time.Since(startedAt).Round(time.Millisecond))
+
+    // 'up' in a child process, so connections and state of this process stay untouched
+    startedAt = time.Now()
+    command := exec.Command(os.Args[0], getChildCommandLineArgs("up", map[string]bool{"clone": true},
+        map[string]string{"database": scratchDatabase, "environment": "rehearsal"})...)
+    command.Stdout = os.Stdout
+    command.Stderr = os.Stderr
+    upErr := command.Run()
+    duration := time.Since(startedAt).Round(time.Millisecond)
+
+    _, err := connection.Exec(context.Background(), "DROP DATABASE "+quoteSQLIdentifier(scratchDatabase))
+    if err != nil {
+        logError("Error: Could not drop scratch database %s, drop it by hand", scratchDatabase)
+        panic(err)
+    }
+    fmt.Println("dropped scratch database", scratchDatabase)
+
+    if upErr != nil {
+        logError("Error: Rehearsal failed after %s: %s", duration, upErr)
+        os.Exit(1)
+    }
+
+    fmt.Printf("Rehearsal succeeded, pending migrations took %s on a copy of %s.\n", duration, sourceDatabase)
+
+    os.Exit(0)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+    "context"
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "path"
+    "strings"
+)
+
+var flagCheckRemote = commandLineFlags.Bool("check-remote", false, "for 'create': warn if the new migration sorts before the latest migration applied to the database (or listed in --remote-lock-file)")
+var flagRemoteLockFile = commandLineFlags.String("remote-lock-file", "", "for 'create --check-remote': lock file of the main branch instead of the database, a path or git ref:path, e.g. origin/main:migrations.lock")
+
+// read lock file from disk, or from another branch with 'git show ref:path'
+func readRemoteLockFile(lockFile string) string {
+    if _, err := os.Stat(lockFile); err == nil || !strings.Contains(lockFile, ":") {
+        content, err := ioutil.ReadFile(lockFile)
+        if err != nil {
+            logError("Error: Could not read lock file %s", lockFile)
+            panic(err)
+        }
+        return string(content)
+    }
+
+    command := exec.Command("git", "show", lockFile)
+    command.Stderr = os.Stderr
+    content, err := command.Output()
+    if err != nil {
+        logError("Error: Could not read %s with git show", lockFile)
+        logError("Hint: Run 'git fetch' first, the ref must exist locally")
+        panic(err)
+    }
+
+    return string(content)
+}
+
+// latest migration known to the database or the lock file of the main branch, empty if there is none
+func getLatestRemoteMigration() string {
+    var known []string
+
+    if len(*flagRemoteLockFile) > 0 {
+        for _, line := range strings.Split(readRemoteLockFile(*flagRemoteLockFile), "\n") {
+            line = strings.TrimSpace(line)
+            if len(line) > 0 && !strings.HasPrefix(line, "#") && isMigrationFileName(path.Base(line)) {
+                known = append(known, path.Base(line))
+            }
+        }
+    } else {
+        connectToStoredDatabaseConnection()
+
+        // nothing applied yet, without creating the tracking table
+        var exists bool
+        err := postgreSQLConnection.QueryRow(context.Background(), "SELECT to_regclass($1) IS NOT NULL", trackingTableName).Scan(&exists)
+        if err != nil {
+            logError("Error: Could not check for table %s", trackingTableName)
+            panic(err)
+        }
+        if exists {
+            known = getMigrationsFromDatabase()
+        }
+    }
+
+    if len(known) == 0 {
+        return ""
+    }
+
+    sortMigrationFileNames(known)
+    return known[len(known)-1]
+}
+
+// stale branches: a migration which sorts before applied ones is refused by 'up' (or applied out of order with lenient consistency)
+func checkRemoteMigrationOrder(filePath string) {
+    if !*flagCheckRemote {
+        return
+    }
+
+    fileName := path.Base(filePath)
+    latest := getLatestRemoteMigration()
+    if len(latest) == 0 || isMigrationFileNameBefore(latest, fileName) {
+        return
+    }
+
+    logError("Warning: %s sorts before %s, which is already known to the %s", fileName, latest, describeRemote())
+    logError("Hint: Rebase the branch, then delete the file and create it again, so it sorts after the migrations of the main branch")
+}
+
+// where the latest migration came from, for messages
+func describeRemote() string {
+    if len(*flagRemoteLockFile) > 0 {
+        return "lock file " + *flagRemoteLockFile
+    }
+
+    return "database"
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+    "context"
+    "os"
+    "sort"
+    "strings"
+)
+
+var flagReplica = commandLineFlags.Bool("replica", false, "for 'status', 'history', 'plan' and 'export-durations': allow connecting to a read replica, read-only")
+
+// commands which only read, they may run against a read replica with --replica
+var readOnlyCommands = map[string]bool{
+    "status":            true,
+    "history":           true,
+    "plan":              true,
+    "export-durations":  true,
+    "verify-connection": true,
+    "export-schema":     true,
+    "assert-current":    true,
+    "at":                true,
+}
+
+// refuse --replica for commands which write
+func checkReplicaCommand(command string) {
+    if !*flagReplica || readOnlyCommands[command] {
+        return
+    }
+
+    var commands []string
+    for readOnlyCommand := range readOnlyCommands {
+        commands = append(commands, readOnlyCommand)
+    }
+    sort.Strings(commands)
+
+    logError("Error: '%s' changes the database and needs the primary, --replica is only allowed for: %s", command, strings.Join(commands, ", "))
+    os.Exit(1)
+}
+
+// check whether the server is a replica, which only --replica may use
+func checkReplicaConnection(connection databaseConnection) {
+    var inRecovery bool
+    err := connection.QueryRow(context.Background(), "SELECT pg_is_in_recovery()").Scan(&inRecovery)
+    if err != nil {
+        logError("Error: Could not check whether the database server is a replica")
+        panic(err)
+    }
+
+    if inRecovery && !*flagReplica {
+        logError("Error: The database server is a read replica, '%s' needs the primary", currentCommand)
+        logError("Hint: Read-only commands can use the replica with --replica")
+        os.Exit(1)
+    }
+}
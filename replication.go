@@ -0,0 +1,141 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+var flagAllowReplicationBreakingDDL = commandLineFlags.Bool("allow-replication-breaking-ddl", false, "for 'up' and 'down': only warn about DDL which breaks logical replication of published tables (e.g. CDC pipelines)")
+
+// DDL on a table which logical replication consumers cannot follow by themselves
+type replicationBreakingChange struct {
+    table       string
+    description string
+}
+
+// get DDL of one statement which breaks logical replication of the affected table
+// (dropped or renamed tables and columns, changed column types and replica identity)
+func getReplicationBreakingChanges(statement string) []replicationBreakingChange {
+    var changes []replicationBreakingChange
+    add := func(table string, format string, args ...interface{}) {
+        changes = append(changes, replicationBreakingChange{table, fmt.Sprintf(format, args...)})
+    }
+
+    parsed := migrate.ParseStatement(statement)
+
+    for _, object := range parsed.DroppedObjects() {
+        if object.Kind == "table" {
+            add(object.Name, "drops table %s", object.Name)
+        }
+    }
+
+    alterTable := parsed.AlterTable()
+    if alterTable == nil {
+        return changes
+    }
+
+    table := alterTable.Table
+    for _, action := range alterTable.Actions {
+        switch action.Kind {
+        case migrate.ActionRenameTable:
+            add(table, "renames table %s to %s", table, action.NewName)
+        case migrate.ActionDropColumn:
+            add(table, "drops column %s.%s", table, action.Name)
+        case migrate.ActionAlterColumnType:
+            add(table, "changes type of column %s.%s", table, action.Name)
+        case migrate.ActionRenameColumn:
+            add(table, "renames column %s.%s to %s", table, action.Name, action.NewName)
+        case migrate.ActionReplicaIdentity:
+            add(table, "changes replica identity of %s", table)
+        }
+    }
+
+    return changes
+}
+
+// check if logical replication slots exist, e.g. of Debezium
+func hasLogicalReplicationSlots() bool {
+    var exists bool
+    err := postgreSQLConnection.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_type = 'logical')").Scan(&exists)
+    if err != nil {
+        logError("Error: Could not read logical replication slots")
+        panic(err)
+    }
+
+    return exists
+}
+
+// get publications of a table, empty if it is not published or does not exist (yet)
+func getPublicationsOfTable(table string) string {
+    var publications string
+    err := postgreSQLConnection.QueryRow(context.Background(), `
+        SELECT coalesce(string_agg(DISTINCT pubname, ', '), '')
+        FROM pg_publication_tables
+        WHERE format('%I.%I', schemaname, tablename)::regclass = to_regclass($1)`, table).Scan(&publications)
+    if err != nil {
+        // e.g. invalid name syntax, the migration reports it better
+        return ""
+    }
+
+    return publications
+}
+
+// abort before migrations whose DDL breaks logical replication of published tables (warn only with --allow-replication-breaking-ddl),
+// without publications (e.g. wal2json) every table of a database with logical replication slots is replicated
+func checkLogicalReplication(fileNames []string, forward bool) {
+    if len(fileNames) == 0 {
+        return
+    }
+
+    hasSlots := hasLogicalReplicationSlots()
+    hasPublications := false
+    if getServerVersionNum() >= 100000 {
+        err := postgreSQLConnection.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM pg_publication)").Scan(&hasPublications)
+        if err != nil {
+            logError("Error: Could not read publications")
+            panic(err)
+        }
+    }
+
+    if !hasSlots && !hasPublications {
+        return
+    }
+
+    failures := 0
+    for _, fileName := range fileNames {
+        sqlMigrationForward, sqlMigrationBackward := readMigrationFromFile(fileName)
+        sql := sqlMigrationForward
+        if !forward {
+            sql = sqlMigrationBackward
+        }
+
+        for _, statement := range splitSQLStatements(cleanUpSQLString(sql)) {
+            for _, change := range getReplicationBreakingChanges(statement) {
+                replicatedBy := "logical replication slots"
+                if hasPublications {
+                    publications := getPublicationsOfTable(change.table)
+                    if len(publications) == 0 {
+                        continue
+                    }
+                    replicatedBy = "publication " + publications
+                }
+
+                if *flagAllowReplicationBreakingDDL {
+                    logError("Warning: %s %s, which is replicated by %s", fileName, change.description, replicatedBy)
+                } else {
+                    logError("Error: %s %s, which is replicated by %s", fileName, change.description, replicatedBy)
+                    failures++
+                }
+            }
+        }
+    }
+
+    if failures > 0 {
+        logError("Hint: Nothing has been applied, logical replication consumers (e.g. CDC pipelines) would break silently")
+        logError("Hint: Coordinate the change with the consumers and rerun with '--allow-replication-breaking-ddl'")
+        os.Exit(1)
+    }
+}
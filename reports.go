@@ -0,0 +1,194 @@
+package main
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "text/tabwriter"
+    "time"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    CONST_REPORT_FORMAT_TEXT = "text"
+    CONST_REPORT_FORMAT_JSON = "json"
+    CONST_REPORT_FORMAT_CSV  = "csv"
+    CONST_REPORT_FORMAT_TSV  = "tsv"
+
+    // state column of csv/tsv reports
+    CONST_REPORT_STATE_APPLIED = "applied"
+    CONST_REPORT_STATE_SKIPPED = "skipped"
+    CONST_REPORT_STATE_PENDING = "pending"
+)
+
+var flagJSON = commandLineFlags.Bool("json", false, "for 'plan', 'status' and 'history': print JSON instead of text (same as --format json)")
+var flagFormat = commandLineFlags.String("format", "", "for 'status' and 'history': text, json, csv or tsv (one row per migration); for 'plan': text or json")
+
+// columns of csv/tsv reports, only ever append to keep scripts working
+var reportTableHeader = []string{"state", "filename", "owner", "applied_at", "duration_ms", "skipped_by"}
+
+// get output format from --format and --json, exits for unknown formats or formats the command does not support
+func getReportFormat(supportedFormats ...string) string {
+    format := *flagFormat
+    if len(format) == 0 {
+        format = CONST_REPORT_FORMAT_TEXT
+        if *flagJSON {
+            format = CONST_REPORT_FORMAT_JSON
+        }
+    } else if *flagJSON && format != CONST_REPORT_FORMAT_JSON {
+        logError("Error: --json conflicts with --format %s", format)
+        os.Exit(1)
+    }
+
+    for _, supportedFormat := range supportedFormats {
+        if format == supportedFormat {
+            return format
+        }
+    }
+
+    logError("Error: Unknown output format %s", format)
+    logError("Hint: Use one of: %s", strings.Join(supportedFormats, ", "))
+    os.Exit(1)
+    return ""
+}
+
+// migration in the output of plan, status and history
+type reportMigration struct {
+    FileName   string     `json:"filename"`
+    Owner      string     `json:"owner,omitempty"`
+    AppliedAt  *time.Time `json:"applied_at,omitempty"`
+    DurationMs *int64     `json:"duration_ms,omitempty"`
+    SkippedBy  *string    `json:"skipped_by,omitempty"`
+}
+
+// pending migration for reports
+func newPendingReportMigration(fileName string) reportMigration {
+    return reportMigration{FileName: fileName, Owner: getMigrationOwner(fileName)}
+}
+
+// applied migration for reports
+func newAppliedReportMigration(migration migrate.AppliedMigration) reportMigration {
+    appliedAt := migration.AppliedAt
+    report := reportMigration{
+        FileName:  migration.FileName,
+        Owner:     getMigrationOwner(migration.FileName),
+        AppliedAt: &appliedAt,
+    }
+
+    // unknown for migrations applied by older versions or by scripts
+    if migration.Duration != nil {
+        durationMs := migration.Duration.Milliseconds()
+        report.DurationMs = &durationMs
+    }
+    if len(migration.SkippedBy) > 0 {
+        skippedBy := migration.SkippedBy
+        report.SkippedBy = &skippedBy
+    }
+
+    return report
+}
+
+// file name with owner, e.g. "20240101120000-add-index.sql (owner: team-payments)"
+func (migration reportMigration) String() string {
+    if len(migration.Owner) == 0 {
+        return migration.FileName
+    }
+
+    return fmt.Sprintf("%s (owner: %s)", migration.FileName, migration.Owner)
+}
+
+// row of csv/tsv reports, timestamps in UTC so the output does not depend on the machine
+func (migration reportMigration) tableRecord(state string) []string {
+    record := []string{state, migration.FileName, migration.Owner, "", "", ""}
+    if migration.AppliedAt != nil {
+        record[3] = migration.AppliedAt.UTC().Format(time.RFC3339)
+    }
+    if migration.DurationMs != nil {
+        record[4] = strconv.FormatInt(*migration.DurationMs, 10)
+    }
+    if migration.SkippedBy != nil {
+        record[5] = *migration.SkippedBy
+    }
+
+    return record
+}
+
+// state of an applied migration for csv/tsv reports
+func (migration reportMigration) appliedState() string {
+    if migration.SkippedBy != nil {
+        return CONST_REPORT_STATE_SKIPPED
+    }
+
+    return CONST_REPORT_STATE_APPLIED
+}
+
+// print rows with header as csv or tsv, e.g. for spreadsheets or cut/awk
+func printReportTable(format string, records [][]string) {
+    writer := csv.NewWriter(os.Stdout)
+    if format == CONST_REPORT_FORMAT_TSV {
+        writer.Comma = '\t'
+    }
+
+    if err := writer.Write(reportTableHeader); err != nil {
+        panic(err)
+    }
+    if err := writer.WriteAll(records); err != nil {
+        panic(err)
+    }
+}
+
+// print value as indented JSON
+func printJSON(value interface{}) {
+    output, err := json.MarshalIndent(value, "", "  ")
+    if err != nil {
+        panic(err)
+    }
+    fmt.Println(string(output))
+}
+
+// show all applied migrations with time, duration and owner
+func cmd_history() {
+    format := getReportFormat(CONST_REPORT_FORMAT_TEXT, CONST_REPORT_FORMAT_JSON, CONST_REPORT_FORMAT_CSV, CONST_REPORT_FORMAT_TSV)
+
+    var history []reportMigration
+    for _, migration := range getAppliedMigrations() {
+        history = append(history, newAppliedReportMigration(migration))
+    }
+
+    switch format {
+    case CONST_REPORT_FORMAT_JSON:
+        if history == nil {
+            history = []reportMigration{}
+        }
+        printJSON(history)
+        os.Exit(0)
+    case CONST_REPORT_FORMAT_CSV, CONST_REPORT_FORMAT_TSV:
+        var records [][]string
+        for _, migration := range history {
+            records = append(records, migration.tableRecord(migration.appliedState()))
+        }
+        printReportTable(format, records)
+        os.Exit(0)
+    }
+
+    writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(writer, "APPLIED AT\tDURATION\tOWNER\tFILE")
+    for _, migration := range history {
+        duration := "unknown"
+        if migration.SkippedBy != nil {
+            duration = "skipped by " + *migration.SkippedBy
+        } else if migration.DurationMs != nil {
+            duration = (time.Duration(*migration.DurationMs) * time.Millisecond).String()
+        }
+
+        fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", migration.AppliedAt.Local().Format("2006-01-02 15:04:05"),
+            duration, migration.Owner, migration.FileName)
+    }
+    writer.Flush()
+
+    os.Exit(0)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io/fs"
+    "os"
+    "path"
+    "strings"
+)
+
+const (
+    // migrations of other components which have to be applied first, e.g. "-- requires: core/20240101120000-add-users.sql"
+    CONST_HEADER_REQUIRES = "requires"
+)
+
+// migration of a component which another migration needs, component is empty for the migrations folder itself
+type requiredMigration struct {
+    component string
+    fileName  string
+}
+
+// describe for messages, e.g. core/20240101120000-add-users.sql
+func (required requiredMigration) String() string {
+    if len(required.component) == 0 {
+        return required.fileName
+    }
+
+    return required.component + "/" + required.fileName
+}
+
+// get tracking table of the required migration's component
+func (required requiredMigration) getTrackingTableName() string {
+    if len(required.component) == 0 {
+        return CONST_POSTGRESQL_TABLE_NAME
+    }
+
+    return CONST_POSTGRESQL_TABLE_NAME + "_" + required.component
+}
+
+// parse comma separated list of component/file, a file without component is in the migrations folder itself
+func parseRequiredMigrations(requires string) ([]requiredMigration, error) {
+    var requiredMigrations []requiredMigration
+    for _, reference := range strings.Split(requires, ",") {
+        reference = strings.TrimSpace(reference)
+        if len(reference) == 0 {
+            continue
+        }
+
+        required := requiredMigration{fileName: reference}
+        if parts := strings.SplitN(reference, "/", 2); len(parts) == 2 {
+            required = requiredMigration{component: parts[0], fileName: parts[1]}
+            if !regexpComponentName.MatchString(required.component) {
+                return nil, fmt.Errorf("invalid component in '%s: %s'", CONST_HEADER_REQUIRES, reference)
+            }
+        }
+
+        requiredMigrations = append(requiredMigrations, required)
+    }
+
+    return requiredMigrations, nil
+}
+
+// check that required migrations exist, for validate
+func checkMigrationRequirements(rawMigrationForward string) error {
+    requires, ok := parseHeaderFields(rawMigrationForward)[CONST_HEADER_REQUIRES]
+    if !ok {
+        return nil
+    }
+
+    requiredMigrations, err := parseRequiredMigrations(requires)
+    if err != nil {
+        return err
+    }
+
+    // the migration file system, e.g. migrations embedded into the binary
+    for _, required := range requiredMigrations {
+        _, err := fs.Stat(migrationFileSystem, path.Join(CONST_MIGRATIONS_FOLDER, required.component, required.fileName))
+        if err != nil {
+            return fmt.Errorf("required migration %s does not exist", required)
+        }
+    }
+
+    return nil
+}
+
+// check if required migration has been applied, before this run for other components
+func isRequiredMigrationApplied(required requiredMigration) bool {
+    // an error would abort the transaction of --rollback-at-end, so check for the table first
+    var exists bool
+    err := postgreSQLConnection.QueryRow(context.Background(), "SELECT to_regclass($1) IS NOT NULL", required.getTrackingTableName()).Scan(&exists)
+    if err != nil {
+        logError("Error: Could not check for table %s", required.getTrackingTableName())
+        panic(err)
+    }
+    if !exists {
+        return false
+    }
+
+    var applied bool
+    err = postgreSQLConnection.QueryRow(context.Background(),
+        fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE filename = $1)", required.getTrackingTableName()), required.fileName).Scan(&applied)
+    if err != nil {
+        logError("Error: Could not read table %s", required.getTrackingTableName())
+        panic(err)
+    }
+
+    return applied
+}
+
+// fail before anything is applied if pending migrations require migrations of other components which have not been applied,
+// migrations of the own component only need to come first
+func checkRequiredMigrations(pendingMigrations []string) {
+    currentComponent := *flagComponent
+    pendingPositions := make(map[string]int)
+    for index, fileName := range pendingMigrations {
+        pendingPositions[fileName] = index
+    }
+
+    failures := 0
+    for index, fileName := range pendingMigrations {
+        requiredMigrations, err := parseRequiredMigrations(readMigrationHeaderFromFile(fileName)[CONST_HEADER_REQUIRES])
+        if err != nil {
+            logError("Error: %s in file %s", err, fileName)
+            failures++
+            continue
+        }
+
+        for _, required := range requiredMigrations {
+            if required.component == currentComponent {
+                if position, ok := pendingPositions[required.fileName]; ok && position > index {
+                    logError("Error: Migration %s requires %s, which comes after it", fileName, required)
+                    failures++
+                }
+                continue
+            }
+
+            if !isRequiredMigrationApplied(required) {
+                logError("Error: Migration %s requires %s, which has not been applied", fileName, required)
+                if len(required.component) == 0 {
+                    logError("Hint: Run 'up' without --component first")
+                } else {
+                    logError("Hint: Run 'up --component %s' first", required.component)
+                }
+                failures++
+            }
+        }
+    }
+
+    if failures > 0 {
+        logError("Hint: Nothing has been applied")
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+    "errors"
+    "net/url"
+
+    "github.com/jackc/pgconn"
+)
+
+const (
+    CONST_ENV_VAR_MAINTENANCE_USER       = "MIGRATE_MAINTENANCE_USER"
+    CONST_ENV_VAR_MAINTENANCE_PASSWORD   = "MIGRATE_MAINTENANCE_PASSWORD"
+    CONST_ENV_VAR_MAINTENANCE_PARAMETERS = "MIGRATE_MAINTENANCE_PARAMETERS"
+
+    // too_many_connections, also for "remaining connection slots are reserved"
+    CONST_SQLSTATE_TOO_MANY_CONNECTIONS = "53300"
+)
+
+var flagMaintenanceUser = commandLineFlags.String("maintenance-user", "", "role which may use reserved connection slots (superuser, or pg_use_reserved_connections since PostgreSQL 16), used when the connection limit is reached")
+var flagMaintenancePassword = commandLineFlags.String("maintenance-password", "", "password of --maintenance-user (prefer "+CONST_ENV_VAR_MAINTENANCE_PASSWORD+")")
+var flagMaintenanceParameters = commandLineFlags.String("maintenance-parameters", "", "additional connection parameters of the maintenance connection, e.g. options=-c statement_timeout=0")
+var flagMaintenanceConnection = commandLineFlags.Bool("maintenance-connection", false, "always connect with the maintenance settings, not only when the connection limit is reached")
+
+// check if a maintenance connection has been configured
+func isMaintenanceConnectionConfigured() bool {
+    return len(getConfigValue("maintenance-user")) > 0 || len(getConfigValue("maintenance-parameters")) > 0
+}
+
+// connection string with maintenance user, password and parameters instead of the configured ones
+func getMaintenanceConnectionString(connectionString string) string {
+    settings := parseConnectionString(connectionString)
+
+    if user := getConfigValue("maintenance-user"); len(user) > 0 {
+        settings["user"] = user
+        settings["password"] = getConfigValue("maintenance-password")
+    }
+
+    // maintenance parameters win, e.g. options of the application role are not wanted in an incident
+    parameters, _ := url.ParseQuery(settings["parameters"])
+    maintenanceParameters, err := url.ParseQuery(getConfigValue("maintenance-parameters"))
+    if err != nil {
+        logError("Error: Invalid maintenance-parameters %s", getConfigValue("maintenance-parameters"))
+        panic(err)
+    }
+    for key, values := range maintenanceParameters {
+        parameters[key] = values
+    }
+
+    port := settings["port"]
+    if len(port) == 0 {
+        port = DEFAULT_PORT
+    }
+
+    return buildConnectionString(settings["host"], port, settings["user"], settings["password"],
+        settings["database"], parameters.Encode())
+}
+
+// check if connecting failed because all connection slots are taken
+func isTooManyConnectionsError(err error) bool {
+    var pgError *pgconn.PgError
+    return errors.As(err, &pgError) && pgError.Code == CONST_SQLSTATE_TOO_MANY_CONNECTIONS
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+var flagBatch = commandLineFlags.Int("batch", 0, "for 'generate rollback': roll back the N most recently applied migrations")
+
+// applied migrations to roll back for 'generate rollback', newest first, with the names of their local files
+func getMigrationsToRollBack(migrationsInDatabase []string) ([]migrate.AppliedMigration, []string) {
+    appliedMigrations := getAppliedMigrations()
+
+    count := *flagBatch
+    if len(*flagSince) > 0 {
+        count = -1
+        for index, fileName := range migrationsInDatabase {
+            if fileName == *flagSince || appliedMigrations[index].FileName == *flagSince {
+                count = len(migrationsInDatabase) - index - 1
+            }
+        }
+        if count < 0 {
+            logError("Error: --since %s is not an applied migration", *flagSince)
+            os.Exit(1)
+        }
+    }
+
+    if count <= 0 || count > len(migrationsInDatabase) {
+        logError("Error: Nothing to roll back, use --batch N (at most %d) or --since migration", len(migrationsInDatabase))
+        os.Exit(1)
+    }
+
+    // the last remaining row tells how many migrations have been archived
+    prunedCount := getPrunedMigrationCount()
+    if prunedCount > 0 && len(migrationsInDatabase)-count <= prunedCount {
+        logError("Error: Cannot roll back %d migrations, older migrations have been archived by 'prune-history'", count)
+        os.Exit(1)
+    }
+
+    var migrations []migrate.AppliedMigration
+    var fileNames []string
+    for index := len(migrationsInDatabase) - 1; index >= len(migrationsInDatabase)-count; index-- {
+        migrations = append(migrations, appliedMigrations[index])
+        fileNames = append(fileNames, migrationsInDatabase[index])
+    }
+
+    return migrations, fileNames
+}
+
+// sql which reverts one migration and removes it from the tracking table, if it is still the most recent one
+func getRollbackScriptForMigration(migration migrate.AppliedMigration, fileName string) string {
+    var script strings.Builder
+
+    fmt.Fprintf(&script, "-- %s\n", fileName)
+
+    guard := fmt.Sprintf(`DO $$
+BEGIN
+    IF (SELECT filename FROM %[1]s ORDER BY position DESC LIMIT 1) IS DISTINCT FROM %[2]s THEN
+        RAISE EXCEPTION 'most recent migration in %[1]s is not %[3]s';
+    END IF;
+END $$;
+`, trackingTableName, quoteSQLLiteral(migration.FileName), strings.ReplaceAll(migration.FileName, "'", "''"))
+
+    deleteTracking := fmt.Sprintf("DELETE FROM %s WHERE id = %d AND filename = %s;\n",
+        trackingTableName, migration.ID, quoteSQLLiteral(migration.FileName))
+
+    // skipped by tag: it has never run, so there is nothing to undo
+    if len(migration.SkippedBy) > 0 {
+        fmt.Fprintf(&script, "-- skipped by %s, only its tracking row is removed\n", migration.SkippedBy)
+        fmt.Fprintf(&script, "BEGIN;\n%s%sCOMMIT;\n", guard, deleteTracking)
+        return script.String()
+    }
+
+    _, sqlMigrationBackward := readMigrationFromFile(fileName)
+    _, annotationsBackward := readMigrationAnnotationsFromFile(fileName)
+
+    // like 'down': statements which cannot run in a transaction block run one by one before it
+    if hasAnnotation(annotationsBackward, CONST_ANNOTATION_NO_TRANSACTION) {
+        fmt.Fprintf(&script, "-- %s: runs outside of a transaction\n%s", CONST_ANNOTATION_NO_TRANSACTION, guard)
+        for _, statement := range splitSQLStatements(sqlMigrationBackward) {
+            fmt.Fprintf(&script, "%s\n", terminateStatement(statement))
+        }
+        fmt.Fprintf(&script, "BEGIN;\n%sCOMMIT;\n", deleteTracking)
+        return script.String()
+    }
+
+    fmt.Fprintf(&script, "BEGIN;\n%s", guard)
+    if len(sqlMigrationBackward) > 0 {
+        fmt.Fprintf(&script, "%s\n", terminateStatement(sqlMigrationBackward))
+    }
+    fmt.Fprintf(&script, "%sCOMMIT;\n", deleteTracking)
+
+    return script.String()
+}
+
+// print one psql script with the down parts of the last migrations and the tracking table deletes,
+// for DBAs who review rollbacks and run them by hand
+func cmd_generate_rollback() {
+    _, migrationsInDatabase := checkConsistencyOfDatabaseAndLocalFileSystem()
+    migrations, fileNames := getMigrationsToRollBack(migrationsInDatabase)
+
+    // down migrations are rarely run before they are needed
+    for _, fileName := range fileNames {
+        checkDownMigrationVerified(fileName)
+    }
+
+    fmt.Printf("-- rollback of %d migration(s), newest first, generated at %s by %s %s\n",
+        len(migrations), time.Now().UTC().Format(time.RFC3339), CONST_TOOL_NAME, getVersion())
+    fmt.Printf("-- run with: psql --file rollback.sql (each migration commits on its own, the script stops at the first error)\n")
+    fmt.Printf("\\set ON_ERROR_STOP on\n")
+    if len(*flagSchema) > 0 {
+        fmt.Printf("SET search_path TO %s;\n", getSchemaSearchPath(*flagSchema))
+    }
+
+    for index, migration := range migrations {
+        fmt.Printf("\n%s", getRollbackScriptForMigration(migration, fileNames[index]))
+    }
+
+    os.Exit(0)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+    "strings"
+    "testing"
+    "testing/fstest"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+func TestGetRollbackScriptForMigration(t *testing.T) {
+    tests := []struct {
+        name     string
+        down     string
+        expected []string
+    }{
+        {
+            name:     "last statement without semicolon",
+            down:     "DROP TABLE b;\nDROP TABLE a",
+            expected: []string{"DROP TABLE b;\nDROP TABLE a\n;\nDELETE FROM"},
+        },
+        {
+            name:     "comment after the last statement",
+            down:     "DROP TABLE a; -- gone for good",
+            expected: []string{"DROP TABLE a; -- gone for good\nDELETE FROM"},
+        },
+        {
+            name:     "comment after the last statement without semicolon",
+            down:     "DROP TABLE a -- gone for good",
+            expected: []string{"DROP TABLE a -- gone for good\n;\nDELETE FROM"},
+        },
+        {
+            name: "without transaction",
+            down: "-- migrate:no-transaction\nDROP INDEX CONCURRENTLY a_b;\nDROP INDEX CONCURRENTLY a_c -- last one",
+            expected: []string{
+                "DROP INDEX CONCURRENTLY a_b;\n",
+                "DROP INDEX CONCURRENTLY a_c -- last one\n;\nBEGIN;\nDELETE FROM",
+            },
+        },
+    }
+
+    originalFileSystem, originalFolder := migrationFileSystem, migrationsFolder
+    defer func() {
+        migrationFileSystem, migrationsFolder = originalFileSystem, originalFolder
+    }()
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            fileName := "20240101120000-a.sql"
+            migrationsFolder = "migrations"
+            migrationFileSystem = fstest.MapFS{
+                "migrations/" + fileName: {Data: []byte("CREATE TABLE a (id int);\nCREATE TABLE b (id int);\n" + migrate.UndoMarker + test.down + "\n")},
+            }
+
+            script := getRollbackScriptForMigration(migrate.AppliedMigration{ID: 3, FileName: fileName}, fileName)
+            for _, expected := range test.expected {
+                if !strings.Contains(script, expected) {
+                    t.Errorf("got script\n%s\nwant it to contain %q", script, expected)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "strconv"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    // number (bigint key) or text (key is hashtext of it), e.g. shared with other tools which must not run during migrations
+    CONST_ENV_VAR_LOCK_KEY = "MIGRATE_LOCK_KEY"
+)
+
+var flagLockKey = commandLineFlags.String("lock-key", "", "advisory lock held by 'up' and 'down', a number or a text (default: per tracking table and schema)")
+var flagNoWait = commandLineFlags.Bool("no-wait", false, "fail instead of waiting while another process applies migrations")
+
+// key of the advisory lock held while 'up' or 'down' runs
+func getRunLockKey() int64 {
+    lockKey := getConfigValue("lock-key")
+    if len(lockKey) == 0 {
+        // the Go library uses the same lock, schemas of 'up --schemas' are migrated in parallel
+        lockKey = migrate.LockName(trackingTableName)
+        if len(*flagSchema) > 0 {
+            lockKey = migrate.LockName(trackingTableName + "." + *flagSchema)
+        }
+    }
+
+    if key, err := strconv.ParseInt(lockKey, 10, 64); err == nil {
+        return key
+    }
+
+    var key int64
+    err := postgreSQLConnection.QueryRow(context.Background(), "SELECT hashtext($1)::bigint", lockKey).Scan(&key)
+    if err != nil {
+        logError("Error: Could not compute key of advisory lock %s", lockKey)
+        panic(err)
+    }
+
+    return key
+}
+
+// take the advisory lock so only one process applies migrations at a time, e.g. replicas of a service starting at once;
+// returns a function which releases it, exiting without calling it releases it as well (with the connection)
+func lockRun() func() {
+    connectToStoredDatabaseConnection()
+    key := getRunLockKey()
+
+    var locked bool
+    err := postgreSQLConnection.QueryRow(context.Background(), "SELECT pg_try_advisory_lock($1)", key).Scan(&locked)
+    if err != nil {
+        logError("Error: Could not take advisory lock %d", key)
+        panic(err)
+    }
+
+    if !locked {
+        // the holder: pg_locks splits bigint keys into classid (high) and objid (low 32 bits)
+        holder := "unknown"
+        var pid int
+        err := postgreSQLConnection.QueryRow(context.Background(),
+            "SELECT pid FROM pg_locks WHERE locktype = 'advisory' AND granted AND objsubid = 1 "+
+                "AND database = (SELECT oid FROM pg_database WHERE datname = current_database()) "+
+                "AND ((classid::bigint << 32) | objid::bigint) = $1 LIMIT 1", key).Scan(&pid)
+        if err == nil {
+            holder = fmt.Sprintf("pid %d", pid)
+        }
+
+        if *flagNoWait {
+            logError("Error: Another process (%s) is applying migrations, advisory lock %d is held", holder, key)
+            logError("Hint: Run again when it has finished, or without --no-wait to wait for it")
+            os.Exit(1)
+        }
+
+        logError("Waiting for another process (%s) which is applying migrations (advisory lock %d)...", holder, key)
+        _, err = postgreSQLConnection.Exec(context.Background(), "SELECT pg_advisory_lock($1)", key)
+        if err != nil {
+            logError("Error: Could not take advisory lock %d", key)
+            panic(err)
+        }
+    }
+
+    return func() {
+        _, err := postgreSQLConnection.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+        if err != nil {
+            logError("Warning: Could not release advisory lock %d: %v", key, err)
+        }
+    }
+}
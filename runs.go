@@ -0,0 +1,223 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "os/user"
+    "text/tabwriter"
+    "time"
+)
+
+const (
+    // backend of every running 'up', 'down' and 'ci', so 'cancel' can find it from another terminal
+    CONST_POSTGRESQL_RUNS_TABLE_SCHEMA = "CREATE TABLE IF NOT EXISTS %s (backend_pid integer PRIMARY KEY, backend_start timestamp with time zone NOT NULL, command text NOT NULL, host_name text NOT NULL, started_at timestamp with time zone NOT NULL DEFAULT NOW(), user_name text NOT NULL DEFAULT '', current_file text NOT NULL DEFAULT '')"
+
+    // for runs tables created before user_name and current_file existed
+    CONST_POSTGRESQL_RUNS_TABLE_UPGRADE = "ALTER TABLE %s ADD COLUMN IF NOT EXISTS user_name text NOT NULL DEFAULT '', ADD COLUMN IF NOT EXISTS current_file text NOT NULL DEFAULT ''"
+
+    CONST_POSTGRESQL_RECORD_RUN = `
+    INSERT INTO %s (backend_pid, backend_start, command, host_name, user_name)
+    SELECT pid, backend_start, $1, $2, $3 FROM pg_stat_activity WHERE pid = pg_backend_pid()
+    ON CONFLICT (backend_pid) DO UPDATE
+    SET backend_start = EXCLUDED.backend_start, command = EXCLUDED.command, host_name = EXCLUDED.host_name,
+        user_name = EXCLUDED.user_name, current_file = '', started_at = NOW()`
+
+    CONST_POSTGRESQL_RECORD_RUN_FILE = "UPDATE %s SET current_file = $2 WHERE backend_pid = $1"
+
+    // runs end with their connection, a reused pid has another backend_start
+    CONST_POSTGRESQL_DELETE_FINISHED_RUNS = `
+    DELETE FROM %s runs
+    WHERE NOT EXISTS (SELECT 1 FROM pg_stat_activity a WHERE a.pid = runs.backend_pid AND a.backend_start = runs.backend_start)`
+
+    CONST_POSTGRESQL_SELECT_RUNNING = `
+    SELECT runs.backend_pid, runs.command, runs.host_name, runs.user_name, runs.started_at, runs.current_file,
+        COALESCE(a.application_name, ''), COALESCE(a.state, ''), COALESCE(a.wait_event_type, '')
+    FROM %s runs
+    JOIN pg_stat_activity a ON a.pid = runs.backend_pid AND a.backend_start = runs.backend_start
+    ORDER BY runs.started_at`
+)
+
+// get runs table of the tracking table (of the component)
+func getRunsTableName() string {
+    return trackingTableName + "_runs"
+}
+
+// set once this run has been recorded
+var runRecorded bool
+
+// run found by 'cancel' and 'status'
+type runningMigration struct {
+    backendPID      int32
+    command         string
+    hostName        string
+    userName        string
+    startedAt       time.Time
+    currentFile     string
+    applicationName string
+    state           string
+    waitEventType   string
+}
+
+// create runs table and forget runs which have ended
+func prepareRunsTable() {
+    connectToStoredDatabaseConnection()
+
+    _, err := postgreSQLConnection.Exec(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_RUNS_TABLE_SCHEMA, getRunsTableName()))
+    if err != nil {
+        logError("Error: Failed to create table %s", getRunsTableName())
+        panic(err)
+    }
+
+    _, err = postgreSQLConnection.Exec(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_RUNS_TABLE_UPGRADE, getRunsTableName()))
+    if err != nil {
+        logError("Error: Failed to upgrade table %s", getRunsTableName())
+        panic(err)
+    }
+
+    _, err = postgreSQLConnection.Exec(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_DELETE_FINISHED_RUNS, getRunsTableName()))
+    if err != nil {
+        logError("Error: Failed to clean up table %s", getRunsTableName())
+        panic(err)
+    }
+}
+
+// record backend of this run before any migration starts
+// (not for connections managed by the caller, they may be inside a transaction)
+func recordRun() {
+    if postgreSQLBackendPID == 0 {
+        return
+    }
+
+    prepareRunsTable()
+
+    hostName, _ := os.Hostname()
+    userName := ""
+    if currentUser, err := user.Current(); err == nil {
+        userName = currentUser.Username
+    }
+
+    _, err := postgreSQLConnection.Exec(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_RECORD_RUN, getRunsTableName()), currentCommand, hostName, userName)
+    if err != nil {
+        logError("Error: Failed to record run in table %s", getRunsTableName())
+        panic(err)
+    }
+
+    runRecorded = true
+}
+
+// record file this run is applying, for 'status' (before its transaction starts, so others see it)
+func recordRunFile(fileName string) {
+    if !runRecorded {
+        return
+    }
+
+    _, err := postgreSQLConnection.Exec(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_RECORD_RUN_FILE, getRunsTableName()), int32(postgreSQLBackendPID), fileName)
+    if err != nil {
+        logError("Error: Failed to record current file in table %s", getRunsTableName())
+        panic(err)
+    }
+}
+
+// describe run for humans, e.g. "migration in progress by deploy-runner-3 since 12:04, applying 2024...-add-index.sql"
+func describeRun(run runningMigration) string {
+    description := fmt.Sprintf("migration in progress by %s", run.hostName)
+    if len(run.userName) > 0 {
+        description += fmt.Sprintf(" (user %s, pid %d)", run.userName, run.backendPID)
+    } else {
+        description += fmt.Sprintf(" (pid %d)", run.backendPID)
+    }
+    description += fmt.Sprintf(" since %s", run.startedAt.Local().Format("15:04"))
+
+    if len(run.currentFile) > 0 {
+        description += ", applying " + run.currentFile
+    } else {
+        description += ", running '" + run.command + "'"
+    }
+
+    return description
+}
+
+// get runs whose backend is still connected
+func getRunningMigrations() []runningMigration {
+    rows, err := postgreSQLConnection.Query(context.Background(),
+        fmt.Sprintf(CONST_POSTGRESQL_SELECT_RUNNING, getRunsTableName()))
+    if err != nil {
+        logError("Error: Failed to read running migrations from table %s", getRunsTableName())
+        panic(err)
+    }
+    defer rows.Close()
+
+    var runs []runningMigration
+    for rows.Next() {
+        var run runningMigration
+        err = rows.Scan(&run.backendPID, &run.command, &run.hostName, &run.userName, &run.startedAt, &run.currentFile,
+            &run.applicationName, &run.state, &run.waitEventType)
+        if err != nil {
+            logError("Error: Failed to read running migrations from table %s: unable to scan row", getRunsTableName())
+            panic(err)
+        }
+
+        runs = append(runs, run)
+    }
+
+    err = rows.Err()
+    if err != nil {
+        logError("Error: Failed to read running migrations from table %s: row error", getRunsTableName())
+        panic(err)
+    }
+
+    return runs
+}
+
+// cancel the statement currently executed by running migrations, from another terminal
+func cmd_cancel() {
+    prepareRunsTable()
+
+    runs := getRunningMigrations()
+    if len(runs) == 0 {
+        fmt.Println("No migration is running.")
+        os.Exit(0)
+    }
+
+    writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(writer, "PID\tCOMMAND\tHOST\tRUNNING FOR\tSTATE\tAPPLICATION NAME")
+    for _, run := range runs {
+        state := run.state
+        if run.waitEventType == "Lock" {
+            state += " (waiting for lock)"
+        }
+
+        fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\n", run.backendPID, run.command, run.hostName,
+            time.Since(run.startedAt).Round(time.Second), state, run.applicationName)
+    }
+    writer.Flush()
+
+    if !confirm("Cancel the statements these runs are executing? Their current migration is rolled back.") {
+        logError("Error: Aborted, nothing has been cancelled")
+        os.Exit(1)
+    }
+
+    for _, run := range runs {
+        var cancelled bool
+        err := postgreSQLConnection.QueryRow(context.Background(), "SELECT pg_cancel_backend($1)", run.backendPID).Scan(&cancelled)
+        if err != nil {
+            logError("Error: Failed to cancel pid %d", run.backendPID)
+            logError("Hint: Only superusers and members of the role running the migration may cancel it")
+            panic(err)
+        }
+
+        if cancelled {
+            fmt.Printf("cancelled: pid %d (%s on %s)\n", run.backendPID, run.command, run.hostName)
+        } else {
+            logError("Warning: pid %d has already ended", run.backendPID)
+        }
+    }
+
+    os.Exit(0)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "strings"
+)
+
+const (
+    CONST_ENV_VAR_SCHEMA_EXPORT        = "MIGRATE_SCHEMA_EXPORT"
+    CONST_ENV_VAR_SCHEMA_EXPORT_FORMAT = "MIGRATE_SCHEMA_EXPORT_FORMAT"
+
+    // plain DDL which sqlc (and other code generators reading schema files) can parse
+    CONST_SCHEMA_FORMAT_SQLC = "sqlc"
+    // schema-only pg_dump as is
+    CONST_SCHEMA_FORMAT_SQL = "sql"
+)
+
+var flagSchemaExport = commandLineFlags.String("schema-export", "", "write the schema to this file after 'up' applied migrations, e.g. for sqlc")
+var flagSchemaExportFormat = commandLineFlags.String("schema-export-format", "", "format of --schema-export: 'sqlc' (plain DDL, default) or 'sql' (pg_dump as is)")
+var flagFor = commandLineFlags.String("for", "", "for 'export-schema': format 'sqlc' or 'sql', overrides schema-export-format")
+
+// schema-only pg_dump of the database, without the tables of this tool
+func dumpSchema() []byte {
+    var output bytes.Buffer
+    connectionString, _ := getDatabaseConnectionString()
+
+    // tracking tables of all components and schemas, runs, freeze, approvals, ...
+    dump := exec.Command("pg_dump", "--schema-only", "--no-owner", "--no-privileges",
+        "--exclude-table=*."+CONST_POSTGRESQL_TABLE_NAME+"*",
+        "--dbname="+connectionString)
+    dump.Stdout = &output
+    dump.Stderr = os.Stderr
+
+    err := dump.Run()
+    if err != nil {
+        logError("Error: pg_dump of the schema failed")
+        logError("Hint: Exporting the schema needs pg_dump in PATH which can reach the database directly (no ssh-host or proxy)")
+        panic(err)
+    }
+
+    return output.Bytes()
+}
+
+// keep only DDL: no SET statements, psql meta-commands or comments, which schema parsers of code generators reject
+func cleanSchemaForCodeGeneration(schema []byte) []byte {
+    var output bytes.Buffer
+    previousLineEmpty := true
+
+    scanner := bufio.NewScanner(bytes.NewReader(schema))
+    scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+    for scanner.Scan() {
+        line := scanner.Text()
+
+        if strings.HasPrefix(line, "SET ") || strings.HasPrefix(line, "SELECT pg_catalog.set_config(") ||
+            strings.HasPrefix(line, "--") || strings.HasPrefix(line, "\\") {
+            continue
+        }
+
+        // collapse the gaps left by removed lines
+        lineEmpty := len(strings.TrimSpace(line)) == 0
+        if lineEmpty && previousLineEmpty {
+            continue
+        }
+        previousLineEmpty = lineEmpty
+
+        output.WriteString(line + "\n")
+    }
+    if err := scanner.Err(); err != nil {
+        panic(err)
+    }
+
+    return output.Bytes()
+}
+
+// schema of the database in the given format
+func exportSchema(format string) []byte {
+    switch format {
+    case CONST_SCHEMA_FORMAT_SQLC:
+        return cleanSchemaForCodeGeneration(dumpSchema())
+    case CONST_SCHEMA_FORMAT_SQL:
+        return dumpSchema()
+    }
+
+    logError("Error: Unknown schema format: %s", format)
+    logError("Hint: Use --for %s or --for %s", CONST_SCHEMA_FORMAT_SQLC, CONST_SCHEMA_FORMAT_SQL)
+    os.Exit(1)
+    return nil
+}
+
+// format of the schema export, 'export-schema --for' wins over the setting
+func getSchemaExportFormat() string {
+    if len(*flagFor) > 0 {
+        return *flagFor
+    }
+
+    return getConfigValue("schema-export-format")
+}
+
+// write schema to file, so code generators read the schema of the applied migrations
+func writeSchemaExport(filePath string) {
+    err := ioutil.WriteFile(filePath, exportSchema(getSchemaExportFormat()), 0644)
+    if err != nil {
+        logError("Error: Could not write schema to %s", filePath)
+        panic(err)
+    }
+
+    fmt.Printf("schema written to: %s\n", filePath)
+}
+
+// after 'up': refresh the schema export if one is configured
+func refreshSchemaExport() {
+    filePath := getConfigValue("schema-export")
+    if len(filePath) > 0 {
+        writeSchemaExport(filePath)
+    }
+}
+
+// write schema of the database to the configured file, or STDOUT
+func cmd_export_schema() {
+    filePath := getConfigValue("schema-export")
+    if len(filePath) == 0 {
+        os.Stdout.Write(exportSchema(getSchemaExportFormat()))
+        os.Exit(0)
+    }
+
+    writeSchemaExport(filePath)
+    os.Exit(0)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    CONST_ENV_VAR_SCHEMA_SIGNAL_TABLE   = "MIGRATE_SCHEMA_SIGNAL_TABLE"
+    CONST_ENV_VAR_SCHEMA_NOTIFY_CHANNEL = "MIGRATE_SCHEMA_NOTIFY_CHANNEL"
+
+    // type of the Debezium signal, 'log' makes the connector log the message
+    CONST_SCHEMA_SIGNAL_TYPE = "log"
+)
+
+var flagSchemaSignalTable = commandLineFlags.String("schema-signal-table", "", "insert a signal row (id, type, data) into this table after each migration, e.g. the Debezium signal table")
+var flagSchemaNotifyChannel = commandLineFlags.String("schema-notify-channel", "", "pg_notify this channel after each migration")
+
+// data of the signal, tells downstream consumers which migration changed the schema
+type schemaChangeSignal struct {
+    Message   string `json:"message"`
+    FileName  string `json:"file_name"`
+    Direction string `json:"direction"`
+}
+
+// signal schema change inside the migration transaction, so consumers only learn about committed migrations
+// and see the signal in the change stream right after the new schema
+func signalSchemaChange(tx pgx.Tx, fileName string, forward bool) {
+    signalTable := getConfigValue("schema-signal-table")
+    notifyChannel := getConfigValue("schema-notify-channel")
+    if len(signalTable) == 0 && len(notifyChannel) == 0 {
+        return
+    }
+
+    signal := schemaChangeSignal{FileName: fileName, Direction: "up"}
+    if !forward {
+        signal.Direction = "down"
+    }
+    signal.Message = fmt.Sprintf("schema migration %s %s", signal.Direction, fileName)
+
+    data, err := json.Marshal(signal)
+    if err != nil {
+        logError("Error: Could not encode schema change signal")
+        panic(err)
+    }
+
+    if len(signalTable) > 0 {
+        // the table name is configured by the operator, like the connection itself
+        _, err = tx.Exec(context.Background(), "INSERT INTO "+signalTable+" (id, type, data) VALUES ($1, $2, $3)",
+            fmt.Sprintf("migrate-%d", time.Now().UnixNano()), CONST_SCHEMA_SIGNAL_TYPE, string(data))
+        if err != nil {
+            logError("Error: Could not insert schema change signal into %s", signalTable)
+            logError("Hint: The signal table needs the columns id, type and data, like the Debezium signal table")
+            panic(err)
+        }
+    }
+
+    if len(notifyChannel) > 0 {
+        _, err = tx.Exec(context.Background(), "SELECT pg_notify($1, $2)", notifyChannel, string(data))
+        if err != nil {
+            logError("Error: Could not notify channel %s about schema change", notifyChannel)
+            panic(err)
+        }
+    }
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    CONST_SCRIPT_HEADER = `--
+-- migration script generated by go-simple-postgresql-migrate
+-- created: %s
+--
+-- Run with: psql -f <this file> (psql 10 or newer)
+-- Each migration is committed on its own. Migrations which are in the tracking table already
+-- are left out, so the script can be re-run after a failure.
+--
+
+\set ON_ERROR_STOP on
+
+%s;
+`
+)
+
+var flagToScript = commandLineFlags.String("to-script", "", "write 'up' as SQL script to this file ('-' for STDOUT) instead of executing it")
+var flagAfter = commandLineFlags.String("after", "", "for --to-script: only include migrations after this (already applied) migration")
+
+// get migrations for script, optionally only those after given migration
+func getMigrationsForScript(afterFileName string) []string {
+    migrationsInFileSystem := getMigrationsFromFileSystem()
+    if len(afterFileName) == 0 {
+        return migrationsInFileSystem
+    }
+
+    for index, fileName := range migrationsInFileSystem {
+        if fileName == afterFileName {
+            return migrationsInFileSystem[index+1:]
+        }
+    }
+
+    logError("Error: Migration %s given with --after does not exist in %s", afterFileName, migrationsFolder)
+    os.Exit(1)
+    return nil
+}
+
+// render forward migration and tracking table INSERT as SQL script block
+func renderForwardMigrationScript(fileName string) string {
+    sqlMigrationForward, _ := readMigrationFromFile(fileName)
+    annotationsForward, _ := readMigrationAnnotationsFromFile(fileName)
+    settings := getForwardMigrationSettings(fileName)
+
+    // like 'up' records them, so destroy --drop-objects finds them by oid after renames:
+    // those its statements name which did not exist before, in a psql variable meanwhile
+    existingObjects := fmt.Sprintf("SELECT (%s) AS migrate_existing_objects \\gset", migrate.CreatedObjectsSQL(sqlMigrationForward, "''"))
+    record := fmt.Sprintf(CONST_POSTGRESQL_INSERT_MIGRATION+";", trackingTableName, quoteSQLLiteral(fileName), "NULL",
+        quoteSQLLiteral(getMigrationFileChecksum(fileName)))
+    record += fmt.Sprintf("\nUPDATE %s SET created_objects = (%s) WHERE filename = %s;", trackingTableName,
+        migrate.CreatedObjectsSQL(sqlMigrationForward, ":'migrate_existing_objects'"), quoteSQLLiteral(fileName))
+
+    var script strings.Builder
+    fmt.Fprintf(&script, "\n--\n-- forward migration: %s\n--\n", fileName)
+
+    // statements of migrations without transaction would run again before the INSERT fails
+    fmt.Fprintf(&script, "SELECT NOT EXISTS (SELECT 1 FROM %s WHERE filename = %s) AS migrate_pending \\gset\n\\if :migrate_pending\n",
+        trackingTableName, quoteSQLLiteral(fileName))
+
+    // same settings as 'up' applies: for the session and RESET afterwards without transaction, SET LOCAL otherwise
+    if hasAnnotation(annotationsForward, CONST_ANNOTATION_NO_TRANSACTION) {
+        for _, setting := range settings {
+            fmt.Fprintf(&script, "SET %s = %s;\n", setting.Name, quoteSQLLiteral(setting.Value))
+        }
+        fmt.Fprintf(&script, "%s\n", existingObjects)
+        for _, statement := range splitSQLStatements(sqlMigrationForward) {
+            fmt.Fprintf(&script, "%s\n", terminateStatement(statement))
+        }
+        for _, setting := range settings {
+            fmt.Fprintf(&script, "RESET %s;\n", setting.Name)
+        }
+        fmt.Fprintf(&script, "BEGIN;\n%s\nCOMMIT;\n", record)
+    } else {
+        script.WriteString("BEGIN;\n")
+        for _, setting := range settings {
+            fmt.Fprintf(&script, "SET LOCAL %s = %s;\n", setting.Name, quoteSQLLiteral(setting.Value))
+        }
+        fmt.Fprintf(&script, "%s\n%s\n%s\nCOMMIT;\n", existingObjects, terminateStatement(sqlMigrationForward), record)
+    }
+
+    fmt.Fprintf(&script, "\\else\n\\echo %s has been applied already\n\\endif\n", fileName)
+
+    return script.String()
+}
+
+// make sure statement ends with a semicolon, which a trailing comment would swallow otherwise
+func terminateStatement(statement string) string {
+    statement = strings.TrimSpace(statement)
+
+    // data of COPY ... FROM stdin ends with \. instead
+    if strings.HasSuffix(statement, "\n\\.") {
+        return statement
+    }
+
+    // tokens are without comments
+    tokens := migrate.Tokenize(statement)
+    if len(tokens) > 0 && tokens[len(tokens)-1].Is(";") {
+        return statement
+    }
+
+    return statement + "\n;"
+}
+
+// write forward migrations as SQL script instead of executing them
+func cmd_up_to_script(scriptFilePath string) {
+    if isTagSelectionActive() {
+        logError("Error: --skip-tag and --only-tag cannot be used together with --to-script")
+        os.Exit(1)
+    }
+
+    migrations := getMigrationsForScript(*flagAfter)
+
+    if len(migrations) == 0 {
+        logError("Error: No migrations to write into script")
+        os.Exit(1)
+    }
+
+    var script strings.Builder
+    fmt.Fprintf(&script, CONST_SCRIPT_HEADER,
+        time.Now().UTC().Format(time.RFC850),
+        fmt.Sprintf(CONST_POSTGRESQL_TABLE_SCHEMA, trackingTableName))
+
+    // tracking table might have been created by an older version
+    for _, statement := range getTrackingTableUpgradeStatements() {
+        fmt.Fprintf(&script, "%s;\n", statement)
+    }
+
+    for _, fileName := range migrations {
+        script.WriteString(renderForwardMigrationScript(fileName))
+    }
+
+    if scriptFilePath == "-" {
+        fmt.Print(script.String())
+        os.Exit(0)
+    }
+
+    writeStringToFile(scriptFilePath, script.String())
+
+    fmt.Printf("wrote %d forward migrations to %s\n", len(migrations), scriptFilePath)
+
+    os.Exit(0)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "crypto/ed25519"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "path/filepath"
+    "runtime"
+    "strings"
+    "time"
+)
+
+const (
+    CONST_RELEASES_URL = "https://api.github.com/repos/bf/go-simple-postgresql-migrate/releases/latest"
+
+    // assets of every release: one binary per platform, their sha256 sums and a signature of the sums
+    CONST_RELEASE_CHECKSUMS_ASSET = "checksums.txt"
+    CONST_RELEASE_SIGNATURE_ASSET = "checksums.txt.sig"
+
+    CONST_SELF_UPDATE_TIMEOUT = 5 * time.Minute
+)
+
+// base64 ed25519 public key which signs checksums.txt of releases,
+// set when building a release: go build -ldflags "-X main.releasePublicKey=..."
+var releasePublicKey = ""
+
+// latest release as returned by the GitHub API
+type githubRelease struct {
+    TagName string `json:"tag_name"`
+    Assets  []struct {
+        Name string `json:"name"`
+        URL  string `json:"browser_download_url"`
+    } `json:"assets"`
+}
+
+// name of the binary for this platform, e.g. go-simple-postgresql-migrate_linux_amd64
+func getReleaseAssetName() string {
+    name := fmt.Sprintf("%s_%s_%s", CONST_TOOL_NAME, runtime.GOOS, runtime.GOARCH)
+    if runtime.GOOS == "windows" {
+        name += ".exe"
+    }
+
+    return name
+}
+
+// download url, fails on anything but 200
+func downloadURL(url string) []byte {
+    client := http.Client{Timeout: CONST_SELF_UPDATE_TIMEOUT}
+
+    request, err := http.NewRequest(http.MethodGet, url, nil)
+    if err != nil {
+        logError("Error: Invalid url %s", url)
+        panic(err)
+    }
+    setUserAgent(request)
+
+    response, err := client.Do(request)
+    if err != nil {
+        logError("Error: Could not download %s", url)
+        panic(err)
+    }
+    defer response.Body.Close()
+
+    if response.StatusCode != http.StatusOK {
+        logError("Error: Could not download %s: %s", url, response.Status)
+        os.Exit(1)
+    }
+
+    content, err := ioutil.ReadAll(response.Body)
+    if err != nil {
+        logError("Error: Could not download %s", url)
+        panic(err)
+    }
+
+    return content
+}
+
+// download asset of release by name
+func downloadReleaseAsset(release githubRelease, name string) []byte {
+    for _, asset := range release.Assets {
+        if asset.Name == name {
+            return downloadURL(asset.URL)
+        }
+    }
+
+    logError("Error: Release %s has no file %s", release.TagName, name)
+    logError("Hint: Maybe there is no release for your platform, build it with 'go install' instead")
+    os.Exit(1)
+
+    return nil
+}
+
+// find sha256 of file in checksums.txt ("checksum  filename" lines as written by sha256sum)
+func getReleaseChecksum(checksums []byte, name string) string {
+    scanner := bufio.NewScanner(bytes.NewReader(checksums))
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+            return fields[0]
+        }
+    }
+
+    logError("Error: %s contains no checksum for %s", CONST_RELEASE_CHECKSUMS_ASSET, name)
+    os.Exit(1)
+
+    return ""
+}
+
+// verify signature of checksums.txt, builds without the public key refuse to update:
+// checksums from the same server as the binary prove nothing about who built it
+func verifyReleaseSignature(release githubRelease, checksums []byte) {
+    if len(releasePublicKey) == 0 {
+        logError("Error: This build has no release public key to verify releases with, nothing has been changed")
+        logError("Hint: Update builds from source with 'go install github.com/bf/go-simple-postgresql-migrate@%s'", release.TagName)
+        os.Exit(1)
+    }
+
+    publicKey, err := base64.StdEncoding.DecodeString(releasePublicKey)
+    if err != nil || len(publicKey) != ed25519.PublicKeySize {
+        logError("Error: Invalid release public key in this build")
+        os.Exit(1)
+    }
+
+    signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(downloadReleaseAsset(release, CONST_RELEASE_SIGNATURE_ASSET))))
+    if err != nil || !ed25519.Verify(ed25519.PublicKey(publicKey), checksums, signature) {
+        logError("Error: Signature of %s of release %s is invalid, nothing has been changed", CONST_RELEASE_CHECKSUMS_ASSET, release.TagName)
+        os.Exit(1)
+    }
+}
+
+// replace running executable, the new file is written next to it first so the rename is atomic
+func replaceExecutable(binary []byte) string {
+    executablePath, err := os.Executable()
+    if err == nil {
+        executablePath, err = filepath.EvalSymlinks(executablePath)
+    }
+    if err != nil {
+        logError("Error: Could not find path of this executable")
+        panic(err)
+    }
+
+    newPath := executablePath + ".new"
+    oldPath := executablePath + ".old"
+
+    err = ioutil.WriteFile(newPath, binary, 0755)
+    if err != nil {
+        logError("Error: Could not write %s", newPath)
+        logError("Hint: Run it as the user which owns %s", executablePath)
+        panic(err)
+    }
+
+    // windows cannot overwrite a running executable, but it can rename it
+    os.Remove(oldPath)
+    err = os.Rename(executablePath, oldPath)
+    if err == nil {
+        err = os.Rename(newPath, executablePath)
+    }
+    if err != nil {
+        os.Remove(newPath)
+        logError("Error: Could not replace %s", executablePath)
+        panic(err)
+    }
+    os.Remove(oldPath)
+
+    return executablePath
+}
+
+// download latest release for this platform, verify and install it in place of this executable
+func cmd_self_update() {
+    var release githubRelease
+    err := json.Unmarshal(downloadURL(CONST_RELEASES_URL), &release)
+    if err != nil {
+        logError("Error: Could not read latest release from %s", CONST_RELEASES_URL)
+        panic(err)
+    }
+
+    if release.TagName == getVersion() {
+        fmt.Println("Already up to date:", getVersionString())
+        os.Exit(0)
+    }
+
+    if !confirm(fmt.Sprintf("Update from %s to %s?", getVersion(), release.TagName)) {
+        logError("Error: Aborted, nothing has been changed")
+        os.Exit(1)
+    }
+
+    assetName := getReleaseAssetName()
+    checksums := downloadReleaseAsset(release, CONST_RELEASE_CHECKSUMS_ASSET)
+    verifyReleaseSignature(release, checksums)
+
+    binary := downloadReleaseAsset(release, assetName)
+    checksum := sha256.Sum256(binary)
+    if hex.EncodeToString(checksum[:]) != getReleaseChecksum(checksums, assetName) {
+        logError("Error: Checksum of %s does not match %s, nothing has been changed", assetName, CONST_RELEASE_CHECKSUMS_ASSET)
+        os.Exit(1)
+    }
+
+    executablePath := replaceExecutable(binary)
+
+    fmt.Printf("Updated %s to %s\n", executablePath, release.TagName)
+
+    os.Exit(0)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    // e.g. "maintenance_work_mem=1GB,synchronous_commit=off"
+    CONST_ENV_VAR_SET_LOCAL = "MIGRATE_SET_LOCAL"
+
+    // settings which migrations may change with "-- migrate:set name=value"
+    CONST_ENV_VAR_SET_ALLOWLIST = "MIGRATE_SET_ALLOWLIST"
+
+    // e.g. "-- migrate:set maintenance_work_mem='2GB'" for the one huge index build, only for this part of the migration
+    CONST_ANNOTATION_SET = migrate.AnnotationSet
+
+    // resources and timeouts, not settings which change what statements do (e.g. search_path)
+    CONST_DEFAULT_SET_ALLOWLIST = migrate.DefaultSetAllowlist
+)
+
+var flagSetLocal = commandLineFlags.String("set-local", "", "settings for each migration only, e.g. maintenance_work_mem=1GB,work_mem=256MB,synchronous_commit=off")
+var flagSetAllowlist = commandLineFlags.String("set-allowlist", "", "settings which migrations may change with '-- migrate:set name=value' (default: memory, parallelism, timeouts and synchronous_commit)")
+
+// parse set-local, exits if it is malformed
+func getMigrationSettings() []migrate.Setting {
+    settings, err := migrate.ParseSettings(getConfigValue("set-local"))
+    if err != nil {
+        logError("Error: Invalid set-local: %s", err)
+        os.Exit(1)
+    }
+
+    return settings
+}
+
+// settings which "-- migrate:set" annotations may change
+func getSetAllowlist() []string {
+    var allowlist []string
+    for _, name := range strings.Split(getConfigValue("set-allowlist"), ",") {
+        if name = strings.TrimSpace(name); len(name) > 0 {
+            allowlist = append(allowlist, name)
+        }
+    }
+
+    return allowlist
+}
+
+// check "-- migrate:set" annotations of up or down part against set-allowlist
+func checkSetAnnotations(migrationPart string, name string) error {
+    settings, err := migrate.ParseSetAnnotations(migrationPart)
+    if err != nil {
+        return fmt.Errorf("%s migration: %s", name, err)
+    }
+
+    err = migrate.CheckSettings(settings, getSetAllowlist())
+    if err != nil {
+        return fmt.Errorf("%s migration: %s", name, err)
+    }
+
+    return nil
+}
+
+// set-local followed by the "-- migrate:set" annotations of the up part of a migration, which override them
+func getForwardMigrationSettings(fileName string) []migrate.Setting {
+    rawMigrationForward, _ := readMigrationPartsFromFile(fileName)
+
+    err := checkSetAnnotations(rawMigrationForward, "up")
+    if err != nil {
+        logError("Error: Invalid file %s: %s", fileName, err)
+        os.Exit(1)
+    }
+
+    annotatedSettings, _ := migrate.ParseSetAnnotations(rawMigrationForward)
+
+    return append(getMigrationSettings(), annotatedSettings...)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+    "strings"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+// database object referenced in migration sql
+type sqlObject struct {
+    kind  string
+    name  string
+    table string // of indexes and constraints
+}
+
+// find objects created by sql statements, e.g. CREATE TABLE IF NOT EXISTS public.users;
+// statements in function bodies and DO blocks are strings to the tokenizer, so they do not count
+func getCreatedObjects(sql string) []sqlObject {
+    seen := make(map[sqlObject]bool)
+    var objects []sqlObject
+    for _, statement := range splitSQLStatements(sql) {
+        created := migrate.ParseStatement(statement).CreatedObject()
+
+        // index without name: CREATE INDEX ON table
+        if created == nil || len(created.Name) == 0 {
+            continue
+        }
+
+        object := sqlObject{kind: created.Kind, name: created.Name, table: created.Table}
+        if !seen[object] {
+            seen[object] = true
+            objects = append(objects, object)
+        }
+    }
+
+    return objects
+}
+
+// split possibly qualified name into schema (empty if not qualified) and object name, unquoting identifiers
+func splitQualifiedName(name string) (string, string) {
+    schema, objectName, ok := migrate.SplitQualifiedName(name)
+    if !ok {
+        return "", name
+    }
+
+    return schema, objectName
+}
+
+// unquote identifier, unquoted identifiers are folded to lower case like PostgreSQL does
+func unquoteIdentifier(identifier string) string {
+    if tokens := migrate.Tokenize(identifier); len(tokens) == 1 && tokens[0].IsIdentifier() {
+        return tokens[0].Identifier()
+    }
+
+    return strings.ToLower(identifier)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+    "context"
+    "time"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+// split SQL into single statements, see migrate.SplitStatements
+func splitSQLStatements(sql string) []string {
+    return migrate.SplitStatements(sql)
+}
+
+// check if statement reads data inline, as in dumps of pg_dump
+func isCopyFromStdin(statement string) bool {
+    return migrate.IsCopyFromStdin(statement)
+}
+
+// execute statements one by one, each in its own implicit transaction
+func executeWithoutTransaction(source sqlSource, sql string) {
+    statements := splitSQLStatements(sql)
+
+    searchFrom := 0
+    for index, statement := range statements {
+        var statementOffset int
+        statementOffset, searchFrom = getStatementOffset(sql, statement, searchFrom)
+
+        statementStartedAt := time.Now()
+        _, err := postgreSQLConnection.Exec(context.Background(), statement)
+        if err != nil {
+            logError("Error: Statement %d of %d failed (migration is not running in a transaction)", index+1, len(statements))
+            logError("Error while processing file: %s", source.filePath)
+            if !printErrorLocation(source, err, statementOffset) {
+                logError(statement)
+            }
+            printSQLStateHint(err)
+            if index > 0 {
+                logError("Hint: The statements before have already been executed, you need to clean up manually")
+            }
+            panic(err)
+        }
+
+        emitProgressEvent(migrate.Event{Kind: migrate.EventStatementExecuted, FileName: currentMigrationFileName,
+            StatementIndex: index + 1, StatementTotal: len(statements), Statement: shortenStatementForProgress(statement),
+            Duration: time.Since(statementStartedAt)})
+    }
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+    "errors"
+
+    "github.com/jackc/pgconn"
+)
+
+// actionable hints for common SQLSTATEs, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+var sqlStateHints = map[string]string{
+    // duplicate_table, duplicate_object, duplicate_column, duplicate_schema, duplicate_function
+    "42P07": "The object already exists. Maybe the migration has been applied by hand: compare with 'compare' or drop the object",
+    "42710": "The object already exists. Maybe the migration has been applied by hand: compare with 'compare' or drop the object",
+    "42701": "The column already exists. Maybe the migration has been applied by hand: compare with 'compare' or drop the column",
+    "42P06": "The schema already exists. Maybe the migration has been applied by hand, or use CREATE SCHEMA IF NOT EXISTS",
+    "42723": "The function already exists. Use CREATE OR REPLACE FUNCTION, or check if the migration has been applied by hand",
+
+    // undefined_table, undefined_column, undefined_object
+    "42P01": "The table does not exist. Check the search_path (see --schema) and whether an earlier migration is missing",
+    "42703": "The column does not exist. Check for typos and whether an earlier migration is missing",
+    "42704": "The object does not exist. Check for typos and whether an earlier migration is missing",
+
+    // insufficient_privilege
+    "42501": "The role lacks privileges. Run migrations as the owner of the objects (see 'owners' and 'verify-connection')",
+
+    // lock_not_available, query_canceled, deadlock_detected
+    "55P03": "A lock could not be acquired in time, another session holds it. Retry when there is less traffic, or raise lock_timeout",
+    "57014": "The statement was canceled, e.g. by statement_timeout. Raise it for this migration (SET LOCAL statement_timeout) or split the work",
+    "40P01": "A deadlock with another session occurred. Retrying the migration usually works",
+
+    // active_sql_transaction, e.g. CREATE INDEX CONCURRENTLY
+    "25001": "The statement cannot run inside a transaction block. Add '-- migrate:no-transaction' to this part of the migration",
+
+    // not_null_violation, foreign_key_violation, unique_violation, check_violation
+    "23502": "Existing rows contain NULL. Fill them first (see 'backfill') or add a DEFAULT",
+    "23503": "Existing rows violate the foreign key. Clean them up, or add the constraint NOT VALID and VALIDATE it later",
+    "23505": "Existing rows contain duplicates. Remove them before adding the unique constraint or index",
+    "23514": "Existing rows violate the check constraint. Fix them, or add the constraint NOT VALID and VALIDATE it later",
+
+    // dependent_objects_still_exist
+    "2BP01": "Other objects depend on this one. Drop them first, or use CASCADE if that is really intended",
+
+    // invalid_text_representation
+    "22P02": "A value cannot be converted to the target type. Check existing data and casts (e.g. text to enum or integer)",
+
+    // disk_full
+    "53100": "The database server ran out of disk space",
+}
+
+// get hint for the SQLSTATE of a PostgreSQL error, empty if there is none
+func getSQLStateHint(err error) string {
+    var pgError *pgconn.PgError
+    if !errors.As(err, &pgError) {
+        return ""
+    }
+
+    return sqlStateHints[pgError.Code]
+}
+
+// print hint for the SQLSTATE of a PostgreSQL error (if there is one)
+func printSQLStateHint(err error) {
+    hint := getSQLStateHint(err)
+    if len(hint) > 0 {
+        logError("Hint: %s", hint)
+    }
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+    "context"
+    "io/ioutil"
+    "net"
+    "os"
+    "os/user"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgconn"
+    "golang.org/x/crypto/ssh"
+    "golang.org/x/crypto/ssh/agent"
+    "golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+    CONST_ENV_VAR_SSH_HOST        = "MIGRATE_SSH_HOST"
+    CONST_ENV_VAR_SSH_USER        = "MIGRATE_SSH_USER"
+    CONST_ENV_VAR_SSH_KEY         = "MIGRATE_SSH_KEY"
+    CONST_ENV_VAR_SSH_KNOWN_HOSTS = "MIGRATE_SSH_KNOWN_HOSTS"
+
+    CONST_SSH_TIMEOUT = 30 * time.Second
+)
+
+var flagSSHHost = commandLineFlags.String("ssh-host", "", "tunnel the database connection through this SSH bastion, e.g. bastion.example.com:22")
+var flagSSHUser = commandLineFlags.String("ssh-user", "", "user on the SSH bastion (default: current user)")
+var flagSSHKey = commandLineFlags.String("ssh-key", "", "private key for the SSH bastion (default: keys of the ssh-agent)")
+
+// connection to the bastion, shared by all database connections of this run
+var sshClient *ssh.Client
+
+// get authentication for the bastion: the configured key, otherwise the keys of the running ssh-agent
+func getSSHAuthMethod() ssh.AuthMethod {
+    keyPath := getConfigValue("ssh-key")
+    if len(keyPath) > 0 {
+        keyContent, err := ioutil.ReadFile(keyPath)
+        if err != nil {
+            logError("Error: Could not read SSH key %s", keyPath)
+            panic(err)
+        }
+
+        signer, err := ssh.ParsePrivateKey(keyContent)
+        if err != nil {
+            logError("Error: Could not parse SSH key %s", keyPath)
+            logError("Hint: Keys with a passphrase need to be added to the ssh-agent instead")
+            panic(err)
+        }
+
+        return ssh.PublicKeys(signer)
+    }
+
+    agentConnection, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+    if err != nil {
+        logError("Error: No ssh-key configured and no ssh-agent running (SSH_AUTH_SOCK)")
+        panic(err)
+    }
+
+    return ssh.PublicKeysCallback(agent.NewClient(agentConnection).Signers)
+}
+
+// connect to the bastion once, its host key has to be in known_hosts
+func connectToSSHBastion(host string) *ssh.Client {
+    if sshClient != nil {
+        return sshClient
+    }
+
+    if _, _, err := net.SplitHostPort(host); err != nil {
+        host = net.JoinHostPort(host, "22")
+    }
+
+    hostKeyCallback, err := knownhosts.New(getConfigValue("ssh-known-hosts"))
+    if err != nil {
+        logError("Error: Could not read SSH known hosts %s", getConfigValue("ssh-known-hosts"))
+        logError("Hint: Connect once with 'ssh %s' to add the bastion's host key", strings.TrimSuffix(host, ":22"))
+        panic(err)
+    }
+
+    sshUser := getConfigValue("ssh-user")
+    if len(sshUser) == 0 {
+        if currentUser, err := user.Current(); err == nil {
+            sshUser = currentUser.Username
+        }
+    }
+
+    sshClient, err = ssh.Dial("tcp", host, &ssh.ClientConfig{
+        User:            sshUser,
+        Auth:            []ssh.AuthMethod{getSSHAuthMethod()},
+        HostKeyCallback: hostKeyCallback,
+        Timeout:         CONST_SSH_TIMEOUT,
+    })
+    if err != nil {
+        logError("Error: Failed to connect to SSH bastion %s as %s", host, sshUser)
+        panic(err)
+    }
+
+    return sshClient
+}
+
+// get dial function which tunnels through the bastion, nil without ssh-host
+func getSSHTunnelDialFunc() pgconn.DialFunc {
+    host := getConfigValue("ssh-host")
+    if len(host) == 0 {
+        return nil
+    }
+
+    return func(ctx context.Context, network string, address string) (net.Conn, error) {
+        return connectToSSHBastion(host).Dial(network, address)
+    }
+}
+
+// get default known_hosts of the current user
+func getDefaultSSHKnownHosts() string {
+    homeDir, err := os.UserHomeDir()
+    if err != nil {
+        return ""
+    }
+
+    return filepath.Join(homeDir, ".ssh", "known_hosts")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+    "fmt"
+    "os"
+)
+
+// output of 'status --json'
+type statusReport struct {
+    Frozen     string            `json:"frozen,omitempty"`
+    InProgress []string          `json:"in_progress"`
+    Applied    int               `json:"applied"`
+    MostRecent *reportMigration  `json:"most_recent"`
+    Pending    []reportMigration `json:"pending"`
+    Skipped    []reportMigration `json:"skipped"`
+}
+
+// show applied and pending migrations and runs in progress
+func cmd_status() {
+    format := getReportFormat(CONST_REPORT_FORMAT_TEXT, CONST_REPORT_FORMAT_JSON, CONST_REPORT_FORMAT_CSV, CONST_REPORT_FORMAT_TSV)
+
+    report := statusReport{InProgress: []string{}, Pending: []reportMigration{}, Skipped: []reportMigration{}}
+
+    // runs are sessions of the primary, a replica does not see them
+    if !*flagReplica {
+        prepareRunsTable()
+        for _, run := range getRunningMigrations() {
+            report.InProgress = append(report.InProgress, describeRun(run))
+        }
+    }
+
+    if freeze := getMigrationFreeze(); freeze != nil {
+        report.Frozen = freeze.String()
+    }
+
+    migrationsInFileSystem, migrationsInDatabase := checkConsistencyOfDatabaseAndLocalFileSystem()
+
+    appliedMigrations := getAppliedMigrations()
+    report.Applied = len(migrationsInDatabase)
+    if len(appliedMigrations) > 0 {
+        mostRecent := newAppliedReportMigration(appliedMigrations[len(appliedMigrations)-1])
+        report.MostRecent = &mostRecent
+    }
+
+    for _, migration := range appliedMigrations {
+        if len(migration.SkippedBy) > 0 {
+            report.Skipped = append(report.Skipped, newAppliedReportMigration(migration))
+        }
+    }
+
+    for _, fileName := range migrationsInFileSystem[len(migrationsInDatabase):] {
+        report.Pending = append(report.Pending, newPendingReportMigration(fileName))
+    }
+
+    switch format {
+    case CONST_REPORT_FORMAT_JSON:
+        printJSON(report)
+        os.Exit(0)
+    case CONST_REPORT_FORMAT_CSV, CONST_REPORT_FORMAT_TSV:
+        // one row per migration, applied ones first
+        var records [][]string
+        for _, migration := range appliedMigrations {
+            applied := newAppliedReportMigration(migration)
+            records = append(records, applied.tableRecord(applied.appliedState()))
+        }
+        for _, migration := range report.Pending {
+            records = append(records, migration.tableRecord(CONST_REPORT_STATE_PENDING))
+        }
+        printReportTable(format, records)
+        os.Exit(0)
+    }
+
+    if len(report.Frozen) > 0 {
+        fmt.Printf("Schema changes are frozen %s\n", report.Frozen)
+    }
+
+    for _, description := range report.InProgress {
+        fmt.Println(description)
+    }
+
+    if report.MostRecent == nil {
+        fmt.Println("No migrations applied.")
+    } else {
+        fmt.Printf("%d migrations applied, most recent is %s\n", report.Applied, report.MostRecent)
+    }
+
+    if len(report.Pending) == 0 {
+        fmt.Println("Database up to date, no pending migrations.")
+    } else {
+        fmt.Printf("%d pending migration(s):\n", len(report.Pending))
+        for _, migration := range report.Pending {
+            fmt.Println("   ", migration)
+        }
+    }
+
+    if len(report.Skipped) > 0 {
+        fmt.Printf("%d migration(s) recorded without running them:\n", len(report.Skipped))
+        for _, migration := range report.Skipped {
+            fmt.Printf("    %s (%s)\n", migration, *migration.SkippedBy)
+        }
+    }
+
+    os.Exit(0)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+    "archive/tar"
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "path"
+    "strings"
+    "time"
+)
+
+var flagName = commandLineFlags.String("name", "", "for 'apply -': description used in the migration file name")
+
+// check for tar archive ("ustar" magic in header)
+func isTarArchive(content []byte) bool {
+    return len(content) > 262 && string(content[257:262]) == "ustar"
+}
+
+// check for gzip compressed content
+func isGzipCompressed(content []byte) bool {
+    return len(content) > 2 && content[0] == 0x1f && content[1] == 0x8b
+}
+
+// migration file read from STDIN
+type stdinMigrationFile struct {
+    fileName string
+    content  []byte
+}
+
+// store migration files in migrations folder, identical existing files are fine; all of them are validated before
+// the first one is written, so a rejected migration leaves nothing behind
+func storeMigrationFiles(files []stdinMigrationFile) {
+    var newFiles []stdinMigrationFile
+    for _, file := range files {
+        filePath := path.Join(migrationsFolder, file.fileName)
+
+        existingContent, err := ioutil.ReadFile(filePath)
+        if err == nil {
+            if !bytes.Equal(existingContent, file.content) {
+                logError("Error: migration file does already exist with different content: %s", filePath)
+                os.Exit(1)
+            }
+            continue
+        }
+
+        // make sure it is well-formed, like 'validate'
+        err = checkMigrationFileContent(string(file.content))
+        if err != nil {
+            logError("Error: Invalid migration %s from STDIN: %s", file.fileName, err)
+            os.Exit(3)
+        }
+
+        newFiles = append(newFiles, file)
+    }
+
+    for _, file := range newFiles {
+        storeMigrationFile(file.fileName, file.content)
+    }
+}
+
+// write migration file to a temporary file which is renamed, so a half written migration never ends up in the folder
+func storeMigrationFile(fileName string, content []byte) {
+    filePath := path.Join(migrationsFolder, fileName)
+
+    // hidden, so it is no migration file while it is written
+    file, err := ioutil.TempFile(migrationsFolder, "."+fileName+".*.tmp")
+    if err != nil {
+        logError("Error: unable to create file in %s", migrationsFolder)
+        panic(err)
+    }
+
+    // like files created with os.Create
+    err = file.Chmod(0644)
+    if err == nil {
+        _, err = file.Write(content)
+    }
+    if closeErr := file.Close(); err == nil {
+        err = closeErr
+    }
+    if err == nil {
+        err = os.Rename(file.Name(), filePath)
+    }
+    if err != nil {
+        os.Remove(file.Name())
+        logError("Error: unable to write file: %s", filePath)
+        panic(err)
+    }
+
+    fmt.Println("added", filePath)
+}
+
+// extract migration files from tar archive into migrations folder
+func extractMigrationsFromTar(content []byte) {
+    reader := tar.NewReader(bytes.NewReader(content))
+
+    var files []stdinMigrationFile
+    for {
+        header, err := reader.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            logError("Error: Could not read tar archive from STDIN")
+            panic(err)
+        }
+
+        fileName := path.Base(header.Name)
+        if header.Typeflag != tar.TypeReg || !isMigrationFileName(fileName) {
+            continue
+        }
+
+        fileContent, err := ioutil.ReadAll(reader)
+        if err != nil {
+            logError("Error: Could not read %s from tar archive", header.Name)
+            panic(err)
+        }
+
+        files = append(files, stdinMigrationFile{fileName, fileContent})
+    }
+
+    if len(files) == 0 {
+        logError("Error: tar archive does not contain any migration files")
+        os.Exit(1)
+    }
+
+    storeMigrationFiles(files)
+}
+
+// read migration(s) from STDIN, add them to migrations folder and migrate
+func cmd_apply(source string) {
+    if source != "-" {
+        logError("Error: 'apply' only reads from STDIN, use: apply -")
+        os.Exit(1)
+    }
+
+    checkDatabaseConfigurationFileExists()
+
+    content, err := ioutil.ReadAll(os.Stdin)
+    if err != nil {
+        logError("Error: Could not read from STDIN")
+        panic(err)
+    }
+
+    if isGzipCompressed(content) {
+        gzipReader, err := gzip.NewReader(bytes.NewReader(content))
+        if err != nil {
+            logError("Error: Could not decompress STDIN")
+            panic(err)
+        }
+
+        content, err = ioutil.ReadAll(gzipReader)
+        if err != nil {
+            logError("Error: Could not decompress STDIN")
+            panic(err)
+        }
+    }
+
+    if isTarArchive(content) {
+        extractMigrationsFromTar(content)
+    } else {
+        // single migration, needs up and down part like any other migration file
+        if !strings.Contains(string(content), CONST_TEMPLATE_UNDO_MARKER) {
+            logError("Error: Could not find the separator in migration from STDIN")
+            logError("Hint: Make sure this string splits up the up/down migration:")
+            logError(CONST_TEMPLATE_UNDO_MARKER)
+            os.Exit(1)
+        }
+
+        description := *flagName
+        if len(description) == 0 {
+            description = "stdin"
+        }
+
+        _, filePath := getNewMigrationFilePath(migrationsFolder, description, time.Now().UTC())
+        storeMigrationFiles([]stdinMigrationFile{{path.Base(filePath), content}})
+    }
+
+    cmd_up()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    // position is maintained by the tool and only ever increases
+    CONST_POSTGRESQL_INSERT_MIGRATION = migrate.InsertMigrationSQL
+)
+
+// read tracking table in the order migrations were applied, see migrate.Migrator.AppliedMigrations
+func getAppliedMigrations() []migrate.AppliedMigration {
+    appliedMigrations, err := getMigrator().AppliedMigrations(context.Background())
+    if err != nil {
+        logError("Error: could not read migrations from database table %s", trackingTableName)
+        panic(err)
+    }
+
+    return appliedMigrations
+}
+
+// number of oldest migrations archived by 'prune-history', positions of remaining rows continue after them
+func getPrunedMigrationCount() int {
+    appliedMigrations := getAppliedMigrations()
+    if len(appliedMigrations) == 0 {
+        return 0
+    }
+
+    return appliedMigrations[0].Position - 1
+}
+
+// create tracking table if it is missing, so 'up' works without 'init',
+// concurrent first runs wait for each other instead of colliding in CREATE TABLE
+func createTrackingTable() {
+    err := getMigrator().CreateTrackingTable(context.Background())
+    if err != nil {
+        logError("Error: Failed to create table %s", trackingTableName)
+        panic(err)
+    }
+}
+
+// get all upgrade statements of the tracking table, e.g. for scripts
+func getTrackingTableUpgradeStatements() []string {
+    var statements []string
+    for _, upgrade := range migrate.TrackingTableUpgrades {
+        for _, statement := range upgrade.Statements {
+            statements = append(statements, fmt.Sprintf(statement, trackingTableName))
+        }
+    }
+
+    return statements
+}
+
+// add columns which are missing in tracking tables created by older versions
+func upgradeTrackingTable(migrator *migrate.Migrator) {
+    if *flagReplica {
+        missingColumns, err := migrator.MissingTrackingTableColumns(context.Background())
+        if err != nil {
+            logError("Error: could not read columns of database table %s", trackingTableName)
+            panic(err)
+        }
+
+        if len(missingColumns) > 0 {
+            logError("Error: Database table %s on the replica lacks column %s", trackingTableName, missingColumns[0])
+            logError("Hint: Run any command of this version against the primary first, it upgrades the table")
+            os.Exit(1)
+        }
+        return
+    }
+
+    addedColumns, err := migrator.UpgradeTrackingTable(context.Background())
+    for _, column := range addedColumns {
+        fmt.Printf("upgraded database table %s: added column %s\n", trackingTableName, column)
+    }
+    if err != nil {
+        logError("Error: Failed to upgrade database table %s", trackingTableName)
+        panic(err)
+    }
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "path"
+    "strings"
+    "time"
+)
+
+const (
+    // where CI systems serve the files of the commit being deployed
+    CONST_ENV_VAR_GITHUB_SERVER_URL = "GITHUB_SERVER_URL"
+    CONST_ENV_VAR_GITHUB_REPOSITORY = "GITHUB_REPOSITORY"
+    CONST_ENV_VAR_GITHUB_SHA        = "GITHUB_SHA"
+    CONST_ENV_VAR_GITLAB_PROJECT    = "CI_PROJECT_URL"
+    CONST_ENV_VAR_GITLAB_SHA        = "CI_COMMIT_SHA"
+)
+
+var flagSummaryFile = commandLineFlags.String("summary-file", "", "for 'up': write a Markdown deployment summary to this file, e.g. for PRs or change tickets")
+var flagSummaryLinkBase = commandLineFlags.String("summary-link-base", "", "for --summary-file: URL of the repository files at the deployed commit, detected in GitHub Actions and GitLab CI")
+
+// migration as listed in the deployment summary
+type summaryMigration struct {
+    fileName string
+    duration time.Duration
+    skipped  string // reason, e.g. the tag it has been skipped by
+}
+
+// collected while 'up' runs
+var (
+    summaryStartedAt   = time.Now()
+    summaryMigrations  []summaryMigration
+    summaryWarnings    []string
+    summaryCurrentFile string // migration being applied, for failures
+)
+
+// remember warnings for the summary, called for every message on STDERR
+func recordSummaryWarning(message string) {
+    if len(*flagSummaryFile) > 0 && strings.HasPrefix(message, "Warning: ") {
+        summaryWarnings = append(summaryWarnings, strings.TrimPrefix(message, "Warning: "))
+    }
+}
+
+// remember applied or skipped migration for the summary
+func recordSummaryMigration(fileName string, duration time.Duration, skipped string) {
+    summaryMigrations = append(summaryMigrations, summaryMigration{fileName, duration, skipped})
+}
+
+// link to the migration file at the deployed commit, empty outside of CI without --summary-link-base
+func getSummaryFileLink(fileName string) string {
+    linkBase := *flagSummaryLinkBase
+    switch {
+    case len(linkBase) > 0:
+    case len(os.Getenv(CONST_ENV_VAR_GITHUB_REPOSITORY)) > 0 && len(os.Getenv(CONST_ENV_VAR_GITHUB_SHA)) > 0:
+        linkBase = os.Getenv(CONST_ENV_VAR_GITHUB_SERVER_URL) + "/" + os.Getenv(CONST_ENV_VAR_GITHUB_REPOSITORY) +
+            "/blob/" + os.Getenv(CONST_ENV_VAR_GITHUB_SHA)
+    case len(os.Getenv(CONST_ENV_VAR_GITLAB_PROJECT)) > 0 && len(os.Getenv(CONST_ENV_VAR_GITLAB_SHA)) > 0:
+        linkBase = os.Getenv(CONST_ENV_VAR_GITLAB_PROJECT) + "/-/blob/" + os.Getenv(CONST_ENV_VAR_GITLAB_SHA)
+    default:
+        return ""
+    }
+
+    return strings.TrimRight(linkBase, "/") + "/" + path.Join(migrationsFolder, fileName)
+}
+
+// render deployment summary as Markdown
+func renderDeploymentSummary(failure string) string {
+    var summary strings.Builder
+
+    status := ":white_check_mark: succeeded"
+    if len(failure) > 0 {
+        status = ":x: failed"
+    }
+
+    database := getConfigValue("database")
+    if environment := getConfigValue("environment"); len(environment) > 0 {
+        database += " (" + environment + ")"
+    }
+
+    fmt.Fprintf(&summary, "### Database migration %s\n\n", status)
+    fmt.Fprintf(&summary, "Database `%s` on `%s`, %s, %s, took %s.\n\n", database, getConfigValue("host"),
+        summaryStartedAt.UTC().Format(time.RFC3339), getVersionString(), time.Since(summaryStartedAt).Round(time.Millisecond))
+
+    if len(summaryMigrations) == 0 {
+        summary.WriteString("No migrations applied.\n\n")
+    } else {
+        summary.WriteString("| Migration | Duration |\n")
+        summary.WriteString("| --- | --- |\n")
+        for _, migration := range summaryMigrations {
+            name := "`" + migration.fileName + "`"
+            if link := getSummaryFileLink(migration.fileName); len(link) > 0 {
+                name = "[" + name + "](" + link + ")"
+            }
+
+            duration := migration.duration.Round(time.Millisecond).String()
+            if len(migration.skipped) > 0 {
+                duration = "skipped (" + migration.skipped + ")"
+            }
+
+            fmt.Fprintf(&summary, "| %s | %s |\n", name, duration)
+        }
+        summary.WriteString("\n")
+    }
+
+    for _, warning := range summaryWarnings {
+        fmt.Fprintf(&summary, "- :warning: %s\n", warning)
+    }
+
+    if len(failure) > 0 {
+        if len(summaryCurrentFile) > 0 {
+            failure = "`" + summaryCurrentFile + "`: " + failure
+        }
+        fmt.Fprintf(&summary, "- :x: %s\n", failure)
+    }
+
+    return summary.String()
+}
+
+// write deployment summary (if asked to), credentials are masked
+func writeDeploymentSummary(failure string) {
+    if len(*flagSummaryFile) == 0 {
+        return
+    }
+
+    writeStringToFile(*flagSummaryFile, sanitizeSupportBundleText(renderDeploymentSummary(failure)))
+}
+
+// write summary of the failed run, then fail as before; deferred by 'up'
+func writeDeploymentSummaryOnPanic() {
+    err := recover()
+    if err == nil {
+        return
+    }
+
+    writeDeploymentSummary(fmt.Sprint(err))
+    panic(err)
+}
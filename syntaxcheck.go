@@ -0,0 +1,105 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "os"
+    "strings"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+    "github.com/jackc/pgconn"
+)
+
+const (
+    // syntax_error, other errors of the check (e.g. no TEMP privilege) do not mean that the migration is broken
+    CONST_SQLSTATE_SYNTAX_ERROR = "42601"
+
+    // dollar quote of the function body, statements containing it are not checked
+    CONST_SYNTAX_CHECK_TAG = "$go_simple_postgresql_migrate_syntax_check$"
+)
+
+var flagSkipSyntaxCheck = commandLineFlags.Bool("skip-syntax-check", false, "for 'up': do not let the server check the syntax of pending migrations before applying them")
+
+// statements which PL/pgSQL reads differently than SQL, e.g. EXECUTE of a prepared statement
+var plpgsqlKeywords = []string{"EXECUTE", "FETCH", "MOVE", "CLOSE", "OPEN", "GET", "RAISE", "PERFORM", "ASSERT",
+    "RETURN", "COMMIT", "ROLLBACK", "BEGIN", "END", "DECLARE", "IMPORT"}
+
+// check if the syntax of a statement can be checked as part of a PL/pgSQL function body
+func isSyntaxCheckable(statement string) bool {
+    tokens := migrate.Tokenize(statement)
+    if len(tokens) == 0 || tokens[0].Is(plpgsqlKeywords...) || strings.Contains(statement, CONST_SYNTAX_CHECK_TAG) {
+        return false
+    }
+
+    // INTO is a PL/pgSQL target, except after INSERT and MERGE
+    for index, token := range tokens {
+        if token.Is("INTO") && (index == 0 || !tokens[index-1].Is("INSERT", "MERGE")) {
+            return false
+        }
+    }
+
+    return true
+}
+
+// let the server parse a statement without analyzing or running it: PL/pgSQL checks the syntax of the statements
+// of a function body when the function is created, the function (in pg_temp) is rolled back right away
+func checkStatementSyntax(statement string) error {
+    // statements keep their ';', the body would get an empty statement ";" otherwise, which is a syntax error
+    statement = strings.TrimSuffix(strings.TrimSpace(statement), ";")
+
+    tx, err := postgreSQLConnection.Begin(context.Background())
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback(context.Background())
+
+    _, err = tx.Exec(context.Background(), "SET LOCAL check_function_bodies = on; "+
+        "CREATE FUNCTION pg_temp.go_simple_postgresql_migrate_syntax_check() RETURNS void LANGUAGE plpgsql AS "+
+        CONST_SYNTAX_CHECK_TAG+"BEGIN\n"+statement+"\n;\nEND"+CONST_SYNTAX_CHECK_TAG)
+
+    return err
+}
+
+// fail before anything is applied if a pending migration has a syntax error, e.g. in migration 5 of 5:
+// otherwise migrations 1 to 4 would be applied and the deployment stops halfway
+func checkSyntaxOfMigrations(pendingMigrations []string) {
+    if *flagSkipSyntaxCheck {
+        return
+    }
+
+    brokenCount := 0
+    for _, fileName := range pendingMigrations {
+        sqlMigrationForward, _ := readMigrationFromFile(fileName)
+
+        for _, statement := range splitSQLStatements(sqlMigrationForward) {
+            // the parser of -tags pg_query needs no round trip; it may not know syntax of a later
+            // PostgreSQL version, so the server decides about statements it rejects
+            if migrate.CheckSyntax(statement) == nil || !isSyntaxCheckable(statement) {
+                continue
+            }
+
+            err := checkStatementSyntax(statement)
+            if err == nil {
+                continue
+            }
+
+            var pgError *pgconn.PgError
+            if !errors.As(err, &pgError) || pgError.Code != CONST_SQLSTATE_SYNTAX_ERROR {
+                logError("Warning: Could not check the syntax of pending migrations: %v", err)
+                return
+            }
+
+            logError("Error: Syntax error in %s: %s", describeMigrationFile(fileName), pgError.Message)
+            logError(statement)
+            brokenCount++
+
+            // one error per file, the statements after it are often broken by it as well
+            break
+        }
+    }
+
+    if brokenCount > 0 {
+        logError("Hint: Nothing has been applied, fix the %d migration(s) first ('--skip-syntax-check' skips this check)", brokenCount)
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    // optional subsystems, e.g. "-- tags: reporting, heavy" in the header of the file
+    CONST_HEADER_TAGS = migrate.HeaderTags
+)
+
+var flagSkipTag = commandLineFlags.String("skip-tag", "", "for 'up': record pending migrations with one of these tags (comma separated) as skipped instead of running them")
+var flagOnlyTag = commandLineFlags.String("only-tag", "", "for 'up': only run migrations with one of these tags (comma separated), including ones skipped before, record the others as skipped")
+
+// check if migration has been skipped by --skip-tag or --only-tag, other skipped migrations are never run
+func isSkippedByTag(migration migrate.AppliedMigration) bool {
+    return len(migration.SkippedBy) > 0 && migrate.IsSkippedByTag(migration.SkippedBy)
+}
+
+// check if tags decide what 'up' runs
+func isTagSelectionActive() bool {
+    return len(*flagSkipTag) > 0 || len(*flagOnlyTag) > 0
+}
+
+// get migrations which actually run, without the skipped ones
+func withoutSkippedMigrations(migrations []string, skippedBy map[string]string) []string {
+    var remaining []string
+    for _, fileName := range migrations {
+        if _, skipped := skippedBy[fileName]; !skipped {
+            remaining = append(remaining, fileName)
+        }
+    }
+
+    return remaining
+}
+
+// warn about migrations which have been skipped by tag, and how to apply them
+func printSkippedMigrationsHint() {
+    skippedCount := 0
+    for _, migration := range getAppliedMigrations() {
+        if isSkippedByTag(migration) {
+            skippedCount++
+        }
+    }
+
+    if skippedCount > 0 {
+        logError("Warning: %d migration(s) have been skipped by tag, run them with 'up --only-tag tag'", skippedCount)
+    }
+}
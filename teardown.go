@@ -0,0 +1,142 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+var flagDropObjects = commandLineFlags.Bool("drop-objects", false, "for 'destroy': drop the objects which applied migrations created (CASCADE) instead of running down migrations, e.g. for ephemeral test databases")
+
+// get objects created by applied migrations, in the order they have been created, with their names today
+// (migrations skipped by tag or because their objects existed did not create anything)
+func getObjectsCreatedByAppliedMigrations() []sqlObject {
+    migrator := getMigrator()
+    var objects []sqlObject
+    for _, migration := range getAppliedMigrationsWithLocalFileNames(migrator) {
+        if len(migration.SkippedBy) > 0 {
+            continue
+        }
+
+        if migration.CreatedObjects == nil {
+            objects = append(objects, getObjectsCreatedByMigrationFile(migration)...)
+            continue
+        }
+
+        // recorded when the migration was applied, by oid: renamed objects keep being found
+        for _, object := range migration.CreatedObjects {
+            name, err := migrator.CurrentName(context.Background(), object)
+            if err != nil {
+                logError("Error: Failed to look up %s created by %s", object.Kind, migration.FileName)
+                panic(err)
+            }
+
+            // e.g. dropped by a later migration
+            if len(name) > 0 {
+                objects = append(objects, sqlObject{kind: object.Kind, name: name})
+            }
+        }
+    }
+
+    return objects
+}
+
+// applied migrations with their local files (renamed ones under their new name); a test database is torn down
+// even if it does not match the local files, then migrations whose file has been renamed are not found
+func getAppliedMigrationsWithLocalFileNames(migrator *migrate.Migrator) []migrate.AppliedMigration {
+    status, err := migrator.Status(context.Background())
+    if err == nil {
+        return status.Applied
+    }
+
+    appliedMigrations, err := migrator.AppliedMigrations(context.Background())
+    if err != nil {
+        logError("Error: Failed to read applied migrations from table %s", trackingTableName)
+        panic(err)
+    }
+
+    for index, migration := range appliedMigrations {
+        if migrationFileExists(migration.FileName) {
+            appliedMigrations[index].LocalFileName = migration.FileName
+        }
+    }
+
+    return appliedMigrations
+}
+
+// get objects of a migration applied before created objects were recorded, from its local file as it is now;
+// objects which may have existed before (IF NOT EXISTS, OR REPLACE) and schemas are left alone
+func getObjectsCreatedByMigrationFile(migration migrate.AppliedMigration) []sqlObject {
+    fileName := migration.LocalFileName
+    if len(fileName) == 0 {
+        logError("Warning: Migration file %s does not exist, its objects are not dropped", migration.FileName)
+        return nil
+    }
+
+    logError("Warning: Objects of %s have not been recorded when it was applied, dropping those its file creates", fileName)
+
+    var objects []sqlObject
+    sqlMigrationForward, _ := readMigrationFromFile(fileName)
+    for _, statement := range splitSQLStatements(sqlMigrationForward) {
+        created := migrate.ParseStatement(statement).CreatedObject()
+        if created != nil && len(created.Name) > 0 && !created.IfNotExists && !created.OrReplace && created.Kind != "schema" {
+            objects = append(objects, sqlObject{kind: created.Kind, name: created.Name})
+        }
+    }
+
+    return objects
+}
+
+// drop everything applied migrations created in one transaction and forget the migrations,
+// does not depend on down migrations being complete
+func destroyCreatedObjects() {
+    objects := getObjectsCreatedByAppliedMigrations()
+    if len(objects) == 0 {
+        fmt.Println("Applied migrations did not create any objects.")
+    }
+
+    if isProtectedEnvironment() && !confirm(fmt.Sprintf("Drop %d objects created by migrations in %s, with everything depending on them?",
+        len(objects), getConfigValue("environment"))) {
+        logError("Error: Aborted, nothing has been dropped")
+        os.Exit(1)
+    }
+
+    tx, err := postgreSQLConnection.Begin(context.Background())
+    if err != nil {
+        logError("Error: Failed to start transaction to drop objects")
+        panic(err)
+    }
+
+    defer tx.Rollback(context.Background())
+
+    // newest first, objects of later migrations may depend on earlier ones
+    for index := len(objects) - 1; index >= 0; index-- {
+        object := objects[index]
+
+        // names are quoted as needed, functions come with their arguments
+        _, err = tx.Exec(context.Background(), fmt.Sprintf("DROP %s IF EXISTS %s CASCADE", object.kind, object.name))
+        if err != nil {
+            logError("Error: Failed to drop %s %s", object.kind, object.name)
+            panic(err)
+        }
+
+        fmt.Printf("dropped: %s %s\n", object.kind, object.name)
+    }
+
+    _, err = tx.Exec(context.Background(), fmt.Sprintf("DELETE FROM %s", trackingTableName))
+    if err != nil {
+        logError("Error: Failed to delete applied migrations from table %s", trackingTableName)
+        panic(err)
+    }
+
+    err = tx.Commit(context.Background())
+    if err != nil {
+        logError("Error: Failed to commit dropping of objects")
+        panic(err)
+    }
+
+    fmt.Printf("Dropped %d objects, no migrations are applied anymore.\n", len(objects))
+    os.Exit(0)
+}
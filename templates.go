@@ -0,0 +1,186 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "path"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+)
+
+const (
+    CONST_MIGRATION_TEMPLATE_CREATE_INDEX_CONCURRENTLY = "create-index-concurrently"
+    CONST_MIGRATION_TEMPLATE_ADD_FOREIGN_KEY           = "add-foreign-key"
+    CONST_MIGRATION_TEMPLATE_ADD_CHECK_CONSTRAINT      = "add-check-constraint"
+
+    // identifiers longer than this are truncated by PostgreSQL
+    CONST_MAX_IDENTIFIER_LENGTH = 63
+
+    // description of the follow-up migration of constraint templates, e.g. orders-customer-fk-validate
+    CONST_FOLLOW_UP_SUFFIX = "-validate"
+)
+
+// template for 'create --template', for migrations which are easy to get wrong:
+// up and down part for a description like "orders-created-at-idx",
+// optionally a follow-up migration which runs later and requires the first one,
+// and a backfill file which runs in between
+type migrationTemplate struct {
+    create         func(description string) (string, string)
+    followUp       func(description string, requires string) (string, string)
+    followUpSuffix string
+    backfill       func(description string) string
+}
+
+var migrationTemplates = map[string]migrationTemplate{
+    CONST_MIGRATION_TEMPLATE_CREATE_INDEX_CONCURRENTLY: {create: getCreateIndexConcurrentlyTemplate},
+    CONST_MIGRATION_TEMPLATE_ADD_FOREIGN_KEY: {
+        create:         getNotValidConstraintTemplate("FOREIGN KEY (column_name) REFERENCES other_table_name (id)"),
+        followUp:       getValidateConstraintTemplate,
+        followUpSuffix: CONST_FOLLOW_UP_SUFFIX,
+    },
+    CONST_MIGRATION_TEMPLATE_ADD_CHECK_CONSTRAINT: {
+        create:         getNotValidConstraintTemplate("CHECK (column_name IS NOT NULL)"),
+        followUp:       getValidateConstraintTemplate,
+        followUpSuffix: CONST_FOLLOW_UP_SUFFIX,
+    },
+    CONST_MIGRATION_TEMPLATE_CHANGE_COLUMN_TYPE: {
+        create:         getChangeColumnTypeTemplate,
+        followUp:       getSwapColumnTemplate,
+        followUpSuffix: CONST_SWAP_SUFFIX,
+        backfill:       getChangeColumnTypeBackfill,
+    },
+}
+
+var regexpIdentifierUnsafe = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// identifier from description, e.g. "Orders-created-at-idx" -> orders_created_at_idx
+func getIdentifierFromDescription(description string) string {
+    identifier := strings.Trim(regexpIdentifierUnsafe.ReplaceAllString(strings.ToLower(description), "_"), "_")
+    if len(identifier) > CONST_MAX_IDENTIFIER_LENGTH {
+        identifier = identifier[:CONST_MAX_IDENTIFIER_LENGTH]
+    }
+
+    return identifier
+}
+
+// CREATE INDEX CONCURRENTLY cannot run in a transaction, and when it fails it leaves an INVALID index behind,
+// which IF NOT EXISTS keeps on the next attempt and which the planner never uses
+func getCreateIndexConcurrentlyTemplate(description string) (string, string) {
+    indexName := getIdentifierFromDescription(description)
+
+    sqlForward := fmt.Sprintf(`-- migrate:no-transaction
+
+-- TODO: table and columns of the index
+-- clean up after a failed attempt, its INVALID index would be kept by IF NOT EXISTS
+-- (DROP INDEX takes a short exclusive lock, lock_timeout keeps it from queueing behind long queries)
+SET lock_timeout = '5s';
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_index WHERE indexrelid = to_regclass('%[1]s') AND NOT indisvalid) THEN
+        DROP INDEX %[1]s;
+    END IF;
+END $$;
+RESET lock_timeout;
+
+CREATE INDEX CONCURRENTLY IF NOT EXISTS %[1]s ON table_name (column_name);
+
+-- never record the migration as applied with an index which is not used
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_index WHERE indexrelid = to_regclass('%[1]s') AND indisvalid) THEN
+        RAISE EXCEPTION 'index %[1]s is missing or INVALID, run the migration again to rebuild it';
+    END IF;
+END $$;`, indexName)
+
+    sqlBackward := fmt.Sprintf(`-- migrate:no-transaction
+
+DROP INDEX CONCURRENTLY IF EXISTS %s;`, indexName)
+
+    return sqlForward, sqlBackward
+}
+
+// adding a constraint checks all existing rows while holding a lock which blocks writes,
+// NOT VALID only checks new rows, the follow-up migration checks the existing ones with a weaker lock
+func getNotValidConstraintTemplate(definition string) func(description string) (string, string) {
+    return func(description string) (string, string) {
+        constraintName := getIdentifierFromDescription(description)
+
+        sqlForward := fmt.Sprintf(`-- TODO: table and definition of the constraint (and the same table in the follow-up migration)
+-- NOT VALID: only new rows are checked, so this needs the lock for a moment only
+ALTER TABLE table_name ADD CONSTRAINT %s %s NOT VALID;`, constraintName, definition)
+
+        sqlBackward := fmt.Sprintf(`ALTER TABLE table_name DROP CONSTRAINT IF EXISTS %s;`, constraintName)
+
+        return sqlForward, sqlBackward
+    }
+}
+
+// runs after the new code ships, which writes valid rows only
+func getValidateConstraintTemplate(description string, requires string) (string, string) {
+    constraintName := getIdentifierFromDescription(description)
+
+    sqlForward := fmt.Sprintf(`-- %s: %s
+-- %s: %s
+-- TODO: same table as in %s
+-- checks existing rows with a SHARE UPDATE EXCLUSIVE lock: reads and writes go on
+ALTER TABLE table_name VALIDATE CONSTRAINT %s;`,
+        CONST_HEADER_PHASE, CONST_PHASE_POST_DEPLOY, CONST_HEADER_REQUIRES, requires, requires, constraintName)
+
+    // the constraint itself is dropped by the migration which added it
+    sqlBackward := "-- migrate:" + CONST_ANNOTATION_NOOP
+
+    return sqlForward, sqlBackward
+}
+
+// names of all templates, for messages
+func getMigrationTemplateNames() []string {
+    var names []string
+    for name := range migrationTemplates {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    return names
+}
+
+// create migration files from the template with this name, exits for unknown templates
+func createMigrationFilesFromTemplate(folderPath string, name string, description string) {
+    template, ok := migrationTemplates[name]
+    if !ok {
+        logError("Error: Unknown migration template %s", name)
+        logError("Hint: Use one of: %s", strings.Join(getMigrationTemplateNames(), ", "))
+        os.Exit(1)
+    }
+
+    timestamp := time.Now().UTC()
+    sqlForward, sqlBackward := template.create(description)
+    filePath := createMigrationFileAt(folderPath, description, sqlForward, sqlBackward, timestamp)
+    fmt.Println("created", filePath)
+    checkRemoteMigrationOrder(filePath)
+
+    // not a migration file name, so 'up' ignores it
+    if template.backfill != nil {
+        backfillFilePath := path.Join(folderPath, "backfill-"+path.Base(filePath))
+        writeStringToFile(backfillFilePath, template.backfill(description))
+        fmt.Println("created", backfillFilePath)
+        fmt.Printf("run it with '%s backfill %s' between deploying the new code and the follow-up migration\n",
+            os.Args[0], backfillFilePath)
+    }
+
+    if template.followUp == nil {
+        return
+    }
+
+    // linked by the requires header, within the component the files are created in
+    requires := path.Base(filePath)
+    if len(*flagComponent) > 0 {
+        requires = *flagComponent + "/" + requires
+    }
+
+    // the next second, so it sorts after the first migration
+    sqlForward, sqlBackward = template.followUp(description, requires)
+    filePath = createMigrationFileAt(folderPath, description+template.followUpSuffix, sqlForward, sqlBackward, timestamp.Add(time.Second))
+    fmt.Println("created", filePath)
+}
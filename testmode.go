@@ -0,0 +1,46 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+
+    "github.com/jackc/pgx/v4"
+)
+
+var flagRollbackAtEnd = commandLineFlags.Bool("rollback-at-end", false, "for 'up': apply all pending migrations in one transaction and roll it back at the end")
+
+// start transaction which all migrations run in (as savepoints), exits if a migration cannot run in a transaction
+func beginRollbackAtEnd(pendingMigrations []string) pgx.Tx {
+    for _, fileName := range pendingMigrations {
+        annotationsForward, _ := readMigrationAnnotationsFromFile(fileName)
+        if hasAnnotation(annotationsForward, CONST_ANNOTATION_NO_TRANSACTION) {
+            logError("Error: Migration %s cannot run inside a transaction, so it cannot be tested with --rollback-at-end", fileName)
+            os.Exit(1)
+        }
+    }
+
+    tx, err := postgreSQLConnection.Begin(context.Background())
+    if err != nil {
+        logError("Error: Failed to start transaction for --rollback-at-end")
+        panic(err)
+    }
+
+    // everything from now on runs within this transaction
+    postgreSQLConnection = tx
+
+    fmt.Println("Running in test mode: all changes will be rolled back at the end.")
+
+    return tx
+}
+
+// roll back everything done since beginRollbackAtEnd
+func finishRollbackAtEnd(tx pgx.Tx, migrationCount int) {
+    err := tx.Rollback(context.Background())
+    if err != nil {
+        logError("Error: Failed to roll back transaction of --rollback-at-end")
+        panic(err)
+    }
+
+    fmt.Printf("All %d migrations executed cleanly and have been rolled back, nothing was persisted.\n", migrationCount)
+}
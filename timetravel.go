@@ -0,0 +1,171 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "text/tabwriter"
+    "time"
+)
+
+const (
+    // archived rows of 'prune-history', whole tracking rows as jsonb
+    CONST_POSTGRESQL_SELECT_ARCHIVED_MIGRATIONS = `
+        SELECT filename, (migration->>'created_at')::timestamptz, (migration->>'duration_ms')::bigint, migration->>'skipped_by'
+        FROM %s ORDER BY position ASC`
+)
+
+var flagDump = commandLineFlags.Bool("dump", false, "for 'at': print the up parts of the migrations applied at that time, which recreate its schema")
+
+// accepted formats of the time for 'at', without time zone in local time like 'history' shows it
+var pointInTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parse time for 'at' in the first accepted format it is in, false if none
+func tryParsePointInTime(value string) (time.Time, bool) {
+    for _, layout := range pointInTimeLayouts {
+        if pointInTime, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+            return pointInTime, true
+        }
+    }
+
+    return time.Time{}, false
+}
+
+// parse time for 'at', exits if it is not in one of the accepted formats
+func parsePointInTime(value string) time.Time {
+    if pointInTime, ok := tryParsePointInTime(value); ok {
+        return pointInTime
+    }
+
+    logError("Error: Could not parse time %s", value)
+    logError("Hint: Use e.g. 2024-06-01T00:00, 2024-06-01 12:30:00 or 2024-06-01T00:00:00Z")
+    os.Exit(1)
+    return time.Time{}
+}
+
+// migrations archived by 'prune-history', none if it never ran
+func getArchivedMigrations() []reportMigration {
+    var exists bool
+    err := postgreSQLConnection.QueryRow(context.Background(), "SELECT to_regclass($1) IS NOT NULL", getHistoryTableName()).Scan(&exists)
+    if err != nil {
+        logError("Error: Could not check for table %s", getHistoryTableName())
+        panic(err)
+    }
+    if !exists {
+        return nil
+    }
+
+    rows, err := postgreSQLConnection.Query(context.Background(), fmt.Sprintf(CONST_POSTGRESQL_SELECT_ARCHIVED_MIGRATIONS, getHistoryTableName()))
+    if err != nil {
+        logError("Error: Could not read migrations from database table %s", getHistoryTableName())
+        panic(err)
+    }
+    defer rows.Close()
+
+    var migrations []reportMigration
+    for rows.Next() {
+        var migration reportMigration
+        var createdAt time.Time
+        err := rows.Scan(&migration.FileName, &createdAt, &migration.DurationMs, &migration.SkippedBy)
+        if err != nil {
+            logError("Error: Could not read migrations from database table %s: unable to scan row", getHistoryTableName())
+            panic(err)
+        }
+
+        migration.Owner = getMigrationOwner(migration.FileName)
+        migration.AppliedAt = &createdAt
+        migrations = append(migrations, migration)
+    }
+
+    if err := rows.Err(); err != nil {
+        logError("Error: Could not read migrations from database table %s: row error", getHistoryTableName())
+        panic(err)
+    }
+
+    return migrations
+}
+
+// migrations applied at this time, archived ones first;
+// migrations reverted with 'down' leave no trace, so they are missing even if they were applied back then
+func getMigrationsAppliedAt(pointInTime time.Time) []reportMigration {
+    var migrations []reportMigration
+    for _, migration := range getArchivedMigrations() {
+        if !migration.AppliedAt.After(pointInTime) {
+            migrations = append(migrations, migration)
+        }
+    }
+
+    for _, migration := range getAppliedMigrations() {
+        if !migration.AppliedAt.After(pointInTime) {
+            migrations = append(migrations, newAppliedReportMigration(migration))
+        }
+    }
+
+    return migrations
+}
+
+// print up parts of migrations in the order they were applied, as sql which recreates the schema of that time
+func printSchemaOfMigrations(migrations []reportMigration) {
+    for _, migration := range migrations {
+        if migration.SkippedBy != nil {
+            fmt.Printf("-- %s: skipped by %s, not run\n\n", migration.FileName, *migration.SkippedBy)
+            continue
+        }
+
+        if !migrationFileExists(migration.FileName) {
+            logError("Warning: Migration %s is not in folder %s, its statements are missing from the output",
+                migration.FileName, migrationsFolder)
+            fmt.Printf("-- %s: missing in %s\n\n", migration.FileName, migrationsFolder)
+            continue
+        }
+
+        sqlMigrationForward, _ := readMigrationFromFile(migration.FileName)
+        fmt.Printf("-- %s\n%s\n\n", migration.FileName, sqlMigrationForward)
+    }
+}
+
+// show which migrations were applied at a point in time, e.g. for incident forensics
+func cmd_at(value string) {
+    format := getReportFormat(CONST_REPORT_FORMAT_TEXT, CONST_REPORT_FORMAT_JSON, CONST_REPORT_FORMAT_CSV, CONST_REPORT_FORMAT_TSV)
+    pointInTime := parsePointInTime(value)
+
+    migrations := getMigrationsAppliedAt(pointInTime)
+
+    if *flagDump {
+        printSchemaOfMigrations(migrations)
+        os.Exit(0)
+    }
+
+    switch format {
+    case CONST_REPORT_FORMAT_JSON:
+        if migrations == nil {
+            migrations = []reportMigration{}
+        }
+        printJSON(migrations)
+        os.Exit(0)
+    case CONST_REPORT_FORMAT_CSV, CONST_REPORT_FORMAT_TSV:
+        var records [][]string
+        for _, migration := range migrations {
+            records = append(records, migration.tableRecord(migration.appliedState()))
+        }
+        printReportTable(format, records)
+        os.Exit(0)
+    }
+
+    if len(migrations) == 0 {
+        fmt.Printf("No migrations applied at %s\n", pointInTime.Format("2006-01-02 15:04:05 -0700"))
+        os.Exit(0)
+    }
+
+    fmt.Printf("%d migrations applied at %s, most recent is %s\n",
+        len(migrations), pointInTime.Format("2006-01-02 15:04:05 -0700"), migrations[len(migrations)-1])
+
+    writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(writer, "APPLIED AT\tOWNER\tFILE")
+    for _, migration := range migrations {
+        fmt.Fprintf(writer, "%s\t%s\t%s\n", migration.AppliedAt.Local().Format("2006-01-02 15:04:05"), migration.Owner, migration.FileName)
+    }
+    writer.Flush()
+
+    os.Exit(0)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+func TestTryParsePointInTime(t *testing.T) {
+    tests := []struct {
+        value    string
+        expected time.Time
+        ok       bool
+    }{
+        {"2024-06-01T12:30:45Z", time.Date(2024, 6, 1, 12, 30, 45, 0, time.UTC), true},
+        {"2024-06-01T12:30:45+02:00", time.Date(2024, 6, 1, 10, 30, 45, 0, time.UTC), true},
+        {"2024-06-01T12:30:45", time.Date(2024, 6, 1, 12, 30, 45, 0, time.Local), true},
+        {"2024-06-01T12:30", time.Date(2024, 6, 1, 12, 30, 0, 0, time.Local), true},
+        {"2024-06-01 12:30:45", time.Date(2024, 6, 1, 12, 30, 45, 0, time.Local), true},
+        {"2024-06-01 12:30", time.Date(2024, 6, 1, 12, 30, 0, 0, time.Local), true},
+        {"2024-06-01", time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local), true},
+        {"", time.Time{}, false},
+        {" 2024-06-01", time.Time{}, false},
+        {"2024-06-01  12:30", time.Date(2024, 6, 1, 12, 30, 0, 0, time.Local), true},
+        {"2024-13-01", time.Time{}, false},
+        {"01.06.2024", time.Time{}, false},
+        {"yesterday", time.Time{}, false},
+    }
+
+    for _, test := range tests {
+        t.Run(test.value, func(t *testing.T) {
+            pointInTime, ok := tryParsePointInTime(test.value)
+            if ok != test.ok || !pointInTime.Equal(test.expected) {
+                t.Errorf("tryParsePointInTime(%q) = %v, %v, want %v, %v", test.value, pointInTime, ok, test.expected, test.ok)
+            }
+        })
+    }
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+const (
+    // e.g. "-- migrate:requires-tool v1.8.0" for a migration using an annotation introduced in v1.8.0
+    CONST_ANNOTATION_REQUIRES_TOOL = "requires-tool"
+)
+
+// every annotation this version understands, older versions reject annotations they do not know
+// instead of reading them as plain comments
+var knownAnnotations = map[string]bool{
+    CONST_ANNOTATION_NO_TRANSACTION: true,
+    CONST_ANNOTATION_NOOP:           true,
+    CONST_ANNOTATION_REQUIRES_PG:    true,
+    CONST_ANNOTATION_REQUIRES_TOOL:  true,
+
+    CONST_ANNOTATION_ALLOW_TABLE_REWRITE: true,
+    CONST_ANNOTATION_SET:                 true,
+}
+
+// release version like v1.8.0, 1.8 or v2
+var regexpToolVersion = regexp.MustCompile(`^v?([0-9]+)(?:\.([0-9]+))?(?:\.([0-9]+))?$`)
+
+// parse release version into major, minor and patch
+func parseToolVersion(toolVersion string) ([3]int, bool) {
+    var parsed [3]int
+
+    match := regexpToolVersion.FindStringSubmatch(strings.TrimSpace(toolVersion))
+    if match == nil {
+        return parsed, false
+    }
+
+    for index := range parsed {
+        parsed[index], _ = strconv.Atoi(match[index+1])
+    }
+
+    return parsed, true
+}
+
+// check if this version is at least the required one, development builds satisfy every requirement
+func isToolVersionSufficient(requiredVersion string) (bool, error) {
+    required, ok := parseToolVersion(requiredVersion)
+    if !ok {
+        return false, fmt.Errorf("invalid tool version requirement '%s', use e.g. 'v1.8.0'", requiredVersion)
+    }
+
+    current, ok := parseToolVersion(getVersion())
+    if !ok {
+        return true, nil
+    }
+
+    for index := range required {
+        if current[index] != required[index] {
+            return current[index] > required[index], nil
+        }
+    }
+
+    return true, nil
+}
+
+// check that this version understands all annotations of up or down part
+func checkToolRequirements(migrationPart string, name string) error {
+    annotations := parseAnnotations(migrationPart)
+
+    if requiredVersion, ok := annotations[CONST_ANNOTATION_REQUIRES_TOOL]; ok {
+        sufficient, err := isToolVersionSufficient(requiredVersion)
+        if err != nil {
+            return err
+        }
+        if !sufficient {
+            return fmt.Errorf("%s migration requires %s %s, but this is %s, please upgrade",
+                name, CONST_TOOL_NAME, requiredVersion, getVersion())
+        }
+    }
+
+    for annotation := range annotations {
+        if !knownAnnotations[annotation] {
+            return fmt.Errorf("%s migration uses unknown annotation '-- migrate:%s', it may need a newer version of %s than %s",
+                name, annotation, CONST_TOOL_NAME, getVersion())
+        }
+    }
+
+    return nil
+}
+
+// applied migrations written for a newer version: someone migrated this database with a newer binary,
+// this one may not handle their down migrations
+func warnAboutNewerToolRequirements(migrationsInDatabase []string) {
+    for _, fileName := range migrationsInDatabase {
+        // pruned or renamed files are reported by the consistency checks
+        fileContent, err := readMigrationFile(fileName)
+        if err != nil || !strings.Contains(string(fileContent), "migrate:") {
+            continue
+        }
+
+        for _, migrationPart := range strings.Split(string(fileContent), CONST_TEMPLATE_UNDO_MARKER) {
+            err = checkToolRequirements(migrationPart, "applied")
+            if err != nil {
+                logError("Warning: Migration %s: %s", fileName, err)
+                break
+            }
+        }
+    }
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    // this migration rewrites a table on purpose (e.g. a small table), no warning about column type changes
+    CONST_ANNOTATION_ALLOW_TABLE_REWRITE = "allow-table-rewrite"
+
+    CONST_MIGRATION_TEMPLATE_CHANGE_COLUMN_TYPE = "change-column-type"
+
+    // description of the migration which swaps the columns, e.g. orders-amount-numeric-swap
+    CONST_SWAP_SUFFIX = "-swap"
+)
+
+// column type change in an ALTER TABLE statement
+type columnTypeChange struct {
+    table    string
+    column   string
+    newType  string
+    hasUsing bool
+}
+
+// find column type changes in sql of a migration
+func getColumnTypeChanges(sql string) []columnTypeChange {
+    var changes []columnTypeChange
+    for _, statement := range splitSQLStatements(sql) {
+        alterTable := migrate.ParseStatement(statement).AlterTable()
+        if alterTable == nil {
+            continue
+        }
+
+        for _, action := range alterTable.Actions {
+            if action.Kind == migrate.ActionAlterColumnType {
+                changes = append(changes, columnTypeChange{table: alterTable.Table, column: action.Name, newType: action.Type, hasUsing: action.HasUsing})
+            }
+        }
+    }
+
+    return changes
+}
+
+// type name as format_type() prints it, e.g. "VARCHAR(20)" -> "character varying(20)", "timestamptz(3)" ->
+// "timestamp(3) with time zone"
+func normalizeTypeName(typeName string) string {
+    typeName = strings.ToLower(strings.Join(strings.Fields(typeName), " "))
+
+    // length or precision aside first, it is in the middle of e.g. timestamp(3) with time zone
+    modifiers := ""
+    if start, end := strings.Index(typeName, "("), strings.Index(typeName, ")"); start >= 0 && end > start {
+        modifiers = strings.ReplaceAll(typeName[start:end+1], " ", "")
+        typeName = strings.TrimSpace(strings.TrimSpace(typeName[:start]) + " " + strings.TrimSpace(typeName[end+1:]))
+    }
+
+    for _, alias := range [][2]string{
+        {"varchar", "character varying"},
+        {"char", "character"},
+        {"int8", "bigint"},
+        {"int4", "integer"},
+        {"int", "integer"},
+        {"int2", "smallint"},
+        {"decimal", "numeric"},
+        {"timestamptz", "timestamp with time zone"},
+        {"timestamp", "timestamp without time zone"},
+        {"timetz", "time with time zone"},
+        {"time", "time without time zone"},
+    } {
+        if typeName == alias[0] {
+            typeName = alias[1]
+            break
+        }
+    }
+
+    // format_type() prints the precision of timestamp and time before the time zone
+    for _, timeZone := range []string{" with time zone", " without time zone"} {
+        if strings.HasSuffix(typeName, timeZone) {
+            return strings.TrimSuffix(typeName, timeZone) + modifiers + timeZone
+        }
+    }
+
+    return typeName + modifiers
+}
+
+var regexpTypeModifiers = regexp.MustCompile(`^([a-z ]+?)(?:\(([0-9]+)(?:,\s*([0-9]+))?\))?( with(?:out)? time zone)?$`)
+
+// check if PostgreSQL changes the type without rewriting the table (and its indexes), e.g. varchar(20) -> varchar(50)
+func isColumnTypeChangeWithoutRewrite(oldType string, newType string) bool {
+    oldType = normalizeTypeName(oldType)
+    newType = normalizeTypeName(newType)
+    if oldType == newType {
+        return true
+    }
+
+    oldMatch := regexpTypeModifiers.FindStringSubmatch(oldType)
+    newMatch := regexpTypeModifiers.FindStringSubmatch(newType)
+    if oldMatch == nil || newMatch == nil {
+        return false
+    }
+
+    // more fractional digits of the same timestamp or time type, 6 without precision
+    if (oldMatch[1] == "timestamp" || oldMatch[1] == "time") && oldMatch[1] == newMatch[1] && oldMatch[4] == newMatch[4] {
+        oldPrecision, newPrecision := 6, 6
+        if len(oldMatch[2]) > 0 {
+            oldPrecision, _ = strconv.Atoi(oldMatch[2])
+        }
+        if len(newMatch[2]) > 0 {
+            newPrecision, _ = strconv.Atoi(newMatch[2])
+        }
+        return newPrecision >= oldPrecision
+    }
+
+    // varchar and text are binary compatible, only a shorter length needs a check of all rows
+    if oldMatch[1] == "character varying" || oldMatch[1] == "text" {
+        if newType == "text" || newType == "character varying" {
+            return true
+        }
+        if newMatch[1] == "character varying" && oldMatch[1] == "character varying" && len(oldMatch[2]) > 0 {
+            oldLength, _ := strconv.Atoi(oldMatch[2])
+            newLength, _ := strconv.Atoi(newMatch[2])
+            return newLength >= oldLength
+        }
+        return false
+    }
+
+    // more digits with the same scale, or unconstrained numeric
+    if oldMatch[1] == "numeric" && newMatch[1] == "numeric" {
+        if len(newMatch[2]) == 0 {
+            return true
+        }
+        if len(oldMatch[2]) == 0 {
+            return false
+        }
+        oldPrecision, _ := strconv.Atoi(oldMatch[2])
+        newPrecision, _ := strconv.Atoi(newMatch[2])
+        return newPrecision >= oldPrecision && oldMatch[3] == newMatch[3]
+    }
+
+    return false
+}
+
+// current type of a column, empty if the table or column does not exist (yet)
+func getColumnType(table string, column string) string {
+    var columnType string
+    err := postgreSQLConnection.QueryRow(context.Background(), `
+        SELECT format_type(atttypid, atttypmod) FROM pg_attribute
+        WHERE attrelid = to_regclass($1) AND attname = $2 AND NOT attisdropped`,
+        table, unquoteIdentifier(column)).Scan(&columnType)
+    if err != nil {
+        return ""
+    }
+
+    return columnType
+}
+
+// warn about column type changes which rewrite the table while holding an ACCESS EXCLUSIVE lock,
+// with a connection the current type rules out changes which do not rewrite, returns the number of warnings
+func warnAboutColumnTypeChanges(fileName string, connected bool) int {
+    rawMigrationForward, _ := readMigrationPartsFromFile(fileName)
+    if hasAnnotation(parseAnnotations(rawMigrationForward), CONST_ANNOTATION_ALLOW_TABLE_REWRITE) {
+        return 0
+    }
+
+    sqlMigrationForward, _ := readMigrationFromFile(fileName)
+
+    warningCount := 0
+    for _, change := range getColumnTypeChanges(sqlMigrationForward) {
+        oldType := ""
+        if connected {
+            oldType = getColumnType(change.table, change.column)
+            if len(oldType) > 0 && isColumnTypeChangeWithoutRewrite(oldType, change.newType) {
+                continue
+            }
+        }
+
+        if len(oldType) > 0 {
+            logError("Warning: %s changes %s.%s from %s to %s, which rewrites the table and blocks reads and writes until done",
+                fileName, change.table, change.column, oldType, change.newType)
+        } else {
+            logError("Warning: %s changes the type of %s.%s to %s, which may rewrite the table and block reads and writes until done",
+                fileName, change.table, change.column, change.newType)
+        }
+
+        if !change.hasUsing {
+            logError("Hint: Without USING, only types with an implicit cast can be converted, e.g. ALTER COLUMN %s TYPE %s USING %s::%s",
+                change.column, change.newType, change.column, change.newType)
+        }
+        logError("Hint: On large tables use 'create --template %s %s-%s': new column, batched backfill, swap under a short lock",
+            CONST_MIGRATION_TEMPLATE_CHANGE_COLUMN_TYPE, unquoteIdentifier(change.table), unquoteIdentifier(change.column))
+        logError("Hint: Add '-- migrate:%s' to the up part if the rewrite is fine, e.g. for a small table",
+            CONST_ANNOTATION_ALLOW_TABLE_REWRITE)
+        warningCount++
+    }
+
+    return warningCount
+}
+
+// expand: new column kept in sync by a trigger, so the old code keeps working while the backfill runs
+func getChangeColumnTypeTemplate(description string) (string, string) {
+    name := getIdentifierFromDescription(description)
+
+    sqlForward := fmt.Sprintf(`-- TODO: table, column and new type (also in the backfill file and the swap migration)
+-- changing the type in place rewrites the table under an ACCESS EXCLUSIVE lock, instead:
+-- 1. this migration adds the new column, a trigger copies writes of the old code
+-- 2. 'backfill' converts existing rows in batches
+-- 3. the swap migration renames the columns after the deployment, with a short lock only
+ALTER TABLE table_name ADD COLUMN IF NOT EXISTS column_name_new new_type;
+
+CREATE OR REPLACE FUNCTION %[1]s_sync() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+    NEW.column_name_new := NEW.column_name::new_type;
+    RETURN NEW;
+END $$;
+
+DROP TRIGGER IF EXISTS %[1]s_sync ON table_name;
+CREATE TRIGGER %[1]s_sync BEFORE INSERT OR UPDATE ON table_name
+    FOR EACH ROW EXECUTE PROCEDURE %[1]s_sync();`, name)
+
+    sqlBackward := fmt.Sprintf(`DROP TRIGGER IF EXISTS %[1]s_sync ON table_name;
+DROP FUNCTION IF EXISTS %[1]s_sync();
+ALTER TABLE table_name DROP COLUMN IF EXISTS column_name_new;`, name)
+
+    return sqlForward, sqlBackward
+}
+
+// batches for 'backfill', each UPDATE fires the sync trigger which does the conversion
+func getChangeColumnTypeBackfill(description string) string {
+    return CONST_BACKFILL_MARKER_COUNT + `
+SELECT count(*) FROM table_name WHERE column_name IS NOT NULL AND column_name_new IS NULL;
+
+` + CONST_BACKFILL_MARKER_BATCH + `
+UPDATE table_name SET column_name_new = column_name::new_type
+WHERE id IN (SELECT id FROM table_name WHERE column_name IS NOT NULL AND column_name_new IS NULL LIMIT $1);
+`
+}
+
+// contract: runs after the new code ships and the backfill is done
+func getSwapColumnTemplate(description string, requires string) (string, string) {
+    name := getIdentifierFromDescription(description)
+
+    sqlForward := fmt.Sprintf(`-- %[1]s: %[2]s
+-- %[3]s: %[4]s
+-- TODO: same table and columns as in %[4]s, run the backfill before this migration
+-- checked before taking the lock: the trigger keeps new rows in sync
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM table_name WHERE column_name IS NOT NULL AND column_name_new IS NULL) THEN
+        RAISE EXCEPTION 'backfill of table_name.column_name_new is not complete, run it before this migration';
+    END IF;
+END $$;
+
+-- renames only need the ACCESS EXCLUSIVE lock for a moment, do not queue behind long queries
+SET LOCAL lock_timeout = '5s';
+DROP TRIGGER IF EXISTS %[5]s_sync ON table_name;
+DROP FUNCTION IF EXISTS %[5]s_sync();
+ALTER TABLE table_name RENAME COLUMN column_name TO column_name_old;
+ALTER TABLE table_name RENAME COLUMN column_name_new TO column_name;
+ALTER TABLE table_name DROP COLUMN column_name_old;`,
+        CONST_HEADER_PHASE, CONST_PHASE_POST_DEPLOY, CONST_HEADER_REQUIRES, requires, name)
+
+    sqlBackward := `-- TODO: old type, converting back rewrites the table
+ALTER TABLE table_name ALTER COLUMN column_name TYPE old_type USING column_name::old_type;`
+
+    return sqlForward, sqlBackward
+}
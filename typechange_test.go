@@ -0,0 +1,69 @@
+package main
+
+import (
+    "testing"
+)
+
+func TestNormalizeTypeName(t *testing.T) {
+    tests := []struct {
+        typeName string
+        expected string
+    }{
+        {"VARCHAR(20)", "character varying(20)"},
+        {"varchar (20)", "character varying(20)"},
+        {"character varying(20)", "character varying(20)"},
+        {"int", "integer"},
+        {"numeric(10, 2)", "numeric(10,2)"},
+        {"timestamp", "timestamp without time zone"},
+        {"timestamp(3)", "timestamp(3) without time zone"},
+        {"timestamptz", "timestamp with time zone"},
+        {"timestamptz(3)", "timestamp(3) with time zone"},
+        {"timestamp(3) with time zone", "timestamp(3) with time zone"},
+        {"TIMESTAMP (3) WITH TIME ZONE", "timestamp(3) with time zone"},
+        {"timestamp with time zone", "timestamp with time zone"},
+        {"time(0)", "time(0) without time zone"},
+        {"timetz", "time with time zone"},
+        {"text", "text"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.typeName, func(t *testing.T) {
+            if normalized := normalizeTypeName(test.typeName); normalized != test.expected {
+                t.Errorf("normalizeTypeName(%q) = %q, want %q", test.typeName, normalized, test.expected)
+            }
+        })
+    }
+}
+
+func TestIsColumnTypeChangeWithoutRewrite(t *testing.T) {
+    tests := []struct {
+        oldType  string
+        newType  string
+        expected bool
+    }{
+        {"character varying(20)", "varchar(50)", true},
+        {"character varying(50)", "varchar(20)", false},
+        {"character varying(20)", "text", true},
+        {"text", "varchar(20)", false},
+        {"integer", "bigint", false},
+        {"numeric(10,2)", "numeric(12, 2)", true},
+        {"numeric(10,2)", "numeric(12,3)", false},
+        {"numeric(10,2)", "numeric", true},
+        {"timestamp(3) with time zone", "timestamptz(3)", true},
+        {"timestamp(3) with time zone", "timestamp(6) with time zone", true},
+        {"timestamp(3) with time zone", "timestamptz", true},
+        {"timestamp with time zone", "timestamptz(3)", false},
+        {"timestamp(3) without time zone", "timestamptz(3)", false},
+        {"timestamp without time zone", "timestamp(6)", true},
+        {"time(0) without time zone", "time(3)", true},
+        {"time(3) without time zone", "timestamp(3)", false},
+    }
+
+    for _, test := range tests {
+        t.Run(test.oldType+" to "+test.newType, func(t *testing.T) {
+            if result := isColumnTypeChangeWithoutRewrite(test.oldType, test.newType); result != test.expected {
+                t.Errorf("isColumnTypeChangeWithoutRewrite(%q, %q) = %v, want %v", test.oldType, test.newType, result, test.expected)
+            }
+        })
+    }
+}
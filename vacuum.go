@@ -0,0 +1,82 @@
+package main
+
+import (
+    "context"
+    "fmt"
+
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    // rows changed by the current transaction, per table (not visible to others before commit)
+    CONST_POSTGRESQL_TRANSACTION_DML = `
+    SELECT format('%I.%I', schemaname, relname), n_tup_upd, n_tup_del
+    FROM pg_stat_xact_user_tables
+    WHERE n_tup_upd + n_tup_del >= $1
+    ORDER BY n_tup_upd + n_tup_del DESC`
+)
+
+var flagVacuumAdviceRows = commandLineFlags.Int64("vacuum-advice-rows", 100000, "recommend VACUUM for tables where a migration updated or deleted at least this many rows (0 disables)")
+var flagVacuum = commandLineFlags.Bool("vacuum", false, "run the recommended VACUUM (ANALYZE) after each migration instead of printing it")
+
+// rows a migration updated and deleted in one table, dead tuples until vacuumed
+type tableDML struct {
+    table   string
+    updated int64
+    deleted int64
+}
+
+// get tables with many updated or deleted rows within migration transaction, before commit
+// (only on connections opened by this tool, test fixtures and --rollback-at-end run inside an outer transaction)
+func getLargeDMLTables(tx pgx.Tx) []tableDML {
+    if _, ok := postgreSQLConnection.(*pgx.Conn); !ok || *flagVacuumAdviceRows <= 0 {
+        return nil
+    }
+
+    rows, err := tx.Query(context.Background(), CONST_POSTGRESQL_TRANSACTION_DML, *flagVacuumAdviceRows)
+    if err != nil {
+        logError("Error: could not read row counts from pg_stat_xact_user_tables")
+        panic(err)
+    }
+    defer rows.Close()
+
+    var tables []tableDML
+    for rows.Next() {
+        var table tableDML
+        err = rows.Scan(&table.table, &table.updated, &table.deleted)
+        if err != nil {
+            logError("Error: could not read row counts from pg_stat_xact_user_tables: unable to scan row")
+            panic(err)
+        }
+
+        tables = append(tables, table)
+    }
+
+    err = rows.Err()
+    if err != nil {
+        logError("Error: could not read row counts from pg_stat_xact_user_tables: row error")
+        panic(err)
+    }
+
+    return tables
+}
+
+// recommend (or with --vacuum run) VACUUM for tables a committed migration left with many dead rows
+func adviseVacuum(fileName string, tables []tableDML) {
+    for _, table := range tables {
+        fmt.Printf("  %s updated %d and deleted %d rows in %s\n", fileName, table.updated, table.deleted, table.table)
+
+        if !*flagVacuum {
+            fmt.Printf("  Hint: avoid bloat with: VACUUM (ANALYZE) %s;\n", table.table)
+            continue
+        }
+
+        _, err := postgreSQLConnection.Exec(context.Background(), "VACUUM (ANALYZE) "+table.table)
+        if err != nil {
+            logError("Warning: VACUUM (ANALYZE) %s failed: %s", table.table, err)
+            continue
+        }
+
+        fmt.Printf("  vacuumed: %s\n", table.table)
+    }
+}
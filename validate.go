@@ -0,0 +1,354 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "io/ioutil"
+    "os"
+    "path"
+    "path/filepath"
+    "runtime"
+    "sort"
+    "strings"
+    "sync"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    CONST_VALIDATION_CACHE_FOLDER = "go-simple-postgresql-migrate"
+
+    // inserted by 'validate --fix' into empty parts of migrations
+    CONST_TODO_MARKER = "-- TODO: write the %s migration, or replace this line with '-- migrate:noop' if it is intentionally empty\n"
+)
+
+var flagFix = commandLineFlags.Bool("fix", false, "for 'validate': insert TODO markers into empty migrations and the template into empty files")
+
+// result of validating a migration file, cached by size & modification time
+type migrationFileInfo struct {
+    Size     int64  `json:"size"`
+    ModTime  int64  `json:"mtime"`
+    Checksum string `json:"sha256"`
+}
+
+// check that content of migration file can be split into non-empty up/down migration
+func checkMigrationFileContent(fileContent string) error {
+    arrParts := strings.Split(fileContent, CONST_TEMPLATE_UNDO_MARKER)
+
+    if len(arrParts) < 2 {
+        return errors.New("could not find the separator between up and down migration")
+    }
+
+    if len(arrParts) > 2 {
+        return fmt.Errorf("found the separator %d times instead of once", len(arrParts)-1)
+    }
+
+    err := checkMigrationPart(arrParts[0], "forward (UP)")
+    if err != nil {
+        return err
+    }
+
+    err = checkMigrationPhase(arrParts[0])
+    if err != nil {
+        return err
+    }
+
+    err = checkMigrationRequirements(arrParts[0])
+    if err != nil {
+        return err
+    }
+
+    // annotations of newer versions must not be mistaken for comments
+    err = checkToolRequirements(arrParts[0], "forward (UP)")
+    if err != nil {
+        return err
+    }
+
+    err = checkToolRequirements(arrParts[1], "backward (DOWN)")
+    if err != nil {
+        return err
+    }
+
+    // resources of single migrations, e.g. "-- migrate:set maintenance_work_mem='2GB'"
+    for index, name := range []string{"forward (UP)", "backward (DOWN)"} {
+        err = checkSetAnnotations(arrParts[index], name)
+        if err != nil {
+            return err
+        }
+    }
+
+    return checkMigrationPart(arrParts[1], "backward (DOWN)")
+}
+
+// check that up or down part is not empty, unless it is marked as intentionally empty
+func checkMigrationPart(migrationPart string, name string) error {
+    isEmpty := len(cleanUpSQLString(migrationPart)) == 0
+    isNoop := hasAnnotation(parseAnnotations(migrationPart), CONST_ANNOTATION_NOOP)
+
+    switch {
+    case isEmpty && isNoop:
+        return nil
+    case isNoop:
+        return fmt.Errorf("%s migration is marked with '-- migrate:noop', but is not empty", name)
+    case isEmpty && strings.Contains(migrationPart, "-- TODO"):
+        return fmt.Errorf("%s migration is empty, except for a TODO marker", name)
+    case isEmpty:
+        return fmt.Errorf("%s migration is empty", name)
+    }
+
+    // the driver cannot send inline data, psql can
+    for _, statement := range splitSQLStatements(migrationPart) {
+        if isCopyFromStdin(statement) {
+            return fmt.Errorf("%s migration contains COPY ... FROM stdin, which only works in psql scripts (up --to-script), use INSERT instead", name)
+        }
+    }
+
+    // version requirements are checked against the server when applying, their syntax already here
+    if requirement, ok := parseAnnotations(migrationPart)[CONST_ANNOTATION_REQUIRES_PG]; ok {
+        _, err := isServerVersionAllowed(requirement, 0)
+        if err != nil {
+            return fmt.Errorf("%s migration: %s", name, err)
+        }
+    }
+
+    return nil
+}
+
+// insert TODO markers into empty parts of a migration file and the template into an empty file, returns if the file was changed
+func fixEmptyMigrationFile(fileName string) bool {
+    filePath := path.Join(migrationsFolder, fileName)
+    fileContentBytes, err := readMigrationFile(fileName)
+    if err != nil {
+        logError("Error: Could not read file %s", filePath)
+        panic(err)
+    }
+
+    fileContent := string(fileContentBytes)
+
+    // zero-byte or whitespace-only file
+    if len(strings.TrimSpace(fileContent)) == 0 {
+        writeStringToFile(filePath, fmt.Sprintf(CONST_TEMPLATE, fileName, "unknown",
+            fmt.Sprintf(CONST_TODO_MARKER, "forward (UP)")+CONST_TEMPLATE_UNDO_MARKER+fmt.Sprintf(CONST_TODO_MARKER, "backward (DOWN)")))
+        return true
+    }
+
+    // files without exactly one separator need a human
+    arrParts := strings.Split(fileContent, CONST_TEMPLATE_UNDO_MARKER)
+    if len(arrParts) != 2 {
+        return false
+    }
+
+    changed := false
+    for index, name := range []string{"forward (UP)", "backward (DOWN)"} {
+        err := checkMigrationPart(arrParts[index], name)
+        if err != nil && len(cleanUpSQLString(arrParts[index])) == 0 && !strings.Contains(arrParts[index], "-- TODO") {
+            arrParts[index] = strings.TrimRight(arrParts[index], "\n") + "\n" + fmt.Sprintf(CONST_TODO_MARKER, name)
+            changed = true
+        }
+    }
+
+    if changed {
+        writeStringToFile(filePath, arrParts[0]+CONST_TEMPLATE_UNDO_MARKER+arrParts[1])
+    }
+
+    return changed
+}
+
+// calculate SHA-256 checksum of file content, the same the migrate package stores in the tracking table
+func getChecksum(fileContent []byte) string {
+    return migrate.Checksum(fileContent)
+}
+
+// read, check and checksum one migration file, unchanged files are taken from cache
+func validateMigrationFile(fileName string, cachedInfo migrationFileInfo) (migrationFileInfo, error) {
+    stat, err := fs.Stat(migrationFileSystem, path.Join(migrationsFolder, fileName))
+    if err != nil {
+        return migrationFileInfo{}, err
+    }
+
+    // embedded files have no modification time, they are validated every time
+    info := migrationFileInfo{Size: stat.Size(), ModTime: stat.ModTime().UnixNano()}
+    if !stat.ModTime().IsZero() && cachedInfo.Size == info.Size && cachedInfo.ModTime == info.ModTime && len(cachedInfo.Checksum) > 0 {
+        return cachedInfo, nil
+    }
+
+    fileContent, err := readMigrationFile(fileName)
+    if err != nil {
+        return migrationFileInfo{}, err
+    }
+
+    err = checkMigrationFileContent(string(fileContent))
+    if err != nil {
+        return migrationFileInfo{}, err
+    }
+
+    info.Checksum = getChecksum(fileContent)
+
+    return info, nil
+}
+
+// path of cache file for validation results of this migrations folder
+func getValidationCacheFilePath() string {
+    cacheFolder, err := os.UserCacheDir()
+    if err != nil {
+        return ""
+    }
+
+    absoluteMigrationsFolder, err := filepath.Abs(migrationsFolder)
+    if err != nil {
+        return ""
+    }
+
+    // per version and set-allowlist, another version may not understand the same annotations
+    return path.Join(cacheFolder, CONST_VALIDATION_CACHE_FOLDER,
+        getChecksum([]byte(absoluteMigrationsFolder+getVersion()+getConfigValue("set-allowlist")))[:16]+".json")
+}
+
+// read validation cache, cache is optional so errors are ignored
+func readValidationCache() map[string]migrationFileInfo {
+    cache := make(map[string]migrationFileInfo)
+
+    cacheFilePath := getValidationCacheFilePath()
+    if len(cacheFilePath) == 0 {
+        return cache
+    }
+
+    cacheContent, err := ioutil.ReadFile(cacheFilePath)
+    if err == nil {
+        _ = json.Unmarshal(cacheContent, &cache)
+    }
+
+    return cache
+}
+
+// write validation cache, cache is optional so errors are ignored
+func writeValidationCache(cache map[string]migrationFileInfo) {
+    cacheFilePath := getValidationCacheFilePath()
+    if len(cacheFilePath) == 0 {
+        return
+    }
+
+    cacheContent, err := json.Marshal(cache)
+    if err != nil {
+        return
+    }
+
+    if os.MkdirAll(path.Dir(cacheFilePath), 0700) == nil {
+        _ = ioutil.WriteFile(cacheFilePath, cacheContent, 0600)
+    }
+}
+
+// validate migration files concurrently, exits with a list of all broken files
+func validateMigrationFiles(fileNames []string) map[string]migrationFileInfo {
+    cache := readValidationCache()
+
+    results := make(map[string]migrationFileInfo)
+    validationErrors := make(map[string]error)
+    var mutex sync.Mutex
+
+    jobs := make(chan string)
+    var workers sync.WaitGroup
+    for i := 0; i < runtime.NumCPU(); i++ {
+        workers.Add(1)
+        go func() {
+            defer workers.Done()
+
+            for fileName := range jobs {
+                mutex.Lock()
+                cachedInfo := cache[fileName]
+                mutex.Unlock()
+
+                info, err := validateMigrationFile(fileName, cachedInfo)
+
+                mutex.Lock()
+                if err != nil {
+                    validationErrors[fileName] = err
+                } else {
+                    results[fileName] = info
+                }
+                mutex.Unlock()
+            }
+        }()
+    }
+
+    for _, fileName := range fileNames {
+        jobs <- fileName
+    }
+    close(jobs)
+    workers.Wait()
+
+    // keep cached results of files which have not been validated this time
+    for fileName, info := range results {
+        cache[fileName] = info
+    }
+    writeValidationCache(cache)
+
+    if len(validationErrors) > 0 {
+        var brokenFileNames []string
+        for fileName := range validationErrors {
+            brokenFileNames = append(brokenFileNames, fileName)
+        }
+        sort.Strings(brokenFileNames)
+
+        for _, fileName := range brokenFileNames {
+            logError("Error: %s in file %s", validationErrors[fileName], path.Join(migrationsFolder, fileName))
+        }
+        logError("Hint: Make sure this string splits up the up/down migration in the file:")
+        logError(CONST_TEMPLATE_UNDO_MARKER)
+        logError("Hint: Mark intentionally empty parts with '-- migrate:noop', 'validate --fix' inserts TODO markers into empty ones")
+        os.Exit(1)
+    }
+
+    return results
+}
+
+// check all migration files without connecting to the database
+func cmd_validate() {
+    migrationsInFileSystem := getMigrationsFromFileSystem()
+
+    if len(migrationsInFileSystem) == 0 {
+        logError("Error: No migration files found in local folder %s", migrationsFolder)
+        os.Exit(1)
+    }
+
+    if *flagFix {
+        for _, fileName := range migrationsInFileSystem {
+            if fixEmptyMigrationFile(fileName) {
+                fmt.Println("inserted TODO marker:", path.Join(migrationsFolder, fileName))
+            }
+        }
+    }
+
+    // re-runs and lenient environments
+    if *flagMakeIdempotent {
+        suggestionCount := 0
+        for _, fileName := range migrationsInFileSystem {
+            if suggestIdempotentStatements(fileName, *flagFix) {
+                suggestionCount++
+            }
+        }
+
+        if suggestionCount > 0 && !*flagFix {
+            logError("Hint: 'validate --make-idempotent --fix' rewrites %d files like this", suggestionCount)
+        }
+    }
+
+    fileInfos := validateMigrationFiles(migrationsInFileSystem)
+
+    // without a connection the current types are unknown, so this also warns about changes which do not rewrite
+    for _, fileName := range migrationsInFileSystem {
+        warnAboutColumnTypeChanges(fileName, false)
+    }
+
+    if *flagVerbose {
+        for _, fileName := range migrationsInFileSystem {
+            fmt.Printf("%s  %s\n", fileInfos[fileName].Checksum, fileName)
+        }
+    }
+
+    fmt.Printf("All %d migration files are valid.\n", len(migrationsInFileSystem))
+
+    os.Exit(0)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+    "encoding/json"
+    "os"
+    "sort"
+    "strings"
+
+    "github.com/bf/go-simple-postgresql-migrate/migrate"
+)
+
+const (
+    // key in config file with template variables by environment, e.g. {"staging": {"ANALYTICS_DB": "analytics_staging"}}
+    CONST_CONFIG_VARIABLES = "variables"
+)
+
+var templateVariables map[string]map[string]string
+
+// read template variables by environment from the config file, empty if there are none
+func getTemplateVariables() map[string]map[string]string {
+    if templateVariables != nil {
+        return templateVariables
+    }
+
+    templateVariables = map[string]map[string]string{}
+    rawValue, ok := readConfigFile()[CONST_CONFIG_VARIABLES]
+    if !ok {
+        return templateVariables
+    }
+
+    err := json.Unmarshal(rawValue, &templateVariables)
+    if err != nil {
+        logError("Error: '%s' in config file %s needs to map environments to variables, e.g. {\"staging\": {\"ANALYTICS_DB\": \"analytics_staging\"}}",
+            CONST_CONFIG_VARIABLES, getConfigFilePath())
+        os.Exit(1)
+    }
+
+    return templateVariables
+}
+
+// get environments which define a template variable
+func getEnvironmentsWithVariable(name string) []string {
+    var environments []string
+    for environment, variables := range getTemplateVariables() {
+        if _, ok := variables[name]; ok {
+            environments = append(environments, environment)
+        }
+    }
+    sort.Strings(environments)
+
+    return environments
+}
+
+// get template variables of the current environment
+func getEnvironmentTemplateVariables() map[string]string {
+    return getTemplateVariables()[getConfigValue("environment")]
+}
+
+// replace ${NAME} with the value of the current environment,
+// names which no environment defines are left alone, names only other environments define fail the migration
+func expandTemplateVariables(sql string, fileName string) string {
+    if len(getTemplateVariables()) == 0 {
+        return sql
+    }
+
+    variables := getEnvironmentTemplateVariables()
+    for _, name := range migrate.VariableNames(sql) {
+        environments := getEnvironmentsWithVariable(name)
+        if _, ok := variables[name]; ok || len(environments) == 0 {
+            continue
+        }
+
+        logError("Error: Migration %s uses ${%s}, which is defined for %s, but not for environment '%s'",
+            fileName, name, strings.Join(environments, ", "), getConfigValue("environment"))
+        logError("Hint: Set the environment with --environment or %s, or define the variable in '%s' of %s",
+            CONST_ENV_VAR_ENVIRONMENT, CONST_CONFIG_VARIABLES, getConfigFilePath())
+        os.Exit(1)
+    }
+
+    return migrate.ExpandVariables(sql, variables)
+}
+
+// get names of template variables of an environment, sorted
+func getTemplateVariableNames(environment string) []string {
+    var names []string
+    for name := range getTemplateVariables()[environment] {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    return names
+}
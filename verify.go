@@ -0,0 +1,102 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+
+    "github.com/jackc/pgx/v4"
+)
+
+const (
+    // who we are connected as and what we are allowed to do
+    CONST_POSTGRESQL_ROLE_INFO_QUERY = `
+    SELECT
+        current_setting('server_version'),
+        current_user::text,
+        session_user::text,
+        current_database()::text,
+        r.rolsuper,
+        r.rolcreaterole,
+        r.rolcreatedb,
+        has_database_privilege(current_database(), 'CREATE'),
+        COALESCE(has_schema_privilege(current_schema(), 'CREATE'), false),
+        COALESCE(current_schema()::text, ''),
+        to_regclass($1) IS NOT NULL
+    FROM pg_roles r
+    WHERE r.rolname = current_user`
+)
+
+// mask password for output
+func maskPassword(password string) string {
+    if len(password) == 0 {
+        return "(empty)"
+    }
+
+    return "********"
+}
+
+// print yes/no
+func formatBool(value bool) string {
+    if value {
+        return "yes"
+    }
+
+    return "no"
+}
+
+// show effective connection settings, connect and report server version and privileges
+func cmd_verify_connection() {
+    connectionString, source := getDatabaseConnectionString()
+
+    connectionConfig, err := pgx.ParseConfig(connectionString)
+    if err != nil {
+        logError("Error: Invalid connection string from %s", source)
+        panic(err)
+    }
+
+    fmt.Println("Connection settings from", source)
+    fmt.Printf("    host:     %s\n", connectionConfig.Host)
+    fmt.Printf("    port:     %d\n", connectionConfig.Port)
+    fmt.Printf("    user:     %s\n", connectionConfig.User)
+    fmt.Printf("    password: %s\n", maskPassword(connectionConfig.Password))
+    fmt.Printf("    database: %s\n", connectionConfig.Database)
+    fmt.Println()
+
+    reserveConnection()
+    connection, err := pgx.ConnectConfig(context.Background(), connectionConfig)
+    if err != nil {
+        logError("Error: Failed to connect: %s", err)
+        os.Exit(1)
+    }
+    defer closePostgreSQLConnection(connection)
+
+    var serverVersion, currentUser, sessionUser, currentDatabase, currentSchema string
+    var isSuperuser, canCreateRole, canCreateDatabase, canCreateInDatabase, canCreateInSchema, trackingTableExists bool
+    err = connection.QueryRow(context.Background(), CONST_POSTGRESQL_ROLE_INFO_QUERY, trackingTableName).Scan(
+        &serverVersion, &currentUser, &sessionUser, &currentDatabase,
+        &isSuperuser, &canCreateRole, &canCreateDatabase,
+        &canCreateInDatabase, &canCreateInSchema, &currentSchema, &trackingTableExists)
+    if err != nil {
+        logError("Error: Connected, but could not read role information")
+        panic(err)
+    }
+
+    fmt.Println("Connected successfully")
+    fmt.Printf("    server version:  %s\n", serverVersion)
+    fmt.Printf("    database:        %s\n", currentDatabase)
+    fmt.Printf("    current role:    %s (session user: %s)\n", currentUser, sessionUser)
+    fmt.Printf("    superuser:       %s\n", formatBool(isSuperuser))
+    fmt.Printf("    create roles:    %s\n", formatBool(canCreateRole))
+    fmt.Printf("    create database: %s\n", formatBool(canCreateDatabase))
+    fmt.Printf("    create schemas:  %s\n", formatBool(canCreateInDatabase))
+    fmt.Printf("    create in %s: %s\n", currentSchema, formatBool(canCreateInSchema))
+
+    if trackingTableExists {
+        fmt.Printf("    tracking table:  %s\n", trackingTableName)
+    } else {
+        fmt.Printf("    tracking table:  missing (run 'init')\n")
+    }
+
+    os.Exit(0)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "os"
+    "runtime"
+    "runtime/debug"
+)
+
+const (
+    CONST_TOOL_NAME = "go-simple-postgresql-migrate"
+)
+
+// set when building a release (e.g. by goreleaser, homebrew or scoop):
+// go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+    version   = "dev"
+    commit    = ""
+    buildDate = ""
+)
+
+var flagVersion = commandLineFlags.Bool("version", false, "show version of this tool and exit")
+
+// version of this tool, falls back to the module version for 'go install ...@v1.2.3'
+func getVersion() string {
+    if version != "dev" {
+        return version
+    }
+
+    buildInfo, ok := debug.ReadBuildInfo()
+    if ok && len(buildInfo.Main.Version) > 0 && buildInfo.Main.Version != "(devel)" {
+        return buildInfo.Main.Version
+    }
+
+    return version
+}
+
+// version, commit, build date, go version and platform in one line
+func getVersionString() string {
+    details := ""
+    if len(commit) > 0 {
+        details += "commit " + commit + ", "
+    }
+    if len(buildDate) > 0 {
+        details += "built " + buildDate + ", "
+    }
+
+    return fmt.Sprintf("%s %s (%s%s, %s/%s)", CONST_TOOL_NAME, getVersion(), details, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// identifies this tool and its version in http requests and server logs, e.g. go-simple-postgresql-migrate/v1.2.3
+func getUserAgent() string {
+    return CONST_TOOL_NAME + "/" + getVersion()
+}
+
+// set user agent on outgoing http requests
+func setUserAgent(request *http.Request) {
+    request.Header.Set("User-Agent", getUserAgent())
+}
+
+// print version
+func cmd_version() {
+    fmt.Println(getVersionString())
+
+    os.Exit(0)
+}